@@ -0,0 +1,161 @@
+package bitcoinng
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"github.com/gcubillos/isis-3007-distributed-ledger/data-structures/blockchain"
+	"github.com/gcubillos/isis-3007-distributed-ledger/data-structures/shared-components"
+	"github.com/perlin-network/noise"
+	"strconv"
+	"time"
+)
+
+// *** Structs ***
+
+// Types of blocks in Bitcoin-NG
+const (
+	// Block with proof of work that elects its Leader until the next key block
+	KeyBlock = "key"
+	// Block signed by the current leader that contains transactions, without proof of work
+	Microblock = "micro"
+)
+
+// Minimum time between a microblock and its parent, so that a leader can't flood the network
+var MicroblockInterval = 10 * time.Millisecond
+
+// What a block in Bitcoin-NG contains
+// Key blocks elect a Leader, identified by the hexadecimal public key of its node, and don't contain
+// transactions. Microblocks are signed by the leader of their epoch, which is the Leader of the last
+// key block before them, and contain the transactions. The Signature is made over the Hash with the
+// key of the leader. Poisons are only present in microblocks, they contain the signed headers of
+// microblocks that prove a previous leader signed two different microblocks with the same parent
+type Block struct {
+	Type         string
+	PrevHash     string
+	Leader       string
+	Transactions []components.Transaction
+	Poisons      []Block
+	Timestamp    time.Time
+	Nonce        int
+	Difficulty   int
+	Hash         string
+	Signature    string
+}
+
+// *** Constructors ***
+
+// Create a key block on top of the given block and do its proof of work. The proof of work is the
+// one of the blockchain package, with the difficulty defined there
+func CreateKeyBlock(pPrevHash, pLeader string) Block {
+	rBlock := Block{
+		Type:       KeyBlock,
+		PrevHash:   pPrevHash,
+		Leader:     pLeader,
+		Timestamp:  time.Now(),
+		Difficulty: blockchain.Difficulty,
+	}
+	// Proof of work, calculating the hash
+	for i := 0; ; i++ {
+		rBlock.Nonce = i
+		if hash := CalculateHash(rBlock); blockchain.IsHashValid(hash, rBlock.Difficulty) {
+			rBlock.Hash = hash
+			break
+		}
+	}
+	return rBlock
+}
+
+// Create a microblock on top of the given block, signed with the key of the node of the leader
+func CreateMicroblock(pPrevHash string, pLeader *noise.Node, pTransactions []components.Transaction, pPoisons []Block) Block {
+	rBlock := Block{
+		Type:         Microblock,
+		PrevHash:     pPrevHash,
+		Leader:       pLeader.ID().ID.String(),
+		Transactions: pTransactions,
+		Poisons:      pPoisons,
+		Timestamp:    time.Now(),
+	}
+	rBlock.Hash = CalculateHash(rBlock)
+	rBlock.Signature = components.Sign(pLeader, rBlock.Hash)
+	return rBlock
+}
+
+// *** Methods ***
+
+// Generate Hash of a block using all of its fields but the signature. The poisons are included through their hashes
+func CalculateHash(pBlock Block) string {
+	record := pBlock.Type + pBlock.PrevHash + pBlock.Leader +
+		strconv.FormatInt(pBlock.Timestamp.UnixNano(), 10) + strconv.Itoa(pBlock.Nonce) + strconv.Itoa(pBlock.Difficulty)
+	for _, v := range pBlock.Transactions {
+		record += v.Origin + v.SenderSignature + v.Destination + strconv.FormatFloat(v.Value, 'f', -1, 64) + strconv.FormatInt(v.Nonce, 10)
+	}
+	for _, v := range pBlock.Poisons {
+		record += v.Hash
+	}
+	h := sha256.New()
+	h.Write([]byte(record))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Whether the block was signed by its leader
+func (pBlock *Block) isSignatureValid() bool {
+	return components.VerifySignature(pBlock.Leader, pBlock.Hash, pBlock.Signature)
+}
+
+// Amount of work a block represents. Microblocks don't have proof of work, so they don't add any
+// weight to their chain and only key blocks decide between forks
+func BlockWork(pBlock Block) int {
+	if pBlock.Type == Microblock {
+		return 0
+	}
+	return blockchain.BlockWork(pBlock.Difficulty)
+}
+
+// Check that the block is valid in relation to its parent
+// Key blocks must have a valid proof of work and can't contain transactions. Microblocks must be
+// signed by the leader of their epoch and respect the interval between microblocks. The parent has
+// to be part of the block tree, though not necessarily the tip of the active chain.
+// The transactions and poisons are verified once the block is connected to the active chain
+func (pNG *BitcoinNG) IsBlockValid(pBlock Block) (bool, error) {
+	parentNode, ok := pNG.Tree.Nodes[pBlock.PrevHash]
+	if !ok {
+		return false, errors.New("previous block is not part of the block tree")
+	}
+	parentBlock := pNG.Blocks[pBlock.PrevHash]
+	switch true {
+	// Previous block didn't fail when connecting it
+	case parentNode.Invalid:
+		return false, errors.New("previous block isn't valid")
+	// Timestamp
+	case !parentBlock.Timestamp.Before(pBlock.Timestamp):
+		return false, errors.New("timestamp is not valid")
+	// Does the corresponding hash match
+	case CalculateHash(pBlock) != pBlock.Hash:
+		return false, errors.New("calculated hash doesn't match")
+	}
+
+	switch pBlock.Type {
+	case KeyBlock:
+		switch true {
+		case !blockchain.IsHashValid(pBlock.Hash, pBlock.Difficulty):
+			return false, errors.New("the proof of work is not valid")
+		case pBlock.Leader == "":
+			return false, errors.New("the key block doesn't elect a leader")
+		case len(pBlock.Transactions) > 0 || len(pBlock.Poisons) > 0:
+			return false, errors.New("a key block can't contain transactions")
+		}
+	case Microblock:
+		switch true {
+		case pBlock.Leader == "" || pBlock.Leader != pNG.Blocks[pNG.EpochOf(pBlock.PrevHash)].Leader:
+			return false, errors.New("the microblock isn't signed by the leader of the epoch")
+		case !pBlock.isSignatureValid():
+			return false, errors.New("the signature of the leader is not valid")
+		case pBlock.Timestamp.Sub(parentBlock.Timestamp) < MicroblockInterval:
+			return false, errors.New("the microblock was created too soon after its parent")
+		}
+	default:
+		return false, errors.New("unknown block type")
+	}
+	return true, nil
+}
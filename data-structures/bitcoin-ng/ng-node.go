@@ -0,0 +1,203 @@
+package bitcoinng
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/gcubillos/isis-3007-distributed-ledger/data-structures/shared-components"
+	"github.com/perlin-network/noise"
+	"github.com/perlin-network/noise/kademlia"
+	"sync"
+	"time"
+)
+
+// Mutual exclusion variable
+var mutex = &sync.Mutex{}
+
+// Time a node waits for a peer to acknowledge a block
+var RequestTimeout = 2 * time.Second
+
+// *** Structs ***
+
+// Declaration of node in the network
+// Contains the underlying data structure as well as the node from the noise library.
+// The node remembers the blocks it has already seen so that each of them is relayed only once,
+// even when it is not added to the structure
+type NodeNG struct {
+	DataStructure BitcoinNG
+	Node          *noise.Node
+	protocol      *kademlia.Protocol
+	seen          map[string]bool
+}
+
+// *** Constructors ***
+
+// Create a node in the network such that it can discover other nodes using the Kademlia
+// protocol. The current state of the structure is passed to the Node and a first peer
+// to connect to the network
+func CreateNode(pCurrentNG BitcoinNG, pNode *noise.Node) *NodeNG {
+	// Create structure. It is copied so that the nodes don't share their state
+	mutex.Lock()
+	thisNode := &NodeNG{
+		DataStructure: pCurrentNG.Copy(),
+		Node:          nil,
+	}
+	mutex.Unlock()
+	thisNode.listen()
+
+	// Ping the provided node in the network
+	_, err := thisNode.Node.Ping(context.TODO(), pNode.Addr())
+	check(err)
+
+	// Discover the other nodes present in the network at the moment
+	thisNode.protocol.Discover()
+
+	return thisNode
+}
+
+// Create the initial node
+// The genesis block is passed to the Node
+// The amount of available currency is passed as well to the node
+// The fork-choice rule is shared by the nodes created afterwards from this node's structure
+func CreateInitialNode(pGenesisBlock Block, pAvailableCurrency float64, pForkChoice components.ForkChoice) *NodeNG {
+	// For simplicity a "main" account will be created that contains the amount of currency available
+	initialState := map[string]float64{"main": pAvailableCurrency}
+	thisNode := &NodeNG{
+		DataStructure: CreateBitcoinNG(pGenesisBlock, initialState, pForkChoice),
+	}
+	thisNode.listen()
+	return thisNode
+}
+
+// *** Methods ***
+
+// Create the network node, bind the Kademlia protocol and the way the requests are handled,
+// and make it listen to the network
+func (pNode *NodeNG) listen() {
+	// Create network node
+	networkNode, err := noise.NewNode()
+	check(err)
+
+	// Assign the Kademlia protocol to the node so it can discover other nodes
+	pNode.protocol = kademlia.New()
+	networkNode.Bind(pNode.protocol.Protocol())
+
+	// Assign the way the node will handle the blocks it receives
+	networkNode.Handle(pNode.handleRequest)
+
+	// Make the node listen to the network
+	check(networkNode.Listen())
+
+	// Assign the network node to the node
+	pNode.Node = networkNode
+	pNode.seen = make(map[string]bool)
+}
+
+// Hexadecimal public key of the node, which identifies it as a leader and receives its rewards
+func (pNode *NodeNG) Key() string {
+	return pNode.Node.ID().ID.String()
+}
+
+// Mine a key block on top of the tip of the active chain, which makes the node the leader of the
+// new epoch, and broadcast it. The proof of work is done without holding the structure
+func (pNode *NodeNG) GenerateKeyBlock() (Block, error) {
+	mutex.Lock()
+	tipHash := pNode.DataStructure.TipHash
+	mutex.Unlock()
+
+	newBlock := CreateKeyBlock(tipHash, pNode.Key())
+	return newBlock, pNode.publish(newBlock)
+}
+
+// Create a microblock with the given transactions on top of the tip of the active chain and
+// broadcast it. Only the leader of the current epoch can do it. The headers proving that a
+// previous leader forked its microblocks are included as poisons
+func (pNode *NodeNG) GenerateMicroblock(pTransactions []components.Transaction) (Block, error) {
+	mutex.Lock()
+	if pNode.DataStructure.CurrentLeader() != pNode.Key() {
+		mutex.Unlock()
+		return Block{}, errors.New("the node isn't the leader of the current epoch")
+	}
+	tipBlock := pNode.DataStructure.Blocks[pNode.DataStructure.TipHash]
+	poisons := pNode.DataStructure.PoisonCandidates()
+	mutex.Unlock()
+
+	// Respect the interval between microblocks
+	if wait := MicroblockInterval - time.Since(tipBlock.Timestamp); wait > 0 {
+		time.Sleep(wait)
+	}
+	newBlock := CreateMicroblock(tipBlock.Hash, pNode.Node, pTransactions, poisons)
+	return newBlock, pNode.publish(newBlock)
+}
+
+// Add a block created by the node to its structure and broadcast it
+func (pNode *NodeNG) publish(pBlock Block) error {
+	mutex.Lock()
+	pNode.seen[pBlock.Hash] = true
+	err := pNode.DataStructure.AddBlock(pBlock)
+	mutex.Unlock()
+	if err != nil {
+		return err
+	}
+	pNode.broadcast(pBlock)
+	return nil
+}
+
+// Send a block to every peer known by the node
+func (pNode *NodeNG) broadcast(pBlock Block) {
+	bytes, err := json.Marshal(pBlock)
+	check(err)
+	for _, v := range pNode.protocol.Table().Peers() {
+		// A peer that left the network or is too busy to answer doesn't stop the block from reaching the others
+		ctx, cancel := context.WithTimeout(context.Background(), RequestTimeout)
+		_, _ = pNode.Node.Request(ctx, v.Address, bytes)
+		cancel()
+	}
+}
+
+// Handle the blocks received. The ones that are new for the node are relayed to its peers
+func (pNode *NodeNG) handleRequest(ctx noise.HandlerContext) error {
+	if !ctx.IsRequest() {
+		return nil
+	}
+	var received Block
+	// The messages used to discover peers are not blocks
+	if err := json.Unmarshal(ctx.Data(), &received); err != nil || received.Hash == "" {
+		return ctx.Send([]byte(""))
+	}
+	if err := ctx.Send([]byte("")); err != nil {
+		return err
+	}
+
+	mutex.Lock()
+	known := pNode.seen[received.Hash]
+	pNode.seen[received.Hash] = true
+	_ = pNode.DataStructure.AddBlock(received)
+	mutex.Unlock()
+	if !known {
+		go pNode.broadcast(received)
+	}
+	return nil
+}
+
+// Whether the node is the leader of the current epoch. Safe to call while the node keeps receiving blocks
+func (pNode *NodeNG) IsLeader() bool {
+	mutex.Lock()
+	defer mutex.Unlock()
+	return pNode.DataStructure.CurrentLeader() == pNode.Key()
+}
+
+// Whether the block is part of the active chain of the node. Safe to call while the node keeps receiving blocks
+func (pNode *NodeNG) IsInActiveChain(pHash string) bool {
+	mutex.Lock()
+	defer mutex.Unlock()
+	return pNode.DataStructure.IsInActiveChain(pHash)
+}
+
+// Balance of an account according to the active chain of the node.
+// Safe to call while the node keeps receiving blocks
+func (pNode *NodeNG) Balance(pAccount string) float64 {
+	mutex.Lock()
+	defer mutex.Unlock()
+	return pNode.DataStructure.State[pAccount]
+}
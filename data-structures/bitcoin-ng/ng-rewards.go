@@ -0,0 +1,143 @@
+package bitcoinng
+
+import (
+	"errors"
+	"github.com/gcubillos/isis-3007-distributed-ledger/data-structures/shared-components"
+)
+
+// *** Structs ***
+
+// Reward given to the leader elected by a key block
+var KeyBlockReward = 1.0
+
+// Fee paid by the origin of every transaction besides its value
+var TransactionFee = 0.01
+
+// Number of key blocks that follow an epoch before its rewards are paid. Until then the leader
+// can still be punished if it forked its microblocks
+var RewardMaturity = 2
+
+// Fraction of the fees of an epoch that goes to its leader. The rest goes to the leader of the
+// next epoch, so that it has an incentive to build on top of the latest microblock
+const LeaderFeeShare = 0.4
+
+// Fraction of the revenue of a punished leader that goes to the leader that reported the fork
+const PoisonRewardShare = 0.05
+
+// *** Methods ***
+
+// Transactions that pay the rewards of the epoch that matures when the given key block is connected.
+// The leader of the epoch receives the key block reward and its share of the fees of the epoch, and
+// the leader of the next epoch the rest of the fees. If the leader of the epoch was punished, its
+// revenue is revoked and only a fraction of it goes to the leader that reported the fork
+func (pNG *BitcoinNG) maturedRewards(pKeyBlock Block) []components.Transaction {
+	rRewards := make([]components.Transaction, 0)
+	// The new key block is not part of the active chain yet
+	keyIndices := append(pNG.keyBlockIndices(), len(pNG.Chain))
+	matured := len(keyIndices) - 1 - RewardMaturity
+	// The genesis epoch has no leader
+	if matured < 1 {
+		return rRewards
+	}
+	epochStart, epochEnd := keyIndices[matured], keyIndices[matured+1]
+	epochBlock := pNG.Blocks[pNG.Chain[epochStart]]
+	nextLeader := pKeyBlock.Leader
+	if epochEnd < len(pNG.Chain) {
+		nextLeader = pNG.Blocks[pNG.Chain[epochEnd]].Leader
+	}
+
+	fees := 0.0
+	for _, v := range pNG.Chain[epochStart+1 : epochEnd] {
+		fees += TransactionFee * float64(len(pNG.Blocks[v].Transactions))
+	}
+	leaderRevenue := KeyBlockReward + LeaderFeeShare*fees
+	if poisoner, ok := pNG.Poisoned[epochBlock.Hash]; ok {
+		rRewards = append(rRewards, components.CreateTransaction("", "", poisoner, PoisonRewardShare*leaderRevenue))
+	} else {
+		rRewards = append(rRewards, components.CreateTransaction("", "", epochBlock.Leader, leaderRevenue))
+	}
+	if fees > 0 {
+		rRewards = append(rRewards, components.CreateTransaction("", "", nextLeader, (1-LeaderFeeShare)*fees))
+	}
+	return rRewards
+}
+
+// Transactions of a microblock followed by the ones that collect their fees
+func (pNG *BitcoinNG) chargeFees(pTransactions []components.Transaction) []components.Transaction {
+	rTransactions := append([]components.Transaction(nil), pTransactions...)
+	for _, v := range pTransactions {
+		rTransactions = append(rTransactions, components.CreateTransaction(v.Origin, v.SenderSignature, "", TransactionFee))
+	}
+	return rTransactions
+}
+
+// Check the poisons of a microblock that extends the tip of the active chain. Each one must contain
+// the header of a microblock that forks the active chain, signed by the same leader as the microblock
+// that follows the same parent in the active chain. The signatures of both headers are checked, so that
+// nobody but the leader can make it look like it forked its microblocks. The epoch can't have been punished already nor
+// have been paid its rewards
+func (pNG *BitcoinNG) verifyPoisons(pBlock Block) error {
+	keyIndices := pNG.keyBlockIndices()
+	poisonedNow := make(map[string]bool)
+	for _, v := range pBlock.Poisons {
+		if v.Type != Microblock || CalculateHash(v) != v.Hash {
+			return errors.New("the poison doesn't contain a valid microblock header")
+		}
+		if !pNG.IsInActiveChain(v.PrevHash) || pNG.IsInActiveChain(v.Hash) {
+			return errors.New("the poisoned microblock doesn't fork the active chain")
+		}
+		// The microblock in the active chain that has the same parent
+		sibling := pNG.Blocks[pNG.Chain[pNG.Tree.Nodes[v.PrevHash].Height+1]]
+		if sibling.Type != Microblock || sibling.Leader != v.Leader {
+			return errors.New("the leader didn't sign two microblocks with the same parent")
+		}
+		if !v.isSignatureValid() || !sibling.isSignatureValid() {
+			return errors.New("the poison doesn't contain two microblocks signed by the leader")
+		}
+		epoch := pNG.EpochOf(v.PrevHash)
+		if _, ok := pNG.Poisoned[epoch]; ok || poisonedNow[epoch] {
+			return errors.New("the leader of the epoch was already punished")
+		}
+		// Position of the epoch among the key blocks of the active chain
+		epochNumber := 0
+		for i, w := range keyIndices {
+			if pNG.Chain[w] == epoch {
+				epochNumber = i
+			}
+		}
+		if epochNumber+RewardMaturity < len(keyIndices) {
+			return errors.New("the rewards of the epoch were already paid")
+		}
+		poisonedNow[epoch] = true
+	}
+	return nil
+}
+
+// Headers of microblocks that prove a leader of an epoch whose rewards haven't been paid yet signed
+// two microblocks with the same parent. The leader of the current epoch includes them as poisons
+func (pNG *BitcoinNG) PoisonCandidates() []Block {
+	rPoisons := make([]Block, 0)
+	keyIndices := pNG.keyBlockIndices()
+	oldestPunishable := 0
+	if len(keyIndices) > RewardMaturity {
+		oldestPunishable = keyIndices[len(keyIndices)-RewardMaturity]
+	}
+	included := make(map[string]bool)
+	for _, v := range pNG.Blocks {
+		if v.Type != Microblock || pNG.Tree.Nodes[v.Hash].Invalid || pNG.IsInActiveChain(v.Hash) || !pNG.IsInActiveChain(v.PrevHash) {
+			continue
+		}
+		position := pNG.Tree.Nodes[v.PrevHash].Height + 1
+		if position >= len(pNG.Chain) || position <= oldestPunishable {
+			continue
+		}
+		sibling := pNG.Blocks[pNG.Chain[position]]
+		epoch := pNG.EpochOf(v.PrevHash)
+		if _, ok := pNG.Poisoned[epoch]; ok || included[epoch] || sibling.Type != Microblock || sibling.Leader != v.Leader {
+			continue
+		}
+		included[epoch] = true
+		rPoisons = append(rPoisons, v)
+	}
+	return rPoisons
+}
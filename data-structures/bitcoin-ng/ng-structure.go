@@ -0,0 +1,326 @@
+package bitcoinng
+
+import (
+	"errors"
+	"github.com/gcubillos/isis-3007-distributed-ledger/data-structures/blockchain"
+	"github.com/gcubillos/isis-3007-distributed-ledger/data-structures/shared-components"
+	"time"
+)
+
+// *** Structs ***
+
+// What the Bitcoin-NG data structure contains
+// Blocks contains every valid key block and microblock received, indexed by hash, and Tree keeps
+// the relations between them. Chain is the active chain, going from the genesis block to the tip
+// chosen by the fork-choice rule, and State is the state at the end of it. Poisoned registers the
+// epochs of the active chain whose leader was punished for forking its microblocks, along with the
+// leader that reported it. Undo keeps, for every block connected to the active chain, what is
+// needed to disconnect it. Since the blocks may arrive in any order, Unchecked keeps the blocks
+// whose parent is still unknown, indexed by the hash they are waiting for
+type BitcoinNG struct {
+	Blocks     map[string]Block
+	Chain      []string
+	State      map[string]float64
+	Tree       components.BlockTree
+	TipHash    string
+	ForkChoice components.ForkChoice
+	Poisoned   map[string]string
+	Undo       map[string]Undo
+	Unchecked  map[string][]Block
+}
+
+// What is needed to disconnect a block from the active chain. Changes is the journal of the
+// changes the block made to the state and Poisoned the epochs it punished
+type Undo struct {
+	Changes  []blockchain.StateChange
+	Poisoned []string
+}
+
+// *** Constructors ***
+
+// Create the genesis block, a key block that doesn't elect any leader
+func CreateGenesisBlock() Block {
+	rBlock := Block{Type: KeyBlock, Timestamp: time.Now()}
+	rBlock.Hash = CalculateHash(rBlock)
+	return rBlock
+}
+
+// Create the structure with only the genesis block. The initial state is the state at the end
+// of the genesis block, and the fork-choice rule decides which branch is followed when there are forks
+func CreateBitcoinNG(pGenesisBlock Block, pInitialState map[string]float64, pForkChoice components.ForkChoice) BitcoinNG {
+	rNG := BitcoinNG{
+		Blocks:     map[string]Block{pGenesisBlock.Hash: pGenesisBlock},
+		Chain:      []string{pGenesisBlock.Hash},
+		State:      make(map[string]float64, len(pInitialState)),
+		Tree:       components.CreateBlockTree(pGenesisBlock.Hash, BlockWork(pGenesisBlock)),
+		TipHash:    pGenesisBlock.Hash,
+		ForkChoice: pForkChoice,
+		Poisoned:   make(map[string]string),
+		Undo:       make(map[string]Undo),
+		Unchecked:  make(map[string][]Block),
+	}
+	for k, v := range pInitialState {
+		rNG.State[k] = v
+	}
+	return rNG
+}
+
+// *** Methods ***
+
+// Create a copy of the structure that doesn't share its state nor its tree with the original one.
+// Needed since several nodes in the same process may start from the same structure
+func (pNG *BitcoinNG) Copy() BitcoinNG {
+	rNG := BitcoinNG{
+		Blocks:     make(map[string]Block, len(pNG.Blocks)),
+		Chain:      append([]string(nil), pNG.Chain...),
+		State:      make(map[string]float64, len(pNG.State)),
+		Tree:       pNG.Tree.Copy(),
+		TipHash:    pNG.TipHash,
+		ForkChoice: pNG.ForkChoice,
+		Poisoned:   make(map[string]string, len(pNG.Poisoned)),
+		Undo:       make(map[string]Undo, len(pNG.Undo)),
+		Unchecked:  make(map[string][]Block, len(pNG.Unchecked)),
+	}
+	for k, v := range pNG.Blocks {
+		rNG.Blocks[k] = v
+	}
+	for k, v := range pNG.State {
+		rNG.State[k] = v
+	}
+	for k, v := range pNG.Poisoned {
+		rNG.Poisoned[k] = v
+	}
+	for k, v := range pNG.Undo {
+		rNG.Undo[k] = Undo{
+			Changes:  append([]blockchain.StateChange(nil), v.Changes...),
+			Poisoned: append([]string(nil), v.Poisoned...),
+		}
+	}
+	for k, v := range pNG.Unchecked {
+		rNG.Unchecked[k] = append([]Block(nil), v...)
+	}
+	return rNG
+}
+
+// Hash of the key block that started the epoch the given block belongs to
+func (pNG *BitcoinNG) EpochOf(pHash string) string {
+	current := pNG.Blocks[pHash]
+	for current.Type != KeyBlock {
+		current = pNG.Blocks[current.PrevHash]
+	}
+	return current.Hash
+}
+
+// Leader of the epoch at the tip of the active chain, the only one allowed to create microblocks on it
+func (pNG *BitcoinNG) CurrentLeader() string {
+	return pNG.Blocks[pNG.EpochOf(pNG.TipHash)].Leader
+}
+
+// Whether the given block is part of the active chain
+func (pNG *BitcoinNG) IsInActiveChain(pHash string) bool {
+	theNode, ok := pNG.Tree.Nodes[pHash]
+	return ok && theNode.Height < len(pNG.Chain) && pNG.Chain[theNode.Height] == pHash
+}
+
+// Positions in the active chain of its key blocks, the genesis block being the first of them
+func (pNG *BitcoinNG) keyBlockIndices() []int {
+	rIndices := make([]int, 0)
+	for i, v := range pNG.Chain {
+		if pNG.Blocks[v].Type == KeyBlock {
+			rIndices = append(rIndices, i)
+		}
+	}
+	return rIndices
+}
+
+// Add a block to the block tree. The fork-choice rule is applied afterwards and, if it chooses a
+// block outside the active chain, the active chain is reorganized towards it.
+// When its parent is still unknown, the block is kept as unchecked and added once the parent arrives
+func (pNG *BitcoinNG) AddBlock(pBlock Block) error {
+	// Block was already received
+	if pNG.Tree.Contains(pBlock.Hash) {
+		return nil
+	}
+	if _, ok := pNG.Blocks[pBlock.PrevHash]; !ok {
+		for _, v := range pNG.Unchecked[pBlock.PrevHash] {
+			if v.Hash == pBlock.Hash {
+				return errors.New("parent block is unknown")
+			}
+		}
+		pNG.Unchecked[pBlock.PrevHash] = append(pNG.Unchecked[pBlock.PrevHash], pBlock)
+		return errors.New("parent block is unknown")
+	}
+	if ok, err := pNG.IsBlockValid(pBlock); !ok {
+		return err
+	}
+	// Include the block in the tree
+	check(pNG.Tree.AddNode(pBlock.Hash, pBlock.PrevHash, BlockWork(pBlock), nil))
+	pNG.Blocks[pBlock.Hash] = pBlock
+	err := pNG.updateTip()
+
+	waiting := pNG.Unchecked[pBlock.Hash]
+	delete(pNG.Unchecked, pBlock.Hash)
+	for _, v := range waiting {
+		_ = pNG.AddBlock(v)
+	}
+	return err
+}
+
+// Apply the fork-choice rule until the chosen tip can be connected. Every time a branch turns out
+// to be invalid, its blocks are excluded and the rule is applied again.
+// The error of the first branch that couldn't be connected is returned
+func (pNG *BitcoinNG) updateTip() error {
+	var firstErr error
+	for {
+		newTip := pNG.ForkChoice.SelectTip(&pNG.Tree, pNG.TipHash)
+		if newTip == pNG.TipHash {
+			return firstErr
+		}
+		if err := pNG.reorganize(newTip); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+}
+
+// Move the active chain to the given tip. The blocks of the current branch are disconnected until
+// reaching the fork block and then the blocks of the new branch are connected. If a block of the
+// new branch turns out to be invalid, it is marked as such and the previous active chain is restored
+func (pNG *BitcoinNG) reorganize(pNewTip string) error {
+	forkHash := pNG.Tree.FindForkBlock(pNG.TipHash, pNewTip)
+
+	// Blocks of the new branch, ordered from the fork block to the new tip
+	newBranch := pNG.Tree.PathFrom(forkHash, pNewTip)
+
+	// Disconnect the blocks of the current branch
+	disconnected := make([]string, 0)
+	for pNG.TipHash != forkHash {
+		disconnected = append(disconnected, pNG.disconnectTip())
+	}
+
+	// Connect the blocks of the new branch
+	for i, v := range newBranch {
+		if err := pNG.connectBlock(pNG.Blocks[v]); err != nil {
+			// Mark the block and its descendants as invalid and go back to the previous branch
+			pNG.Tree.MarkInvalid(v)
+			for j := i - 1; j >= 0; j-- {
+				pNG.disconnectTip()
+			}
+			for j := len(disconnected) - 1; j >= 0; j-- {
+				check(pNG.connectBlock(pNG.Blocks[disconnected[j]]))
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// Connect a block that extends the tip of the active chain. The transactions and poisons of a
+// microblock are applied, while a key block pays the rewards of the epoch that matured with it
+func (pNG *BitcoinNG) connectBlock(pBlock Block) error {
+	if pBlock.PrevHash != pNG.TipHash {
+		return errors.New("block doesn't extend the tip of the active chain")
+	}
+	var transactions []components.Transaction
+	theUndo := Undo{Poisoned: make([]string, 0)}
+	switch pBlock.Type {
+	case KeyBlock:
+		transactions = pNG.maturedRewards(pBlock)
+	case Microblock:
+		if err := pNG.verifyPoisons(pBlock); err != nil {
+			return err
+		}
+		if !pNG.verifyStateTransition(pBlock.Transactions) {
+			return errors.New("the transactions are inconsistent with the state")
+		}
+		transactions = pNG.chargeFees(pBlock.Transactions)
+		for _, v := range pBlock.Poisons {
+			epoch := pNG.EpochOf(v.PrevHash)
+			pNG.Poisoned[epoch] = pBlock.Leader
+			theUndo.Poisoned = append(theUndo.Poisoned, epoch)
+		}
+	}
+	theUndo.Changes = pNG.applyTransactions(transactions)
+	pNG.Undo[pBlock.Hash] = theUndo
+	pNG.Chain = append(pNG.Chain, pBlock.Hash)
+	pNG.TipHash = pBlock.Hash
+	return nil
+}
+
+// Remove the tip of the active chain, rolling the state back with its undo journal, and return its hash
+func (pNG *BitcoinNG) disconnectTip() string {
+	tipHash := pNG.TipHash
+	theUndo := pNG.Undo[tipHash]
+	// Revert the changes in the opposite order they were registered
+	for i := len(theUndo.Changes) - 1; i >= 0; i-- {
+		v := theUndo.Changes[i]
+		if v.Existed {
+			pNG.State[v.Account] = v.PreviousBalance
+		} else {
+			delete(pNG.State, v.Account)
+		}
+	}
+	for _, v := range theUndo.Poisoned {
+		delete(pNG.Poisoned, v)
+	}
+	delete(pNG.Undo, tipHash)
+	pNG.Chain = pNG.Chain[:len(pNG.Chain)-1]
+	pNG.TipHash = pNG.Blocks[tipHash].PrevHash
+	return tipHash
+}
+
+// Checks whether the transactions can be performed in order over the state of the active chain,
+// each of them paying the transaction fee besides its value. The state isn't modified
+func (pNG *BitcoinNG) verifyStateTransition(pTransactions []components.Transaction) bool {
+	// Balances of the accounts that have been modified by the transactions
+	modifiedState := make(map[string]float64, 0)
+	balance := func(pAccount string) float64 {
+		if value, ok := modifiedState[pAccount]; ok {
+			return value
+		}
+		return pNG.State[pAccount]
+	}
+	for _, v := range pTransactions {
+		switch true {
+		// Transaction is well formed
+		case v.Value < 0 || v.Origin == "":
+			return false
+		// The origin can't pay the value and the fee
+		case balance(v.Origin) < v.Value+TransactionFee:
+			return false
+		}
+		// Update state
+		modifiedState[v.Origin] = balance(v.Origin) - v.Value - TransactionFee
+		modifiedState[v.Destination] = balance(v.Destination) + v.Value
+	}
+	return true
+}
+
+// Performs the transactions over the state of the active chain and returns the undo journal
+// needed to revert them. They must have been verified before. Transactions without an origin
+// create currency and transactions without a destination remove it, they are only used to pay
+// the rewards and to collect the fees until they are paid to the leaders
+func (pNG *BitcoinNG) applyTransactions(pTransactions []components.Transaction) []blockchain.StateChange {
+	journal := make([]blockchain.StateChange, 0, 2*len(pTransactions))
+	record := func(pAccount string) {
+		previousBalance, existed := pNG.State[pAccount]
+		journal = append(journal, blockchain.StateChange{Account: pAccount, Existed: existed, PreviousBalance: previousBalance})
+	}
+	for _, v := range pTransactions {
+		if v.Origin != "" {
+			record(v.Origin)
+			pNG.State[v.Origin] -= v.Value
+		}
+		if v.Destination != "" {
+			record(v.Destination)
+			pNG.State[v.Destination] += v.Value
+		}
+	}
+	return journal
+}
+
+// Revises whether the error is not nil
+func check(err error) {
+	if err != nil {
+		panic(err)
+	}
+}
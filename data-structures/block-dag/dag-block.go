@@ -0,0 +1,126 @@
+package blockdag
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"github.com/gcubillos/isis-3007-distributed-ledger/data-structures/shared-components"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// *** Structs ***
+
+// The number of leading zeroes wanted from the hash of the Blocks
+var Difficulty = 1
+
+// What a Block in the DAG contains
+// Instead of a single parent plus some uncles, a Block references every tip its miner knows of, so
+// no Block is left out of the structure. The first of the Parents has no special meaning, the
+// selected parent is chosen by GHOSTDAG. The genesis Block has no parents and its only transaction
+// creates the whole supply
+type Block struct {
+	Parents      []string
+	Transactions []components.Transaction
+	Miner        string
+	Timestamp    time.Time
+	Nonce        int
+	Difficulty   int
+	Hash         string
+}
+
+// *** Constructors ***
+
+// Create a Block that references the given parents and do its proof of work
+func CreateBlock(pParents []string, pTransactions []components.Transaction, pMiner string) Block {
+	rBlock := Block{
+		Parents:      append([]string(nil), pParents...),
+		Transactions: pTransactions,
+		Miner:        pMiner,
+		Timestamp:    time.Now(),
+		Difficulty:   Difficulty,
+	}
+	// The order of the parents doesn't matter, they are sorted so that the hash doesn't depend on it
+	sort.Strings(rBlock.Parents)
+	// Proof of work, calculating the hash
+	for i := 0; ; i++ {
+		rBlock.Nonce = i
+		if hash := CalculateHash(rBlock); IsHashValid(hash, rBlock.Difficulty) {
+			rBlock.Hash = hash
+			break
+		}
+	}
+	return rBlock
+}
+
+// Create the genesis Block, whose transaction gives the whole supply to the given account
+func CreateGenesisBlock(pAccount string, pSupply float64) Block {
+	return CreateBlock(nil, []components.Transaction{components.CreateTransaction("", "", pAccount, pSupply)}, "")
+}
+
+// *** Methods ***
+
+// Generate Hash of a Block using all of its fields
+func CalculateHash(pBlock Block) string {
+	record := strings.Join(pBlock.Parents, "") + pBlock.Miner +
+		strconv.FormatInt(pBlock.Timestamp.UnixNano(), 10) + strconv.Itoa(pBlock.Nonce)
+	for _, v := range pBlock.Transactions {
+		record += v.Origin + v.SenderSignature + v.Destination + strconv.FormatFloat(v.Value, 'f', -1, 64) + strconv.FormatInt(v.Nonce, 10)
+	}
+	h := sha256.New()
+	h.Write([]byte(record))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Checks whether the hash is valid by checking if it starts with the given number of zeroes specified in the difficulty
+func IsHashValid(hash string, difficulty int) bool {
+	prefix := strings.Repeat("0", difficulty)
+	return strings.HasPrefix(hash, prefix)
+}
+
+// Check that the Block is valid
+// The hash and proof of work must be valid and the parents must be part of the DAG, must not repeat
+// and must not be ancestors of each other. The transactions are not checked here, since whether
+// they conflict depends on the order GHOSTDAG gives to the Blocks
+func (pDAG *BlockDAG) IsBlockValid(pBlock Block) (bool, error) {
+	switch true {
+	// Does the corresponding hash match
+	case CalculateHash(pBlock) != pBlock.Hash:
+		return false, errors.New("calculated hash doesn't match")
+	// Checking proof of work
+	case !IsHashValid(pBlock.Hash, pBlock.Difficulty):
+		return false, errors.New("the proof of work is not valid")
+	case len(pBlock.Parents) == 0:
+		return false, errors.New("only the genesis block has no parents")
+	case !sort.StringsAreSorted(pBlock.Parents):
+		return false, errors.New("the parents must be sorted")
+	}
+	for i, v := range pBlock.Parents {
+		parent, ok := pDAG.Blocks[v]
+		switch true {
+		case !ok:
+			return false, errors.New("parent block is unknown")
+		case i > 0 && pBlock.Parents[i-1] == v:
+			return false, errors.New("a parent is repeated")
+		case pBlock.Timestamp.Before(parent.Timestamp):
+			return false, errors.New("the block is older than its parents")
+		}
+	}
+	// A parent that is an ancestor of another one is redundant
+	for _, v := range pBlock.Parents {
+		ancestors := pDAG.Past(pDAG.Blocks[v].Parents...)
+		for _, w := range pBlock.Parents {
+			if ancestors[w] {
+				return false, errors.New("a parent is an ancestor of another parent")
+			}
+		}
+	}
+	for _, v := range pBlock.Transactions {
+		if v.Value < 0 {
+			return false, errors.New("the value of a transaction can't be negative")
+		}
+	}
+	return true, nil
+}
@@ -0,0 +1,200 @@
+package blockdag
+
+import (
+	"sort"
+)
+
+// *** Structs ***
+
+// What GHOSTDAG computes for a Block
+// The selected parent is the parent with the highest blue score, and the merge set are the Blocks
+// in the past of the Block that are not in the past of the selected parent. The merge set is split
+// into blue and red Blocks by the k-cluster colouring, the selected parent being the first blue.
+// BlueScore is the number of blue Blocks in the past of the Block. BluesAnticoneSizes keeps, for the
+// Blues coloured or updated by the Block, the number of blue Blocks in their anticone as seen by it.
+// MergeSetOrder is the order in which the merge set, without the selected parent, is added to the
+// total order before the Block itself
+type GhostData struct {
+	SelectedParent     string
+	BlueScore          int
+	MergeSetBlues      []string
+	MergeSetReds       []string
+	MergeSetOrder      []string
+	BluesAnticoneSizes map[string]int
+}
+
+// *** Methods ***
+
+// Blocks coloured blue according to the virtual Block that references every tip
+func (pDAG *BlockDAG) Blues() map[string]bool {
+	rBlues := map[string]bool{pDAG.Genesis: true}
+	for current := pDAG.ghostdag(pDAG.TipHashes()); current.SelectedParent != ""; current = pDAG.GhostData[current.SelectedParent] {
+		for _, v := range current.MergeSetBlues {
+			rBlues[v] = true
+		}
+	}
+	return rBlues
+}
+
+// Whether the Block is blue according to the virtual Block that references every tip
+func (pDAG *BlockDAG) IsBlue(pHash string) bool {
+	return pDAG.Blues()[pHash]
+}
+
+// Blue score of the virtual Block that references every tip
+func (pDAG *BlockDAG) BlueScore() int {
+	return pDAG.ghostdag(pDAG.TipHashes()).BlueScore
+}
+
+// Apply GHOSTDAG to a Block with the given parents. The Blocks of the merge set are visited in
+// topological order, and each one is coloured blue only if the blue Blocks keep being a k-cluster,
+// that is neither the candidate nor any blue Block in its anticone ends with more than K blue
+// Blocks in its anticone
+func (pDAG *BlockDAG) ghostdag(pParents []string) *GhostData {
+	rData := &GhostData{
+		SelectedParent:     pDAG.selectParent(pParents),
+		MergeSetBlues:      make([]string, 0),
+		MergeSetReds:       make([]string, 0),
+		BluesAnticoneSizes: make(map[string]int),
+	}
+	rData.MergeSetBlues = append(rData.MergeSetBlues, rData.SelectedParent)
+	rData.BluesAnticoneSizes[rData.SelectedParent] = 0
+
+	mergeSet := pDAG.mergeSet(rData.SelectedParent, pParents)
+	for _, candidate := range pDAG.topologicalOrder(mergeSet, nil) {
+		if isBlue, anticoneSizes := pDAG.checkBlueCandidate(rData, candidate); isBlue {
+			rData.MergeSetBlues = append(rData.MergeSetBlues, candidate)
+			rData.BluesAnticoneSizes[candidate] = len(anticoneSizes)
+			for k, v := range anticoneSizes {
+				rData.BluesAnticoneSizes[k] = v + 1
+			}
+		} else {
+			rData.MergeSetReds = append(rData.MergeSetReds, candidate)
+		}
+	}
+	rData.BlueScore = pDAG.GhostData[rData.SelectedParent].BlueScore + len(rData.MergeSetBlues)
+
+	// In the total order the blue Blocks go before the red ones, as long as the topology allows it
+	blues := make(map[string]bool, len(rData.MergeSetBlues))
+	for _, v := range rData.MergeSetBlues {
+		blues[v] = true
+	}
+	rData.MergeSetOrder = pDAG.topologicalOrder(mergeSet, blues)
+	return rData
+}
+
+// Parent with the highest blue score. Ties are broken by the smallest hash
+func (pDAG *BlockDAG) selectParent(pParents []string) string {
+	rSelected := pParents[0]
+	for _, v := range pParents[1:] {
+		score, selectedScore := pDAG.GhostData[v].BlueScore, pDAG.GhostData[rSelected].BlueScore
+		if score > selectedScore || score == selectedScore && v < rSelected {
+			rSelected = v
+		}
+	}
+	return rSelected
+}
+
+// Blocks in the past of the given parents that are neither the selected parent nor in its past
+func (pDAG *BlockDAG) mergeSet(pSelectedParent string, pParents []string) map[string]bool {
+	selectedPast := pDAG.Past(pSelectedParent)
+	rMergeSet := make(map[string]bool)
+	pending := append([]string(nil), pParents...)
+	for len(pending) > 0 {
+		current := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+		if selectedPast[current] || rMergeSet[current] {
+			continue
+		}
+		rMergeSet[current] = true
+		pending = append(pending, pDAG.Blocks[current].Parents...)
+	}
+	return rMergeSet
+}
+
+// Order the given Blocks so that every Block goes after its parents. Among the Blocks that can go
+// next, the preferred ones go first, then the ones with the lowest blue score, then the smallest hash
+func (pDAG *BlockDAG) topologicalOrder(pBlocks map[string]bool, pPreferred map[string]bool) []string {
+	missingParents := make(map[string]int, len(pBlocks))
+	available := make([]string, 0)
+	for k := range pBlocks {
+		for _, v := range pDAG.Blocks[k].Parents {
+			if pBlocks[v] {
+				missingParents[k]++
+			}
+		}
+		if missingParents[k] == 0 {
+			available = append(available, k)
+		}
+	}
+	rOrder := make([]string, 0, len(pBlocks))
+	for len(available) > 0 {
+		sort.Slice(available, func(i, j int) bool {
+			a, b := available[i], available[j]
+			if pPreferred[a] != pPreferred[b] {
+				return pPreferred[a]
+			}
+			if pDAG.GhostData[a].BlueScore != pDAG.GhostData[b].BlueScore {
+				return pDAG.GhostData[a].BlueScore < pDAG.GhostData[b].BlueScore
+			}
+			return a < b
+		})
+		next := available[0]
+		available = available[1:]
+		rOrder = append(rOrder, next)
+		for _, v := range pDAG.Children[next] {
+			if !pBlocks[v] {
+				continue
+			}
+			if missingParents[v]--; missingParents[v] == 0 {
+				available = append(available, v)
+			}
+		}
+	}
+	return rOrder
+}
+
+// Whether the candidate can be coloured blue by the Block whose data is being computed. The blue
+// Blocks in the anticone of the candidate are found by walking down the chain of selected parents,
+// until reaching a chain Block in the past of the candidate, since every Block in its past is in the
+// past of the candidate as well. The blue anticone sizes of the Blues in the anticone are returned
+func (pDAG *BlockDAG) checkBlueCandidate(pData *GhostData, pCandidate string) (bool, map[string]int) {
+	anticoneSizes := make(map[string]int)
+	// At most K + 1 Blocks of a merge set can be blue
+	if len(pData.MergeSetBlues) == pDAG.K+1 {
+		return false, anticoneSizes
+	}
+	candidatePast := pDAG.Past(pCandidate)
+	current := pData
+	for {
+		for _, v := range current.MergeSetBlues {
+			if candidatePast[v] {
+				continue
+			}
+			// The blue Block is in the anticone of the candidate
+			anticoneSizes[v] = pDAG.blueAnticoneSize(pData, v)
+			if len(anticoneSizes) > pDAG.K || anticoneSizes[v] == pDAG.K {
+				return false, anticoneSizes
+			}
+		}
+		if current.SelectedParent == "" || candidatePast[current.SelectedParent] {
+			break
+		}
+		current = pDAG.GhostData[current.SelectedParent]
+	}
+	return true, anticoneSizes
+}
+
+// Number of blue Blocks in the anticone of a blue Block, as seen by the Block whose data is given.
+// It is the size recorded by the most recent Block of its chain of selected parents that coloured
+// or updated the blue Block
+func (pDAG *BlockDAG) blueAnticoneSize(pData *GhostData, pBlue string) int {
+	for current := pData; ; current = pDAG.GhostData[current.SelectedParent] {
+		if size, ok := current.BluesAnticoneSizes[pBlue]; ok {
+			return size
+		}
+		if current.SelectedParent == "" {
+			return 0
+		}
+	}
+}
@@ -0,0 +1,178 @@
+package blockdag
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/gcubillos/isis-3007-distributed-ledger/data-structures/shared-components"
+	"github.com/perlin-network/noise"
+	"github.com/perlin-network/noise/kademlia"
+	"sync"
+	"time"
+)
+
+// Mutual exclusion variable
+var mutex = &sync.Mutex{}
+
+// Time a node waits for a peer to acknowledge a Block
+var RequestTimeout = 2 * time.Second
+
+// *** Structs ***
+
+// Declaration of node in the network
+// Contains the underlying data structure as well as the node from the noise library.
+// The node remembers the Blocks it has already seen so that each of them is relayed only once,
+// even when it is not added to the DAG
+type NodeDAG struct {
+	DataStructure BlockDAG
+	Node          *noise.Node
+	protocol      *kademlia.Protocol
+	seen          map[string]bool
+}
+
+// *** Constructors ***
+
+// Create a node in the network such that it can discover other nodes using the Kademlia
+// protocol. The current state of the DAG is passed to the Node and a first peer
+// to connect to the network
+func CreateNode(pCurrentDAG BlockDAG, pNode *noise.Node) *NodeDAG {
+	// Create structure. The DAG is copied so that the nodes don't share their state
+	mutex.Lock()
+	thisNode := &NodeDAG{
+		DataStructure: pCurrentDAG.Copy(),
+		Node:          nil,
+	}
+	mutex.Unlock()
+	thisNode.listen()
+
+	// Ping the provided node in the network
+	_, err := thisNode.Node.Ping(context.TODO(), pNode.Addr())
+	check(err)
+
+	// Discover the other nodes present in the network at the moment
+	thisNode.protocol.Discover()
+
+	return thisNode
+}
+
+// Create the initial node
+// For simplicity the genesis Block gives the amount of available currency to a "main" account
+func CreateInitialNode(pAvailableCurrency float64, pK int) *NodeDAG {
+	thisNode := &NodeDAG{
+		DataStructure: CreateBlockDAG(CreateGenesisBlock("main", pAvailableCurrency), pK),
+	}
+	thisNode.listen()
+	return thisNode
+}
+
+// *** Methods ***
+
+// Create the network node, bind the Kademlia protocol and the way the requests are handled,
+// and make it listen to the network
+func (pNode *NodeDAG) listen() {
+	// Create network node
+	networkNode, err := noise.NewNode()
+	check(err)
+
+	// Assign the Kademlia protocol to the node so it can discover other nodes
+	pNode.protocol = kademlia.New()
+	networkNode.Bind(pNode.protocol.Protocol())
+
+	// Assign the way the node will handle the Blocks it receives
+	networkNode.Handle(pNode.handleRequest)
+
+	// Make the node listen to the network
+	check(networkNode.Listen())
+
+	// Assign the network node to the node
+	pNode.Node = networkNode
+	pNode.seen = make(map[string]bool)
+}
+
+// Generate a Block with the given transactions that references every tip known by the node.
+// The proof of work is done without holding the structure, so the tips may change in the meantime,
+// in which case the Block simply doesn't reference the newest ones
+func (pNode *NodeDAG) GenerateBlock(pTransactions []components.Transaction) (Block, error) {
+	mutex.Lock()
+	parents := pNode.DataStructure.TipHashes()
+	mutex.Unlock()
+
+	newBlock := CreateBlock(parents, pTransactions, pNode.Node.Addr())
+
+	mutex.Lock()
+	pNode.seen[newBlock.Hash] = true
+	_, err := pNode.DataStructure.AddBlock(newBlock)
+	mutex.Unlock()
+	if err != nil {
+		return Block{}, err
+	}
+	pNode.broadcast(newBlock)
+	return newBlock, nil
+}
+
+// Send a Block to every peer known by the node
+func (pNode *NodeDAG) broadcast(pBlock Block) {
+	bytes, err := json.Marshal(pBlock)
+	check(err)
+	for _, v := range pNode.protocol.Table().Peers() {
+		// A peer that left the network or is too busy to answer doesn't stop the Block from reaching the others
+		ctx, cancel := context.WithTimeout(context.Background(), RequestTimeout)
+		_, _ = pNode.Node.Request(ctx, v.Address, bytes)
+		cancel()
+	}
+}
+
+// Handle the Blocks received. The ones that are new for the node are relayed to its peers
+func (pNode *NodeDAG) handleRequest(ctx noise.HandlerContext) error {
+	if !ctx.IsRequest() {
+		return nil
+	}
+	var received Block
+	// The messages used to discover peers are not Blocks
+	if err := json.Unmarshal(ctx.Data(), &received); err != nil || received.Hash == "" {
+		return ctx.Send([]byte(""))
+	}
+	if err := ctx.Send([]byte("")); err != nil {
+		return err
+	}
+
+	mutex.Lock()
+	known := pNode.seen[received.Hash]
+	pNode.seen[received.Hash] = true
+	_, _ = pNode.DataStructure.AddBlock(received)
+	mutex.Unlock()
+	if !known {
+		go pNode.broadcast(received)
+	}
+	return nil
+}
+
+// Number of Blocks in the DAG of the node. Safe to call while the node keeps receiving Blocks
+func (pNode *NodeDAG) NumberBlocks() int {
+	mutex.Lock()
+	defer mutex.Unlock()
+	return len(pNode.DataStructure.Blocks)
+}
+
+// Number of blue and red Blocks in the DAG of the node, according to the virtual Block.
+// Safe to call while the node keeps receiving Blocks
+func (pNode *NodeDAG) Colouring() (int, int) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	blues := len(pNode.DataStructure.Blues())
+	return blues, len(pNode.DataStructure.Blocks) - blues
+}
+
+// Balances of the accounts according to the total order of the node, along with the transactions
+// rejected because of conflicts. Safe to call while the node keeps receiving Blocks
+func (pNode *NodeDAG) State() (map[string]float64, []components.Transaction) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	return pNode.DataStructure.State()
+}
+
+// Revises whether the error is not nil
+func check(err error) {
+	if err != nil {
+		panic(err)
+	}
+}
@@ -0,0 +1,197 @@
+package blockdag
+
+import (
+	"errors"
+	"github.com/gcubillos/isis-3007-distributed-ledger/data-structures/shared-components"
+	"sort"
+)
+
+// *** Structs ***
+
+// Declaration of structure
+// Blocks contains every Block of the DAG indexed by its hash, Children the Blocks that reference
+// each Block and Tips the Blocks that no Block references yet. GhostData keeps what GHOSTDAG
+// computed for each Block when it was added, and K is the parameter of the k-cluster colouring.
+// Since the Blocks may arrive in any order, Unchecked keeps the Blocks whose parents are not all
+// known yet, indexed by the hash they are waiting for
+type BlockDAG struct {
+	Blocks    map[string]Block
+	Children  map[string][]string
+	Tips      map[string]bool
+	GhostData map[string]*GhostData
+	Unchecked map[string][]Block
+	Genesis   string
+	K         int
+}
+
+// *** Constructors ***
+
+// Create the DAG with only the genesis Block, using the given K for the colouring
+func CreateBlockDAG(pGenesisBlock Block, pK int) BlockDAG {
+	rDAG := BlockDAG{
+		Blocks:    make(map[string]Block),
+		Children:  make(map[string][]string),
+		Tips:      make(map[string]bool),
+		GhostData: make(map[string]*GhostData),
+		Unchecked: make(map[string][]Block),
+		Genesis:   pGenesisBlock.Hash,
+		K:         pK,
+	}
+	rDAG.Blocks[pGenesisBlock.Hash] = pGenesisBlock
+	rDAG.Tips[pGenesisBlock.Hash] = true
+	rDAG.GhostData[pGenesisBlock.Hash] = &GhostData{
+		MergeSetBlues:      make([]string, 0),
+		MergeSetReds:       make([]string, 0),
+		MergeSetOrder:      make([]string, 0),
+		BluesAnticoneSizes: make(map[string]int),
+	}
+	return rDAG
+}
+
+// *** Methods ***
+
+// Create a copy of the DAG that doesn't share any of its maps with the original one.
+// Needed since several nodes in the same process may start from the same structure.
+// The GHOSTDAG data of a Block never changes once computed, so it is shared between the copies
+func (pDAG *BlockDAG) Copy() BlockDAG {
+	rDAG := BlockDAG{
+		Blocks:    make(map[string]Block, len(pDAG.Blocks)),
+		Children:  make(map[string][]string, len(pDAG.Children)),
+		Tips:      make(map[string]bool, len(pDAG.Tips)),
+		GhostData: make(map[string]*GhostData, len(pDAG.GhostData)),
+		Unchecked: make(map[string][]Block, len(pDAG.Unchecked)),
+		Genesis:   pDAG.Genesis,
+		K:         pDAG.K,
+	}
+	for k, v := range pDAG.Blocks {
+		rDAG.Blocks[k] = v
+	}
+	for k, v := range pDAG.Children {
+		rDAG.Children[k] = append([]string(nil), v...)
+	}
+	for k, v := range pDAG.Tips {
+		rDAG.Tips[k] = v
+	}
+	for k, v := range pDAG.GhostData {
+		rDAG.GhostData[k] = v
+	}
+	for k, v := range pDAG.Unchecked {
+		rDAG.Unchecked[k] = append([]Block(nil), v...)
+	}
+	return rDAG
+}
+
+// Hashes of the current tips, sorted so that the result doesn't depend on the order of the map
+func (pDAG *BlockDAG) TipHashes() []string {
+	rTips := make([]string, 0, len(pDAG.Tips))
+	for k := range pDAG.Tips {
+		rTips = append(rTips, k)
+	}
+	sort.Strings(rTips)
+	return rTips
+}
+
+// Add a Block to the DAG. When one of its parents is still unknown, it is kept as unchecked and added
+// once that parent arrives. The Blocks that became part of the DAG are returned, that is the Block
+// itself followed by the unchecked Blocks that were waiting for it
+func (pDAG *BlockDAG) AddBlock(pBlock Block) ([]Block, error) {
+	// Block was already received
+	if _, ok := pDAG.Blocks[pBlock.Hash]; ok {
+		return nil, nil
+	}
+	for _, v := range pBlock.Parents {
+		if _, ok := pDAG.Blocks[v]; ok {
+			continue
+		}
+		if CalculateHash(pBlock) != pBlock.Hash {
+			return nil, errors.New("calculated hash doesn't match")
+		}
+		for _, w := range pDAG.Unchecked[v] {
+			if w.Hash == pBlock.Hash {
+				return nil, errors.New("the block is waiting for a parent that is still unknown")
+			}
+		}
+		pDAG.Unchecked[v] = append(pDAG.Unchecked[v], pBlock)
+		return nil, errors.New("the block is waiting for a parent that is still unknown")
+	}
+	if ok, err := pDAG.IsBlockValid(pBlock); !ok {
+		return nil, err
+	}
+	pDAG.GhostData[pBlock.Hash] = pDAG.ghostdag(pBlock.Parents)
+	pDAG.Blocks[pBlock.Hash] = pBlock
+	pDAG.Tips[pBlock.Hash] = true
+	for _, v := range pBlock.Parents {
+		pDAG.Children[v] = append(pDAG.Children[v], pBlock.Hash)
+		delete(pDAG.Tips, v)
+	}
+
+	rAdded := []Block{pBlock}
+	waiting := pDAG.Unchecked[pBlock.Hash]
+	delete(pDAG.Unchecked, pBlock.Hash)
+	for _, v := range waiting {
+		if added, err := pDAG.AddBlock(v); err == nil {
+			rAdded = append(rAdded, added...)
+		}
+	}
+	return rAdded, nil
+}
+
+// Blocks reachable from the given Blocks through their parents, including themselves
+func (pDAG *BlockDAG) Past(pHashes ...string) map[string]bool {
+	rPast := make(map[string]bool)
+	pending := append([]string(nil), pHashes...)
+	for len(pending) > 0 {
+		current := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+		if rPast[current] {
+			continue
+		}
+		rPast[current] = true
+		pending = append(pending, pDAG.Blocks[current].Parents...)
+	}
+	return rPast
+}
+
+// Hashes of every Block of the DAG in the total order given by GHOSTDAG. The order is the one
+// of a virtual Block that references every tip
+func (pDAG *BlockDAG) Order() []string {
+	virtual := pDAG.ghostdag(pDAG.TipHashes())
+	chain := []*GhostData{virtual}
+	for current := virtual; current.SelectedParent != ""; {
+		current = pDAG.GhostData[current.SelectedParent]
+		chain = append(chain, current)
+	}
+	rOrder := []string{pDAG.Genesis}
+	for i := len(chain) - 2; i >= 0; i-- {
+		rOrder = append(rOrder, chain[i].MergeSetOrder...)
+		if i > 0 {
+			rOrder = append(rOrder, chain[i-1].SelectedParent)
+		}
+	}
+	return rOrder
+}
+
+// Balances of the accounts after applying the transactions of the Blocks in the total order.
+// When two transactions conflict, the one that comes first in the order is accepted and the
+// other one is rejected, so that no account ends with a negative balance
+func (pDAG *BlockDAG) State() (map[string]float64, []components.Transaction) {
+	rState := make(map[string]float64)
+	rRejected := make([]components.Transaction, 0)
+	for _, hash := range pDAG.Order() {
+		for _, v := range pDAG.Blocks[hash].Transactions {
+			switch true {
+			// Only the genesis Block creates currency
+			case v.Origin == "" && hash != pDAG.Genesis:
+				rRejected = append(rRejected, v)
+			case v.Origin != "" && rState[v.Origin] < v.Value:
+				rRejected = append(rRejected, v)
+			default:
+				if v.Origin != "" {
+					rState[v.Origin] -= v.Value
+				}
+				rState[v.Destination] += v.Value
+			}
+		}
+	}
+	return rState, rRejected
+}
@@ -0,0 +1,170 @@
+package lattice
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"github.com/gcubillos/isis-3007-distributed-ledger/data-structures/shared-components"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// *** Structs ***
+
+// Types of blocks an account chain may contain
+const (
+	// First block of an account chain, it receives the funds of a send block
+	OpenBlock = "open"
+	// Takes funds out of the account and makes them pending for the destination
+	SendBlock = "send"
+	// Takes the funds of a pending send block into the account
+	ReceiveBlock = "receive"
+	// Changes the representative of the account
+	ChangeBlock = "change"
+)
+
+// The number of leading zeroes wanted from the hash of every block. The proof of work is small since
+// it is only meant to prevent spam, not to order the blocks
+var Difficulty = 1
+
+// What a block in the block-lattice contains
+// Every block belongs to the chain of a single account and contains the state of the account after
+// it, that is its Balance and Representative. Accounts and representatives are the hexadecimal public
+// keys of the nodes that control them, and Signature is made over the Hash with the key of the account.
+// Previous is the hash of the previous block of the same account. Link is the destination account for
+// send blocks and the hash of the send block being received for open and receive blocks
+type Block struct {
+	Type           string
+	Account        string
+	Previous       string
+	Representative string
+	Balance        float64
+	Link           string
+	Timestamp      time.Time
+	Nonce          int
+	Difficulty     int
+	Hash           string
+	Signature      string
+}
+
+// *** Constructors ***
+
+// Create a block of the given type on top of the previous block of the account and do its proof of work.
+// The previous block is nil when opening the account. The block still has to be signed by the account
+func CreateBlock(pType, pAccount string, pPrevious *Block, pRepresentative string, pBalance float64, pLink string) Block {
+	rBlock := Block{
+		Type:           pType,
+		Account:        pAccount,
+		Representative: pRepresentative,
+		Balance:        pBalance,
+		Link:           pLink,
+		Timestamp:      time.Now(),
+		Difficulty:     Difficulty,
+	}
+	if pPrevious != nil {
+		rBlock.Previous = pPrevious.Hash
+	}
+	// Proof of work, calculating the hash
+	for i := 0; ; i++ {
+		rBlock.Nonce = i
+		if hash := CalculateHash(rBlock); IsHashValid(hash, rBlock.Difficulty) {
+			rBlock.Hash = hash
+			break
+		}
+	}
+	return rBlock
+}
+
+// *** Methods ***
+
+// Generate Hash of a block using all of its fields but the signature
+func CalculateHash(pBlock Block) string {
+	record := pBlock.Type + pBlock.Account + pBlock.Previous + pBlock.Representative +
+		strconv.FormatFloat(pBlock.Balance, 'f', -1, 64) + pBlock.Link +
+		strconv.FormatInt(pBlock.Timestamp.UnixNano(), 10) + strconv.Itoa(pBlock.Nonce) + strconv.Itoa(pBlock.Difficulty)
+	h := sha256.New()
+	h.Write([]byte(record))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Checks whether the hash is valid by checking if it starts with the given number of zeroes specified in the difficulty
+func IsHashValid(hash string, difficulty int) bool {
+	prefix := strings.Repeat("0", difficulty)
+	return strings.HasPrefix(hash, prefix)
+}
+
+// Whether the block has the proof of work of the configured difficulty, so that no peer can skip it
+func (pBlock *Block) hasProofOfWork() bool {
+	return pBlock.Difficulty == Difficulty && IsHashValid(pBlock.Hash, pBlock.Difficulty)
+}
+
+// Whether the block was signed by the key of its account
+func (pBlock *Block) isSignatureValid() bool {
+	return components.VerifySignature(pBlock.Account, pBlock.Hash, pBlock.Signature)
+}
+
+// Root of the block, that is what identifies the position the block takes in the account chain.
+// Two different blocks with the same root are in conflict
+func (pBlock *Block) Root() string {
+	if pBlock.Previous == "" {
+		return pBlock.Account
+	}
+	return pBlock.Previous
+}
+
+// Check that the block is valid
+// The hash, proof of work and signature must be valid, and the block must follow the rules of its type in
+// relation to the previous block of the account. The previous block must be the current head
+// of the account, otherwise the block is in conflict with the one that follows it
+func (pLattice *Lattice) IsBlockValid(pBlock Block) (bool, error) {
+	head, hasChain := pLattice.Heads[pBlock.Account]
+	previousBalance := 0.0
+	if hasChain {
+		previousBalance = pLattice.Blocks[head].Balance
+	}
+	switch true {
+	// Does the corresponding hash match
+	case CalculateHash(pBlock) != pBlock.Hash:
+		return false, errors.New("calculated hash doesn't match")
+	// Checking proof of work, with the configured difficulty
+	case !pBlock.hasProofOfWork():
+		return false, errors.New("the proof of work is not valid")
+	case !pBlock.isSignatureValid():
+		return false, errors.New("the signature of the account is not valid")
+	case pBlock.Balance < 0:
+		return false, errors.New("the balance can't be negative")
+	// Only an open block starts a chain, and only once
+	case pBlock.Type == OpenBlock && (hasChain || pBlock.Previous != ""):
+		return false, errors.New("the account is already open")
+	case pBlock.Type != OpenBlock && !hasChain:
+		return false, errors.New("the account hasn't been opened")
+	// Previous block is the head of the account chain
+	case pBlock.Type != OpenBlock && pBlock.Previous != head:
+		return false, errors.New("previous block isn't the head of the account")
+	}
+
+	switch pBlock.Type {
+	case SendBlock:
+		if pBlock.Balance >= previousBalance {
+			return false, errors.New("a send block must decrease the balance")
+		}
+	case OpenBlock, ReceiveBlock:
+		pending, ok := pLattice.Pending[pBlock.Link]
+		switch true {
+		case !ok:
+			return false, errors.New("the send block being received is not pending")
+		case pending.Destination != pBlock.Account:
+			return false, errors.New("the send block being received is for another account")
+		case pBlock.Balance != previousBalance+pending.Amount:
+			return false, errors.New("the balance doesn't match the amount received")
+		}
+	case ChangeBlock:
+		if pBlock.Balance != previousBalance {
+			return false, errors.New("a change block can't modify the balance")
+		}
+	default:
+		return false, errors.New("unknown block type")
+	}
+	return true, nil
+}
@@ -0,0 +1,287 @@
+package lattice
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/gcubillos/isis-3007-distributed-ledger/data-structures/shared-components"
+	"github.com/perlin-network/noise"
+	"github.com/perlin-network/noise/kademlia"
+	"sync"
+	"time"
+)
+
+// Mutual exclusion variable
+var mutex = &sync.Mutex{}
+
+// Time a node waits for a peer to acknowledge a block or a vote
+var RequestTimeout = 2 * time.Second
+
+// *** Structs ***
+
+// Declaration of node in the network
+// Contains the underlying data structure as well as the node from the noise library.
+// Accounts are the accounts whose chains the node is allowed to extend. The first of them is the
+// node's own account, identified by its public key, and it is the representative the node votes as.
+// The node remembers the blocks it has already seen so that each of them is relayed only once,
+// even when it is not added to the block-lattice
+type NodeLattice struct {
+	DataStructure Lattice
+	Node          *noise.Node
+	Accounts      []string
+	protocol      *kademlia.Protocol
+	seen          map[string]bool
+}
+
+// What is sent between the nodes, either a block or a vote
+type Message struct {
+	Block *Block
+	Vote  *Vote
+}
+
+// *** Constructors ***
+
+// Create a node in the network such that it can discover other nodes using the Kademlia
+// protocol. The current state of the block-lattice is passed to the Node and a first peer
+// to connect to the network
+func CreateNode(pCurrentLattice Lattice, pNode *noise.Node) *NodeLattice {
+	// Create structure. The block-lattice is copied so that the nodes don't share their state
+	mutex.Lock()
+	thisNode := &NodeLattice{
+		DataStructure: pCurrentLattice.Copy(),
+		Node:          nil,
+	}
+	mutex.Unlock()
+	thisNode.listen()
+
+	// Ping the provided node in the network
+	_, err := thisNode.Node.Ping(context.TODO(), pNode.Addr())
+	check(err)
+
+	// Discover the other nodes present in the network at the moment
+	thisNode.protocol.Discover()
+
+	return thisNode
+}
+
+// Create the initial node
+// The genesis block opens the account of the initial node with the amount of available currency. The
+// node signs the block and is the representative of the account, so at first it holds all the voting weight
+func CreateInitialNode(pAvailableCurrency float64) *NodeLattice {
+	thisNode := &NodeLattice{}
+	thisNode.listen()
+	genesisBlock := CreateGenesisBlock(thisNode.Account(), thisNode.Account(), pAvailableCurrency)
+	thisNode.sign(&genesisBlock)
+	thisNode.DataStructure = CreateLattice(genesisBlock)
+
+	return thisNode
+}
+
+// *** Methods ***
+
+// Create the network node, bind the Kademlia protocol and the way the requests are handled,
+// and make it listen to the network
+func (pNode *NodeLattice) listen() {
+	// Create network node
+	networkNode, err := noise.NewNode()
+	check(err)
+
+	// Assign the Kademlia protocol to the node so it can discover other nodes
+	pNode.protocol = kademlia.New()
+	networkNode.Bind(pNode.protocol.Protocol())
+
+	// Assign the way the node will handle the blocks and votes it receives
+	networkNode.Handle(pNode.handleRequest)
+
+	// Make the node listen to the network
+	check(networkNode.Listen())
+
+	// Assign the network node to the node
+	pNode.Node = networkNode
+	pNode.Accounts = []string{networkNode.ID().ID.String()}
+	pNode.seen = make(map[string]bool)
+}
+
+// Account of the node, which is the hexadecimal public key of the network node
+func (pNode *NodeLattice) Account() string {
+	return pNode.Accounts[0]
+}
+
+// Sign the block with the key of the node, which must control the account of the block
+func (pNode *NodeLattice) sign(pBlock *Block) {
+	pBlock.Signature = components.Sign(pNode.Node, pBlock.Hash)
+}
+
+// Create a send block that moves the given amount from one of the node's accounts to the destination
+func (pNode *NodeLattice) Send(pAccount, pDestination string, pAmount float64) (Block, error) {
+	mutex.Lock()
+	head := pNode.DataStructure.Head(pAccount)
+	switch true {
+	case !pNode.controls(pAccount):
+		mutex.Unlock()
+		return Block{}, errors.New("the node doesn't control the account")
+	case head == nil:
+		mutex.Unlock()
+		return Block{}, errors.New("the account hasn't been opened")
+	case pAmount <= 0 || pAmount > head.Balance:
+		mutex.Unlock()
+		return Block{}, errors.New("the amount can't be sent from the account")
+	}
+	sendBlock := CreateBlock(SendBlock, pAccount, head, head.Representative, head.Balance-pAmount, pDestination)
+	pNode.sign(&sendBlock)
+	return sendBlock, pNode.publish(sendBlock)
+}
+
+// Create a receive block that takes the funds of a pending send block into one of the node's accounts.
+// If the account hasn't been opened yet, an open block is created with the node as representative
+func (pNode *NodeLattice) Receive(pAccount, pSendHash string) (Block, error) {
+	mutex.Lock()
+	pending, ok := pNode.DataStructure.Pending[pSendHash]
+	if !pNode.controls(pAccount) || !ok || pending.Destination != pAccount {
+		mutex.Unlock()
+		return Block{}, errors.New("there is no pending send block for the account")
+	}
+	var receiveBlock Block
+	if head := pNode.DataStructure.Head(pAccount); head == nil {
+		receiveBlock = CreateBlock(OpenBlock, pAccount, nil, pNode.Account(), pending.Amount, pSendHash)
+	} else {
+		receiveBlock = CreateBlock(ReceiveBlock, pAccount, head, head.Representative, head.Balance+pending.Amount, pSendHash)
+	}
+	pNode.sign(&receiveBlock)
+	return receiveBlock, pNode.publish(receiveBlock)
+}
+
+// Create a change block that assigns a new representative to one of the node's accounts
+func (pNode *NodeLattice) ChangeRepresentative(pAccount, pRepresentative string) (Block, error) {
+	mutex.Lock()
+	head := pNode.DataStructure.Head(pAccount)
+	if !pNode.controls(pAccount) || head == nil {
+		mutex.Unlock()
+		return Block{}, errors.New("the account can't be changed by the node")
+	}
+	changeBlock := CreateBlock(ChangeBlock, pAccount, head, pRepresentative, head.Balance, "")
+	pNode.sign(&changeBlock)
+	return changeBlock, pNode.publish(changeBlock)
+}
+
+// Add a block created by the node to its block-lattice, broadcast it and vote for it.
+// It is called with the mutex locked, so that no other block takes the head of the account
+// between the creation of the block and its addition
+func (pNode *NodeLattice) publish(pBlock Block) error {
+	pNode.seen[pBlock.Hash] = true
+	_, err := pNode.DataStructure.AddBlock(pBlock)
+	mutex.Unlock()
+	if err != nil {
+		return err
+	}
+	pNode.broadcast(Message{Block: &pBlock})
+	pNode.vote(pBlock)
+	return nil
+}
+
+// Vote for a block as the representative of the node, and broadcast the vote
+func (pNode *NodeLattice) vote(pBlock Block) {
+	theVote := Vote{Representative: pNode.Account(), Root: pBlock.Root(), Hash: pBlock.Hash}
+	theVote.Signature = components.Sign(pNode.Node, theVote.signedData())
+	mutex.Lock()
+	_ = pNode.DataStructure.AddVote(theVote)
+	mutex.Unlock()
+	pNode.broadcast(Message{Vote: &theVote})
+}
+
+// Send a message to every peer known by the node
+func (pNode *NodeLattice) broadcast(pMessage Message) {
+	bytes, err := json.Marshal(pMessage)
+	check(err)
+	for _, v := range pNode.protocol.Table().Peers() {
+		// A peer that left the network or is too busy to answer doesn't stop the message from reaching the others
+		ctx, cancel := context.WithTimeout(context.Background(), RequestTimeout)
+		_, _ = pNode.Node.Request(ctx, v.Address, bytes)
+		cancel()
+	}
+}
+
+// Handle the blocks and votes received. The ones that are new for the node are relayed to its peers,
+// the node votes for the blocks it accepts, and the funds sent to its accounts are received
+func (pNode *NodeLattice) handleRequest(ctx noise.HandlerContext) error {
+	if !ctx.IsRequest() {
+		return nil
+	}
+	var received Message
+	// The messages used to discover peers are not blocks nor votes
+	if err := json.Unmarshal(ctx.Data(), &received); err != nil {
+		return ctx.Send([]byte(""))
+	}
+	if err := ctx.Send([]byte("")); err != nil {
+		return err
+	}
+
+	switch true {
+	case received.Block != nil:
+		mutex.Lock()
+		known := pNode.seen[received.Block.Hash]
+		pNode.seen[received.Block.Hash] = true
+		added, _ := pNode.DataStructure.AddBlock(*received.Block)
+		mutex.Unlock()
+		if known {
+			return nil
+		}
+		go pNode.broadcast(received)
+		// Besides the received block, the blocks that were waiting for it may have been added
+		for _, v := range added {
+			go pNode.vote(v)
+			if v.Type == SendBlock && pNode.controls(v.Link) {
+				go pNode.Receive(v.Link, v.Hash)
+			}
+		}
+	case received.Vote != nil:
+		mutex.Lock()
+		election, ok := pNode.DataStructure.Elections[received.Vote.Root]
+		// Votes for elections that already finished are not relayed either
+		alreadyCounted := ok && (election.Winner != "" || election.Votes[received.Vote.Representative] == received.Vote.Hash)
+		err := pNode.DataStructure.AddVote(*received.Vote)
+		mutex.Unlock()
+		// Votes that aren't signed by their representative are not relayed
+		if !alreadyCounted && err == nil {
+			go pNode.broadcast(received)
+		}
+	}
+	return nil
+}
+
+// Block that received the given send block and the moment it was confirmed, if it already was.
+// Safe to call while the node keeps receiving blocks and votes
+func (pNode *NodeLattice) ConfirmedReceive(pSendHash string) (Block, time.Time, bool) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	receiveHash, ok := pNode.DataStructure.ReceivedBy[pSendHash]
+	if !ok {
+		return Block{}, time.Time{}, false
+	}
+	confirmation, ok := pNode.DataStructure.Confirmed[receiveHash]
+	return pNode.DataStructure.Blocks[receiveHash], confirmation, ok
+}
+
+// Whether the node considers the block confirmed. Safe to call while the node keeps receiving blocks and votes
+func (pNode *NodeLattice) IsConfirmed(pHash string) bool {
+	mutex.Lock()
+	defer mutex.Unlock()
+	return pNode.DataStructure.IsConfirmed(pHash)
+}
+
+// Whether the node is allowed to extend the chain of the account
+func (pNode *NodeLattice) controls(pAccount string) bool {
+	for _, v := range pNode.Accounts {
+		if v == pAccount {
+			return true
+		}
+	}
+	return false
+}
+
+// Revises whether the error is not nil
+func check(err error) {
+	if err != nil {
+		panic(err)
+	}
+}
@@ -0,0 +1,296 @@
+package lattice
+
+import (
+	"errors"
+	"time"
+)
+
+// *** Structs ***
+
+// What is kept for a send block that hasn't been received yet by its destination
+type PendingSend struct {
+	Source      string
+	Destination string
+	Amount      float64
+}
+
+// Declaration of structure
+// Every account has its own chain of blocks, whose last block is the head of the account.
+// Blocks contains the blocks of every account chain indexed by their hash and Heads the hash
+// of the head of each account. The funds of send blocks stay in Pending until the destination
+// receives them, and ReceivedBy keeps which block received each send block.
+// Elections are used to resolve conflicts between blocks that have the same root, and Confirmed
+// registers the moment each block was confirmed by the votes of the representatives.
+// Since the blocks may arrive in any order, Unchecked keeps the blocks whose previous block or
+// received send block is still unknown, indexed by the hash they are waiting for
+type Lattice struct {
+	Blocks      map[string]Block
+	Heads       map[string]string
+	Pending     map[string]PendingSend
+	ReceivedBy  map[string]string
+	Unchecked   map[string][]Block
+	Elections   map[string]*Election
+	Confirmed   map[string]time.Time
+	Genesis     string
+	TotalSupply float64
+}
+
+// *** Constructors ***
+
+// Create the block-lattice with the genesis block, which opens the account holding the whole supply
+func CreateLattice(pGenesisBlock Block) Lattice {
+	rLattice := Lattice{
+		Blocks:      make(map[string]Block),
+		Heads:       make(map[string]string),
+		Pending:     make(map[string]PendingSend),
+		ReceivedBy:  make(map[string]string),
+		Unchecked:   make(map[string][]Block),
+		Elections:   make(map[string]*Election),
+		Confirmed:   make(map[string]time.Time),
+		Genesis:     pGenesisBlock.Hash,
+		TotalSupply: pGenesisBlock.Balance,
+	}
+	rLattice.Blocks[pGenesisBlock.Hash] = pGenesisBlock
+	rLattice.Heads[pGenesisBlock.Account] = pGenesisBlock.Hash
+	rLattice.Confirmed[pGenesisBlock.Hash] = pGenesisBlock.Timestamp
+	return rLattice
+}
+
+// Create the genesis block, an open block for the given account that doesn't receive from any send block
+func CreateGenesisBlock(pAccount, pRepresentative string, pSupply float64) Block {
+	return CreateBlock(OpenBlock, pAccount, nil, pRepresentative, pSupply, "")
+}
+
+// *** Methods ***
+
+// Create a copy of the block-lattice that doesn't share any of its maps with the original one.
+// Needed since several nodes in the same process may start from the same structure
+func (pLattice *Lattice) Copy() Lattice {
+	rLattice := Lattice{
+		Blocks:      make(map[string]Block, len(pLattice.Blocks)),
+		Heads:       make(map[string]string, len(pLattice.Heads)),
+		Pending:     make(map[string]PendingSend, len(pLattice.Pending)),
+		ReceivedBy:  make(map[string]string, len(pLattice.ReceivedBy)),
+		Unchecked:   make(map[string][]Block, len(pLattice.Unchecked)),
+		Elections:   make(map[string]*Election, len(pLattice.Elections)),
+		Confirmed:   make(map[string]time.Time, len(pLattice.Confirmed)),
+		Genesis:     pLattice.Genesis,
+		TotalSupply: pLattice.TotalSupply,
+	}
+	for k, v := range pLattice.Blocks {
+		rLattice.Blocks[k] = v
+	}
+	for k, v := range pLattice.Heads {
+		rLattice.Heads[k] = v
+	}
+	for k, v := range pLattice.Pending {
+		rLattice.Pending[k] = v
+	}
+	for k, v := range pLattice.ReceivedBy {
+		rLattice.ReceivedBy[k] = v
+	}
+	for k, v := range pLattice.Unchecked {
+		rLattice.Unchecked[k] = append([]Block(nil), v...)
+	}
+	for k, v := range pLattice.Elections {
+		electionCopy := v.copy()
+		rLattice.Elections[k] = &electionCopy
+	}
+	for k, v := range pLattice.Confirmed {
+		rLattice.Confirmed[k] = v
+	}
+	return rLattice
+}
+
+// Balance of an account according to the head of its chain
+func (pLattice *Lattice) Balance(pAccount string) float64 {
+	if head, ok := pLattice.Heads[pAccount]; ok {
+		return pLattice.Blocks[head].Balance
+	}
+	return 0
+}
+
+// Head of the chain of an account, or nil if the account hasn't been opened
+func (pLattice *Lattice) Head(pAccount string) *Block {
+	if head, ok := pLattice.Heads[pAccount]; ok {
+		theBlock := pLattice.Blocks[head]
+		return &theBlock
+	}
+	return nil
+}
+
+// Blocks of the chain of an account, going from the open block to the head
+func (pLattice *Lattice) AccountChain(pAccount string) []Block {
+	rChain := make([]Block, 0)
+	for current, ok := pLattice.Heads[pAccount]; ok && current != ""; current = pLattice.Blocks[current].Previous {
+		rChain = append([]Block{pLattice.Blocks[current]}, rChain...)
+	}
+	return rChain
+}
+
+// Send blocks that are waiting to be received by the given account
+func (pLattice *Lattice) PendingFor(pAccount string) []string {
+	rHashes := make([]string, 0)
+	for k, v := range pLattice.Pending {
+		if v.Destination == pAccount {
+			rHashes = append(rHashes, k)
+		}
+	}
+	return rHashes
+}
+
+// Add a block to the block-lattice. When the block is valid it becomes the new head of its account
+// and an election is started for it. When it is in conflict with a block that already follows its
+// previous block, it is kept as a candidate of the election of that root, waiting for the votes.
+// When a block it depends on is still unknown, it is kept as unchecked and added once that block arrives.
+// The blocks that became part of the block-lattice are returned, that is the block itself followed
+// by the unchecked blocks that were waiting for it
+func (pLattice *Lattice) AddBlock(pBlock Block) ([]Block, error) {
+	// Block was already received
+	if _, ok := pLattice.Blocks[pBlock.Hash]; ok {
+		return nil, nil
+	}
+	if election, ok := pLattice.Elections[pBlock.Root()]; ok {
+		if _, isCandidate := election.Candidates[pBlock.Hash]; isCandidate {
+			return nil, nil
+		}
+	}
+
+	if missing := pLattice.missingDependency(pBlock); missing != "" {
+		if CalculateHash(pBlock) != pBlock.Hash || !pBlock.hasProofOfWork() || !pBlock.isSignatureValid() {
+			return nil, errors.New("the block doesn't have a valid proof of work and signature")
+		}
+		for _, v := range pLattice.Unchecked[missing] {
+			if v.Hash == pBlock.Hash {
+				return nil, errors.New("the block is waiting for a block that is still unknown")
+			}
+		}
+		pLattice.Unchecked[missing] = append(pLattice.Unchecked[missing], pBlock)
+		return nil, errors.New("the block is waiting for a block that is still unknown")
+	}
+	if err := pLattice.addBlock(pBlock); err != nil {
+		return nil, err
+	}
+	return append([]Block{pBlock}, pLattice.addUnchecked(pBlock.Hash)...), nil
+}
+
+// Add the unchecked blocks that were waiting for the given block, returning the ones that became
+// part of the block-lattice
+func (pLattice *Lattice) addUnchecked(pHash string) []Block {
+	rAdded := make([]Block, 0)
+	waiting := pLattice.Unchecked[pHash]
+	delete(pLattice.Unchecked, pHash)
+	for _, v := range waiting {
+		if added, err := pLattice.AddBlock(v); err == nil {
+			rAdded = append(rAdded, added...)
+		}
+	}
+	return rAdded
+}
+
+// Add a block whose dependencies are already part of the block-lattice
+func (pLattice *Lattice) addBlock(pBlock Block) error {
+	if ok, err := pLattice.IsBlockValid(pBlock); !ok {
+		if !pLattice.isInConflict(pBlock) {
+			return err
+		}
+		pLattice.startElection(pBlock)
+		return errors.New("the block is in conflict with another block of the account")
+	}
+	pLattice.applyBlock(pBlock)
+	pLattice.startElection(pBlock)
+	return nil
+}
+
+// Hash of the previous block or of the received send block when it is not yet part of the
+// block-lattice, or an empty string when the block doesn't depend on an unknown block
+func (pLattice *Lattice) missingDependency(pBlock Block) string {
+	if _, ok := pLattice.Blocks[pBlock.Previous]; pBlock.Previous != "" && !ok {
+		return pBlock.Previous
+	}
+	if pBlock.Type != OpenBlock && pBlock.Type != ReceiveBlock || pBlock.Link == "" {
+		return ""
+	}
+	if _, ok := pLattice.Blocks[pBlock.Link]; !ok {
+		return pBlock.Link
+	}
+	return ""
+}
+
+// Whether the block takes the place of a block already present in the chain of its account.
+// Only the hash, proof of work and signature of the block are checked
+func (pLattice *Lattice) isInConflict(pBlock Block) bool {
+	if CalculateHash(pBlock) != pBlock.Hash || !pBlock.hasProofOfWork() || !pBlock.isSignatureValid() {
+		return false
+	}
+	if pBlock.Type == OpenBlock {
+		_, hasChain := pLattice.Heads[pBlock.Account]
+		return hasChain && pBlock.Previous == ""
+	}
+	previousBlock, ok := pLattice.Blocks[pBlock.Previous]
+	return ok && previousBlock.Account == pBlock.Account && pLattice.Heads[pBlock.Account] != pBlock.Previous
+}
+
+// Make a valid block the head of its account and update the pending send blocks
+func (pLattice *Lattice) applyBlock(pBlock Block) {
+	previousBalance := pLattice.Balance(pBlock.Account)
+	pLattice.Blocks[pBlock.Hash] = pBlock
+	pLattice.Heads[pBlock.Account] = pBlock.Hash
+	switch pBlock.Type {
+	case SendBlock:
+		pLattice.Pending[pBlock.Hash] = PendingSend{
+			Source:      pBlock.Account,
+			Destination: pBlock.Link,
+			Amount:      previousBalance - pBlock.Balance,
+		}
+	case OpenBlock, ReceiveBlock:
+		delete(pLattice.Pending, pBlock.Link)
+		pLattice.ReceivedBy[pBlock.Link] = pBlock.Hash
+	}
+}
+
+// Remove a block, and the blocks that follow it in the account chain, from the block-lattice.
+// When a removed send block had already been received, the receiving block is removed as well
+func (pLattice *Lattice) rollback(pHash string) {
+	rolledBack, ok := pLattice.Blocks[pHash]
+	if !ok {
+		return
+	}
+	for {
+		head := pLattice.Blocks[pLattice.Heads[rolledBack.Account]]
+		switch head.Type {
+		case SendBlock:
+			if receiveHash, received := pLattice.ReceivedBy[head.Hash]; received {
+				receiveBlock := pLattice.Blocks[receiveHash]
+				pLattice.rollback(receiveHash)
+				delete(pLattice.Elections, receiveBlock.Root())
+			}
+			delete(pLattice.Pending, head.Hash)
+		case OpenBlock, ReceiveBlock:
+			sendBlock := pLattice.Blocks[head.Link]
+			previousBalance := 0.0
+			if head.Previous != "" {
+				previousBalance = pLattice.Blocks[head.Previous].Balance
+			}
+			pLattice.Pending[head.Link] = PendingSend{
+				Source:      sendBlock.Account,
+				Destination: head.Account,
+				Amount:      head.Balance - previousBalance,
+			}
+			delete(pLattice.ReceivedBy, head.Link)
+		}
+		delete(pLattice.Blocks, head.Hash)
+		// The elections of the blocks that followed the removed one no longer make sense
+		if head.Hash != pHash {
+			delete(pLattice.Elections, head.Root())
+		}
+		if head.Previous == "" {
+			delete(pLattice.Heads, head.Account)
+		} else {
+			pLattice.Heads[head.Account] = head.Previous
+		}
+		if head.Hash == pHash {
+			return
+		}
+	}
+}
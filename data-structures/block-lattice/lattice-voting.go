@@ -0,0 +1,148 @@
+package lattice
+
+import (
+	"errors"
+	"github.com/gcubillos/isis-3007-distributed-ledger/data-structures/shared-components"
+	"time"
+)
+
+// *** Structs ***
+
+// Fraction of the total supply that has to vote for a block so that it is confirmed
+var Quorum = 0.5
+
+// What a vote contains. The representative votes for the block it considers should take the given root,
+// and signs the vote with its key
+type Vote struct {
+	Representative string
+	Root           string
+	Hash           string
+	Signature      string
+}
+
+// What an election for a root contains
+// Candidates are the blocks competing for the root, Votes keeps the block each representative voted
+// for and Winner is the hash of the confirmed block, empty while the election is still open
+type Election struct {
+	Root       string
+	Candidates map[string]Block
+	Votes      map[string]string
+	Winner     string
+	Started    time.Time
+}
+
+// *** Constructors ***
+
+func createElection(pRoot string) *Election {
+	return &Election{
+		Root:       pRoot,
+		Candidates: make(map[string]Block),
+		Votes:      make(map[string]string),
+		Started:    time.Now(),
+	}
+}
+
+// *** Methods ***
+
+// Data signed by the representative of the vote
+func (pVote *Vote) signedData() string {
+	return pVote.Root + pVote.Hash
+}
+
+func (pElection *Election) copy() Election {
+	rElection := *pElection
+	rElection.Candidates = make(map[string]Block, len(pElection.Candidates))
+	rElection.Votes = make(map[string]string, len(pElection.Votes))
+	for k, v := range pElection.Candidates {
+		rElection.Candidates[k] = v
+	}
+	for k, v := range pElection.Votes {
+		rElection.Votes[k] = v
+	}
+	return rElection
+}
+
+// Include a block as a candidate of the election of its root, creating the election if needed
+func (pLattice *Lattice) startElection(pBlock Block) {
+	election, ok := pLattice.Elections[pBlock.Root()]
+	if !ok {
+		election = createElection(pBlock.Root())
+		pLattice.Elections[pBlock.Root()] = election
+	}
+	election.Candidates[pBlock.Hash] = pBlock
+	// The votes may have arrived before the block
+	pLattice.tally(election)
+}
+
+// Voting weight of a representative, which is the sum of the balances of the accounts that chose it
+func (pLattice *Lattice) VotingWeight(pRepresentative string) float64 {
+	weight := 0.0
+	for _, v := range pLattice.Heads {
+		if head := pLattice.Blocks[v]; head.Representative == pRepresentative {
+			weight += head.Balance
+		}
+	}
+	return weight
+}
+
+// Register the vote of a representative once its signature is checked. Votes for roots without an
+// election are kept until the blocks arrive. A representative may change its vote while the election is open
+func (pLattice *Lattice) AddVote(pVote Vote) error {
+	if !components.VerifySignature(pVote.Representative, pVote.signedData(), pVote.Signature) {
+		return errors.New("signature of the vote is not valid")
+	}
+	election, ok := pLattice.Elections[pVote.Root]
+	if !ok {
+		election = createElection(pVote.Root)
+		pLattice.Elections[pVote.Root] = election
+	}
+	if election.Winner != "" {
+		return errors.New("the election is already confirmed")
+	}
+	election.Votes[pVote.Representative] = pVote.Hash
+	pLattice.tally(election)
+	return nil
+}
+
+// Count the votes of an election. When a candidate gets the quorum it is confirmed, and if it wasn't
+// the block present in the account chain, the other block is rolled back and the winner takes its place
+func (pLattice *Lattice) tally(pElection *Election) {
+	if pElection.Winner != "" {
+		return
+	}
+	weights := make(map[string]float64)
+	for representative, hash := range pElection.Votes {
+		if _, ok := pElection.Candidates[hash]; ok {
+			weights[hash] += pLattice.VotingWeight(representative)
+		}
+	}
+	for hash, weight := range weights {
+		if weight <= Quorum*pLattice.TotalSupply {
+			continue
+		}
+		winner := pElection.Candidates[hash]
+		if _, applied := pLattice.Blocks[hash]; !applied {
+			// Remove the block that took the root
+			for candidate := range pElection.Candidates {
+				if _, ok := pLattice.Blocks[candidate]; ok {
+					pLattice.rollback(candidate)
+				}
+			}
+			if ok, _ := pLattice.IsBlockValid(winner); !ok {
+				// The winner can't be applied yet, the election stays open
+				return
+			}
+			pLattice.applyBlock(winner)
+			pLattice.addUnchecked(hash)
+		}
+		pElection.Winner = hash
+		pLattice.Confirmed[hash] = time.Now()
+		return
+	}
+}
+
+// Whether the block has been confirmed by the representatives
+func (pLattice *Lattice) IsConfirmed(pHash string) bool {
+	_, ok := pLattice.Confirmed[pHash]
+	return ok
+}
@@ -1,8 +1,7 @@
 package ghost
 
 import (
-	"crypto/sha256"
-	"encoding/hex"
+	"context"
 	"errors"
 	"github.com/gcubillos/isis-3007-distributed-ledger/data-structures/shared-components"
 	"strconv"
@@ -14,43 +13,101 @@ import (
 // The network is intended to produce roughly one Block every ten minutes, with each Block
 // containing a Timestamp, a Nonce, a reference to (ie. Hash of) the previous Block and a
 // list of all of the Transactions that have taken place since the previous Block.
+// Uncles are the hashes of stale Blocks referenced by the Block so that their miners are also rewarded, and
+// Miner is the address that receives the rewards.
+// References are the hashes of the other leaves of the tree known by the miner. They are only used
+// by the inclusive protocol, so that the transactions of Blocks outside the current chain count as well.
+// Algorithm is the name of the proof of work function, chosen in the genesis Block and kept by its
+// descendants as the Difficulty is. Single SHA-256 is used when it is empty.
 
 type Block struct {
 	Timestamp         time.Time
 	Nonce             int
 	Hash              string
 	HashPreviousBlock string
-	Parent            *Block
-	Uncles            []Block
+	Parent            *Block `json:"-"`
+	Uncles            []string
+	References        []string
 	Transactions      []components.Transaction
 	RecentState       map[string]*Account
 	BlockNumber       int
 	Difficulty        int
+	Miner             string
+	Algorithm         string
 }
 
 // *** Constructors ***
 
+// Create a child of the given parent with the given transactions, without its proof of work.
+// The Block references as uncles the stale Blocks that are eligible or, with the inclusive protocol,
+// every other leaf of the tree, and includes the transactions that reward its miner and the miners
+// of the uncles
+func (pGhost *Ghost) CreateBlock(pParent *Block, pMiner string, pTransactions []components.Transaction) Block {
+	var rBlock Block
+	rBlock.Parent = pParent
+	rBlock.Timestamp = pGhost.NextTimestamp(pParent)
+	rBlock.HashPreviousBlock = pParent.Hash
+	rBlock.Difficulty = pParent.Difficulty
+	rBlock.Algorithm = pParent.Algorithm
+	rBlock.BlockNumber = pParent.BlockNumber + 1
+	rBlock.Miner = pMiner
+	if pGhost.Inclusive {
+		rBlock.References = pGhost.SelectReferences(pParent.Hash)
+	} else {
+		rBlock.Uncles = pGhost.SelectUncles(pParent)
+	}
+
+	// Adding the transactions that give the "miner" and the miners of the uncles a reward for doing the work
+	rewardTransactions := pGhost.RewardTransactions(rBlock.Miner, pParent.Hash, rBlock.Uncles)
+	rBlock.Transactions = append(append([]components.Transaction(nil), pTransactions...), rewardTransactions...)
+	return rBlock
+}
+
 // *** Methods ***
 // Check that the Block is valid
-// By checking if the previous Block referenced by the Block exists and is valid
-// Checking that the Timestamp of the Block is greater than that of the previous Block
+// By checking if the previous Block referenced by the Block exists and is valid. Every Block in
+// the tree was validated when it was added, so it is enough to check the parent is there
+// Checking that the Timestamp of the Block is greater than the median Timestamp of the last Blocks of
+// its chain, and not too far ahead of the network-adjusted clock of the node
 // Check that the proof of work on the Block is valid.
+// Check that the uncles are eligible and the rewards are the expected ones.
+// Check that the referenced Blocks are known. Only inclusive Blocks reference other leaves, and they
+// don't reference uncles, since the Blocks outside the current chain are already rewarded when included.
 // Let S[0] be the state at the end of the previous Block.
 // Suppose TX is the Block's Transactions list with n Transactions. For all i in 0...n-1,
 // set S[i+1] = APPLY(S[i],TX[i]) If any application returns an error, exit and return false.
-// Return true, and register S[n] as the state at the end of this Block.
+// The state is only known for the tip of the current chain, so the transactions are checked
+// when the Block extends it. Otherwise they are checked once the Block is connected
 
 func (pGhost *Ghost) IsBlockValid(pBlock *Block) (bool, error) {
 	// Checking that it is valid until you reach the genesis block
 	if pBlock.HashPreviousBlock != "" {
+		parentNode, ok := pGhost.Tree.Nodes[pBlock.HashPreviousBlock]
+		switch true {
 		// Previous Block exists and valid
-		if condition, _ := pGhost.IsBlockValid(pBlock.Parent); !condition {
+		case !ok || pBlock.Parent == nil:
+			return false, errors.New("previous Block is not part of the tree")
+		case parentNode.Invalid:
 			return false, errors.New("previous Block isn't valid")
-		}
-		switch true {
+		// Finality
+		case !pGhost.isAfterFinalized(pBlock.HashPreviousBlock):
+			return false, errors.New("block conflicts with the finalized checkpoint")
 		// Timestamp
-		case pBlock.Timestamp.Before(pBlock.Parent.Timestamp):
-			return false, errors.New("timestamp of previous Block isn't valid")
+		case !pBlock.Timestamp.After(pGhost.MedianTimePast(pBlock.Parent)):
+			return false, errors.New("timestamp is not after the median time past")
+		case pGhost.Clock.IsTooFarAhead(pBlock.Timestamp):
+			return false, errors.New("timestamp is too far in the future")
+		// Proof of work function of the genesis Block
+		case pBlock.Algorithm != pBlock.Parent.Algorithm:
+			return false, errors.New("hash function differs from the one of the previous Block")
+		case !isAlgorithmKnown(pBlock.Algorithm):
+			return false, errors.New("hash function is unknown")
+		// Difficulty of the genesis Block, so that no Block is cheaper to mine than the others
+		case pBlock.Difficulty != pBlock.Parent.Difficulty:
+			return false, errors.New("difficulty differs from the one of the previous Block")
+		// Block number follows the one of the previous Block
+		case pBlock.BlockNumber != pBlock.Parent.BlockNumber+1:
+			return false, errors.New("block number doesn't follow the previous Block")
 		// Previous block hash comparison
 		case pBlock.HashPreviousBlock != CalculateHash(*pBlock.Parent):
 			return false, errors.New("hash of previous block doesn't match")
@@ -60,10 +117,21 @@ func (pGhost *Ghost) IsBlockValid(pBlock *Block) (bool, error) {
 		// Validating proof of work
 		case !IsHashValid(pBlock.Hash, pBlock.Difficulty):
 			return false, errors.New("proof of work is not valid")
+		// References
+		case !pGhost.areReferencesKnown(pBlock):
+			return false, errors.New("referenced Block is not part of the tree")
+		case pGhost.Inclusive && len(pBlock.Uncles) > 0:
+			return false, errors.New("inclusive Blocks can't reference uncles")
+		case !pGhost.Inclusive && len(pBlock.References) > 0:
+			return false, errors.New("only inclusive Blocks can reference other leaves")
 		// State transition check
-		case !verifyStateTransition(pBlock):
+		case pGhost.isTip(pBlock.Parent) && !verifyStateTransition(pBlock, pGhost.State, pGhost.immatureCoinbase()):
 			return false, errors.New("the transactions are inconsistent with the state")
+		// Uncles and rewards
 		default:
+			if err := pGhost.validateUncles(pBlock); err != nil {
+				return false, err
+			}
 			return true, nil
 		}
 	} else {
@@ -71,13 +139,81 @@ func (pGhost *Ghost) IsBlockValid(pBlock *Block) (bool, error) {
 	}
 }
 
-// Generate Hash of a Block. Using Block header which includes Timestamp, Nonce,
-// previous Block Hash
+// Generate Hash of a Block with its proof of work function. Using Block header which includes Timestamp,
+// Nonce, previous Block Hash, the Miner, the function, the Difficulty, the BlockNumber, the Transactions,
+// the hashes of the uncles and the referenced Blocks, so that none of them can be changed without
+// redoing the proof of work. The Timestamp is included with its canonical encoding. Panics when the
+// function is unknown, which the validation of a Block rules out before hashing it
 func CalculateHash(pBlock Block) string {
-	bHeader := strconv.Itoa(pBlock.Nonce) + pBlock.Timestamp.String() + pBlock.HashPreviousBlock
-	Hash := sha256.New()
-	Hash.Write([]byte(bHeader))
-	return hex.EncodeToString(Hash.Sum(nil))
+	bHeader := strconv.Itoa(pBlock.Nonce) + components.EncodeTimestamp(pBlock.Timestamp) + pBlock.HashPreviousBlock + pBlock.Miner + pBlock.Algorithm +
+		strconv.Itoa(pBlock.Difficulty) + strconv.Itoa(pBlock.BlockNumber)
+	for _, v := range pBlock.Transactions {
+		bHeader += v.Origin + v.SenderSignature + v.Destination + strconv.FormatFloat(v.Value, 'f', -1, 64) + strconv.FormatInt(v.Nonce, 10)
+	}
+	for _, v := range pBlock.Uncles {
+		bHeader += v
+	}
+	for _, v := range pBlock.References {
+		bHeader += v
+	}
+	algorithm, err := components.ProofOfWorkByName(pBlock.Algorithm)
+	check(err)
+	return algorithm.Sum([]byte(bHeader))
+}
+
+// Whether the proof of work function with the given name is known
+func isAlgorithmKnown(pName string) bool {
+	_, err := components.ProofOfWorkByName(pName)
+	return err == nil
+}
+
+// Median Timestamp of the last Blocks of the chain ending in the given Block. Its ancestors are taken
+// from the structure, so the Block itself doesn't need to be part of it
+func (pGhost *Ghost) MedianTimePast(pBlock *Block) time.Time {
+	timestamps := []time.Time{pBlock.Timestamp}
+	for theBlock, ok := pGhost.knownBlocks[pBlock.HashPreviousBlock]; ok && len(timestamps) < components.MedianTimeBlocks; theBlock, ok = pGhost.knownBlocks[theBlock.HashPreviousBlock] {
+		timestamps = append(timestamps, theBlock.Timestamp)
+	}
+	return components.MedianTime(timestamps)
+}
+
+// Timestamp for a child of the given Block, the time of the network-adjusted clock unless it isn't
+// after the median time past
+func (pGhost *Ghost) NextTimestamp(pParent *Block) time.Time {
+	rTimestamp := pGhost.Clock.Now()
+	if medianTime := pGhost.MedianTimePast(pParent); !rTimestamp.After(medianTime) {
+		rTimestamp = medianTime.Add(time.Nanosecond)
+	}
+	return rTimestamp
+}
+
+// Proof of work, calculating the hash of the Block
+func MineBlock(pBlock *Block) {
+	_, _ = MineBlockContext(context.Background(), pBlock)
+}
+
+// Proof of work, searching the nonce with the mining workers until it is found or the context is
+// cancelled. The nonce and the hash of the Block are only set when the search succeeds
+func MineBlockContext(pContext context.Context, pBlock *Block) (components.MiningResult, error) {
+	header := *pBlock
+	rResult, err := components.Mine(pContext, func(pNonce int) string {
+		theBlock := header
+		theBlock.Nonce = pNonce
+		return CalculateHash(theBlock)
+	}, func(pHash string) bool {
+		return IsHashValid(pHash, header.Difficulty)
+	})
+	if err == nil {
+		pBlock.Nonce = rResult.Nonce
+		pBlock.Hash = rResult.Hash
+	}
+	return rResult, err
+}
+
+// Amount of work a Block with the given difficulty represents. Since the difficulty is the number
+// of leading hexadecimal zeroes, each extra zero requires sixteen times more hashes on average
+func BlockWork(pDifficulty int) int {
+	return 1 << (4 * uint(pDifficulty))
 }
 
 // Checks whether the hash is valid by checking if it starts with the given number of zeroes specified in the difficulty
@@ -87,40 +223,59 @@ func IsHashValid(hash string, difficulty int) bool {
 	return strings.HasPrefix(hash, prefix)
 }
 
-// Receives a state and then performs the transactions and returns the modified state when it is valid
-func verifyStateTransition(pBlock *Block) bool {
+// Receives a state and checks whether the transactions of the block can be performed in order
+// over it, where the locked amount of each account can't be spent. The coinbase transactions mint
+// their value, the rewards of the block are checked with its uncles. The given state isn't modified
+func verifyStateTransition(pBlock *Block, pState map[string]*Account, pLocked map[string]float64) bool {
 	// TODO: Checking validity of accounts
-	// Initialize state
-	var modifiedState = pBlock.Parent.RecentState
+	// Balances of the accounts that have been modified by the transactions
+	modifiedBalances := make(map[string]float64, 0)
+	balance := func(pAddress string) float64 {
+		if value, ok := modifiedBalances[pAddress]; ok {
+			return value
+		}
+		if theAccount, ok := pState[pAddress]; ok {
+			return theAccount.Balance
+		}
+		return 0
+	}
 	// Go through the lists of transactions
 	for _, v := range pBlock.Transactions {
-		// Create if necessary an account for the sender
-		if _, ok := modifiedState[v.Origin]; !ok {
-			senderAccount := CreateAccount(v.Origin)
-			modifiedState[v.Origin] = &senderAccount
-		}
 		switch true {
 		// Checking transaction is valid and well formed
 		case v.Value < 0:
 			return false
+		case components.IsCoinbase(v):
+			modifiedBalances[v.Destination] = balance(v.Destination) + v.Value
+			continue
 		// Signature of sender does not match owner
 		// TODO: Calculating signature
-		// Referenced UTXO is not in the state
-		case modifiedState[v.Origin].Balance < v.Value:
+		// Referenced UTXO is not in the state, or it is a reward that hasn't matured
+		case balance(v.Origin)-pLocked[v.Origin] < v.Value:
 			return false
 		}
-		// Update state
-		modifiedState[v.Origin].Balance -= v.Value
-		// Check that the recipient of the UTXO exists, if not, create it
-		if _, ok := modifiedState[v.Destination]; ok {
-			modifiedState[v.Destination].Balance += v.Value
-		} else {
-			theAccount := CreateAccount(v.Destination)
-			modifiedState[v.Destination] = &theAccount
-			modifiedState[v.Destination].Balance = v.Value
-		}
+		modifiedBalances[v.Origin] = balance(v.Origin) - v.Value
+		modifiedBalances[v.Destination] = balance(v.Destination) + v.Value
 	}
-	// Update the state
-	pBlock.RecentState = modifiedState
 	return true
 }
+
+// Performs a transaction that has already been verified over the state. The coinbase only credits
+// its destination
+func applyTransaction(pState map[string]*Account, pTransaction components.Transaction) {
+	if !components.IsCoinbase(pTransaction) {
+		// Create if necessary an account for the sender
+		if _, ok := pState[pTransaction.Origin]; !ok {
+			senderAccount := CreateAccount(pTransaction.Origin)
+			pState[pTransaction.Origin] = &senderAccount
+		}
+		// Update state
+		pState[pTransaction.Origin].Balance -= pTransaction.Value
+	}
+	// Check that the recipient of the UTXO exists, if not, create it
+	if _, ok := pState[pTransaction.Destination]; !ok {
+		theAccount := CreateAccount(pTransaction.Destination)
+		pState[pTransaction.Destination] = &theAccount
+	}
+	pState[pTransaction.Destination].Balance += pTransaction.Value
+}
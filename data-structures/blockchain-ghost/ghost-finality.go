@@ -0,0 +1,304 @@
+package ghost
+
+import (
+	"errors"
+	"github.com/gcubillos/isis-3007-distributed-ledger/data-structures/shared-components"
+	"strconv"
+)
+
+// *** Structs ***
+
+// Number of heights between two checkpoints. The genesis Block is the first checkpoint, and every
+// Block whose height is a multiple of the interval is a checkpoint as well
+var CheckpointInterval = 4
+
+// Conditions under which a validator can be slashed, following Casper FFG
+const (
+	// The validator voted for two different targets of the same height
+	DoubleVote = "double-vote"
+	// The source and target of one vote of the validator are strictly between those of another one
+	SurroundVote = "surround-vote"
+)
+
+// What a checkpoint contains: the hash of the Block and its height in the tree
+type Checkpoint struct {
+	Hash   string
+	Height int
+}
+
+// What a vote of a validator contains: a link from a justified checkpoint to a checkpoint that
+// descends from it, signed by the validator, which is identified by its hexadecimal public key
+type FinalityVote struct {
+	Validator string
+	Source    Checkpoint
+	Target    Checkpoint
+	Signature string
+}
+
+// Proof that a validator broke one of the slashing conditions: two of its votes and the condition
+type SlashingEvidence struct {
+	Condition string
+	First     FinalityVote
+	Second    FinalityVote
+}
+
+// What the finality overlay contains
+// Stakes are the stakes of the validators, indexed by their keys. Votes contains every vote received,
+// in the order they were added, and each vote is sent to the other nodes once it is cast. The rest is
+// computed by each node from the votes: the justified checkpoints, the last justified and finalized
+// ones, and the evidence of the validators that broke a slashing condition.
+// A checkpoint is justified when validators with at least 2/3 of the stake vote for a link from a
+// justified checkpoint to it, and a justified checkpoint is finalized when such a link goes from it to
+// the next checkpoint. The genesis Block is justified and finalized from the start
+type Finality struct {
+	Stakes        map[string]float64
+	Votes         []FinalityVote
+	Justified     map[string]bool    `json:"-"`
+	LastJustified Checkpoint         `json:"-"`
+	LastFinalized Checkpoint         `json:"-"`
+	Slashings     []SlashingEvidence `json:"-"`
+	links         map[string]map[string]bool
+	counted       map[string]bool
+	pending       []FinalityVote
+}
+
+// *** Constructors ***
+
+// Create the overlay for the given validators and stakes, with the given genesis Block as the first
+// justified and finalized checkpoint
+func CreateFinality(pGenesisHash string, pStakes map[string]float64) Finality {
+	genesis := Checkpoint{Hash: pGenesisHash, Height: 0}
+	rFinality := Finality{
+		Stakes:        make(map[string]float64, len(pStakes)),
+		Votes:         make([]FinalityVote, 0),
+		Justified:     map[string]bool{pGenesisHash: true},
+		LastJustified: genesis,
+		LastFinalized: genesis,
+		Slashings:     make([]SlashingEvidence, 0),
+		links:         make(map[string]map[string]bool),
+		counted:       make(map[string]bool),
+		pending:       make([]FinalityVote, 0),
+	}
+	for k, v := range pStakes {
+		rFinality.Stakes[k] = v
+	}
+	return rFinality
+}
+
+// Create the structure with only the genesis Block and the finality overlay for the given validators
+func CreateGhostWithFinality(pGenesisBlock Block, pForkChoice components.ForkChoice, pStakes map[string]float64) Ghost {
+	rGhost := CreateGhost(pGenesisBlock, pForkChoice)
+	theFinality := CreateFinality(pGenesisBlock.Hash, pStakes)
+	rGhost.Finality = &theFinality
+	return rGhost
+}
+
+// *** Methods ***
+
+// Data signed by the validator of the vote
+func (pVote *FinalityVote) signedData() string {
+	return pVote.Source.Hash + strconv.Itoa(pVote.Source.Height) + pVote.Target.Hash + strconv.Itoa(pVote.Target.Height)
+}
+
+// Sign the vote with the given function, which signs data with the key of the validator
+func (pVote *FinalityVote) Sign(pSign func([]byte) string) {
+	pVote.Signature = pSign([]byte(pVote.signedData()))
+}
+
+// Identifies the link between the source and the target of the vote
+func (pVote *FinalityVote) link() string {
+	return pVote.Source.Hash + "/" + pVote.Target.Hash
+}
+
+// Identifies the vote, which is signed deterministically, so a vote received twice is only counted once
+func (pVote *FinalityVote) id() string {
+	return pVote.Validator + "/" + pVote.link()
+}
+
+// Whether the two votes of the same validator break one of the slashing conditions, and which one
+func SlashingCondition(pFirst, pSecond FinalityVote) (string, bool) {
+	switch true {
+	case pFirst.Validator != pSecond.Validator || pFirst.link() == pSecond.link():
+		return "", false
+	case pFirst.Target.Height == pSecond.Target.Height:
+		return DoubleVote, true
+	case pFirst.Source.Height < pSecond.Source.Height && pSecond.Target.Height < pFirst.Target.Height,
+		pSecond.Source.Height < pFirst.Source.Height && pFirst.Target.Height < pSecond.Target.Height:
+		return SurroundVote, true
+	}
+	return "", false
+}
+
+// Create a copy of the overlay that doesn't share any of its maps or lists with the original one
+func (pFinality *Finality) Copy() Finality {
+	rFinality := *pFinality
+	rFinality.Stakes = make(map[string]float64, len(pFinality.Stakes))
+	rFinality.Justified = make(map[string]bool, len(pFinality.Justified))
+	rFinality.links = make(map[string]map[string]bool, len(pFinality.links))
+	rFinality.counted = make(map[string]bool, len(pFinality.counted))
+	rFinality.Votes = append([]FinalityVote(nil), pFinality.Votes...)
+	rFinality.Slashings = append([]SlashingEvidence(nil), pFinality.Slashings...)
+	rFinality.pending = append([]FinalityVote(nil), pFinality.pending...)
+	for k, v := range pFinality.Stakes {
+		rFinality.Stakes[k] = v
+	}
+	for k, v := range pFinality.Justified {
+		rFinality.Justified[k] = v
+	}
+	for k, v := range pFinality.links {
+		rFinality.links[k] = make(map[string]bool, len(v))
+		for l, w := range v {
+			rFinality.links[k][l] = w
+		}
+	}
+	for k, v := range pFinality.counted {
+		rFinality.counted[k] = v
+	}
+	return rFinality
+}
+
+// Sum of the stakes of the validators
+func (pFinality *Finality) totalStake() float64 {
+	rTotal := 0.0
+	for _, v := range pFinality.Stakes {
+		rTotal += v
+	}
+	return rTotal
+}
+
+// Add a vote to the overlay. The vote must be signed by a validator and link two checkpoints of
+// increasing heights. When it breaks a slashing condition with a previous vote of the
+// same validator, the evidence is kept and the vote doesn't count. Votes whose source isn't justified
+// yet, or whose checkpoints aren't part of the tree, wait until they are
+func (pGhost *Ghost) AddVote(pVote FinalityVote) error {
+	theFinality := pGhost.Finality
+	switch true {
+	case theFinality == nil:
+		return errors.New("the structure doesn't have a finality overlay")
+	case theFinality.Stakes[pVote.Validator] <= 0:
+		return errors.New("the vote isn't from a validator")
+	case pVote.Source.Height%CheckpointInterval != 0 || pVote.Target.Height%CheckpointInterval != 0:
+		return errors.New("the vote doesn't link two checkpoints")
+	case pVote.Source.Height >= pVote.Target.Height:
+		return errors.New("the target of the vote isn't after its source")
+	case !components.VerifySignature(pVote.Validator, pVote.signedData(), pVote.Signature):
+		return errors.New("signature of the vote is not valid")
+	}
+	if theFinality.counted[pVote.id()] {
+		return nil
+	}
+	theFinality.counted[pVote.id()] = true
+	for _, v := range theFinality.Votes {
+		if condition, ok := SlashingCondition(v, pVote); ok {
+			theFinality.Votes = append(theFinality.Votes, pVote)
+			theFinality.Slashings = append(theFinality.Slashings, SlashingEvidence{Condition: condition, First: v, Second: pVote})
+			return errors.New("the vote breaks the " + condition + " slashing condition")
+		}
+	}
+	theFinality.Votes = append(theFinality.Votes, pVote)
+	theFinality.pending = append(theFinality.pending, pVote)
+	pGhost.tallyVotes()
+	return nil
+}
+
+// Count the pending votes whose checkpoints are part of the tree and whose source is justified, until
+// no more checkpoints are justified. Votes for checkpoints that conflict with the finalized one are dropped
+func (pGhost *Ghost) tallyVotes() {
+	theFinality := pGhost.Finality
+	for progress := true; progress; {
+		progress = false
+		remaining := make([]FinalityVote, 0)
+		for _, v := range theFinality.pending {
+			sourceNode, sourceKnown := pGhost.Tree.Nodes[v.Source.Hash]
+			targetNode, targetKnown := pGhost.Tree.Nodes[v.Target.Hash]
+			switch true {
+			case !sourceKnown || !targetKnown:
+				remaining = append(remaining, v)
+				continue
+			case sourceNode.Height != v.Source.Height || targetNode.Height != v.Target.Height,
+				!pGhost.Tree.IsAncestor(v.Source.Hash, v.Target.Hash),
+				!pGhost.Tree.IsAncestor(theFinality.LastFinalized.Hash, v.Target.Hash):
+				continue
+			case !theFinality.Justified[v.Source.Hash]:
+				remaining = append(remaining, v)
+				continue
+			}
+			if _, ok := theFinality.links[v.link()]; !ok {
+				theFinality.links[v.link()] = make(map[string]bool)
+			}
+			theFinality.links[v.link()][v.Validator] = true
+			if pGhost.checkLink(v.Source, v.Target) {
+				progress = true
+			}
+		}
+		theFinality.pending = remaining
+	}
+}
+
+// Justify the target of a link once validators with at least 2/3 of the stake voted for it, and
+// finalize its source if the target is the next checkpoint. Returns whether the target was justified now
+func (pGhost *Ghost) checkLink(pSource, pTarget Checkpoint) bool {
+	theFinality := pGhost.Finality
+	if theFinality.Justified[pTarget.Hash] {
+		return false
+	}
+	linkStake := 0.0
+	for k := range theFinality.links[pSource.Hash+"/"+pTarget.Hash] {
+		linkStake += theFinality.Stakes[k]
+	}
+	if 3*linkStake < 2*theFinality.totalStake() {
+		return false
+	}
+	theFinality.Justified[pTarget.Hash] = true
+	if pTarget.Height > theFinality.LastJustified.Height {
+		theFinality.LastJustified = pTarget
+	}
+	if pTarget.Height == pSource.Height+CheckpointInterval && pSource.Height > theFinality.LastFinalized.Height {
+		pGhost.finalize(pSource)
+	}
+	return true
+}
+
+// Make the given checkpoint the last finalized one. The Blocks that don't descend from it, other than
+// its ancestors, are marked as invalid in the tree so that the fork-choice rule never chooses them, and
+// the current chain moves away from them if needed
+func (pGhost *Ghost) finalize(pCheckpoint Checkpoint) {
+	pGhost.Finality.LastFinalized = pCheckpoint
+	path := append([]string{pGhost.Tree.Genesis}, pGhost.Tree.PathFrom(pGhost.Tree.Genesis, pCheckpoint.Hash)...)
+	for i := 0; i < len(path)-1; i++ {
+		for _, v := range pGhost.Tree.Nodes[path[i]].Children {
+			if v != path[i+1] {
+				pGhost.Tree.MarkInvalid(v)
+			}
+		}
+	}
+	_ = pGhost.updateTip()
+}
+
+// Whether a new child of the given Block would descend from the last finalized checkpoint. Always
+// true without the finality overlay
+func (pGhost *Ghost) isAfterFinalized(pParentHash string) bool {
+	return pGhost.Finality == nil || pGhost.Tree.IsAncestor(pGhost.Finality.LastFinalized.Hash, pParentHash)
+}
+
+// Vote that the given validator would cast over the current chain: from the last justified checkpoint
+// of the chain to its last checkpoint. Returns false when the last checkpoint of the chain is the last
+// justified one, since there is nothing to vote for
+func (pGhost *Ghost) NextVote(pValidator string) (FinalityVote, bool) {
+	if pGhost.Finality == nil {
+		return FinalityVote{}, false
+	}
+	var rVote FinalityVote
+	rVote.Validator = pValidator
+	for i := (len(pGhost.CurrentChain) - 1) / CheckpointInterval * CheckpointInterval; i >= 0; i -= CheckpointInterval {
+		current := Checkpoint{Hash: pGhost.CurrentChain[i].Hash, Height: i}
+		if rVote.Target.Hash == "" {
+			rVote.Target = current
+		}
+		if pGhost.Finality.Justified[current.Hash] {
+			rVote.Source = current
+			break
+		}
+	}
+	return rVote, rVote.Source.Hash != rVote.Target.Hash
+}
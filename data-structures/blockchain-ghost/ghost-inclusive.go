@@ -0,0 +1,145 @@
+package ghost
+
+import (
+	"github.com/gcubillos/isis-3007-distributed-ledger/data-structures/shared-components"
+	"sort"
+)
+
+// *** Structs ***
+
+// Fraction of the Block reward paid to the miner of a Block outside the current chain when it is
+// included. It is smaller than the full reward so that miners still prefer extending the current chain
+var OffChainRewardShare = 0.5
+
+// *** Methods ***
+
+// Leaves of the tree that a new child of the given parent references when the protocol is
+// inclusive. The parent itself is left out, as well as the leaves already included by the parent or
+// one of its ancestors, which stay leaves of the tree forever. The hashes are sorted so that the
+// Block is the same regardless of the order in which the leaves were received
+func (pGhost *Ghost) SelectReferences(pParentHash string) []string {
+	rReferences := make([]string, 0)
+	for _, v := range pGhost.Tree.Leaves() {
+		if includer, ok := pGhost.includedIn[v]; v == pParentHash || ok && pGhost.Tree.IsAncestor(includer, pParentHash) {
+			continue
+		}
+		rReferences = append(rReferences, v)
+	}
+	sort.Strings(rReferences)
+	return rReferences
+}
+
+// Whether the parent of the Block and the Blocks it references, as uncles or other leaves, are part
+// of the structure
+func (pGhost *Ghost) areReferencesKnown(pBlock *Block) bool {
+	if _, ok := pGhost.knownBlocks[pBlock.HashPreviousBlock]; !ok {
+		return false
+	}
+	for _, v := range append(append([]string(nil), pBlock.Uncles...), pBlock.References...) {
+		if _, ok := pGhost.knownBlocks[v]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// Transactions of a Block other than its rewards, which always go at the end of the Block
+func userTransactions(pBlock *Block) []components.Transaction {
+	numberTransactions := len(pBlock.Transactions)
+	for numberTransactions > 0 && components.IsCoinbase(pBlock.Transactions[numberTransactions-1]) {
+		numberTransactions--
+	}
+	return pBlock.Transactions[:numberTransactions]
+}
+
+// Blocks outside the current chain that are included when the given Block is connected to it.
+// They are the Blocks in the past of the Block, reached through parents and references, that are
+// neither its ancestors nor included by one of them. They are ordered with a depth-first traversal
+// that visits the parent of each Block first and then its references, so every Block goes after
+// the Blocks in its past and all nodes get the same order
+func (pGhost *Ghost) offChainBlocks(pBlock *Block) []string {
+	rOrder := make([]string, 0)
+	visited := make(map[string]bool)
+	var visit func(pHash string)
+	visit = func(pHash string) {
+		if visited[pHash] {
+			return
+		}
+		visited[pHash] = true
+		if _, ok := pGhost.includedIn[pHash]; ok || pGhost.Tree.IsAncestor(pHash, pBlock.HashPreviousBlock) {
+			return
+		}
+		theBlock := pGhost.knownBlocks[pHash]
+		visit(theBlock.HashPreviousBlock)
+		for _, v := range theBlock.References {
+			visit(v)
+		}
+		rOrder = append(rOrder, pHash)
+	}
+	for _, v := range pBlock.References {
+		visit(v)
+	}
+	return rOrder
+}
+
+// Apply the transactions of the Blocks outside the current chain that the given Block includes,
+// after the ones of the Block itself. Each transaction is applied only if it is consistent with the
+// state at that point and doesn't spend the locked rewards, otherwise it is rejected, and the miner of
+// each included Block receives its share of the reward. The given function registers in the journal
+// an account before it changes
+func (pGhost *Ghost) includeOffChainBlocks(pBlock *Block, pRecord func(string), pLocked map[string]float64) {
+	included := pGhost.offChainBlocks(pBlock)
+	rejected := make([]components.Transaction, 0)
+	apply := func(pTransaction components.Transaction) {
+		if !components.IsCoinbase(pTransaction) {
+			pRecord(pTransaction.Origin)
+		}
+		pRecord(pTransaction.Destination)
+		applyTransaction(pGhost.State, pTransaction)
+	}
+	for _, v := range included {
+		theBlock := pGhost.knownBlocks[v]
+		for _, w := range userTransactions(theBlock) {
+			if verifyStateTransition(&Block{Transactions: []components.Transaction{w}}, pGhost.State, pLocked) {
+				apply(w)
+			} else {
+				rejected = append(rejected, w)
+			}
+		}
+		apply(pGhost.offChainReward(theBlock))
+		pGhost.includedIn[v] = pBlock.Hash
+	}
+	pGhost.Included[pBlock.Hash] = included
+	pGhost.Rejected[pBlock.Hash] = rejected
+}
+
+// Coinbase that mints the share of the reward of a Block outside the current chain once it is included,
+// which depends on the height of the Block itself
+func (pGhost *Ghost) offChainReward(pBlock *Block) components.Transaction {
+	height := pGhost.Tree.Nodes[pBlock.Hash].Height
+	return components.CreateCoinbase(pBlock.Miner, OffChainRewardShare*Subsidy.Subsidy(height), height)
+}
+
+// Remove the record of the Blocks included by the given Block, once it is disconnected
+func (pGhost *Ghost) excludeOffChainBlocks(pBlock *Block) {
+	for _, v := range pGhost.Included[pBlock.Hash] {
+		delete(pGhost.includedIn, v)
+	}
+	delete(pGhost.Included, pBlock.Hash)
+	delete(pGhost.Rejected, pBlock.Hash)
+}
+
+// Number of transactions, other than rewards, applied by the current chain. With the inclusive
+// protocol, the ones of the Blocks included that were not rejected count as well
+func (pGhost *Ghost) ConfirmedTransactions() int {
+	rConfirmed := 0
+	for i := range pGhost.CurrentChain {
+		theBlock := &pGhost.CurrentChain[i]
+		rConfirmed += len(userTransactions(theBlock))
+		for _, v := range pGhost.Included[theBlock.Hash] {
+			rConfirmed += len(userTransactions(pGhost.knownBlocks[v]))
+		}
+		rConfirmed -= len(pGhost.Rejected[theBlock.Hash])
+	}
+	return rConfirmed
+}
@@ -3,10 +3,12 @@ package ghost
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/gcubillos/isis-3007-distributed-ledger/data-structures/shared-components"
 	"github.com/perlin-network/noise"
 	"github.com/perlin-network/noise/kademlia"
+	"strings"
 	"sync"
 	"time"
 )
@@ -14,11 +16,30 @@ import (
 // Mutual exclusion variable
 var mutex = &sync.Mutex{}
 
+// Time a node waits for a peer to acknowledge the Blocks and votes it sends
+var RequestTimeout = 2 * time.Second
+
 // Declaration of node in the network
-// Contains the underlying data structure as well as the node from the noise library
+// Contains the underlying data structure as well as the node from the noise library.
+// The new Blocks and votes are broadcast to the peers in the Kademlia table of the node, which forward
+// the ones that are new to them to their own peers. Mining keeps the hashes computed by the node while
+// mining, and tipListeners the functions called once the tip of the current chain changes, which
+// interrupt the Blocks being mined.
+// When the structure has the finality overlay and the key of the node is one of the validators, the
+// node votes every time its current chain reaches a new checkpoint. LastVote is the last vote it cast,
+// which the following ones must not conflict with.
+// The miner produces Blocks in the background on top of the current chain, carrying the pending
+// transactions, the ones submitted to the node that haven't been accepted yet
 type NodeGhost struct {
 	DataStructure Ghost
 	Node          *noise.Node
+	LastVote      FinalityVote
+	Mining        components.MiningStats
+	protocol      *kademlia.Protocol
+	tipListeners  map[int]func()
+	nextListener  int
+	miner         *components.BackgroundMiner
+	pending       []components.Transaction
 }
 
 // *** Constructors ***
@@ -27,11 +48,13 @@ type NodeGhost struct {
 // protocol. The current state of the blockchain is passed to the Node and a first peer
 // to connect to the network
 func GenerateNode(pCurrentGhost Ghost, pNode *noise.Node) *NodeGhost {
-	// Create structure
+	// Create structure. The structure is copied so that the nodes don't share their state
+	mutex.Lock()
 	thisNode := NodeGhost{
-		DataStructure: pCurrentGhost,
+		DataStructure: pCurrentGhost.Copy(),
 		Node:          nil,
 	}
+	mutex.Unlock()
 	// Create network node
 	networkNode, err := noise.NewNode()
 	check(err)
@@ -43,7 +66,7 @@ func GenerateNode(pCurrentGhost Ghost, pNode *noise.Node) *NodeGhost {
 	// Assign the way the node will handle the requests for updates in the chain
 	networkNode.Handle(func(ctx noise.HandlerContext) error {
 		if !ctx.IsRequest() {
-			return ctx.Send([]byte(""))
+			return nil
 		}
 
 		receivedGhost := Ghost{
@@ -53,17 +76,14 @@ func GenerateNode(pCurrentGhost Ghost, pNode *noise.Node) *NodeGhost {
 		// TODO: Avoid having the unmarshal error when discovering peers. Check the kademlia discover method.
 		// Just change the context received. Uncomment to view the error
 		if err := json.Unmarshal(ctx.Data(), &receivedGhost); err == nil {
-			thisNode.DataStructure.FindGHOST(receivedGhost)
-			fmt.Printf("current structure Create Node \n")
-			for _, v := range thisNode.DataStructure.Blocks {
-				fmt.Printf("a block %v \n", v)
-
-			}
+			fmt.Printf("current structure Create Node \n%v", thisNode.receive(receivedGhost))
 		} else {
-			// fmt.Printf("trouble unmarshalling Create Node. Error: %v Blockchain: %v \n", err, receivedGhost)
+			// The messages used to discover peers are answered by the Kademlia protocol, answering them
+			// here as well would make the node that sent them miss the peers it asked for
+			return nil
 		}
 
-		return ctx.Send([]byte(""))
+		return ctx.Send([]byte(components.EncodeTimestamp(thisNode.DataStructure.Clock.Local())))
 	})
 
 	// Make the node listen to the network
@@ -75,8 +95,9 @@ func GenerateNode(pCurrentGhost Ghost, pNode *noise.Node) *NodeGhost {
 
 	// Discover the other nodes present in the network at the moment
 	ka.Discover()
-	// Assign the network node to the node
+	// Assign the network node and the protocol to the node
 	thisNode.Node = networkNode
+	thisNode.protocol = ka
 
 	return &thisNode
 }
@@ -84,10 +105,11 @@ func GenerateNode(pCurrentGhost Ghost, pNode *noise.Node) *NodeGhost {
 // Create the initial node
 // The genesis block is passed to the Node
 // The amount of available currency is passed to the node
-func CreateInitialNode(pGenesisBlock Block) *NodeGhost {
+// The fork-choice rule is shared by the nodes created afterwards from this node's structure
+func CreateInitialNode(pGenesisBlock Block, pForkChoice components.ForkChoice) *NodeGhost {
 	// Create structure
 	thisNode := NodeGhost{
-		DataStructure: Ghost{[]Block{pGenesisBlock}, []Block{pGenesisBlock}},
+		DataStructure: CreateGhost(pGenesisBlock, pForkChoice),
 		Node:          nil,
 	}
 	// Create network node
@@ -101,7 +123,7 @@ func CreateInitialNode(pGenesisBlock Block) *NodeGhost {
 	// Assign the way the node will handle the requests for updates in the chain
 	networkNode.Handle(func(ctx noise.HandlerContext) error {
 		if !ctx.IsRequest() {
-			return ctx.Send([]byte(""))
+			return nil
 		}
 
 		receivedGhost := Ghost{
@@ -111,25 +133,23 @@ func CreateInitialNode(pGenesisBlock Block) *NodeGhost {
 		// TODO: Avoid having the unmarshal error when discovering peers. Check the kademlia discover method.
 		// Just change the context received. Uncomment to view the error
 		if err := json.Unmarshal(ctx.Data(), &receivedGhost); err == nil {
-			thisNode.DataStructure.FindGHOST(receivedGhost)
 			// TODO: Pretty printing the results using a JSON format
-			fmt.Printf("current structure InitialNode \n")
-			for _, v := range thisNode.DataStructure.Blocks {
-				fmt.Printf("a block %v \n", v)
-
-			}
+			fmt.Printf("current structure InitialNode \n%v", thisNode.receive(receivedGhost))
 		} else {
-			// fmt.Printf("trouble unmarshalling InitialNode. Error: %v Blockchain: %v \n", err, receivedGhost)
+			// The messages used to discover peers are answered by the Kademlia protocol, answering them
+			// here as well would make the node that sent them miss the peers it asked for
+			return nil
 		}
 
-		return ctx.Send([]byte(""))
+		return ctx.Send([]byte(components.EncodeTimestamp(thisNode.DataStructure.Clock.Local())))
 	})
 
 	// Make the node listen to the network
 	check(networkNode.Listen())
 
-	// Assign the network node to the node
+	// Assign the network node and the protocol to the node
 	thisNode.Node = networkNode
+	thisNode.protocol = ka
 
 	return &thisNode
 }
@@ -137,53 +157,335 @@ func CreateInitialNode(pGenesisBlock Block) *NodeGhost {
 // *** Methods ***
 
 // Creating a standard Block in the network and broadcasting it
-func GenerateBlock(pNode *NodeGhost, pParent *Block, pTransactions []components.Transaction) Block {
-
-	var nBlock Block
+// The Block references as uncles the stale Blocks that are eligible, or every other leaf with the
+// inclusive protocol, and includes the transactions that reward its miner and the miners of the uncles.
+// The mining is interrupted when the tip of the current chain of the node changes. The Block is then
+// returned without hash, and it isn't added nor broadcast
+func (pNode *NodeGhost) GenerateBlock(pParent *Block, pTransactions []components.Transaction) Block {
+	rBlock, _ := pNode.GenerateBlockContext(context.Background(), pParent, pTransactions)
+	return rBlock
+}
 
-	// Adding the transaction that gives the "miner" a reward for doing the work
-	// TODO: Revise the rewards whether it is belonging to the main chain or not
-	rewardTransaction := components.CreateTransaction("main", "main", pNode.Node.Addr(), 1)
-	pTransactions = append(pTransactions, rewardTransaction)
+// Creating a standard Block in the network and broadcasting it, giving up once the context is cancelled.
+// The error is the one of the context when the Block couldn't be mined, or the reason why it couldn't be added
+func (pNode *NodeGhost) GenerateBlockContext(pContext context.Context, pParent *Block, pTransactions []components.Transaction) (Block, error) {
 
 	// Basic information in the block
-	nBlock.Parent = pParent
-	nBlock.Timestamp = time.Now()
-	nBlock.HashPreviousBlock = pParent.Hash
-	nBlock.Difficulty = pParent.Difficulty
-	nBlock.Transactions = pTransactions
-	nBlock.BlockNumber = len(pNode.DataStructure.Blocks) + 1
-
-	// Proof of work, calculating the hash
-	for i := 0; ; i++ {
-		nBlock.Nonce = i
-		if !IsHashValid(CalculateHash(nBlock), nBlock.Difficulty) {
+	mutex.Lock()
+	nBlock := pNode.DataStructure.CreateBlock(pParent, pNode.Node.Addr(), pTransactions)
+	mutex.Unlock()
+
+	// Proof of work, calculating the hash. A Block whose parent stopped being the tip would hardly
+	// become part of the current chain, so the mining stops as well when the tip changes
+	ctx, cancel := context.WithCancel(pContext)
+	defer cancel()
+	removeListener := pNode.onNewTip(cancel)
+	result, err := MineBlockContext(ctx, &nBlock)
+	removeListener()
+	mutex.Lock()
+	pNode.Mining.Add(result)
+	mutex.Unlock()
+	if err != nil {
+		return nBlock, err
+	}
+
+	// Check that the block is valid and add it to the current structure. It becomes part of the
+	// current chain if the fork-choice rule chooses it
+	mutex.Lock()
+	previousTip := pNode.tip()
+	err = pNode.DataStructure.AddBlock(nBlock)
+	votes := make([]FinalityVote, 0)
+	if err == nil && pNode.vote() {
+		votes = append(votes, pNode.LastVote)
+	}
+	if pNode.tip() != previousTip {
+		pNode.notifyNewTip()
+	}
+	mutex.Unlock()
+	if err == nil {
+		pNode.relay([]Block{nBlock}, votes)
+	}
+
+	return nBlock, err
+}
+
+// Hash of the tip of the current chain. Must be called holding the mutex
+func (pNode *NodeGhost) tip() string {
+	return pNode.DataStructure.CurrentChain[len(pNode.DataStructure.CurrentChain)-1].Hash
+}
+
+// Register a function to be called the next time the tip of the current chain of the node changes.
+// Returns the function that removes it, in case the tip didn't change
+func (pNode *NodeGhost) onNewTip(pListener func()) func() {
+	mutex.Lock()
+	defer mutex.Unlock()
+	if pNode.tipListeners == nil {
+		pNode.tipListeners = make(map[int]func())
+	}
+	id := pNode.nextListener
+	pNode.nextListener++
+	pNode.tipListeners[id] = pListener
+	return func() {
+		mutex.Lock()
+		defer mutex.Unlock()
+		delete(pNode.tipListeners, id)
+	}
+}
+
+// Call the functions waiting for the tip of the current chain to change. Must be called holding the mutex
+func (pNode *NodeGhost) notifyNewTip() {
+	for k, v := range pNode.tipListeners {
+		v()
+		delete(pNode.tipListeners, k)
+	}
+}
+
+// Hashes per second computed by the node while mining. Safe to call while the node keeps mining
+func (pNode *NodeGhost) HashRate() float64 {
+	mutex.Lock()
+	defer mutex.Unlock()
+	return pNode.Mining.HashRate()
+}
+
+// Add a transaction to the ones the node puts in the Blocks it mines in the background
+func (pNode *NodeGhost) SubmitTransaction(pTransaction components.Transaction) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	pNode.pending = append(pNode.pending, pTransaction)
+}
+
+// Transactions for the next Block on top of the current chain, in the order they were submitted.
+// The ones already in the current chain are skipped, and forgotten once they are accepted or final.
+// The ones minting currency are forgotten as well, since only rewards can, while the ones the state
+// can't pay for yet, for instance because they spend rewards that haven't matured, are left for later
+// Blocks. Must be called holding the mutex
+func (pNode *NodeGhost) pendingTransactions() []components.Transaction {
+	heights := pNode.DataStructure.transactionHeights()
+	locked := pNode.DataStructure.immatureCoinbase()
+	chainLength := len(pNode.DataStructure.CurrentChain)
+	remaining := make([]components.Transaction, 0, len(pNode.pending))
+	rTransactions := make([]components.Transaction, 0)
+	for _, v := range pNode.pending {
+		if components.IsCoinbase(v) {
+			continue
+		}
+		if i, ok := heights[v.ID()]; ok {
+			final := pNode.DataStructure.Finality != nil && i <= pNode.DataStructure.Finality.LastFinalized.Height
+			confirmation := components.CreateConfirmation(v.ID(), pNode.DataStructure.CurrentChain[i].Hash, chainLength-i, final)
+			if !confirmation.IsAccepted() {
+				remaining = append(remaining, v)
+			}
 			continue
-		} else {
-			nBlock.Hash = CalculateHash(nBlock)
-			break
+		}
+		remaining = append(remaining, v)
+		if verifyStateTransition(&Block{Transactions: append(rTransactions, v)}, pNode.DataStructure.State, locked) {
+			rTransactions = append(rTransactions, v)
 		}
 	}
+	pNode.pending = remaining
+	return rTransactions
+}
 
-	// Check that the block is valid
-	if ok, err := pNode.DataStructure.IsBlockValid(&nBlock); ok {
-		check(err)
-		// Add the block to the current structure
-		mutex.Lock()
-		pNode.DataStructure.Blocks = append(pNode.DataStructure.Blocks, nBlock)
-		pNode.DataStructure.CurrentChain = append(pNode.DataStructure.CurrentChain, nBlock)
-		mutex.Unlock()
-		// Convert the chain so that it can be broadcast
-		bytes, err := json.Marshal(pNode.DataStructure)
-		check(err)
-		// Broadcast the chain to the network
-		for _, v := range pNode.Node.Outbound() {
-			_, err = pNode.Node.Request(context.TODO(), v.ID().Address, bytes)
-			check(err)
+// Produce a Block on top of the tip of the current chain with the pending transactions. Mining the
+// Block stops once the tip changes, returning ErrTipChanged so that the miner starts over on the new one
+// without waiting. The listener is registered before reading the tip so that a change in between isn't missed
+func (pNode *NodeGhost) mineOnTip(pContext context.Context) error {
+	ctx, cancel := context.WithCancel(pContext)
+	defer pNode.onNewTip(cancel)()
+	defer cancel()
+	mutex.Lock()
+	parent, _ := pNode.DataStructure.GetBlock(pNode.tip())
+	transactions := pNode.pendingTransactions()
+	mutex.Unlock()
+	_, err := pNode.GenerateBlockContext(ctx, parent, transactions)
+	if err != nil && ctx.Err() != nil && pContext.Err() == nil {
+		return components.ErrTipChanged
+	}
+	return err
+}
+
+// Miner of the node, created the first time it is needed
+func (pNode *NodeGhost) backgroundMiner() *components.BackgroundMiner {
+	mutex.Lock()
+	defer mutex.Unlock()
+	if pNode.miner == nil {
+		pNode.miner = components.CreateBackgroundMiner(pNode.mineOnTip)
+	}
+	return pNode.miner
+}
+
+// Start mining in the background, or resume if the mining was paused. The node keeps producing Blocks
+// on top of the tip chosen by the fork-choice rule until the mining is paused or stopped
+func (pNode *NodeGhost) StartMining() {
+	pNode.backgroundMiner().Start()
+}
+
+// Pause the mining in the background, abandoning the Block being mined
+func (pNode *NodeGhost) PauseMining() {
+	pNode.backgroundMiner().Pause()
+}
+
+// Stop the mining in the background. Once it returns, the node doesn't produce any other Block
+func (pNode *NodeGhost) StopMining() {
+	pNode.backgroundMiner().Stop()
+}
+
+// Whether the node is mining in the background, paused or stopped
+func (pNode *NodeGhost) MiningState() string {
+	return pNode.backgroundMiner().State()
+}
+
+// Number of Blocks the node produced while mining in the background
+func (pNode *NodeGhost) BlocksMined() int {
+	return pNode.backgroundMiner().Produced()
+}
+
+// Add the Blocks and votes received from a peer and vote if the current chain reached a new checkpoint.
+// The Blocks that were added and the votes that were new, the node's own included, are forwarded to
+// its peers, so that they reach the nodes outside the Kademlia table of the one that created them.
+// Returns the Blocks of the structure, one per line, read while holding the mutex
+func (pNode *NodeGhost) receive(pReceived Ghost) string {
+	mutex.Lock()
+	previousTip := pNode.tip()
+	added, votes := pNode.DataStructure.FindGHOST(pReceived)
+	if pNode.vote() {
+		votes = append(votes, pNode.LastVote)
+	}
+	if pNode.tip() != previousTip {
+		pNode.notifyNewTip()
+	}
+	var rDescription strings.Builder
+	for _, v := range pNode.DataStructure.Blocks {
+		rDescription.WriteString(fmt.Sprintf("a block %v \n", v))
+	}
+	mutex.Unlock()
+	if len(added) > 0 || len(votes) > 0 {
+		go pNode.relay(added, votes)
+	}
+	return rDescription.String()
+}
+
+// Send the given Blocks and votes to the peers in the Kademlia table of the node. Only what is new is
+// sent, since the whole structure would soon be larger than the messages the peers accept. The peers
+// answer with the time of their local clock, which adjusts the clock of the node. A peer that doesn't
+// answer doesn't stop the message from reaching the others, and the error names the peers that failed
+func (pNode *NodeGhost) broadcast(pBlocks []Block, pVotes []FinalityVote) error {
+	message := Ghost{Blocks: pBlocks}
+	if len(pVotes) > 0 {
+		message.Finality = &Finality{Votes: pVotes}
+	}
+	bytes, err := json.Marshal(message)
+	if err != nil {
+		return err
+	}
+	failed := make([]string, 0)
+	for _, v := range pNode.protocol.Table().Peers() {
+		ctx, cancel := context.WithTimeout(context.Background(), RequestTimeout)
+		sent := pNode.DataStructure.Clock.Local()
+		answer, err := pNode.Node.Request(ctx, v.Address, bytes)
+		cancel()
+		if err != nil {
+			failed = append(failed, v.Address+": "+err.Error())
+			continue
 		}
+		if peerTime, err := components.DecodeTimestamp(string(answer)); err == nil {
+			pNode.DataStructure.Clock.AddSample(v.ID.String(), peerTime, sent, pNode.DataStructure.Clock.Local())
+		}
+	}
+	if len(failed) > 0 {
+		return errors.New("couldn't reach the peers " + strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// Broadcast the given Blocks and votes, logging the peers that couldn't be reached. The Blocks are part
+// of the structure of the node already, so a peer that missed them doesn't make them fail
+func (pNode *NodeGhost) relay(pBlocks []Block, pVotes []FinalityVote) {
+	if err := pNode.broadcast(pBlocks, pVotes); err != nil {
+		fmt.Printf("broadcast incomplete: %v \n", err)
 	}
+}
+
+// Key that identifies the node as a validator of the finality overlay
+func (pNode *NodeGhost) Key() string {
+	return pNode.Node.ID().ID.String()
+}
+
+// Add the finality overlay to the structure of the node, with the given validators and stakes. Every
+// node of the network must enable it with the same validators
+func (pNode *NodeGhost) EnableFinality(pStakes map[string]float64) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	theFinality := CreateFinality(pNode.DataStructure.Tree.Genesis, pStakes)
+	pNode.DataStructure.Finality = &theFinality
+}
+
+// Cast the vote of the node over its current chain, if it is a validator and the chain reached a new
+// checkpoint. A vote that would break a slashing condition together with the last one is never cast,
+// which happens when the current chain moved to a branch with an older justified checkpoint.
+// Must be called holding the mutex. Returns whether a vote was cast
+func (pNode *NodeGhost) vote() bool {
+	theFinality := pNode.DataStructure.Finality
+	if theFinality == nil || theFinality.Stakes[pNode.Key()] <= 0 {
+		return false
+	}
+	nVote, ok := pNode.DataStructure.NextVote(pNode.Key())
+	switch true {
+	case !ok:
+		return false
+	case nVote.Target.Height <= pNode.LastVote.Target.Height || nVote.Source.Height < pNode.LastVote.Source.Height:
+		return false
+	}
+	nVote.Sign(func(pData []byte) string {
+		return pNode.Node.Sign(pData).String()
+	})
+	if err := pNode.DataStructure.AddVote(nVote); err != nil {
+		return false
+	}
+	pNode.LastVote = nVote
+	return true
+}
 
-	return nBlock
+// Last justified and last finalized checkpoints of the node. Safe to call while the node receives Blocks
+func (pNode *NodeGhost) Checkpoints() (Checkpoint, Checkpoint) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	if pNode.DataStructure.Finality == nil {
+		return Checkpoint{}, Checkpoint{}
+	}
+	return pNode.DataStructure.Finality.LastJustified, pNode.DataStructure.Finality.LastFinalized
+}
+
+// Height of the tip of the current chain of the node. Safe to call while the node receives Blocks
+func (pNode *NodeGhost) Height() int {
+	mutex.Lock()
+	defer mutex.Unlock()
+	return len(pNode.DataStructure.CurrentChain) - 1
+}
+
+// What the node knows about the transaction with the given identifier: the Block containing it, its
+// depth in the current chain, how safe it is and whether it is final. Safe to call while the node
+// receives Blocks
+func (pNode *NodeGhost) Confirmation(pTransactionID string) components.Confirmation {
+	mutex.Lock()
+	defer mutex.Unlock()
+	return pNode.DataStructure.Confirmation(pTransactionID)
+}
+
+// Evidence of the validators that broke a slashing condition, as detected by the node. Safe to call
+// while the node receives Blocks
+func (pNode *NodeGhost) Slashings() []SlashingEvidence {
+	mutex.Lock()
+	defer mutex.Unlock()
+	if pNode.DataStructure.Finality == nil {
+		return nil
+	}
+	return append([]SlashingEvidence(nil), pNode.DataStructure.Finality.Slashings...)
+}
+
+// Creating a standard Block in the network and broadcasting it
+func GenerateBlock(pNode *NodeGhost, pParent *Block, pTransactions []components.Transaction) Block {
+	return pNode.GenerateBlock(pParent, pTransactions)
 }
 
 // Revises whether the error is not nil
@@ -0,0 +1,118 @@
+package ghost
+
+import (
+	"errors"
+	"github.com/gcubillos/isis-3007-distributed-ledger/data-structures/shared-components"
+)
+
+// What is registered in the undo journal every time a transaction modifies an account
+// A copy of the account before the change is kept, or nothing if the account didn't exist
+type AccountChange struct {
+	Address         string
+	Existed         bool
+	PreviousAccount Account
+}
+
+// *** Methods ***
+
+// Apply the transactions of a block that extends the tip of the current chain over the state,
+// registering in the journal the changes needed to revert them. With the inclusive protocol, the
+// transactions of the blocks outside the current chain that it includes are applied afterwards.
+// The rewards minted by the last blocks of the current chain can't be spent yet
+func (pGhost *Ghost) connectBlock(pBlock *Block) error {
+	locked := pGhost.immatureCoinbase()
+	if !verifyStateTransition(pBlock, pGhost.State, locked) {
+		return errors.New("the transactions are inconsistent with the state")
+	}
+	journal := make([]AccountChange, 0, 2*len(pBlock.Transactions))
+	record := func(pAddress string) {
+		change := AccountChange{Address: pAddress}
+		if theAccount, ok := pGhost.State[pAddress]; ok {
+			change.Existed = true
+			change.PreviousAccount = *theAccount
+		}
+		journal = append(journal, change)
+	}
+	for _, v := range pBlock.Transactions {
+		if !components.IsCoinbase(v) {
+			record(v.Origin)
+		}
+		record(v.Destination)
+		applyTransaction(pGhost.State, v)
+	}
+	if pGhost.Inclusive {
+		pGhost.includeOffChainBlocks(pBlock, record, locked)
+	}
+	pGhost.Journal[pBlock.Hash] = journal
+	return nil
+}
+
+// Rewards minted by the current chain that a block extending it can't spend yet, by account. With the
+// inclusive protocol, they include the shares of the blocks outside the current chain
+func (pGhost *Ghost) immatureCoinbase() map[string]float64 {
+	rLocked := make(map[string]float64)
+	nextHeight := len(pGhost.CurrentChain)
+	for i := nextHeight - 1; i > 0 && !components.IsMature(i, nextHeight); i-- {
+		theBlock := &pGhost.CurrentChain[i]
+		for _, v := range theBlock.Transactions {
+			if components.IsCoinbase(v) {
+				rLocked[v.Destination] += v.Value
+			}
+		}
+		for _, v := range pGhost.Included[theBlock.Hash] {
+			reward := pGhost.offChainReward(pGhost.knownBlocks[v])
+			rLocked[reward.Destination] += reward.Value
+		}
+	}
+	return rLocked
+}
+
+// Roll the state back to the one before the given block, which must be the tip of the current chain
+func (pGhost *Ghost) disconnectBlock(pBlock *Block) {
+	journal := pGhost.Journal[pBlock.Hash]
+	// Revert the changes in the opposite order they were registered
+	for i := len(journal) - 1; i >= 0; i-- {
+		v := journal[i]
+		if v.Existed {
+			previousAccount := v.PreviousAccount
+			pGhost.State[v.Address] = &previousAccount
+		} else {
+			delete(pGhost.State, v.Address)
+		}
+	}
+	delete(pGhost.Journal, pBlock.Hash)
+	pGhost.excludeOffChainBlocks(pBlock)
+}
+
+// Move the current chain to a new branch. The blocks after the fork index are disconnected and
+// the blocks of the new branch are connected in order. If one of them is inconsistent with the
+// state, it is marked as invalid in the tree and the previous current chain is restored
+func (pGhost *Ghost) switchBranch(pForkIndex int, pNewBranch []Block) error {
+	oldBranch := make([]Block, len(pGhost.CurrentChain)-pForkIndex-1)
+	copy(oldBranch, pGhost.CurrentChain[pForkIndex+1:])
+
+	// Roll back the state to the fork block
+	for i := len(pGhost.CurrentChain) - 1; i > pForkIndex; i-- {
+		pGhost.disconnectBlock(&pGhost.CurrentChain[i])
+	}
+	pGhost.CurrentChain = pGhost.CurrentChain[:pForkIndex+1]
+
+	// Re-apply the new branch
+	for i := range pNewBranch {
+		if err := pGhost.connectBlock(&pNewBranch[i]); err != nil {
+			// The Block and its descendants are never chosen again
+			pGhost.Tree.MarkInvalid(pNewBranch[i].Hash)
+			for j := i - 1; j >= 0; j-- {
+				pGhost.disconnectBlock(&pNewBranch[j])
+			}
+			pGhost.CurrentChain = pGhost.CurrentChain[:pForkIndex+1]
+			for j := range oldBranch {
+				check(pGhost.connectBlock(&oldBranch[j]))
+				pGhost.CurrentChain = append(pGhost.CurrentChain, oldBranch[j])
+			}
+			return err
+		}
+		pGhost.CurrentChain = append(pGhost.CurrentChain, pNewBranch[i])
+	}
+	return nil
+}
@@ -1,80 +1,299 @@
 package ghost
 
+import (
+	"errors"
+	"github.com/gcubillos/isis-3007-distributed-ledger/data-structures/shared-components"
+)
+
 // *** Structs ***
 
-/* Declaration of structure
-Contains Blocks and State, it also saves the children and unused nodes */
+// Declaration of structure
+// Contains Blocks and State, it also saves the children and unused nodes.
+// Blocks contains every Block received, in the order they were added, while CurrentChain goes
+// from the genesis Block to the tip chosen by the fork-choice rule.
+// Tree keeps the relations between the Blocks along with the cached weight of each subtree.
+// State is the state at the end of the current chain and Journal keeps, for every Block connected
+// to the current chain, the changes needed to roll the state back. Neither of them is sent to other
+// nodes, each node computes them by connecting the Blocks itself.
+// When Inclusive is set, the structure follows the inclusive protocol: the transactions of the Blocks
+// outside the current chain are applied as well when they don't conflict. Included keeps, for every
+// Block of the current chain, the Blocks outside of it whose transactions it included, and Rejected
+// the transactions of those Blocks that were left out because of conflicts.
+// Finality is the overlay in which a set of validators finalizes checkpoints, nil if the structure
+// doesn't have one. Once a checkpoint is finalized, the current chain never goes back below it.
+// Clock is the network-adjusted clock of the node, which each copy has its own.
+// Orphans are the Blocks received before their parent or the Blocks they reference, kept until those arrive
 type Ghost struct {
 	Blocks       []Block
 	CurrentChain []Block
+	State        map[string]*Account                 `json:"-"`
+	Journal      map[string][]AccountChange          `json:"-"`
+	Tree         components.BlockTree                `json:"-"`
+	ForkChoice   components.ForkChoice               `json:"-"`
+	Inclusive    bool                                `json:"-"`
+	Included     map[string][]string                 `json:"-"`
+	Rejected     map[string][]components.Transaction `json:"-"`
+	Finality     *Finality                           `json:",omitempty"`
+	Clock        *components.NetworkClock            `json:"-"`
+	knownBlocks  map[string]*Block
+	includedIn   map[string]string
+	orphans      []Block
 }
 
+// Maximum number of Blocks waiting for their parent or references. Since the nodes only send the new
+// Blocks, a child may arrive before its parent, but a peer can't make the node keep unlimited Blocks
+const MaxOrphans = 500
+
 // *** Constructors ***
+
+// Create the structure with only the genesis Block. The state at the end of the genesis Block
+// is taken from its RecentState
+func CreateGhost(pGenesisBlock Block, pForkChoice components.ForkChoice) Ghost {
+	rGhost := Ghost{
+		Blocks:       []Block{pGenesisBlock},
+		CurrentChain: []Block{pGenesisBlock},
+		State:        make(map[string]*Account, len(pGenesisBlock.RecentState)),
+		Journal:      make(map[string][]AccountChange, 0),
+		Tree:         components.CreateBlockTree(pGenesisBlock.Hash, BlockWork(pGenesisBlock.Difficulty)),
+		ForkChoice:   pForkChoice,
+		Included:     make(map[string][]string),
+		Rejected:     make(map[string][]components.Transaction),
+		Clock:        components.CreateNetworkClock(),
+		knownBlocks:  make(map[string]*Block),
+		includedIn:   make(map[string]string),
+	}
+	rGhost.knownBlocks[pGenesisBlock.Hash] = &rGhost.Blocks[0]
+	for k, v := range pGenesisBlock.RecentState {
+		theAccount := *v
+		rGhost.State[k] = &theAccount
+	}
+	return rGhost
+}
+
+// Create the structure with only the genesis Block, following the inclusive protocol
+func CreateInclusiveGhost(pGenesisBlock Block, pForkChoice components.ForkChoice) Ghost {
+	rGhost := CreateGhost(pGenesisBlock, pForkChoice)
+	rGhost.Inclusive = true
+	return rGhost
+}
+
 // *** Methods ***
 
-// Finding the GHOST (Greedy Heaviest-Observed Sub-Tree)
-// Way of replacing the chain
-// Choosing the branch with the most combined proof of work, measured by the amount of
-// nodes present in such branch
-// Modified version where you start at the tip and work your way backwards to find the
-// heaviest sub tree
-func (pGhost *Ghost) FindGHOST(pNewBlockchain Ghost) {
-	var forkBlock Block
-	diverges := false
-	// Find the place the fork occurs and history diverges
-	for i := 0; !diverges && i < len(pGhost.CurrentChain); i++ {
-		if pGhost.CurrentChain[i].Hash != pNewBlockchain.CurrentChain[i].Hash {
-			forkBlock = *pGhost.CurrentChain[i].Parent
-			diverges = true
+// Create a copy of the structure that doesn't share its state with the original one.
+// Needed since several nodes in the same process may start from the same structure. The clock of the
+// copy starts without offsets from peers
+func (pGhost *Ghost) Copy() Ghost {
+	rGhost := Ghost{
+		Blocks:       make([]Block, len(pGhost.Blocks)),
+		CurrentChain: make([]Block, len(pGhost.CurrentChain)),
+		State:        make(map[string]*Account, len(pGhost.State)),
+		Journal:      make(map[string][]AccountChange, len(pGhost.Journal)),
+		Tree:         pGhost.Tree.Copy(),
+		ForkChoice:   pGhost.ForkChoice,
+		Inclusive:    pGhost.Inclusive,
+		Included:     make(map[string][]string, len(pGhost.Included)),
+		Rejected:     make(map[string][]components.Transaction, len(pGhost.Rejected)),
+		Clock:        components.CreateNetworkClock(),
+		knownBlocks:  make(map[string]*Block, len(pGhost.knownBlocks)),
+		includedIn:   make(map[string]string, len(pGhost.includedIn)),
+	}
+	copy(rGhost.Blocks, pGhost.Blocks)
+	copy(rGhost.CurrentChain, pGhost.CurrentChain)
+	for i := range rGhost.Blocks {
+		rGhost.knownBlocks[rGhost.Blocks[i].Hash] = &rGhost.Blocks[i]
+	}
+	for k, v := range pGhost.State {
+		theAccount := *v
+		rGhost.State[k] = &theAccount
+	}
+	for k, v := range pGhost.Journal {
+		rGhost.Journal[k] = append([]AccountChange(nil), v...)
+	}
+	for k, v := range pGhost.Included {
+		rGhost.Included[k] = append([]string(nil), v...)
+		for _, w := range v {
+			rGhost.includedIn[w] = k
 		}
 	}
+	for k, v := range pGhost.Rejected {
+		rGhost.Rejected[k] = append([]components.Transaction(nil), v...)
+	}
+	if pGhost.Finality != nil {
+		theFinality := pGhost.Finality.Copy()
+		rGhost.Finality = &theFinality
+	}
+	return rGhost
+}
 
-	var newChainSize int
-	var currentChainSize int
-	// Check whether the fork block was found
-	if diverges {
-		// Subtree size of the new chain
-		newChainSize = findSubTreeSize(pNewBlockchain, forkBlock)
-		currentChainSize = findSubTreeSize(*pGhost, forkBlock)
-	} else {
-		// Just get the chain with the greatest length
-		newChainSize = len(pNewBlockchain.Blocks)
-		currentChainSize = len(pGhost.Blocks)
+// Whether the given Block is the tip of the current chain
+func (pGhost *Ghost) isTip(pBlock *Block) bool {
+	return pBlock != nil && pGhost.CurrentChain[len(pGhost.CurrentChain)-1].Hash == pBlock.Hash
+}
 
+// Get a Block that is part of the structure by its hash
+func (pGhost *Ghost) GetBlock(pHash string) (*Block, bool) {
+	theBlock, ok := pGhost.knownBlocks[pHash]
+	return theBlock, ok
+}
+
+// Add a Block to the structure. Its Parent is linked to the Block already present in the structure,
+// and then the fork-choice rule is applied to find out whether the current chain changes
+func (pGhost *Ghost) AddBlock(pBlock Block) error {
+	// Block was already received
+	if pGhost.Tree.Contains(pBlock.Hash) {
+		return nil
+	}
+	parentBlock, ok := pGhost.knownBlocks[pBlock.HashPreviousBlock]
+	if !ok {
+		return errors.New("parent block is unknown")
 	}
+	pBlock.Parent = parentBlock
+	if ok, err := pGhost.IsBlockValid(&pBlock); !ok {
+		return err
+	}
+	check(pGhost.Tree.AddNode(pBlock.Hash, pBlock.HashPreviousBlock, BlockWork(pBlock.Difficulty), pBlock.Uncles))
+	pGhost.Blocks = append(pGhost.Blocks, pBlock)
+	storedBlock := pBlock
+	pGhost.knownBlocks[pBlock.Hash] = &storedBlock
+
+	return pGhost.updateTip()
+}
 
-	if newChainSize > currentChainSize {
-		pGhost.Blocks = pNewBlockchain.Blocks
-		pGhost.CurrentChain = pNewBlockchain.CurrentChain
+// Apply the fork-choice rule until the chosen tip can be connected. Every time a branch turns out
+// to be invalid, its Blocks are excluded and the rule is applied again.
+// The error of the first branch that couldn't be connected is returned
+func (pGhost *Ghost) updateTip() error {
+	var firstErr error
+	for {
+		currentTip := pGhost.CurrentChain[len(pGhost.CurrentChain)-1].Hash
+		newTip := pGhost.ForkChoice.SelectTip(&pGhost.Tree, currentTip)
+		if newTip == currentTip {
+			return firstErr
+		}
+		forkHash := pGhost.Tree.FindForkBlock(currentTip, newTip)
+		newBranch := make([]Block, 0)
+		for _, v := range pGhost.Tree.PathFrom(forkHash, newTip) {
+			newBranch = append(newBranch, *pGhost.knownBlocks[v])
+		}
+		if err := pGhost.switchBranch(pGhost.Tree.Nodes[forkHash].Height, newBranch); err != nil && firstErr == nil {
+			firstErr = err
+		}
 	}
 }
 
-func findChildren(pBlock Block, pBlockchain Ghost) int {
-	numberOfChildren := 0
-	for _, v := range pBlockchain.Blocks {
-		if v.Parent.Hash == pBlock.Hash {
-			numberOfChildren++
+// What the node knows about the transaction with the given identifier. When the transaction is part of
+// the current chain, its first Block there is the one reported. With the inclusive protocol, a transaction
+// of a Block outside the current chain that was included without being rejected counts as part of the
+// Block that included it. Otherwise the transaction is orphaned, and one of the Blocks containing it is
+// reported. With the finality overlay, the transactions up to the last finalized checkpoint are final
+func (pGhost *Ghost) Confirmation(pTransactionID string) components.Confirmation {
+	contains := func(pTransactions []components.Transaction) bool {
+		for _, v := range pTransactions {
+			if v.ID() == pTransactionID {
+				return true
+			}
 		}
+		return false
 	}
-	return numberOfChildren
+	if i, ok := pGhost.transactionHeights()[pTransactionID]; ok {
+		final := pGhost.Finality != nil && i <= pGhost.Finality.LastFinalized.Height
+		return components.CreateConfirmation(pTransactionID, pGhost.CurrentChain[i].Hash, len(pGhost.CurrentChain)-i, final)
+	}
+	orphanedIn := ""
+	for _, v := range pGhost.Blocks {
+		if _, ok := pGhost.includedIn[v.Hash]; !ok && !pGhost.isInCurrentChain(v.Hash) && contains(v.Transactions) {
+			orphanedIn = v.Hash
+			break
+		}
+	}
+	return components.CreateConfirmation(pTransactionID, orphanedIn, 0, false)
 }
 
-func findSubTreeSize(pNewBlockchain Ghost, pForkBlock Block) int {
-	pCurrentBlock := pNewBlockchain.CurrentChain[len(pNewBlockchain.CurrentChain)-1]
-	newSubtreeSize := 0
-	var reachedFork = false
-	for j := 0; !reachedFork; j++ {
-		if pCurrentBlock.Parent.Hash == pForkBlock.Hash {
-			reachedFork = true
-		} else {
-			newSubtreeSize += 1
-			newSubtreeSize += findChildren(pCurrentBlock, pNewBlockchain) - 1
-			pCurrentBlock = *pCurrentBlock.Parent
+// Position in the current chain of the first Block containing each transaction, by identifier. With the
+// inclusive protocol, the transactions included from Blocks outside the current chain without being
+// rejected count as part of the Block that included them
+func (pGhost *Ghost) transactionHeights() map[string]int {
+	rHeights := make(map[string]int)
+	add := func(pTransaction components.Transaction, pHeight int) {
+		if _, ok := rHeights[pTransaction.ID()]; !ok {
+			rHeights[pTransaction.ID()] = pHeight
+		}
+	}
+	for i, v := range pGhost.CurrentChain {
+		for _, w := range v.Transactions {
+			add(w, i)
+		}
+		rejected := make(map[string]bool)
+		for _, w := range pGhost.Rejected[v.Hash] {
+			rejected[w.ID()] = true
+		}
+		for _, w := range pGhost.Included[v.Hash] {
+			for _, x := range userTransactions(pGhost.knownBlocks[w]) {
+				if !rejected[x.ID()] {
+					add(x, i)
+				}
+			}
 		}
 	}
-	return newSubtreeSize
+	return rHeights
+}
 
+// Whether the Block is part of the current chain
+func (pGhost *Ghost) isInCurrentChain(pHash string) bool {
+	theNode, ok := pGhost.Tree.Nodes[pHash]
+	return ok && theNode.Height < len(pGhost.CurrentChain) && pGhost.CurrentChain[theNode.Height].Hash == pHash
 }
 
-// TODO: Having two implementations of Ghost, one with the ethereum chain selection and another
-// with the one present in the ghost paper
+// Finding the GHOST (Greedy Heaviest-Observed Sub-Tree)
+// Way of replacing the chain
+// The Blocks of the other structure are merged into the tree, and then the current chain is
+// chosen by the fork-choice rule. With the rule from the GHOST paper, it starts at the genesis
+// Block and repeatedly descends to the child with the heaviest subtree, whose weight is kept
+// cached in the tree and updated as the Blocks arrive.
+// The state of the other node is never trusted, when the other chain is chosen the state is
+// rolled back to the fork block and the Blocks of the other chain are applied over it.
+// With the finality overlay, the votes of the other structure are added as well, and the Blocks that
+// don't descend from the last finalized checkpoint are refused, so the current chain is never
+// reorganized below it.
+// Returns the Blocks that were added and the votes that were new, which the node forwards to its peers
+func (pGhost *Ghost) FindGHOST(pNewBlockchain Ghost) ([]Block, []FinalityVote) {
+	rAdded := make([]Block, 0)
+	rVotes := make([]FinalityVote, 0)
+	pending := append(append([]Block(nil), pGhost.orphans...), pNewBlockchain.Blocks...)
+	// A Block can only be added after its parent and the Blocks it references, so the ones that are
+	// still waiting for them are retried while the others keep being added
+	for progress := true; progress && len(pending) > 0; {
+		progress = false
+		remaining := make([]Block, 0)
+		for _, v := range pending {
+			if pGhost.Tree.Contains(v.Hash) {
+				continue
+			}
+			if !pGhost.areReferencesKnown(&v) {
+				remaining = append(remaining, v)
+				continue
+			}
+			if pGhost.AddBlock(v) == nil {
+				rAdded = append(rAdded, v)
+			}
+			progress = true
+		}
+		pending = remaining
+	}
+	// The Blocks still waiting are kept for the next time, the most recent ones if there are too many
+	if len(pending) > MaxOrphans {
+		pending = pending[len(pending)-MaxOrphans:]
+	}
+	pGhost.orphans = pending
+	if pGhost.Finality != nil && pNewBlockchain.Finality != nil {
+		for _, v := range pNewBlockchain.Finality.Votes {
+			known := pGhost.Finality.counted[v.id()]
+			if err := pGhost.AddVote(v); err == nil && !known {
+				rVotes = append(rVotes, v)
+			}
+		}
+		// Votes received before the Blocks they are about can be counted now
+		pGhost.tallyVotes()
+	}
+	return rAdded, rVotes
+}
@@ -0,0 +1,148 @@
+package ghost
+
+import (
+	"errors"
+	"github.com/gcubillos/isis-3007-distributed-ledger/data-structures/shared-components"
+	"sort"
+)
+
+// *** Structs ***
+
+// Amount minted for the miner of a Block, depending on its height. The rewards of the uncles and of the
+// Blocks outside the current chain are fractions of it
+var Subsidy components.SubsidySchedule = components.ConstantSubsidy{Value: 1}
+
+// Maximum number of generations between a Block and the uncles it references. As in Ethereum,
+// the parent of an uncle must be an ancestor of the Block at most seven generations back
+const MaxUncleDepth = 6
+
+// Maximum number of uncles a Block may reference
+const MaxUnclesPerBlock = 2
+
+// *** Methods ***
+
+// Coinbase transactions that mint the rewards of a Block, following Ethereum's scheme. The miner
+// receives the subsidy for the height of the Block plus 1/32 of it for each uncle referenced, and the
+// miner of each uncle receives (8 - d)/8 of the subsidy, where d is the number of generations between
+// the uncle and the Block. Each account receives a single coinbase adding up its rewards, the miner's
+// first and then the ones of the uncles in order. The uncles, given by their hashes, must be part of the tree
+func (pGhost *Ghost) RewardTransactions(pMiner string, pParentHash string, pUncles []string) []components.Transaction {
+	height := pGhost.Tree.Nodes[pParentHash].Height + 1
+	subsidy := Subsidy.Subsidy(height)
+	amounts := map[string]float64{pMiner: subsidy}
+	accounts := []string{pMiner}
+	for _, v := range pUncles {
+		depth := height - pGhost.Tree.Nodes[v].Height
+		uncleMiner := pGhost.knownBlocks[v].Miner
+		amounts[pMiner] += subsidy / 32
+		if _, ok := amounts[uncleMiner]; !ok {
+			accounts = append(accounts, uncleMiner)
+		}
+		amounts[uncleMiner] += subsidy * float64(8-depth) / 8
+	}
+	rewards := make([]components.Transaction, 0, len(accounts))
+	for _, v := range accounts {
+		rewards = append(rewards, components.CreateCoinbase(v, amounts[v], height))
+	}
+	return rewards
+}
+
+// Hashes of the stale Blocks that a new child of the given parent may reference as uncles. The closest
+// ones are preferred, up to the maximum number of uncles per Block
+func (pGhost *Ghost) SelectUncles(pParent *Block) []string {
+	rUncles := make([]string, 0)
+	parentNode, ok := pGhost.Tree.Nodes[pParent.Hash]
+	if !ok {
+		return rUncles
+	}
+	alreadyIncluded := pGhost.includedUncles(pParent.Hash)
+	candidates := make([]*components.TreeNode, 0)
+	for _, v := range pGhost.Tree.Nodes {
+		if pGhost.isUncleEligible(v, parentNode, alreadyIncluded) {
+			candidates = append(candidates, v)
+		}
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].Height != candidates[j].Height {
+			return candidates[i].Height > candidates[j].Height
+		}
+		return candidates[i].Hash < candidates[j].Hash
+	})
+	for i := 0; i < len(candidates) && i < MaxUnclesPerBlock; i++ {
+		rUncles = append(rUncles, candidates[i].Hash)
+	}
+	return rUncles
+}
+
+// Check that the uncles of a Block are eligible and that its rewards are the expected ones.
+// The uncles must already be part of the tree, which isn't changed by the check
+func (pGhost *Ghost) validateUncles(pBlock *Block) error {
+	if len(pBlock.Uncles) > MaxUnclesPerBlock {
+		return errors.New("too many uncles")
+	}
+	parentNode := pGhost.Tree.Nodes[pBlock.HashPreviousBlock]
+	alreadyIncluded := pGhost.includedUncles(pBlock.HashPreviousBlock)
+	for _, v := range pBlock.Uncles {
+		if !pGhost.Tree.Contains(v) {
+			return errors.New("uncle isn't part of the tree")
+		}
+		if !pGhost.isUncleEligible(pGhost.Tree.Nodes[v], parentNode, alreadyIncluded) {
+			return errors.New("uncle is not eligible")
+		}
+		// The same uncle can't be referenced twice by the Block
+		alreadyIncluded[v] = true
+	}
+
+	// The Block can only create currency through the expected rewards, which go at the end
+	expectedRewards := pGhost.RewardTransactions(pBlock.Miner, pBlock.HashPreviousBlock, pBlock.Uncles)
+	numberTransactions := len(pBlock.Transactions) - len(expectedRewards)
+	if numberTransactions < 0 {
+		return errors.New("the rewards of the block are missing")
+	}
+	for i, v := range pBlock.Transactions {
+		if i < numberTransactions && components.IsCoinbase(v) {
+			return errors.New("the block creates currency outside of its rewards")
+		}
+		if i >= numberTransactions && v != expectedRewards[i-numberTransactions] {
+			return errors.New("the rewards of the block are not the expected ones")
+		}
+	}
+	return nil
+}
+
+// Whether a Block of the tree can be an uncle of a new child of the given parent. The uncle can't
+// be an ancestor of the new Block, its parent must be an ancestor within the allowed depth, and it
+// can't have been referenced already by one of those ancestors
+func (pGhost *Ghost) isUncleEligible(pUncle, pParent *components.TreeNode, pAlreadyIncluded map[string]bool) bool {
+	depth := pParent.Height + 1 - pUncle.Height
+	switch true {
+	case pUncle.Invalid || pUncle.Hash == pGhost.Tree.Genesis:
+		return false
+	case depth < 1 || depth > MaxUncleDepth:
+		return false
+	case pGhost.Tree.IsAncestor(pUncle.Hash, pParent.Hash):
+		return false
+	case !pGhost.Tree.IsAncestor(pUncle.ParentHash, pParent.Hash):
+		return false
+	case pAlreadyIncluded[pUncle.Hash]:
+		return false
+	default:
+		return true
+	}
+}
+
+// Uncles referenced by the given Block and its ancestors within the uncle window
+func (pGhost *Ghost) includedUncles(pHash string) map[string]bool {
+	rIncluded := make(map[string]bool)
+	current := pGhost.Tree.Nodes[pHash]
+	for i := 0; i <= MaxUncleDepth; i++ {
+		for _, v := range current.Uncles {
+			rIncluded[v] = true
+		}
+		if current.Hash == pGhost.Tree.Genesis {
+			break
+		}
+		current = pGhost.Tree.Nodes[current.ParentHash]
+	}
+	return rIncluded
+}
@@ -0,0 +1,139 @@
+package blockchain
+
+import (
+	"context"
+	"errors"
+	"github.com/gcubillos/isis-3007-distributed-ledger/data-structures/shared-components"
+	"time"
+)
+
+// *** Structs ***
+
+// Difficulty of a block of proof of authority signed by the authority whose turn it is, and of one signed
+// by another authority. With a fork-choice rule based on work, the block signed in turn is preferred
+const (
+	DifficultyInTurn    = 2
+	DifficultyOutOfTurn = 1
+)
+
+// Time an authority whose turn it isn't waits, for every position it is away from the one in turn,
+// before signing a block. It gives the authority in turn the chance to sign first
+var OutOfTurnDelay = 50 * time.Millisecond
+
+// Blocks are signed by a configured set of authorities, identified by the hexadecimal public keys of
+// their nodes, which take turns according to the height of the block. Consecutive blocks are at least
+// Period apart, and each authority signs at most one block out of any half of the authorities plus one
+// consecutive blocks, so that a single authority can't take over the chain
+type ProofOfAuthority struct {
+	Authorities []string
+	Period      time.Duration
+}
+
+// *** Methods ***
+
+func (ProofOfAuthority) Name() string {
+	return "proof-of-authority"
+}
+
+// Authority whose turn it is to sign the block at the given height, the genesis block being at height zero.
+// It is empty when there are no authorities or the height is negative
+func (pAuthority ProofOfAuthority) InTurn(pHeight int) string {
+	if len(pAuthority.Authorities) == 0 || pHeight < 0 {
+		return ""
+	}
+	return pAuthority.Authorities[pHeight%len(pAuthority.Authorities)]
+}
+
+// Number of consecutive blocks among which an authority can sign only one
+func (pAuthority ProofOfAuthority) SignerLimit() int {
+	return len(pAuthority.Authorities)/2 + 1
+}
+
+// Position of the authority in the set, or -1 if it isn't an authority
+func (pAuthority ProofOfAuthority) position(pKey string) int {
+	for i, v := range pAuthority.Authorities {
+		if v == pKey {
+			return i
+		}
+	}
+	return -1
+}
+
+// Whether the authority signed one of the blocks that, along with a child of the given parent, would
+// exceed the signer limit. The height of each block is kept in its slot
+func (pAuthority ProofOfAuthority) signedRecently(pBlockchain *Blockchain, pParent Block, pKey string) bool {
+	theBlock := pParent
+	for i := 1; i < pAuthority.SignerLimit(); i++ {
+		if theBlock.Producer == pKey {
+			return true
+		}
+		knownParent, ok := pBlockchain.KnownBlocks[theBlock.PrevHash]
+		if !ok {
+			return false
+		}
+		theBlock = knownParent.Block
+	}
+	return false
+}
+
+// Wait until the period after the parent is over, and further if it isn't the turn of the node, then
+// sign the block. If the node signed a block too recently, the block is rejected when it is added
+func (pAuthority ProofOfAuthority) SealBlock(pContext context.Context, pNode *NodeBlockchain, pParent Block, pBlock *Block) error {
+	if len(pAuthority.Authorities) == 0 {
+		return errors.New("there are no authorities to sign the block")
+	}
+	authority := pNode.ValidatorKey()
+	pBlock.Producer = authority
+	pBlock.Slot = pParent.Slot + 1
+	pBlock.Difficulty = DifficultyInTurn
+	readyTime := pParent.Timestamp.Add(pAuthority.Period)
+	if inTurn := pAuthority.InTurn(pBlock.Slot); inTurn != authority {
+		pBlock.Difficulty = DifficultyOutOfTurn
+		numberAuthorities := len(pAuthority.Authorities)
+		distance := (pAuthority.position(authority) - pAuthority.position(inTurn) + numberAuthorities) % numberAuthorities
+		readyTime = readyTime.Add(time.Duration(distance) * OutOfTurnDelay)
+	}
+	select {
+	case <-pContext.Done():
+		return pContext.Err()
+	case <-time.After(readyTime.Sub(pNode.DataStructure.Clock.Now())):
+	}
+	pBlock.Timestamp = pNode.DataStructure.Clock.Now()
+	pBlock.Hash = CalculateHash(*pBlock)
+	pBlock.Signature = components.Sign(pNode.Node, pBlock.Hash)
+	return nil
+}
+
+// The producer and the height of the block are checked before the turn is computed from them
+func (pAuthority ProofOfAuthority) VerifyBlock(pBlockchain *Blockchain, pBlock, pParent Block) error {
+	switch true {
+	case len(pAuthority.Authorities) == 0:
+		return errors.New("there are no authorities")
+	case pAuthority.position(pBlock.Producer) < 0:
+		return errors.New("the producer isn't an authority")
+	case pBlock.Slot != pParent.Slot+1:
+		return errors.New("the height must follow the one of the previous block")
+	}
+	expectedDifficulty := DifficultyOutOfTurn
+	if pAuthority.InTurn(pBlock.Slot) == pBlock.Producer {
+		expectedDifficulty = DifficultyInTurn
+	}
+	switch true {
+	case pBlock.Timestamp.Before(pParent.Timestamp.Add(pAuthority.Period)):
+		return errors.New("the block was signed before the period was over")
+	case pBlock.Difficulty != expectedDifficulty:
+		return errors.New("the difficulty doesn't match the turn of the producer")
+	case len(pBlock.Slashings) > 0:
+		return errors.New("a block of proof of authority can't slash")
+	case !isSignatureValid(pBlock):
+		return errors.New("the signature of the producer is not valid")
+	case pAuthority.signedRecently(pBlockchain, pParent, pBlock.Producer):
+		return errors.New("the producer signed a block too recently")
+	default:
+		return nil
+	}
+}
+
+func (ProofOfAuthority) VerifyConnection(pBlockchain *Blockchain, pBlock Block) ([]components.Transaction, error) {
+	return nil, nil
+}
@@ -0,0 +1,92 @@
+package blockchain
+
+import (
+	"context"
+	"errors"
+	"github.com/gcubillos/isis-3007-distributed-ledger/data-structures/shared-components"
+)
+
+// *** Structs ***
+
+// Way in which the blocks of a network are produced and validated. Every node of a network must
+// use the same engine, it is chosen when the initial node is created and copied to the others
+type Consensus interface {
+	// Name used to choose the engine from the configuration of a network
+	Name() string
+	// Complete a block created by the node on top of the given parent so that it can be added.
+	// It is called without holding the structure of the node, and gives up once the context is cancelled
+	SealBlock(pContext context.Context, pNode *NodeBlockchain, pParent Block, pBlock *Block) error
+	// Check the fields of the block that depend on the engine, in relation to its parent
+	VerifyBlock(pBlockchain *Blockchain, pBlock, pParent Block) error
+	// Check the block once it extends the tip of the active chain, so the state is the one at the end
+	// of its parent, and return the transactions the engine applies besides the ones of the block
+	VerifyConnection(pBlockchain *Blockchain, pBlock Block) ([]components.Transaction, error)
+}
+
+// Blocks are mined, the proof of work being a hash with the number of leading zeroes given by the difficulty
+type ProofOfWork struct{}
+
+// *** Constructors ***
+
+// Get a consensus engine by its name. Proof of authority needs its set of authorities, so it is
+// created directly instead
+func ConsensusByName(pName string) (Consensus, error) {
+	for _, v := range []Consensus{ProofOfWork{}, ProofOfStake{}} {
+		if v.Name() == pName {
+			return v, nil
+		}
+	}
+	return nil, errors.New("unknown consensus engine " + pName)
+}
+
+// *** Methods ***
+
+func (ProofOfWork) Name() string {
+	return "proof-of-work"
+}
+
+// The nonce is searched by the mining workers. The search stops as well when the tip of the active
+// chain of the node changes, since the block would hardly become part of it
+func (ProofOfWork) SealBlock(pContext context.Context, pNode *NodeBlockchain, pParent Block, pBlock *Block) error {
+	ctx, cancel := context.WithCancel(pContext)
+	defer cancel()
+	defer pNode.onNewTip(cancel)()
+
+	// Calculating the hash
+	header := *pBlock
+	result, err := components.Mine(ctx, func(pNonce int) string {
+		theBlock := header
+		theBlock.Nonce = pNonce
+		return CalculateHash(theBlock)
+	}, func(pHash string) bool {
+		return IsHashValid(pHash, header.Difficulty)
+	})
+	pNode.recordMining(result)
+	if err != nil {
+		return err
+	}
+	pBlock.Nonce = result.Nonce
+	pBlock.Hash = result.Hash
+	return nil
+}
+
+// The difficulty of a mined block must be the one of the network, so that no block is cheaper to mine
+// than the others
+func (ProofOfWork) VerifyBlock(pBlockchain *Blockchain, pBlock, pParent Block) error {
+	switch true {
+	case pBlock.Difficulty != Difficulty:
+		return errors.New("the difficulty isn't the one of the network")
+	// Checking proof of work
+	case !IsHashValid(pBlock.Hash, pBlock.Difficulty):
+		return errors.New("the proof of work is not valid")
+	// Mined blocks aren't signed
+	case pBlock.Producer != "" || pBlock.Signature != "" || len(pBlock.Slashings) > 0:
+		return errors.New("a mined block can't be signed")
+	default:
+		return nil
+	}
+}
+
+func (ProofOfWork) VerifyConnection(pBlockchain *Blockchain, pBlock Block) ([]components.Transaction, error) {
+	return nil, nil
+}
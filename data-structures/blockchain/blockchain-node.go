@@ -14,26 +14,48 @@ import (
 // Mutual exclusion variable
 var mutex = &sync.Mutex{}
 
-// What the node contains, the data structure and a reference to a peer in the p2p network
+// Time a node waits for a peer to acknowledge a chain
+var RequestTimeout = 2 * time.Second
+
+// What the node contains, the data structure and a reference to a peer in the p2p network.
+// Mining keeps the hashes computed by the node while mining, and tipListeners the functions called
+// once the tip of the active chain changes, which interrupt the blocks being mined.
+// The miner produces blocks in the background on top of the active chain, carrying the pending
+// transactions, the ones submitted to the node that haven't been accepted yet
 type NodeBlockchain struct {
 	DataStructure Blockchain
 	Node          *noise.Node
+	Mining        components.MiningStats
+	tipListeners  map[int]func()
+	nextListener  int
+	miner         *components.BackgroundMiner
+	pending       []components.Transaction
 }
 
-// An instance of the blockchain node
-var thisNode NodeBlockchain
-
 // Create a node in the network such that it can discover other nodes using the Kademlia
 // protocol. The current state of the blockchain is passed to the Node and a first peer
 // to connect to the network
-func CreateNode(pCurrentBlockchain Blockchain, pNode *noise.Node) NodeBlockchain {
-	// Create structure
-	thisNode = NodeBlockchain{
-		DataStructure: pCurrentBlockchain,
+func CreateNode(pCurrentBlockchain Blockchain, pNode *noise.Node) *NodeBlockchain {
+	return createNode(pCurrentBlockchain, pNode)
+}
+
+// Create a node in the network whose network node has the given private key. With proof of authority,
+// the keys of the authorities are generated beforehand so that the set is known when the chain starts
+func CreateAuthorityNode(pCurrentBlockchain Blockchain, pNode *noise.Node, pPrivateKey noise.PrivateKey) *NodeBlockchain {
+	return createNode(pCurrentBlockchain, pNode, noise.WithNodePrivateKey(pPrivateKey))
+}
+
+// Create a node in the network with the given options for its network node
+func createNode(pCurrentBlockchain Blockchain, pNode *noise.Node, pOptions ...noise.NodeOption) *NodeBlockchain {
+	// Create structure. The blockchain is copied so that the nodes don't share their state
+	mutex.Lock()
+	thisNode := &NodeBlockchain{
+		DataStructure: pCurrentBlockchain.Copy(),
 		Node:          nil,
 	}
+	mutex.Unlock()
 	// Create network node
-	networkNode, err := noise.NewNode()
+	networkNode, err := noise.NewNode(pOptions...)
 	check(err)
 
 	// Assign the Kademlia protocol to the node so it can discover other nodes
@@ -41,29 +63,7 @@ func CreateNode(pCurrentBlockchain Blockchain, pNode *noise.Node) NodeBlockchain
 	networkNode.Bind(ka.Protocol())
 
 	// Assign the way the node will handle the requests for blockchain updates
-	networkNode.Handle(func(ctx noise.HandlerContext) error {
-		if !ctx.IsRequest() {
-			return nil
-		}
-
-		receivedBlockchain := Blockchain{
-			Blocks: make([]Block, 0),
-			State:  make(map[string]float64, 0),
-		}
-		// TODO: Avoid having the unmarshal error when discovering peers. Check the kademlia discover method.
-		// Just change the context received. Uncomment to view the error
-		if err := json.Unmarshal(ctx.Data(), &receivedBlockchain); err == nil {
-			thisNode.DataStructure.ReplaceChain(receivedBlockchain)
-			fmt.Printf("current structure Create Node \n")
-			for _, v := range thisNode.DataStructure.Blocks {
-				fmt.Printf("a block %v \n", v)
-			}
-		} else {
-			// fmt.Printf("trouble unmarshalling CreateNode. Error: %v Blockchain: %v \n", err.Error(), receivedBlockchain.Blocks)
-		}
-
-		return ctx.Send([]byte(""))
-	})
+	networkNode.Handle(thisNode.handleRequest)
 
 	// Make the node listen to the network
 	check(networkNode.Listen())
@@ -83,14 +83,10 @@ func CreateNode(pCurrentBlockchain Blockchain, pNode *noise.Node) NodeBlockchain
 // Create the initial node
 // The genesis block is passed to the Node
 // The amount of available currency is passed as well to the node
-func CreateInitialNode(pGenesisBlock Block, pAvailableCurrency float64) NodeBlockchain {
-	// Create structure
-	thisNode = NodeBlockchain{
-		DataStructure: Blockchain{[]Block{pGenesisBlock}, make(map[string]float64, 0)},
-		Node:          nil,
-	}
-	// For simplicity a "main" account will be created that contains the amount of currency available
-	thisNode.DataStructure.State["main"] = pAvailableCurrency
+// The fork-choice rule and the consensus engine are shared by the nodes created afterwards from this
+// node's blockchain. With proof of stake, the initial node is the first validator
+func CreateInitialNode(pGenesisBlock Block, pAvailableCurrency float64, pForkChoice components.ForkChoice, pConsensus Consensus) *NodeBlockchain {
+	thisNode := &NodeBlockchain{}
 	// Create network node
 	networkNode, err := noise.NewNode()
 	check(err)
@@ -100,88 +96,307 @@ func CreateInitialNode(pGenesisBlock Block, pAvailableCurrency float64) NodeBloc
 	networkNode.Bind(ka.Protocol())
 
 	// Assign the way the node will handle the requests for blockchain updates
-	networkNode.Handle(func(ctx noise.HandlerContext) error {
-		if !ctx.IsRequest() {
-			return nil
-		}
-
-		receivedBlockchain := Blockchain{
-			Blocks: make([]Block, 0),
-			State:  make(map[string]float64, 0),
-		}
-		// TODO: Avoid having the unmarshal error when discovering peers. Check the kademlia discover method.
-		// Just change the context received. Uncomment to view the error
-		if err := json.Unmarshal(ctx.Data(), &receivedBlockchain); err == nil {
-			thisNode.DataStructure.ReplaceChain(receivedBlockchain)
-			fmt.Printf("current structure InitialNode \n")
-			for _, v := range thisNode.DataStructure.Blocks {
-				fmt.Printf("a block %v \n", v)
-			}
-		} else {
-			// fmt.Printf("trouble unmarshalling CreateNode. Error: %v Blockchain: %v \n", err.Error(), receivedBlockchain.Blocks)
-		}
-
-		return ctx.Send([]byte(""))
-	})
+	networkNode.Handle(thisNode.handleRequest)
 
 	// Make the node listen to the network
 	check(networkNode.Listen())
 
-	// Assign the network node to the node
+	// For simplicity a "main" account will be created that contains the amount of currency available,
+	// which the examples spend from. It is only the genesis allocation: the rewards are minted by the
+	// blocks and the slashed stake is burned, so no currency goes back to it.
+	// The key of the node is only known once it listens
+	initialState := map[string]float64{"main": pAvailableCurrency}
+	if _, ok := pConsensus.(ProofOfStake); ok {
+		initialState[StakeAccount(networkNode.ID().ID.String())] = InitialStake
+	}
+
+	// Create structure and assign the network node to the node
+	thisNode.DataStructure = CreateBlockchain(pGenesisBlock, initialState, pForkChoice, pConsensus)
 	thisNode.Node = networkNode
 
 	return thisNode
 }
 
 // Create a block and broadcast it to the rest of the network
-
+// The block is completed by the consensus engine: it is mined with proof of work, while with proof of
+// stake the node waits for a slot it is selected for and signs it.
+// With proof of work, the mining is interrupted when the tip of the active chain of the node changes.
+// The block is then returned without hash, and it isn't added nor broadcast
 func (pNode *NodeBlockchain) GenerateBlock(oldBlock Block, pTransactions []components.Transaction) Block {
+	rBlock, _ := pNode.GenerateBlockContext(context.Background(), oldBlock, pTransactions)
+	return rBlock
+}
+
+// Create a block and broadcast it to the rest of the network, giving up once the context is cancelled.
+// The error is the one of the context when the block couldn't be completed, or the reason why it
+// couldn't be added
+func (pNode *NodeBlockchain) GenerateBlockContext(pContext context.Context, oldBlock Block, pTransactions []components.Transaction) (Block, error) {
 
 	var newBlock Block
 
-	// Adding the transaction that gives the "miner" a reward for doing the work
-	rewardTransaction := components.Transaction{
-		Origin:          "main",
-		SenderSignature: "main",
-		Destination:     pNode.Node.Addr(),
-		Value:           1,
+	// Including information relevant to the block, along with the coinbase that mints the subsidy
+	// for the "miner" as a reward for doing the work
+	mutex.Lock()
+	newBlock.Timestamp = pNode.DataStructure.NextTimestamp(oldBlock)
+	height := 1
+	if parentNode, ok := pNode.DataStructure.Tree.Nodes[oldBlock.Hash]; ok {
+		height = parentNode.Height + 1
 	}
-	pTransactions = append(pTransactions, rewardTransaction)
-
-	// Including information relevant to the block
-	newBlock.Timestamp = time.Now()
+	mutex.Unlock()
+	pTransactions = append(pTransactions, components.CreateCoinbase(pNode.Node.Addr(), Subsidy.Subsidy(height), height))
 	newBlock.Transactions = pTransactions
 	newBlock.PrevHash = oldBlock.Hash
 	newBlock.Difficulty = Difficulty
-	// Calculating the hash
-	for i := 0; ; i++ {
-		newBlock.Nonce = i
-		if !IsHashValid(CalculateHash(newBlock), newBlock.Difficulty) {
+	newBlock.Algorithm = oldBlock.Algorithm
+	if err := pNode.DataStructure.Consensus.SealBlock(pContext, pNode, oldBlock, &newBlock); err != nil {
+		return newBlock, err
+	}
+
+	// Add the block to the block tree, it becomes the tip if its branch is the heaviest one
+	mutex.Lock()
+	previousTip := pNode.DataStructure.TipHash
+	err := pNode.DataStructure.AddBlock(newBlock)
+	var chainToBlock []Block
+	if err == nil {
+		chainToBlock = pNode.DataStructure.ChainTo(newBlock.Hash)
+	}
+	if pNode.DataStructure.TipHash != previousTip {
+		pNode.notifyNewTip()
+	}
+	mutex.Unlock()
+	if err == nil {
+		// Convert the chain ending in the new block so that it can be sent
+		bytes, err := json.Marshal(Blockchain{Blocks: chainToBlock})
+		check(err)
+		// Broadcast the blockchain to the network
+		pNode.broadcast(bytes)
+	}
+
+	return newBlock, err
+}
+
+// Register a function to be called the next time the tip of the active chain of the node changes.
+// Returns the function that removes it, in case the tip didn't change
+func (pNode *NodeBlockchain) onNewTip(pListener func()) func() {
+	mutex.Lock()
+	defer mutex.Unlock()
+	if pNode.tipListeners == nil {
+		pNode.tipListeners = make(map[int]func())
+	}
+	id := pNode.nextListener
+	pNode.nextListener++
+	pNode.tipListeners[id] = pListener
+	return func() {
+		mutex.Lock()
+		defer mutex.Unlock()
+		delete(pNode.tipListeners, id)
+	}
+}
+
+// Call the functions waiting for the tip of the active chain to change. Must be called holding the mutex
+func (pNode *NodeBlockchain) notifyNewTip() {
+	for k, v := range pNode.tipListeners {
+		v()
+		delete(pNode.tipListeners, k)
+	}
+}
+
+// Add the hashes of a search for a nonce to the ones computed by the node
+func (pNode *NodeBlockchain) recordMining(pResult components.MiningResult) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	pNode.Mining.Add(pResult)
+}
+
+// Hashes per second computed by the node while mining. Safe to call while the node keeps mining
+func (pNode *NodeBlockchain) HashRate() float64 {
+	mutex.Lock()
+	defer mutex.Unlock()
+	return pNode.Mining.HashRate()
+}
+
+// Add a transaction to the ones the node puts in the blocks it mines in the background
+func (pNode *NodeBlockchain) SubmitTransaction(pTransaction components.Transaction) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	pNode.pending = append(pNode.pending, pTransaction)
+}
+
+// Transactions for the next block on top of the active chain, in the order they were submitted.
+// The ones already in the active chain are skipped, and forgotten once they are accepted, as are the
+// ones minting currency. The ones the state can't pay for yet, for instance because they spend rewards
+// that haven't matured, are left for later blocks. Must be called holding the mutex
+func (pNode *NodeBlockchain) pendingTransactions() []components.Transaction {
+	heights := pNode.DataStructure.transactionHeights()
+	locked := pNode.DataStructure.immatureCoinbase()
+	remaining := make([]components.Transaction, 0, len(pNode.pending))
+	rTransactions := make([]components.Transaction, 0)
+	for _, v := range pNode.pending {
+		if components.IsCoinbase(v) {
+			continue
+		}
+		if i, ok := heights[v.ID()]; ok {
+			confirmation := components.CreateConfirmation(v.ID(), pNode.DataStructure.Blocks[i].Hash, len(pNode.DataStructure.Blocks)-i, false)
+			if !confirmation.IsAccepted() {
+				remaining = append(remaining, v)
+			}
 			continue
-		} else {
-			newBlock.Hash = CalculateHash(newBlock)
-			break
+		}
+		remaining = append(remaining, v)
+		if verifyStateTransition(append(rTransactions, v), pNode.DataStructure.State, locked) {
+			rTransactions = append(rTransactions, v)
 		}
 	}
+	pNode.pending = remaining
+	return rTransactions
+}
 
-	// Check that the block is valid
-	if ok, err := thisNode.DataStructure.IsBlockValid(newBlock, oldBlock); ok {
-		check(err)
-		// Add the block to the current blockchain
+// Produce a block on top of the tip of the active chain with the pending transactions. The block is
+// abandoned once the tip changes, whatever the consensus engine, and ErrTipChanged is returned so that
+// the miner starts over on the new one right away
+func (pNode *NodeBlockchain) mineOnTip(pContext context.Context) error {
+	ctx, cancel := context.WithCancel(pContext)
+	defer pNode.onNewTip(cancel)()
+	defer cancel()
+	mutex.Lock()
+	tip := pNode.DataStructure.Blocks[len(pNode.DataStructure.Blocks)-1]
+	transactions := pNode.pendingTransactions()
+	mutex.Unlock()
+	_, err := pNode.GenerateBlockContext(ctx, tip, transactions)
+	if err != nil && ctx.Err() != nil && pContext.Err() == nil {
+		return components.ErrTipChanged
+	}
+	return err
+}
+
+// Miner of the node, created the first time it is needed
+func (pNode *NodeBlockchain) backgroundMiner() *components.BackgroundMiner {
+	mutex.Lock()
+	defer mutex.Unlock()
+	if pNode.miner == nil {
+		pNode.miner = components.CreateBackgroundMiner(pNode.mineOnTip)
+	}
+	return pNode.miner
+}
+
+// Start mining in the background, or resume if the mining was paused. The node keeps producing blocks
+// on top of its active chain until the mining is paused or stopped
+func (pNode *NodeBlockchain) StartMining() {
+	pNode.backgroundMiner().Start()
+}
+
+// Pause the mining in the background, abandoning the block being produced
+func (pNode *NodeBlockchain) PauseMining() {
+	pNode.backgroundMiner().Pause()
+}
+
+// Stop the mining in the background. Once it returns, the node doesn't produce any other block
+func (pNode *NodeBlockchain) StopMining() {
+	pNode.backgroundMiner().Stop()
+}
+
+// Whether the node is mining in the background, paused or stopped
+func (pNode *NodeBlockchain) MiningState() string {
+	return pNode.backgroundMiner().State()
+}
+
+// Number of blocks the node produced while mining in the background
+func (pNode *NodeBlockchain) BlocksMined() int {
+	return pNode.backgroundMiner().Produced()
+}
+
+// Send a chain to every peer connected to the node, either because the node dialed it or because
+// the peer dialed the node. The peers answer with the time of their local clock, which adjusts the
+// clock of the node
+func (pNode *NodeBlockchain) broadcast(pBytes []byte) {
+	for _, v := range append(pNode.Node.Outbound(), pNode.Node.Inbound()...) {
+		// A peer that left the network or is too busy to answer doesn't stop the chain from reaching the others
+		ctx, cancel := context.WithTimeout(context.Background(), RequestTimeout)
+		sent := pNode.DataStructure.Clock.Local()
+		answer, err := pNode.Node.Request(ctx, v.ID().Address, pBytes)
+		cancel()
+		if err != nil {
+			continue
+		}
+		if peerTime, err := components.DecodeTimestamp(string(answer)); err == nil {
+			pNode.DataStructure.Clock.AddSample(v.ID().ID.String(), peerTime, sent, pNode.DataStructure.Clock.Local())
+		}
+	}
+}
+
+// Validator that identifies the node with proof of stake, or authority with proof of authority, the
+// hexadecimal public key of the node
+func (pNode *NodeBlockchain) ValidatorKey() string {
+	return pNode.Node.ID().ID.String()
+}
+
+// Handle the requests for blockchain updates. The received blocks are merged into the block tree and,
+// if they change the tip of the active chain, the chain is relayed to the peers of the node so that it
+// reaches the nodes that aren't connected to the one that created it
+func (pNode *NodeBlockchain) handleRequest(ctx noise.HandlerContext) error {
+	if !ctx.IsRequest() {
+		return nil
+	}
+
+	receivedBlockchain := Blockchain{
+		Blocks: make([]Block, 0),
+	}
+	// TODO: Avoid having the unmarshal error when discovering peers. Check the kademlia discover method.
+	// Just change the context received. Uncomment to view the error
+	if err := json.Unmarshal(ctx.Data(), &receivedBlockchain); err == nil && len(receivedBlockchain.Blocks) > 0 {
 		mutex.Lock()
-		thisNode.DataStructure.Blocks = append(thisNode.DataStructure.Blocks, newBlock)
+		previousTip := pNode.DataStructure.TipHash
+		pNode.DataStructure.ReplaceChain(receivedBlockchain)
+		fmt.Printf("current structure \n")
+		for _, v := range pNode.DataStructure.Blocks {
+			fmt.Printf("a block %v \n", v)
+		}
+		var relayedChain []Block
+		if pNode.DataStructure.TipHash != previousTip {
+			relayedChain = pNode.DataStructure.ChainTo(pNode.DataStructure.TipHash)
+			pNode.notifyNewTip()
+		}
 		mutex.Unlock()
-		// Convert the blockchain so that it can be sent
-		bytes, err := json.Marshal(thisNode.DataStructure)
-		check(err)
-		// Broadcast the blockchain to the network
-		for _, v := range thisNode.Node.Outbound() {
-			_, err = thisNode.Node.Request(context.TODO(), v.ID().Address, bytes)
+		if relayedChain != nil {
+			bytes, err := json.Marshal(Blockchain{Blocks: relayedChain})
 			check(err)
+			go pNode.broadcast(bytes)
 		}
+	} else {
+		// fmt.Printf("trouble unmarshalling. Error: %v Blockchain: %v \n", err, receivedBlockchain.Blocks)
 	}
 
-	return newBlock
+	return ctx.Send([]byte(components.EncodeTimestamp(pNode.DataStructure.Clock.Local())))
+}
+
+// Tip of the active chain of the node. Safe to call while the node keeps receiving blocks
+func (pNode *NodeBlockchain) LastBlock() Block {
+	mutex.Lock()
+	defer mutex.Unlock()
+	return pNode.DataStructure.Blocks[len(pNode.DataStructure.Blocks)-1]
+}
+
+// Whether the block is part of the active chain of the node. Safe to call while the node keeps receiving blocks
+func (pNode *NodeBlockchain) IsInActiveChain(pHash string) bool {
+	mutex.Lock()
+	defer mutex.Unlock()
+	return pNode.DataStructure.IsInActiveChain(pHash)
+}
+
+// What the node knows about the transaction with the given identifier: the block containing it, its
+// depth in the active chain and how safe it is. Safe to call while the node keeps receiving blocks
+func (pNode *NodeBlockchain) Confirmation(pTransactionID string) components.Confirmation {
+	mutex.Lock()
+	defer mutex.Unlock()
+	return pNode.DataStructure.Confirmation(pTransactionID)
+}
+
+// Balance of an account according to the active chain of the node.
+// Safe to call while the node keeps receiving blocks
+func (pNode *NodeBlockchain) Balance(pAccount string) float64 {
+	mutex.Lock()
+	defer mutex.Unlock()
+	return pNode.DataStructure.State[pAccount]
 }
 
 func check(err error) {
@@ -0,0 +1,213 @@
+package blockchain
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"github.com/gcubillos/isis-3007-distributed-ledger/data-structures/shared-components"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// *** Structs ***
+
+// Duration of each slot of proof of stake. Slots are counted from the timestamp of the genesis block
+// and at most one block per slot is produced by the validator selected for it
+var SlotDuration = 50 * time.Millisecond
+
+// Stake the genesis state gives to the initial node, so that there is a first validator
+var InitialStake = 10.0
+
+// Prefix of the accounts that hold the stake of the validators. A validator is identified by the
+// hexadecimal public key of its node, and it stakes currency by transferring it to its stake account
+const StakePrefix = "stake:"
+
+// Destination of the slashed stake. The currency sent to it is destroyed instead of credited, so that
+// neither the block producer nor any other account profits from a slashing
+const BurnAccount = "burn"
+
+// Blocks are signed by the validator selected for their slot, with a probability proportional to its stake
+type ProofOfStake struct{}
+
+// Proof that a validator signed two different blocks for the same slot. It is included in a later
+// block, and the stake of the validator is slashed when that block is connected
+type Equivocation struct {
+	First  Block
+	Second Block
+}
+
+// *** Methods ***
+
+// Account holding the stake of the given validator
+func StakeAccount(pValidator string) string {
+	return StakePrefix + pValidator
+}
+
+// Slot to which the given time belongs, in a chain whose genesis block has the given timestamp
+func SlotAt(pGenesisTime, pTime time.Time) int {
+	return int(pTime.Sub(pGenesisTime) / SlotDuration)
+}
+
+// Validators with stake in the state of the active chain and their stakes, sorted by validator
+func (pBlockchain *Blockchain) Validators() ([]string, []float64) {
+	rValidators := make([]string, 0)
+	for k, v := range pBlockchain.State {
+		if strings.HasPrefix(k, StakePrefix) && v > 0 {
+			rValidators = append(rValidators, strings.TrimPrefix(k, StakePrefix))
+		}
+	}
+	sort.Strings(rValidators)
+	rStakes := make([]float64, len(rValidators))
+	for i, v := range rValidators {
+		rStakes[i] = pBlockchain.State[StakeAccount(v)]
+	}
+	return rValidators, rStakes
+}
+
+// Validator selected to produce the child of the given block in the given slot, according to the
+// stakes in the state of the active chain. The selection is pseudo-random, seeded by the parent and
+// the slot, so every node selects the same validator. It is empty if no validator has stake
+func (pBlockchain *Blockchain) SlotLeader(pParentHash string, pSlot int) string {
+	validators, stakes := pBlockchain.Validators()
+	totalStake := 0.0
+	for _, v := range stakes {
+		totalStake += v
+	}
+	if totalStake == 0 {
+		return ""
+	}
+	seed := sha256.Sum256([]byte(pParentHash + strconv.Itoa(pSlot)))
+	target := float64(binary.BigEndian.Uint64(seed[:8])) / math.MaxUint64 * totalStake
+	for i, v := range stakes {
+		if target < v {
+			return validators[i]
+		}
+		target -= v
+	}
+	return validators[len(validators)-1]
+}
+
+// Equivocations whose validator still has stake in the state of the active chain, at most one per
+// validator. A validator includes them in its next block so that the stake is slashed
+func (pBlockchain *Blockchain) PendingSlashings() []Equivocation {
+	rSlashings := make([]Equivocation, 0)
+	included := make(map[string]bool)
+	for _, v := range pBlockchain.Equivocations {
+		offender := v.First.Producer
+		if included[offender] || pBlockchain.State[StakeAccount(offender)] <= 0 {
+			continue
+		}
+		included[offender] = true
+		rSlashings = append(rSlashings, v)
+	}
+	return rSlashings
+}
+
+// Register the block as produced by its producer in its slot. If the producer had already signed a
+// different block for the same slot, the equivocation is kept so that it can be slashed
+func (pBlockchain *Blockchain) recordProducer(pBlock Block) {
+	if pBlock.Producer == "" {
+		return
+	}
+	key := pBlock.Producer + "/" + strconv.Itoa(pBlock.Slot)
+	if first, ok := pBlockchain.producedBlocks[key]; ok && first != pBlock.Hash {
+		pBlockchain.Equivocations = append(pBlockchain.Equivocations, Equivocation{
+			First:  pBlockchain.KnownBlocks[first].Block,
+			Second: pBlock,
+		})
+		return
+	}
+	pBlockchain.producedBlocks[key] = pBlock.Hash
+}
+
+func (ProofOfStake) Name() string {
+	return "proof-of-stake"
+}
+
+// Wait for a slot after the one of the parent in which the node is selected, then sign the block.
+// The equivocations still pending are included so that they are slashed
+func (ProofOfStake) SealBlock(pContext context.Context, pNode *NodeBlockchain, pParent Block, pBlock *Block) error {
+	validator := pNode.ValidatorKey()
+	pBlock.Producer = validator
+	pBlock.Difficulty = 0
+	for {
+		mutex.Lock()
+		genesisTime := pNode.DataStructure.KnownBlocks[pNode.DataStructure.Tree.Genesis].Block.Timestamp
+		now := pNode.DataStructure.Clock.Now()
+		slot := SlotAt(genesisTime, now)
+		if slot > pParent.Slot && pNode.DataStructure.SlotLeader(pParent.Hash, slot) == validator {
+			pBlock.Timestamp = now
+			pBlock.Slot = slot
+			pBlock.Slashings = pNode.DataStructure.PendingSlashings()
+			mutex.Unlock()
+			break
+		}
+		mutex.Unlock()
+		// Wait until the next slot starts
+		select {
+		case <-pContext.Done():
+			return pContext.Err()
+		case <-time.After(genesisTime.Add(time.Duration(slot+1) * SlotDuration).Sub(now)):
+		}
+	}
+	pBlock.Hash = CalculateHash(*pBlock)
+	pBlock.Signature = components.Sign(pNode.Node, pBlock.Hash)
+	return nil
+}
+
+func (ProofOfStake) VerifyBlock(pBlockchain *Blockchain, pBlock, pParent Block) error {
+	genesisTime := pBlockchain.KnownBlocks[pBlockchain.Tree.Genesis].Block.Timestamp
+	switch true {
+	// Signed blocks don't have proof of work, so they can't add more weight than one block
+	case pBlock.Difficulty != 0:
+		return errors.New("a signed block can't have difficulty")
+	// One slot per block, and the slot matches the timestamp
+	case pBlock.Slot <= pParent.Slot:
+		return errors.New("the slot must be after the one of the previous block")
+	case pBlock.Slot != SlotAt(genesisTime, pBlock.Timestamp):
+		return errors.New("the slot doesn't match the timestamp")
+	// Signature of the producer
+	case !isSignatureValid(pBlock):
+		return errors.New("the signature of the producer is not valid")
+	default:
+		return nil
+	}
+}
+
+// Check that the producer was selected for the slot and that the equivocations can be slashed.
+// The whole stake of each offender is burned
+func (ProofOfStake) VerifyConnection(pBlockchain *Blockchain, pBlock Block) ([]components.Transaction, error) {
+	if pBlockchain.SlotLeader(pBlock.PrevHash, pBlock.Slot) != pBlock.Producer {
+		return nil, errors.New("the producer wasn't selected for the slot")
+	}
+	rSlashings := make([]components.Transaction, 0, len(pBlock.Slashings))
+	slashed := make(map[string]bool)
+	for _, v := range pBlock.Slashings {
+		offender := v.First.Producer
+		stake := pBlockchain.State[StakeAccount(offender)]
+		switch true {
+		case offender == "" || v.Second.Producer != offender || v.First.Slot != v.Second.Slot:
+			return nil, errors.New("the blocks of the equivocation don't share producer and slot")
+		case v.First.Hash == v.Second.Hash:
+			return nil, errors.New("the blocks of the equivocation are the same")
+		case !HasCorrectHash(v.First) || !HasCorrectHash(v.Second):
+			return nil, errors.New("the hash of a block of the equivocation doesn't match")
+		case !isSignatureValid(v.First) || !isSignatureValid(v.Second):
+			return nil, errors.New("a block of the equivocation isn't signed by its producer")
+		case slashed[offender] || stake <= 0:
+			return nil, errors.New("the producer of the equivocation has no stake to slash")
+		}
+		slashed[offender] = true
+		rSlashings = append(rSlashings, components.CreateTransaction(StakeAccount(offender), StakeAccount(offender), BurnAccount, stake))
+	}
+	return rSlashings, nil
+}
+
+// Whether the signature of the block was made over its hash by the key of its producer
+func isSignatureValid(pBlock Block) bool {
+	return components.VerifySignature(pBlock.Producer, pBlock.Hash, pBlock.Signature)
+}
@@ -1,8 +1,6 @@
 package blockchain
 
 import (
-	"crypto/sha256"
-	"encoding/hex"
 	"errors"
 	"github.com/gcubillos/isis-3007-distributed-ledger/data-structures/shared-components"
 	"strconv"
@@ -16,7 +14,15 @@ import (
 // The number of leading zeroes wanted from the hash when doing the proof of work
 var Difficulty = 1
 
+// Amount minted by each block for its producer, depending on its height
+var Subsidy components.SubsidySchedule = components.ConstantSubsidy{Value: 1}
+
 // What a block in the blockchain contains
+// Mined blocks have a Nonce and a Difficulty. Signed blocks have instead the Producer that signed
+// them, the Slot in which they were produced and its Signature over the hash, along with the
+// equivocations of other producers that are slashed by the block.
+// Algorithm is the name of the function used to calculate the hash, which is chosen in the genesis
+// block and kept by every block after it. Single SHA-256 is used when it is empty
 type Block struct {
 	Timestamp    time.Time
 	Hash         string
@@ -24,70 +30,249 @@ type Block struct {
 	Nonce        int
 	Transactions []components.Transaction
 	Difficulty   int
+	Producer     string
+	Slot         int
+	Signature    string
+	Slashings    []Equivocation
+	Algorithm    string
 }
 
 // What the blockchain data structure contains
+// Blocks is the active chain, going from the genesis block to the current tip, and State is
+// the state at the end of the active chain. The state is never sent to other nodes, each node
+// computes it by connecting the blocks itself.
+// Tree keeps every valid block that has been received, including the ones belonging to side
+// branches, and KnownBlocks holds their contents indexed by hash. ForkChoice is the rule used
+// to decide which block of the tree is the tip of the active chain, and Consensus the engine used
+// to produce and validate the blocks. Equivocations keeps the producers found signing two different
+// blocks for the same slot. Clock is the network-adjusted clock of the node, which each copy has its own
 type Blockchain struct {
-	Blocks []Block
-	State  map[string]float64
+	Blocks          []Block
+	State           map[string]float64       `json:"-"`
+	Tree            components.BlockTree     `json:"-"`
+	KnownBlocks     map[string]*KnownBlock   `json:"-"`
+	TipHash         string                   `json:"-"`
+	ForkChoice      components.ForkChoice    `json:"-"`
+	Consensus       Consensus                `json:"-"`
+	Reorganizations []Reorganization         `json:"-"`
+	Equivocations   []Equivocation           `json:"-"`
+	Clock           *components.NetworkClock `json:"-"`
+	producedBlocks  map[string]string
+}
+
+// What is kept for every block of the tree
+// Undo is the journal of the changes the block made to the state, it is only present while
+// the block is connected to the active chain
+type KnownBlock struct {
+	Block Block
+	Undo  []StateChange
+}
+
+// What is registered in the undo journal every time a transaction modifies an account
+// The previous balance is restored when the block is disconnected, and the account is
+// deleted if it didn't exist before the block
+type StateChange struct {
+	Account         string
+	Existed         bool
+	PreviousBalance float64
+}
+
+// What is registered every time the active chain changes from one branch to another
+// Depth is the number of blocks that were disconnected from the active chain
+type Reorganization struct {
+	Timestamp time.Time
+	OldTip    string
+	NewTip    string
+	ForkHash  string
+	Depth     int
+	Connected int
+}
+
+// *** Constructors ***
+
+// Create a blockchain that only contains the genesis block
+// The initial state is the state at the end of the genesis block, the fork-choice rule
+// decides which branch is followed when there are forks and the consensus engine how blocks are produced
+func CreateBlockchain(pGenesisBlock Block, pInitialState map[string]float64, pForkChoice components.ForkChoice, pConsensus Consensus) Blockchain {
+	rBlockchain := Blockchain{
+		Blocks:          []Block{pGenesisBlock},
+		State:           make(map[string]float64, len(pInitialState)),
+		Tree:            components.CreateBlockTree(pGenesisBlock.Hash, BlockWork(pGenesisBlock.Difficulty)),
+		KnownBlocks:     make(map[string]*KnownBlock),
+		TipHash:         pGenesisBlock.Hash,
+		ForkChoice:      pForkChoice,
+		Consensus:       pConsensus,
+		Reorganizations: make([]Reorganization, 0),
+		Equivocations:   make([]Equivocation, 0),
+		Clock:           components.CreateNetworkClock(),
+		producedBlocks:  make(map[string]string),
+	}
+	for k, v := range pInitialState {
+		rBlockchain.State[k] = v
+	}
+	rBlockchain.KnownBlocks[pGenesisBlock.Hash] = &KnownBlock{Block: pGenesisBlock}
+	return rBlockchain
 }
 
 // *** Methods ***
 
-// Generate Hash of a block
+// Generate Hash of a block with the proof of work function of the block. The signature isn't part
+// of it, since it is made over the hash. The timestamp is included with its canonical encoding.
+// Panics when the function is unknown, so the blocks received from peers are checked with HasCorrectHash
 func CalculateHash(block Block) string {
-	record := strconv.Itoa(block.Nonce) + block.Timestamp.String() + block.PrevHash
-	h := sha256.New()
-	h.Write([]byte(record))
-	return hex.EncodeToString(h.Sum(nil))
+	record := strconv.Itoa(block.Nonce) + components.EncodeTimestamp(block.Timestamp) + block.PrevHash + block.Producer + strconv.Itoa(block.Slot) + block.Algorithm
+	for _, v := range block.Transactions {
+		record += v.Origin + v.SenderSignature + v.Destination + strconv.FormatFloat(v.Value, 'f', -1, 64) + strconv.FormatInt(v.Nonce, 10)
+	}
+	for _, v := range block.Slashings {
+		record += v.First.Hash + v.Second.Hash
+	}
+	algorithm, err := components.ProofOfWorkByName(block.Algorithm)
+	check(err)
+	return algorithm.Sum([]byte(record))
 }
 
-// Function that checks whether a block is valid
-// TODO: Receives a boolean parameter that indicates whether it is a new block or not.
-// This is done as a way to reverse the state and checking it
-func (pBlockchain *Blockchain) IsBlockValid(newBlock, oldBlock Block) (bool, error) {
-	// Validating previous blocks until the genesis block is reached
-	if oldBlock.PrevHash != "" {
-		// Finding parent of block
-		var parentOfBlock Block
-		for _, v := range pBlockchain.Blocks {
-			if v.PrevHash == oldBlock.Hash {
-				parentOfBlock = v
-				break
-			}
+// Whether the hash of the block is the one calculated from it. A block whose proof of work function
+// is unknown doesn't have a correct hash
+func HasCorrectHash(pBlock Block) bool {
+	if _, err := components.ProofOfWorkByName(pBlock.Algorithm); err != nil {
+		return false
+	}
+	return CalculateHash(pBlock) == pBlock.Hash
+}
+
+// Amount of work a block with the given difficulty represents. Since the difficulty is the number
+// of leading hexadecimal zeroes, each extra zero requires sixteen times more hashes on average
+func BlockWork(pDifficulty int) int {
+	return 1 << (4 * uint(pDifficulty))
+}
+
+// Create a copy of the blockchain that doesn't share its state nor its tree with the original one.
+// Needed since several nodes in the same process may start from the same structure. The copy starts
+// with a clock of its own, without offsets from peers
+func (pBlockchain *Blockchain) Copy() Blockchain {
+	rBlockchain := Blockchain{
+		Blocks:          make([]Block, len(pBlockchain.Blocks)),
+		State:           make(map[string]float64, len(pBlockchain.State)),
+		Tree:            pBlockchain.Tree.Copy(),
+		KnownBlocks:     make(map[string]*KnownBlock, len(pBlockchain.KnownBlocks)),
+		TipHash:         pBlockchain.TipHash,
+		ForkChoice:      pBlockchain.ForkChoice,
+		Consensus:       pBlockchain.Consensus,
+		Reorganizations: make([]Reorganization, len(pBlockchain.Reorganizations)),
+		Equivocations:   make([]Equivocation, len(pBlockchain.Equivocations)),
+		Clock:           components.CreateNetworkClock(),
+		producedBlocks:  make(map[string]string, len(pBlockchain.producedBlocks)),
+	}
+	copy(rBlockchain.Blocks, pBlockchain.Blocks)
+	copy(rBlockchain.Reorganizations, pBlockchain.Reorganizations)
+	copy(rBlockchain.Equivocations, pBlockchain.Equivocations)
+	for k, v := range pBlockchain.producedBlocks {
+		rBlockchain.producedBlocks[k] = v
+	}
+	for k, v := range pBlockchain.State {
+		rBlockchain.State[k] = v
+	}
+	for k, v := range pBlockchain.KnownBlocks {
+		rBlockchain.KnownBlocks[k] = &KnownBlock{
+			Block: v.Block,
+			Undo:  append([]StateChange(nil), v.Undo...),
 		}
-		// Previous block exists and is valid
-		if condition, _ := pBlockchain.IsBlockValid(oldBlock, parentOfBlock); !condition {
-			return false, errors.New("previous Block isn't valid")
+	}
+	return rBlockchain
+}
+
+// Function that checks whether a block is valid in relation to its parent
+// The parent has to be part of the block tree, though not necessarily the tip of the active chain.
+// The timestamp must be after the median timestamp of the last blocks, so that a single producer can't
+// move the time of the chain back, and not too far ahead of the network-adjusted clock of the node.
+// The last transaction must be the coinbase, minting the subsidy for the height of the block, and no
+// other transaction can mint currency. The fields that depend on the consensus engine are checked by it.
+// The transactions are verified against the state once the block is connected to the active chain
+func (pBlockchain *Blockchain) IsBlockValid(newBlock, oldBlock Block) (bool, error) {
+	parentNode, ok := pBlockchain.Tree.Nodes[oldBlock.Hash]
+	switch true {
+	// Previous block exists in the block tree
+	case !ok:
+		return false, errors.New("previous block is not part of the block tree")
+	// Previous block didn't fail when connecting it
+	case parentNode.Invalid:
+		return false, errors.New("previous block isn't valid")
+	// Timestamp
+	case !newBlock.Timestamp.After(pBlockchain.MedianTimePast(oldBlock)):
+		return false, errors.New("timestamp is not after the median time past")
+	case pBlockchain.Clock.IsTooFarAhead(newBlock.Timestamp):
+		return false, errors.New("timestamp is too far in the future")
+	// Previous block hash comparison
+	case oldBlock.Hash != newBlock.PrevHash:
+		return false, errors.New("hash of previous block doesn't match")
+	// The hash function is the one of the genesis block
+	case newBlock.Algorithm != oldBlock.Algorithm:
+		return false, errors.New("hash function differs from the one of the previous block")
+	// Does the corresponding hash match
+	case !HasCorrectHash(newBlock):
+		return false, errors.New("calculated hash doesn't match")
+	// Currency is only minted by the coinbase
+	case !isCoinbaseValid(newBlock, parentNode.Height+1):
+		return false, errors.New("the coinbase of the block isn't the expected one")
+	default:
+		if err := pBlockchain.Consensus.VerifyBlock(pBlockchain, newBlock, oldBlock); err != nil {
+			return false, err
 		}
-		switch true {
-		// Previous block exists in the blockchain. It is assumed it is valid
-		case oldBlock.Hash != pBlockchain.Blocks[len(pBlockchain.Blocks)-1].Hash:
-			return false, errors.New("oldBlock's hash doesn't seem to match the latest block in the blockchain")
-		// Timestamp
-		case !oldBlock.Timestamp.Before(newBlock.Timestamp):
-			return false, errors.New("timestamp is not valid")
-		// Previous block hash comparison
-		case oldBlock.Hash != newBlock.PrevHash:
-			return false, errors.New("hash of previous block doesn't match")
-		// Does the corresponding hash match
-		case CalculateHash(newBlock) != newBlock.Hash:
-			return false, errors.New("calculated hash doesn't match")
-		// Checking proof of work
-		case !IsHashValid(newBlock.Hash, newBlock.Difficulty):
-			return false, errors.New("the proof of work is not valid")
-		// Verifying state transition
-		case !pBlockchain.verifyStateTransition(newBlock.Transactions, pBlockchain.State):
-			return false, errors.New("the transactions are inconsistent with the state")
-		default:
-			return true, nil
-		}
-
-	} else {
 		return true, nil
 	}
 }
 
+// Median timestamp of the last blocks of the chain ending in the given block, which must be in the tree
+// or be the parent of one that is
+func (pBlockchain *Blockchain) MedianTimePast(pBlock Block) time.Time {
+	timestamps := []time.Time{pBlock.Timestamp}
+	for theBlock, ok := pBlockchain.KnownBlocks[pBlock.PrevHash]; ok && len(timestamps) < components.MedianTimeBlocks; theBlock, ok = pBlockchain.KnownBlocks[theBlock.Block.PrevHash] {
+		timestamps = append(timestamps, theBlock.Block.Timestamp)
+	}
+	return components.MedianTime(timestamps)
+}
+
+// Timestamp for a child of the given block, the time of the network-adjusted clock unless it isn't
+// after the median time past
+func (pBlockchain *Blockchain) NextTimestamp(pParent Block) time.Time {
+	rTimestamp := pBlockchain.Clock.Now()
+	if medianTime := pBlockchain.MedianTimePast(pParent); !rTimestamp.After(medianTime) {
+		rTimestamp = medianTime.Add(time.Nanosecond)
+	}
+	return rTimestamp
+}
+
+// Whether the only transaction of the block that mints currency is the last one, and it mints the
+// subsidy for the given height with the height as its nonce
+func isCoinbaseValid(pBlock Block, pHeight int) bool {
+	numberTransactions := len(pBlock.Transactions)
+	if numberTransactions == 0 {
+		return false
+	}
+	for _, v := range pBlock.Transactions[:numberTransactions-1] {
+		if components.IsCoinbase(v) {
+			return false
+		}
+	}
+	coinbase := pBlock.Transactions[numberTransactions-1]
+	return components.IsCoinbase(coinbase) && coinbase.Value == Subsidy.Subsidy(pHeight) && coinbase.Nonce == int64(pHeight)
+}
+
+// Rewards minted by the active chain that the next block can't spend yet, by account
+func (pBlockchain *Blockchain) immatureCoinbase() map[string]float64 {
+	rLocked := make(map[string]float64)
+	nextHeight := len(pBlockchain.Blocks)
+	for i := nextHeight - 1; i > 0 && !components.IsMature(i, nextHeight); i-- {
+		for _, v := range pBlockchain.Blocks[i].Transactions {
+			if components.IsCoinbase(v) {
+				rLocked[v.Destination] += v.Value
+			}
+		}
+	}
+	return rLocked
+}
+
 // Checks whether the hash is valid by checking if it starts with the given number of zeroes specified in the difficulty
 // TODO: Check whether it influences if the block has more than the difficulty number of leading zeroes. Does it matter?
 func IsHashValid(hash string, difficulty int) bool {
@@ -95,55 +280,276 @@ func IsHashValid(hash string, difficulty int) bool {
 	return strings.HasPrefix(hash, prefix)
 }
 
-// that is that the transitions in the state are valid
+// Add a block to the block tree. The fork-choice rule is applied afterwards and, if it chooses a
+// block outside the active chain, the active chain is reorganized towards it
+func (pBlockchain *Blockchain) AddBlock(pBlock Block) error {
+	// Block was already received
+	if pBlockchain.Tree.Contains(pBlock.Hash) {
+		return nil
+	}
+	parentBlock, ok := pBlockchain.KnownBlocks[pBlock.PrevHash]
+	if !ok {
+		return errors.New("parent block is unknown")
+	}
+	if ok, err := pBlockchain.IsBlockValid(pBlock, parentBlock.Block); !ok {
+		return err
+	}
+	// Include the block in the tree
+	check(pBlockchain.Tree.AddNode(pBlock.Hash, pBlock.PrevHash, BlockWork(pBlock.Difficulty), nil))
+	pBlockchain.KnownBlocks[pBlock.Hash] = &KnownBlock{Block: pBlock}
+	pBlockchain.recordProducer(pBlock)
+
+	return pBlockchain.updateTip()
+}
+
+// Apply the fork-choice rule until the chosen tip can be connected. Every time a branch turns out
+// to be invalid, its blocks are excluded and the rule is applied again.
+// The error of the first branch that couldn't be connected is returned
+func (pBlockchain *Blockchain) updateTip() error {
+	var firstErr error
+	for {
+		newTip := pBlockchain.ForkChoice.SelectTip(&pBlockchain.Tree, pBlockchain.TipHash)
+		if newTip == pBlockchain.TipHash {
+			return firstErr
+		}
+		if err := pBlockchain.reorganize(newTip); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+}
+
+// Move the active chain to the given tip. The blocks of the current branch are disconnected until
+// reaching the fork block and then the blocks of the new branch are connected. If a block of the
+// new branch turns out to be invalid, it is marked as such and the previous active chain is restored
+func (pBlockchain *Blockchain) reorganize(pNewTip string) error {
+	oldTip := pBlockchain.TipHash
+	forkHash := pBlockchain.Tree.FindForkBlock(oldTip, pNewTip)
+
+	// Blocks of the new branch, ordered from the fork block to the new tip
+	newBranch := pBlockchain.Tree.PathFrom(forkHash, pNewTip)
+
+	// Disconnect the blocks of the current branch
+	disconnected := make([]Block, 0)
+	for pBlockchain.TipHash != forkHash {
+		disconnected = append(disconnected, pBlockchain.disconnectTip())
+	}
+
+	// Connect the blocks of the new branch
+	for i, v := range newBranch {
+		if err := pBlockchain.connectBlock(pBlockchain.KnownBlocks[v].Block); err != nil {
+			// Mark the block and its descendants as invalid and go back to the previous branch
+			pBlockchain.Tree.MarkInvalid(v)
+			for j := i - 1; j >= 0; j-- {
+				pBlockchain.disconnectTip()
+			}
+			for j := len(disconnected) - 1; j >= 0; j-- {
+				check(pBlockchain.connectBlock(disconnected[j]))
+			}
+			return err
+		}
+	}
+
+	if len(disconnected) > 0 {
+		pBlockchain.Reorganizations = append(pBlockchain.Reorganizations, Reorganization{
+			Timestamp: time.Now(),
+			OldTip:    oldTip,
+			NewTip:    pNewTip,
+			ForkHash:  forkHash,
+			Depth:     len(disconnected),
+			Connected: len(newBranch),
+		})
+	}
+	return nil
+}
+
+// Apply the transactions of a block that extends the tip of the active chain, followed by the ones
+// the consensus engine applies for it
+func (pBlockchain *Blockchain) connectBlock(pBlock Block) error {
+	if pBlock.PrevHash != pBlockchain.TipHash {
+		return errors.New("block doesn't extend the tip of the active chain")
+	}
+	consensusTransactions, err := pBlockchain.Consensus.VerifyConnection(pBlockchain, pBlock)
+	if err != nil {
+		return err
+	}
+	transactions := append(append([]components.Transaction(nil), pBlock.Transactions...), consensusTransactions...)
+	if !verifyStateTransition(transactions, pBlockchain.State, pBlockchain.immatureCoinbase()) {
+		return errors.New("the transactions are inconsistent with the state")
+	}
+	pBlockchain.KnownBlocks[pBlock.Hash].Undo = ApplyTransactions(pBlockchain.State, transactions)
+	pBlockchain.Blocks = append(pBlockchain.Blocks, pBlock)
+	pBlockchain.TipHash = pBlock.Hash
+	return nil
+}
+
+// Remove the tip of the active chain, rolling the state back with its undo journal, and return it
+func (pBlockchain *Blockchain) disconnectTip() Block {
+	tipBlock := pBlockchain.Blocks[len(pBlockchain.Blocks)-1]
+	tipNode := pBlockchain.KnownBlocks[tipBlock.Hash]
+	// Revert the changes in the opposite order they were registered
+	for i := len(tipNode.Undo) - 1; i >= 0; i-- {
+		v := tipNode.Undo[i]
+		if v.Existed {
+			pBlockchain.State[v.Account] = v.PreviousBalance
+		} else {
+			delete(pBlockchain.State, v.Account)
+		}
+	}
+	tipNode.Undo = nil
+	pBlockchain.Blocks = pBlockchain.Blocks[:len(pBlockchain.Blocks)-1]
+	pBlockchain.TipHash = tipBlock.PrevHash
+	return tipBlock
+}
+
+// Blocks going from the genesis block up to the given block
+func (pBlockchain *Blockchain) ChainTo(pHash string) []Block {
+	rBlocks := []Block{pBlockchain.KnownBlocks[pBlockchain.Tree.Genesis].Block}
+	for _, v := range pBlockchain.Tree.PathFrom(pBlockchain.Tree.Genesis, pHash) {
+		rBlocks = append(rBlocks, pBlockchain.KnownBlocks[v].Block)
+	}
+	return rBlocks
+}
+
+// Whether the given block is part of the active chain
+func (pBlockchain *Blockchain) IsInActiveChain(pHash string) bool {
+	theNode, ok := pBlockchain.Tree.Nodes[pHash]
+	return ok && theNode.Height < len(pBlockchain.Blocks) && pBlockchain.Blocks[theNode.Height].Hash == pHash
+}
+
+// Number of valid blocks in the tree that are not part of the active chain
+func (pBlockchain *Blockchain) CountOrphanedBlocks() int {
+	orphaned := 0
+	for _, v := range pBlockchain.Tree.Nodes {
+		if !v.Invalid && !pBlockchain.IsInActiveChain(v.Hash) {
+			orphaned++
+		}
+	}
+	return orphaned
+}
+
+// What the node knows about the transaction with the given identifier. When the transaction is part of
+// the active chain, its first block there is the one reported. Otherwise it is one of the blocks outside
+// the active chain that contain it, and the transaction is orphaned
+func (pBlockchain *Blockchain) Confirmation(pTransactionID string) components.Confirmation {
+	if i, ok := pBlockchain.transactionHeights()[pTransactionID]; ok {
+		return components.CreateConfirmation(pTransactionID, pBlockchain.Blocks[i].Hash, len(pBlockchain.Blocks)-i, false)
+	}
+	orphanedIn := ""
+	for k, v := range pBlockchain.KnownBlocks {
+		if pBlockchain.IsInActiveChain(k) || orphanedIn != "" && orphanedIn < k {
+			continue
+		}
+		for _, w := range v.Block.Transactions {
+			if w.ID() == pTransactionID {
+				orphanedIn = k
+				break
+			}
+		}
+	}
+	return components.CreateConfirmation(pTransactionID, orphanedIn, 0, false)
+}
+
+// Position in the active chain of the first block containing each transaction, by identifier
+func (pBlockchain *Blockchain) transactionHeights() map[string]int {
+	rHeights := make(map[string]int)
+	for i, v := range pBlockchain.Blocks {
+		for _, w := range v.Transactions {
+			if _, ok := rHeights[w.ID()]; !ok {
+				rHeights[w.ID()] = i
+			}
+		}
+	}
+	return rHeights
+}
+
+// Merges the blocks of another chain into the block tree. The active chain is replaced when the
+// fork-choice rule prefers the other chain, otherwise its blocks are kept as a side branch.
+// The state of the other chain is never trusted, it is recomputed by connecting its blocks
 func (pBlockchain *Blockchain) ReplaceChain(newBlockchain Blockchain) {
-	var forkBlock Block
-	diverges := false
-	// Find the place the fork occurs and history diverges
-	for i := 0; !diverges && i < len(pBlockchain.Blocks); i++ {
-		if pBlockchain.Blocks[i].Hash != newBlockchain.Blocks[i].Hash {
-			forkBlock = pBlockchain.Blocks[i-1]
-			diverges = true
+	for _, v := range newBlockchain.Blocks {
+		if pBlockchain.Tree.Contains(v.Hash) {
+			continue
+		}
+		if err := pBlockchain.AddBlock(v); err != nil {
+			// The rest of the received chain depends on this block
+			break
 		}
 	}
-	if forkBlock.Hash != pBlockchain.Blocks[0].Hash {
-		lenNewBlockchain := len(newBlockchain.Blocks)
-		// Verify length and validity of blocks in the received chain
-		if ok, _ := newBlockchain.IsBlockValid(newBlockchain.Blocks[lenNewBlockchain-1], newBlockchain.Blocks[lenNewBlockchain-2]); lenNewBlockchain > len(pBlockchain.Blocks) && ok {
-			pBlockchain.Blocks = newBlockchain.Blocks
-			pBlockchain.State = newBlockchain.State
+}
+
+// Receives a state and checks whether the transactions can be performed in order over it.
+// The given state isn't modified. Transactions minting currency are never valid on their own
+func VerifyStateTransition(pTransactions []components.Transaction, initialState map[string]float64) bool {
+	for _, v := range pTransactions {
+		if components.IsCoinbase(v) {
+			return false
 		}
 	}
+	return verifyStateTransition(pTransactions, initialState, nil)
 }
 
-// Receives a state and then performs the transactions and returns the modified state when it is valid
-func (pBlockchain *Blockchain) verifyStateTransition(pTransactions []components.Transaction, initialState map[string]float64) bool {
-	modifiedState := initialState
+// Checks whether the transactions can be performed in order over the state, where the locked amount of
+// each account can't be spent. The coinbase mints its value, the block rules decide whether it can.
+// The currency sent to the burn account is destroyed
+func verifyStateTransition(pTransactions []components.Transaction, initialState map[string]float64, pLocked map[string]float64) bool {
+	// Balances of the accounts that have been modified by the transactions
+	modifiedState := make(map[string]float64, 0)
+	balance := func(pAccount string) float64 {
+		if value, ok := modifiedState[pAccount]; ok {
+			return value
+		}
+		return initialState[pAccount]
+	}
 	for _, v := range pTransactions {
 		switch true {
 		// TODO: Verifying signature, doing it in the same main function?
 		// Signature of sender does not match the owner of the UTXO
 		// Transaction is well formed
-		case pBlockchain.State[v.Origin] < 0:
+		case v.Value < 0:
 			return false
-		// UTXO is not in the state
-		case pBlockchain.State[v.Origin] < v.Value:
+		case components.IsCoinbase(v):
+			modifiedState[v.Destination] = balance(v.Destination) + v.Value
+			continue
+		// UTXO is not in the state, or it is a reward that hasn't matured
+		case balance(v.Origin)-pLocked[v.Origin] < v.Value:
 			return false
 		}
 		// Update state
-		modifiedState[v.Origin] -= v.Value
+		modifiedState[v.Origin] = balance(v.Origin) - v.Value
+		if v.Destination != BurnAccount {
+			modifiedState[v.Destination] = balance(v.Destination) + v.Value
+		}
+	}
+	return true
+}
+
+// Performs the transactions over the given state and returns the undo journal needed to revert
+// them. They must have been verified before. The coinbase only credits its destination, and the
+// burn account is never credited
+func ApplyTransactions(pState map[string]float64, pTransactions []components.Transaction) []StateChange {
+	journal := make([]StateChange, 0, 2*len(pTransactions))
+	record := func(pAccount string) {
+		previousBalance, existed := pState[pAccount]
+		journal = append(journal, StateChange{Account: pAccount, Existed: existed, PreviousBalance: previousBalance})
+	}
+	for _, v := range pTransactions {
+		if !components.IsCoinbase(v) {
+			record(v.Origin)
+			pState[v.Origin] -= v.Value
+		}
+		if v.Destination == BurnAccount {
+			continue
+		}
+		record(v.Destination)
 		// Checking that the recipient of the UTXO exists. If not, create it
-		if _, ok := modifiedState[v.Destination]; ok {
-			modifiedState[v.Destination] += v.Value
+		if _, ok := pState[v.Destination]; ok {
+			pState[v.Destination] += v.Value
 		} else {
-			modifiedState[v.Destination] = v.Value
+			pState[v.Destination] = v.Value
 		}
 	}
-	// Update the final state
-	initialState = modifiedState
-	return true
+	return journal
 }
 
 // TODO: Adding a limit for number of transactions in a block?
-// TODO: Add a function to request to add a transaction to a block
 // TODO: Standardize names through out the implementations
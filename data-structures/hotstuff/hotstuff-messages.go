@@ -0,0 +1,83 @@
+package hotstuff
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/gcubillos/isis-3007-distributed-ledger/data-structures/blockchain"
+	"github.com/gcubillos/isis-3007-distributed-ledger/data-structures/shared-components"
+	"strconv"
+)
+
+// *** Structs ***
+
+// Types of messages exchanged by the replicas
+const (
+	// Transactions submitted to the replicas, which the leaders order into blocks
+	Request = "request"
+	// Node of the tree proposed by the leader of a view, carrying the certificate of its parent
+	Proposal = "proposal"
+	// A replica accepted the proposal of a view. It is only sent to the leader of the next view
+	Vote = "vote"
+	// A replica gave up on a view and moved to the next one. It is only sent to the leader of that view,
+	// along with the highest certificate the replica knows
+	NewView = "new-view"
+)
+
+// What a message between replicas contains
+// Digest is the digest of the node of the tree the message is about. A proposal carries the Node and a
+// new view the Certificate. Every message but the requests is signed by the Replica that sent it,
+// identified by its key
+type Message struct {
+	Type         string
+	View         int
+	Digest       string
+	Node         *TreeNode
+	Certificate  *QuorumCertificate
+	Transactions []components.Transaction
+	Replica      string
+	Signature    string
+}
+
+// What a replica knows about the validators: the key that identifies it and the address to reach it
+type Validator struct {
+	Key     string
+	Address string
+}
+
+// Proof that a quorum of replicas voted for a node of the tree in a view
+type QuorumCertificate struct {
+	View   int
+	Digest string
+	Votes  []Message
+}
+
+// What a node of the tree contains: a block, whose slot is the view in which it was proposed and whose
+// previous hash is the digest of its parent, and the certificate of its parent that justifies it
+type TreeNode struct {
+	Block   blockchain.Block
+	Justify QuorumCertificate
+}
+
+// *** Methods ***
+
+// Data signed by the replica that sends the message
+func (pMessage *Message) signedData() string {
+	return pMessage.Type + strconv.Itoa(pMessage.View) + pMessage.Digest + pMessage.Replica
+}
+
+// Whether the message was signed by its replica
+func (pMessage *Message) isSignatureValid() bool {
+	return components.VerifySignature(pMessage.Replica, pMessage.signedData(), pMessage.Signature)
+}
+
+// Digest of the node, which covers both the block and the certificate that justifies it
+func (pNode *TreeNode) Digest() string {
+	h := sha256.New()
+	h.Write([]byte(pNode.Block.Hash + strconv.Itoa(pNode.Justify.View) + pNode.Justify.Digest))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// View in which the node was proposed
+func (pNode *TreeNode) View() int {
+	return pNode.Block.Slot
+}
@@ -0,0 +1,560 @@
+package hotstuff
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/gcubillos/isis-3007-distributed-ledger/data-structures/blockchain"
+	"github.com/gcubillos/isis-3007-distributed-ledger/data-structures/shared-components"
+	"github.com/perlin-network/noise"
+	"sync"
+	"time"
+)
+
+// Mutual exclusion variable
+var mutex = &sync.Mutex{}
+
+// Time a node waits for a replica to acknowledge a message
+var RequestTimeout = 2 * time.Second
+
+// Time the replicas wait for a view to make progress while there is work left, before moving to the
+// next one. It doubles after each view that fails in a row, until one makes progress
+var ViewTimeout = 500 * time.Millisecond
+
+// Maximum number of transactions the leader orders in a block
+var BlockSize = 500
+
+// Number of consecutive views each leader leads. A node is committed once nodes of three consecutive
+// views follow it and the leader of the fourth view certifies the last one, so with a leader per view
+// a single replica that leaves the network could stop a small network from committing
+var ViewsPerLeader = 4
+
+// *** Structs ***
+
+// Declaration of a replica in the network
+// Contains the underlying data structure as well as the node from the noise library.
+// Validators is the known set of replicas, the same for every one of them. Leaders take turns in the
+// order of the validators, each one leading ViewsPerLeader views in a row. The replica keeps the last
+// view it voted in, the node it is locked on, the highest certificate it knows and the last view it
+// proposed in as a leader. As the leader of the next view it collects the votes for each node, and as
+// the leader of a later view the new views sent to it. Proposals that arrived before their parent wait
+// for it. MessagesSent counts the messages the replica sent to the others
+type NodeHotStuff struct {
+	DataStructure HotStuff
+	Node          *noise.Node
+	Validators    []Validator
+	View          int
+	MessagesSent  int
+	votedView     int
+	locked        string
+	highCert      QuorumCertificate
+	proposedView  int
+	votes         map[string]map[string]Message
+	certified     map[string]bool
+	newViews      map[int]map[string]Message
+	orphans       map[string][]Message
+	pending       []components.Transaction
+	isPending     map[components.Transaction]bool
+	lastProgress  time.Time
+	failedViews   int
+	outbox        []outgoing
+	stopped       bool
+}
+
+// Message waiting to be sent, along with the key of the only replica that receives it, or an empty key
+// if every other replica receives it
+type outgoing struct {
+	To      string
+	Message Message
+}
+
+// *** Constructors ***
+
+// Create a replica that listens to the network. The genesis block and the "main" account with the
+// amount of available currency must be the same for every replica. The replica doesn't take part in
+// the protocol until it is started with the validator set
+func CreateNode(pGenesisBlock blockchain.Block, pAvailableCurrency float64) *NodeHotStuff {
+	thisNode := &NodeHotStuff{
+		View:      1,
+		votes:     make(map[string]map[string]Message),
+		certified: make(map[string]bool),
+		newViews:  make(map[int]map[string]Message),
+		orphans:   make(map[string][]Message),
+		isPending: make(map[components.Transaction]bool),
+		stopped:   true,
+	}
+	// For simplicity a "main" account will be created that contains the amount of currency available
+	thisNode.DataStructure = CreateHotStuff(pGenesisBlock, map[string]float64{"main": pAvailableCurrency})
+	thisNode.locked = thisNode.DataStructure.Genesis
+	thisNode.highCert = thisNode.DataStructure.GenesisCertificate()
+
+	// Create network node
+	networkNode, err := noise.NewNode()
+	check(err)
+
+	// Assign the way the node will handle the messages of the other replicas
+	networkNode.Handle(thisNode.handleRequest)
+
+	// Make the node listen to the network
+	check(networkNode.Listen())
+	thisNode.Node = networkNode
+
+	return thisNode
+}
+
+// *** Methods ***
+
+// How the other replicas know this one. It is only valid once the node listens
+func (pNode *NodeHotStuff) Validator() Validator {
+	return Validator{Key: pNode.Node.ID().ID.String(), Address: pNode.Node.Addr()}
+}
+
+// Start taking part in the protocol with the given validator set, which must include the replica
+// and be in the same order for every replica. The pacemaker of the replica checks periodically that
+// the current view makes progress
+func (pNode *NodeHotStuff) Start(pValidators []Validator) {
+	mutex.Lock()
+	pNode.Validators = pValidators
+	pNode.lastProgress = time.Now()
+	pNode.stopped = false
+	pNode.propose()
+	pNode.flush()
+	go func() {
+		for {
+			time.Sleep(ViewTimeout / 4)
+			mutex.Lock()
+			if pNode.stopped {
+				mutex.Unlock()
+				return
+			}
+			pNode.checkTimeout()
+			pNode.flush()
+		}
+	}()
+}
+
+// Stop taking part in the protocol and close the network node
+func (pNode *NodeHotStuff) Close() {
+	mutex.Lock()
+	pNode.stopped = true
+	mutex.Unlock()
+	check(pNode.Node.Close())
+}
+
+// Send transactions to every replica so that the leaders order them in blocks
+func (pNode *NodeHotStuff) Submit(pTransactions []components.Transaction) {
+	mutex.Lock()
+	pNode.send("", Message{Type: Request, Transactions: pTransactions})
+	pNode.flush()
+}
+
+// Number of replicas that may be faulty without affecting the protocol
+func (pNode *NodeHotStuff) faulty() int {
+	return (len(pNode.Validators) - 1) / 3
+}
+
+// Number of replicas that must agree on something: all of them but the faulty ones, so that any two
+// quorums share a correct replica for any size of the set
+func (pNode *NodeHotStuff) quorum() int {
+	return len(pNode.Validators) - pNode.faulty()
+}
+
+// Key of the leader of the given view
+func (pNode *NodeHotStuff) leader(pView int) string {
+	return pNode.Validators[pView/ViewsPerLeader%len(pNode.Validators)].Key
+}
+
+// Whether the key belongs to the validator set
+func (pNode *NodeHotStuff) isValidator(pKey string) bool {
+	for _, v := range pNode.Validators {
+		if v.Key == pKey {
+			return true
+		}
+	}
+	return false
+}
+
+// Sign a message of the replica and queue it to be sent to the given replica, or to every other one if
+// the key is empty. The replica processes its own messages right away. It is called with the mutex locked
+func (pNode *NodeHotStuff) send(pTo string, pMessage Message) {
+	self := pNode.Validator().Key
+	if pMessage.Type != Request {
+		pMessage.Replica = self
+		pMessage.Signature = components.Sign(pNode.Node, pMessage.signedData())
+	}
+	if pTo != self {
+		pNode.outbox = append(pNode.outbox, outgoing{To: pTo, Message: pMessage})
+	}
+	if pTo == "" || pTo == self {
+		pNode.process(pMessage)
+	}
+}
+
+// Unlock the mutex and send the queued messages to the other replicas. Messages are sent without
+// holding the structure, so that the replicas can answer each other, and each replica receives them
+// in order. A replica that left the network doesn't delay the messages to the others
+func (pNode *NodeHotStuff) flush() {
+	outbox := pNode.outbox
+	pNode.outbox = nil
+	self := pNode.Validator().Key
+	messages := make(map[string][][]byte)
+	for _, v := range outbox {
+		bytes, err := json.Marshal(v.Message)
+		check(err)
+		for _, w := range pNode.Validators {
+			if w.Key != self && (v.To == "" || v.To == w.Key) {
+				messages[w.Address] = append(messages[w.Address], bytes)
+				pNode.MessagesSent++
+			}
+		}
+	}
+	mutex.Unlock()
+	for k, v := range messages {
+		go func(pAddress string, pMessages [][]byte) {
+			for _, w := range pMessages {
+				// A replica that is too busy to answer doesn't stop the next messages from being sent
+				ctx, cancel := context.WithTimeout(context.Background(), RequestTimeout)
+				_, _ = pNode.Node.Request(ctx, pAddress, w)
+				cancel()
+			}
+		}(k, v)
+	}
+}
+
+// Handle the messages of the other replicas
+func (pNode *NodeHotStuff) handleRequest(ctx noise.HandlerContext) error {
+	if !ctx.IsRequest() {
+		return nil
+	}
+	var received Message
+	if err := json.Unmarshal(ctx.Data(), &received); err != nil {
+		return ctx.Send([]byte(""))
+	}
+	if err := ctx.Send([]byte("")); err != nil {
+		return err
+	}
+
+	mutex.Lock()
+	if pNode.stopped {
+		mutex.Unlock()
+		return nil
+	}
+	// Only the requests are accepted from outside the validator set
+	if received.Type == Request || pNode.isValidator(received.Replica) && received.isSignatureValid() {
+		pNode.process(received)
+	}
+	pNode.flush()
+	return nil
+}
+
+// Process a message according to its type. It is called with the mutex locked
+func (pNode *NodeHotStuff) process(pMessage Message) {
+	switch pMessage.Type {
+	case Request:
+		pNode.addRequest(pMessage.Transactions)
+	case Proposal:
+		if pMessage.Node != nil && pMessage.Replica == pNode.leader(pMessage.View) {
+			pNode.acceptProposal(pMessage)
+		}
+	case Vote:
+		pNode.addVote(pMessage)
+	case NewView:
+		if pMessage.Certificate != nil {
+			pNode.addNewView(pMessage)
+		}
+	}
+}
+
+// Keep the transactions that aren't committed nor pending yet and that can be performed over the
+// committed state. The leader of the current view proposes them if it can
+func (pNode *NodeHotStuff) addRequest(pTransactions []components.Transaction) {
+	for _, v := range pTransactions {
+		if pNode.isPending[v] || pNode.DataStructure.IsTransactionCommitted(v) ||
+			!blockchain.VerifyStateTransition([]components.Transaction{v}, pNode.DataStructure.State) {
+			continue
+		}
+		pNode.pending = append(pNode.pending, v)
+		pNode.isPending[v] = true
+	}
+	pNode.propose()
+}
+
+// Whether the certificate proves that a quorum of validators voted for its node in its view. The
+// certificate of the genesis node needs no votes
+func (pNode *NodeHotStuff) isCertificateValid(pCertificate QuorumCertificate) bool {
+	if pCertificate.View == 0 {
+		return pCertificate.Digest == pNode.DataStructure.Genesis
+	}
+	voters := make(map[string]bool)
+	for _, v := range pCertificate.Votes {
+		if v.Type == Vote && v.View == pCertificate.View && v.Digest == pCertificate.Digest &&
+			pNode.isValidator(v.Replica) && v.isSignatureValid() {
+			voters[v.Replica] = true
+		}
+	}
+	return len(voters) >= pNode.quorum()
+}
+
+// Keep the certificate if it is higher than the highest one the replica knows
+func (pNode *NodeHotStuff) updateHighCert(pCertificate QuorumCertificate) {
+	if pCertificate.View > pNode.highCert.View {
+		pNode.highCert = pCertificate
+	}
+}
+
+// Whether there is work left: pending transactions, or nodes with transactions that aren't committed
+// yet. Those nodes need later nodes on top of them to be committed, even if the later ones are empty
+func (pNode *NodeHotStuff) hasWork() bool {
+	if len(pNode.pending) > 0 {
+		return true
+	}
+	executedView := pNode.DataStructure.Tree[pNode.DataStructure.Executed].View()
+	for _, v := range pNode.DataStructure.Tree {
+		if v.View() > executedView && len(v.Block.Transactions) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// If the replica is the leader of the current view and didn't propose in it yet, propose a node that
+// extends the node of the highest certificate. The leader may propose once it holds the certificate of
+// the previous view, or once a quorum moved to the view. The node contains the pending transactions
+// that its branch doesn't contain yet
+func (pNode *NodeHotStuff) propose() {
+	self := pNode.Validator().Key
+	switch true {
+	case len(pNode.Validators) == 0 || pNode.leader(pNode.View) != self || pNode.proposedView >= pNode.View:
+		return
+	case pNode.highCert.View != pNode.View-1 && len(pNode.newViews[pNode.View]) < pNode.quorum():
+		return
+	case !pNode.hasWork():
+		return
+	}
+	parent := pNode.DataStructure.Tree[pNode.highCert.Digest]
+	state, included, err := pNode.DataStructure.stateAt(pNode.highCert.Digest)
+	if parent == nil || err != nil {
+		return
+	}
+	transactions := make([]components.Transaction, 0)
+	for _, v := range pNode.pending {
+		if len(transactions) == BlockSize {
+			break
+		}
+		if !included[v] && blockchain.VerifyStateTransition(append(transactions, v), state) {
+			transactions = append(transactions, v)
+		}
+	}
+	// The monotonic clock reading is stripped, since it isn't kept when the block is sent to other replicas
+	newBlock := blockchain.Block{
+		Timestamp:    time.Now().Round(0),
+		PrevHash:     pNode.highCert.Digest,
+		Transactions: transactions,
+		Producer:     self,
+		Slot:         pNode.View,
+	}
+	if newBlock.Timestamp.Before(parent.Block.Timestamp) {
+		newBlock.Timestamp = parent.Block.Timestamp
+	}
+	newBlock.Hash = blockchain.CalculateHash(newBlock)
+	newBlock.Signature = components.Sign(pNode.Node, newBlock.Hash)
+	newNode := &TreeNode{Block: newBlock, Justify: pNode.highCert}
+	pNode.proposedView = pNode.View
+	pNode.send("", Message{Type: Proposal, View: pNode.View, Digest: newNode.Digest(), Node: newNode})
+}
+
+// Add the node proposed by the leader of a view to the tree, once its parent is known, and update the
+// state of the replica with the chain of certificates it carries. The replica votes for it if it didn't
+// vote in its view or a later one and the node is safe: either it extends the locked node, or its
+// certificate is newer than the locked node, which means a quorum moved past the lock. The vote goes
+// only to the leader of the next view
+func (pNode *NodeHotStuff) acceptProposal(pMessage Message) {
+	theNode := pMessage.Node
+	if pMessage.Digest != theNode.Digest() || pMessage.View != theNode.View() || pNode.DataStructure.Tree[pMessage.Digest] != nil {
+		return
+	}
+	if _, ok := pNode.DataStructure.Tree[theNode.Block.PrevHash]; !ok {
+		pNode.orphans[theNode.Block.PrevHash] = append(pNode.orphans[theNode.Block.PrevHash], pMessage)
+		return
+	}
+	if !pNode.isCertificateValid(theNode.Justify) {
+		return
+	}
+	if valid, _ := pNode.DataStructure.IsNodeValid(theNode, pMessage.Replica); !valid {
+		return
+	}
+	pNode.DataStructure.Tree[pMessage.Digest] = theNode
+	pNode.update(theNode)
+
+	lockedNode := pNode.DataStructure.Tree[pNode.locked]
+	safe := pNode.DataStructure.Extends(pMessage.Digest, pNode.locked) || theNode.Justify.View > lockedNode.View()
+	if pMessage.View > pNode.votedView && safe {
+		pNode.votedView = pMessage.View
+		if pMessage.View >= pNode.View {
+			pNode.View = pMessage.View + 1
+			pNode.lastProgress = time.Now()
+			pNode.failedViews = 0
+		}
+		pNode.send(pNode.leader(pMessage.View+1), Message{Type: Vote, View: pMessage.View, Digest: pMessage.Digest})
+	}
+
+	orphans := pNode.orphans[pMessage.Digest]
+	delete(pNode.orphans, pMessage.Digest)
+	for _, v := range orphans {
+		pNode.acceptProposal(v)
+	}
+	pNode.propose()
+}
+
+// Follow the chain of certificates of a new node. The certificate it carries may be the highest one.
+// Two certificates in a row lock the replica on the node certified first, and three certificates for
+// nodes of consecutive views commit the first of them along with its ancestors
+func (pNode *NodeHotStuff) update(pTreeNode *TreeNode) {
+	pNode.updateHighCert(pTreeNode.Justify)
+	tree := pNode.DataStructure.Tree
+	parent, ok := tree[pTreeNode.Justify.Digest]
+	if !ok || parent.View() == 0 {
+		return
+	}
+	grandparent, ok := tree[parent.Justify.Digest]
+	if !ok || grandparent.View() == 0 {
+		return
+	}
+	if grandparent.View() > tree[pNode.locked].View() {
+		pNode.locked = parent.Justify.Digest
+	}
+	greatGrandparent, ok := tree[grandparent.Justify.Digest]
+	if !ok || parent.View() != grandparent.View()+1 || grandparent.View() != greatGrandparent.View()+1 {
+		return
+	}
+	if greatGrandparent.View() > tree[pNode.DataStructure.Executed].View() {
+		pNode.commit(grandparent.Justify.Digest)
+	}
+}
+
+// Commit a node and its ancestors, and drop the pending transactions they contain, as well as the ones
+// that can no longer be performed
+func (pNode *NodeHotStuff) commit(pDigest string) {
+	pNode.DataStructure.commitUpTo(pDigest)
+	pNode.lastProgress = time.Now()
+	pNode.failedViews = 0
+	pending := pNode.pending
+	pNode.pending = make([]components.Transaction, 0, len(pending))
+	for _, v := range pending {
+		if !pNode.DataStructure.IsTransactionCommitted(v) &&
+			blockchain.VerifyStateTransition([]components.Transaction{v}, pNode.DataStructure.State) {
+			pNode.pending = append(pNode.pending, v)
+		} else {
+			delete(pNode.isPending, v)
+		}
+	}
+}
+
+// Keep the vote of a replica, if the replica is the leader of the view after the one voted in. Once a
+// quorum voted for the same node, their votes form its certificate, which becomes the highest one, and
+// the replica moves to its view and proposes
+func (pNode *NodeHotStuff) addVote(pMessage Message) {
+	if pNode.leader(pMessage.View+1) != pNode.Validator().Key || pNode.certified[pMessage.Digest] {
+		return
+	}
+	if _, ok := pNode.votes[pMessage.Digest]; !ok {
+		pNode.votes[pMessage.Digest] = make(map[string]Message)
+	}
+	pNode.votes[pMessage.Digest][pMessage.Replica] = pMessage
+	received := pNode.votes[pMessage.Digest]
+	if len(received) < pNode.quorum() {
+		return
+	}
+	pNode.certified[pMessage.Digest] = true
+	delete(pNode.votes, pMessage.Digest)
+	certificate := QuorumCertificate{View: pMessage.View, Digest: pMessage.Digest}
+	for _, v := range received {
+		certificate.Votes = append(certificate.Votes, v)
+	}
+	pNode.updateHighCert(certificate)
+	if pMessage.View+1 > pNode.View {
+		pNode.View = pMessage.View + 1
+	}
+	pNode.propose()
+}
+
+// Move to the first view of the next leader if the current view didn't make progress for a while, as
+// long as there is work left. The replica sends the highest certificate it knows to that leader, and
+// the time it waits doubles with each view that fails in a row
+func (pNode *NodeHotStuff) checkTimeout() {
+	if time.Since(pNode.lastProgress) < ViewTimeout<<uint(pNode.failedViews) || !pNode.hasWork() {
+		return
+	}
+	pNode.View = (pNode.View/ViewsPerLeader + 1) * ViewsPerLeader
+	pNode.lastProgress = time.Now()
+	if pNode.failedViews < 5 {
+		pNode.failedViews++
+	}
+	highCert := pNode.highCert
+	pNode.send(pNode.leader(pNode.View), Message{Type: NewView, View: pNode.View, Digest: highCert.Digest, Certificate: &highCert})
+}
+
+// Keep a new view sent to the replica as the leader of the view, along with the certificate it carries.
+// Once a quorum moved to the view, the leader joins it and proposes on top of the highest certificate
+func (pNode *NodeHotStuff) addNewView(pMessage Message) {
+	if pNode.leader(pMessage.View) != pNode.Validator().Key || pMessage.View < pNode.View ||
+		pMessage.Digest != pMessage.Certificate.Digest || !pNode.isCertificateValid(*pMessage.Certificate) {
+		return
+	}
+	if _, ok := pNode.newViews[pMessage.View]; !ok {
+		pNode.newViews[pMessage.View] = make(map[string]Message)
+	}
+	pNode.newViews[pMessage.View][pMessage.Replica] = pMessage
+	if _, ok := pNode.DataStructure.Tree[pMessage.Certificate.Digest]; ok {
+		pNode.updateHighCert(*pMessage.Certificate)
+	}
+	if len(pNode.newViews[pMessage.View]) >= pNode.quorum() {
+		pNode.View = pMessage.View
+		pNode.lastProgress = time.Now()
+		pNode.propose()
+	}
+}
+
+// Height of the committed chain of the replica, including the genesis block. Safe to call while the
+// replica keeps receiving messages
+func (pNode *NodeHotStuff) Height() int {
+	mutex.Lock()
+	defer mutex.Unlock()
+	return len(pNode.DataStructure.Chain)
+}
+
+// Whether the transaction is part of a committed node of the replica. Safe to call while the replica
+// keeps receiving messages
+func (pNode *NodeHotStuff) IsTransactionCommitted(pTransaction components.Transaction) bool {
+	mutex.Lock()
+	defer mutex.Unlock()
+	return pNode.DataStructure.IsTransactionCommitted(pTransaction)
+}
+
+// Current view of the replica. Safe to call while the replica keeps receiving messages
+func (pNode *NodeHotStuff) CurrentView() int {
+	mutex.Lock()
+	defer mutex.Unlock()
+	return pNode.View
+}
+
+// Number of messages the replica sent to the others. Safe to call while the replica keeps receiving messages
+func (pNode *NodeHotStuff) CountMessagesSent() int {
+	mutex.Lock()
+	defer mutex.Unlock()
+	return pNode.MessagesSent
+}
+
+// Balance of an account according to the committed chain of the replica. Safe to call while the replica
+// keeps receiving messages
+func (pNode *NodeHotStuff) Balance(pAccount string) float64 {
+	mutex.Lock()
+	defer mutex.Unlock()
+	return pNode.DataStructure.State[pAccount]
+}
+
+// Revises whether the error is not nil
+func check(err error) {
+	if err != nil {
+		panic(err)
+	}
+}
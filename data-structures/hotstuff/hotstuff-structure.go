@@ -0,0 +1,170 @@
+package hotstuff
+
+import (
+	"errors"
+	"github.com/gcubillos/isis-3007-distributed-ledger/data-structures/blockchain"
+	"github.com/gcubillos/isis-3007-distributed-ledger/data-structures/shared-components"
+	"time"
+)
+
+// *** Structs ***
+
+// What the HotStuff data structure contains
+// Tree keeps the nodes proposed by the leaders, indexed by digest, starting with the genesis node. Each
+// node extends the one certified by the certificate it carries. Executed is the last committed node:
+// Chain contains the blocks from the genesis block to it and State is the state at the end of it
+type HotStuff struct {
+	Chain     []blockchain.Block
+	State     map[string]float64
+	Tree      map[string]*TreeNode
+	Genesis   string
+	Executed  string
+	committed map[components.Transaction]bool
+}
+
+// *** Constructors ***
+
+// Create the structure with only the genesis node, which is committed. The initial state is the state at
+// the end of it
+func CreateHotStuff(pGenesisBlock blockchain.Block, pInitialState map[string]float64) HotStuff {
+	genesisNode := &TreeNode{Block: pGenesisBlock}
+	rHotStuff := HotStuff{
+		Chain:     []blockchain.Block{pGenesisBlock},
+		State:     make(map[string]float64, len(pInitialState)),
+		Tree:      map[string]*TreeNode{genesisNode.Digest(): genesisNode},
+		Genesis:   genesisNode.Digest(),
+		Executed:  genesisNode.Digest(),
+		committed: make(map[components.Transaction]bool),
+	}
+	for k, v := range pInitialState {
+		rHotStuff.State[k] = v
+	}
+	return rHotStuff
+}
+
+// Create the genesis block. It has a fixed timestamp, so that every replica creates the same one
+func CreateGenesisBlock() blockchain.Block {
+	rGenesisBlock := blockchain.Block{Timestamp: time.Unix(0, 0).UTC(), Transactions: make([]components.Transaction, 0)}
+	rGenesisBlock.Hash = blockchain.CalculateHash(rGenesisBlock)
+	return rGenesisBlock
+}
+
+// *** Methods ***
+
+// Certificate of the genesis node, which needs no votes
+func (pHotStuff *HotStuff) GenesisCertificate() QuorumCertificate {
+	return QuorumCertificate{View: 0, Digest: pHotStuff.Genesis}
+}
+
+// Nodes from the given one back to the last committed node, excluding it, with the most recent first.
+// It fails if the node doesn't extend the last committed node
+func (pHotStuff *HotStuff) uncommittedBranch(pDigest string) ([]*TreeNode, error) {
+	rBranch := make([]*TreeNode, 0)
+	executedView := pHotStuff.Tree[pHotStuff.Executed].View()
+	for digest := pDigest; digest != pHotStuff.Executed; {
+		theNode, ok := pHotStuff.Tree[digest]
+		if !ok || theNode.View() <= executedView {
+			return nil, errors.New("the node doesn't extend the last committed node")
+		}
+		rBranch = append(rBranch, theNode)
+		digest = theNode.Block.PrevHash
+	}
+	return rBranch, nil
+}
+
+// Whether the first node extends the second one, or is the same node
+func (pHotStuff *HotStuff) Extends(pDescendant, pAncestor string) bool {
+	for digest := pDescendant; ; {
+		if digest == pAncestor {
+			return true
+		}
+		theNode, ok := pHotStuff.Tree[digest]
+		if !ok || digest == pHotStuff.Genesis {
+			return false
+		}
+		digest = theNode.Block.PrevHash
+	}
+}
+
+// State at the end of the given node, which must extend the last committed node, along with the
+// transactions of the nodes that aren't committed yet
+func (pHotStuff *HotStuff) stateAt(pDigest string) (map[string]float64, map[components.Transaction]bool, error) {
+	branch, err := pHotStuff.uncommittedBranch(pDigest)
+	if err != nil {
+		return nil, nil, err
+	}
+	rState := make(map[string]float64, len(pHotStuff.State))
+	for k, v := range pHotStuff.State {
+		rState[k] = v
+	}
+	rIncluded := make(map[components.Transaction]bool)
+	for i := len(branch) - 1; i >= 0; i-- {
+		blockchain.ApplyTransactions(rState, branch[i].Block.Transactions)
+		for _, v := range branch[i].Block.Transactions {
+			rIncluded[v] = true
+		}
+	}
+	return rState, rIncluded, nil
+}
+
+// Check that a node proposed by the given leader can be added to the tree. Its parent must be the node
+// certified by its certificate, which is checked by the replica, and its transactions must be consistent
+// with the state at the end of the parent
+func (pHotStuff *HotStuff) IsNodeValid(pNode *TreeNode, pLeader string) (bool, error) {
+	theBlock := pNode.Block
+	parent, ok := pHotStuff.Tree[theBlock.PrevHash]
+	if !ok {
+		return false, errors.New("the parent of the node is unknown")
+	}
+	switch true {
+	case theBlock.PrevHash != pNode.Justify.Digest:
+		return false, errors.New("the node doesn't extend the node certified by its certificate")
+	case pNode.Justify.View != parent.View() || theBlock.Slot <= parent.View():
+		return false, errors.New("the view of the node must be after the one of its parent")
+	case theBlock.Timestamp.Before(parent.Block.Timestamp):
+		return false, errors.New("timestamp is not valid")
+	case !blockchain.HasCorrectHash(theBlock):
+		return false, errors.New("calculated hash doesn't match")
+	case theBlock.Producer != pLeader || !components.VerifySignature(theBlock.Producer, theBlock.Hash, theBlock.Signature):
+		return false, errors.New("the block isn't signed by the leader of the view")
+	}
+	state, included, err := pHotStuff.stateAt(theBlock.PrevHash)
+	if err != nil {
+		return false, err
+	}
+	for _, v := range theBlock.Transactions {
+		if included[v] {
+			return false, errors.New("the node repeats a transaction of its branch")
+		}
+	}
+	if !blockchain.VerifyStateTransition(theBlock.Transactions, state) {
+		return false, errors.New("the transactions are inconsistent with the state")
+	}
+	return true, nil
+}
+
+// Commit the nodes from the last committed one up to the given node, applying their transactions, and
+// return their blocks in order
+func (pHotStuff *HotStuff) commitUpTo(pDigest string) []blockchain.Block {
+	branch, err := pHotStuff.uncommittedBranch(pDigest)
+	if err != nil {
+		return nil
+	}
+	rBlocks := make([]blockchain.Block, 0, len(branch))
+	for i := len(branch) - 1; i >= 0; i-- {
+		theBlock := branch[i].Block
+		blockchain.ApplyTransactions(pHotStuff.State, theBlock.Transactions)
+		for _, v := range theBlock.Transactions {
+			pHotStuff.committed[v] = true
+		}
+		pHotStuff.Chain = append(pHotStuff.Chain, theBlock)
+		rBlocks = append(rBlocks, theBlock)
+	}
+	pHotStuff.Executed = pDigest
+	return rBlocks
+}
+
+// Whether the transaction is part of a committed node
+func (pHotStuff *HotStuff) IsTransactionCommitted(pTransaction components.Transaction) bool {
+	return pHotStuff.committed[pTransaction]
+}
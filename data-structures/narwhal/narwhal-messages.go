@@ -0,0 +1,87 @@
+package narwhal
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/gcubillos/isis-3007-distributed-ledger/data-structures/shared-components"
+	"strconv"
+)
+
+// *** Structs ***
+
+// Types of messages exchanged by the validators
+const (
+	// Header of a round proposed by a validator, with its batch of transactions
+	Proposal = "proposal"
+	// A validator stored the header and its batch. It is only sent to the author of the header
+	Vote = "vote"
+	// Header that a quorum voted for, which becomes a vertex of the DAG
+	Certification = "certification"
+)
+
+// What a message between validators contains
+// Digest is the digest of the header the message is about. A proposal carries the Header and a
+// certification the Certificate. Every message is signed by the Replica that sent it, identified by its
+// key
+type Message struct {
+	Type        string
+	Round       int
+	Digest      string
+	Header      *Header
+	Certificate *Certificate
+	Replica     string
+	Signature   string
+}
+
+// What a replica knows about the validators: the key that identifies it and the address to reach it
+type Validator struct {
+	Key     string
+	Address string
+}
+
+// What a header contains: the validator that proposed it, its round, its batch of transactions and the
+// digests of the certificates of the previous round it references
+type Header struct {
+	Author       string
+	Round        int
+	Transactions []components.Transaction
+	Parents      []string
+}
+
+// Proof that a quorum of validators stored a header and its batch, so that it is available even if its
+// author leaves the network
+type Certificate struct {
+	Header Header
+	Votes  []Message
+}
+
+// *** Methods ***
+
+// Data signed by the validator that sends the message
+func (pMessage *Message) signedData() string {
+	return pMessage.Type + strconv.Itoa(pMessage.Round) + pMessage.Digest + pMessage.Replica
+}
+
+// Whether the message was signed by its validator
+func (pMessage *Message) isSignatureValid() bool {
+	return components.VerifySignature(pMessage.Replica, pMessage.signedData(), pMessage.Signature)
+}
+
+// Digest of the header, which covers its author, round, transactions and parents
+func (pHeader *Header) Digest() string {
+	record := pHeader.Author + strconv.Itoa(pHeader.Round)
+	for _, v := range pHeader.Transactions {
+		record += v.Origin + v.SenderSignature + v.Destination + strconv.FormatFloat(v.Value, 'f', -1, 64) + strconv.FormatInt(v.Nonce, 10)
+	}
+	for _, v := range pHeader.Parents {
+		record += v
+	}
+	h := sha256.New()
+	h.Write([]byte(record))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Digest of the header the certificate is about
+func (pCertificate *Certificate) Digest() string {
+	return pCertificate.Header.Digest()
+}
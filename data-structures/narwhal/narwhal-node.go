@@ -0,0 +1,483 @@
+package narwhal
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/gcubillos/isis-3007-distributed-ledger/data-structures/blockchain"
+	"github.com/gcubillos/isis-3007-distributed-ledger/data-structures/shared-components"
+	"github.com/perlin-network/noise"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Mutual exclusion variable
+var mutex = &sync.Mutex{}
+
+// Time a node waits for a validator to acknowledge a message
+var RequestTimeout = 2 * time.Second
+
+// Time a validator waits in a round with an anchor for the vertex of its leader, once it has a quorum of
+// the round, before moving to the next round without it
+var RoundTimeout = 500 * time.Millisecond
+
+// Maximum number of transactions in the batch of a header
+var BatchSize = 500
+
+// *** Structs ***
+
+// Declaration of a validator in the network
+// Contains the underlying data structure as well as the node from the noise library.
+// Validators is the known set of validators, the same for every one of them. Round is the round the
+// validator is in, in which it proposes a header once it has transactions to disseminate or sees the
+// others move forward. The transactions submitted to the validator wait in its pending list until they
+// are part of one of its batches, and stay in flight until they are executed. The validator keeps its
+// header waiting for votes, the headers it voted for and the messages whose parents are still unknown.
+// MessagesSent counts the messages the validator sent to the others
+type NodeNarwhal struct {
+	DataStructure Narwhal
+	Node          *noise.Node
+	Validators    []Validator
+	Round         int
+	MessagesSent  int
+	pending       []components.Transaction
+	isPending     map[components.Transaction]bool
+	inFlight      map[components.Transaction]int
+	header        *Header
+	votes         map[string]Message
+	voted         map[string]bool
+	proposed      int
+	waiting       []Message
+	highestSeen   int
+	roundStart    time.Time
+	timedOut      bool
+	outbox        []outgoing
+	stopped       bool
+}
+
+// Message waiting to be sent, along with the key of the only validator that receives it, or an empty
+// key if every other validator receives it
+type outgoing struct {
+	To      string
+	Message Message
+}
+
+// *** Constructors ***
+
+// Create a validator that listens to the network. The "main" account with the amount of available
+// currency must be the same for every validator. The validator doesn't take part in the protocol until
+// it is started with the validator set
+func CreateNode(pAvailableCurrency float64) *NodeNarwhal {
+	thisNode := &NodeNarwhal{
+		isPending: make(map[components.Transaction]bool),
+		inFlight:  make(map[components.Transaction]int),
+		votes:     make(map[string]Message),
+		voted:     make(map[string]bool),
+		stopped:   true,
+	}
+	// For simplicity a "main" account will be created that contains the amount of currency available
+	thisNode.DataStructure = CreateNarwhal(map[string]float64{"main": pAvailableCurrency})
+
+	// Create network node
+	networkNode, err := noise.NewNode()
+	check(err)
+
+	// Assign the way the node will handle the messages of the other validators
+	networkNode.Handle(thisNode.handleRequest)
+
+	// Make the node listen to the network
+	check(networkNode.Listen())
+	thisNode.Node = networkNode
+
+	return thisNode
+}
+
+// *** Methods ***
+
+// How the other validators know this one. It is only valid once the node listens
+func (pNode *NodeNarwhal) Validator() Validator {
+	return Validator{Key: pNode.Node.ID().ID.String(), Address: pNode.Node.Addr()}
+}
+
+// Start taking part in the protocol with the given validator set, which must include the validator
+// and be in the same order for every validator. The DAG starts with a vertex of round zero for each
+// of them, and the validator checks periodically whether it waited too long for an anchor
+func (pNode *NodeNarwhal) Start(pValidators []Validator) {
+	mutex.Lock()
+	pNode.Validators = pValidators
+	authors := make([]string, len(pValidators))
+	for i, v := range pValidators {
+		authors[i] = v.Key
+	}
+	pNode.DataStructure.addGenesis(authors)
+	pNode.Round = 1
+	pNode.roundStart = time.Now()
+	pNode.stopped = false
+	pNode.propose()
+	pNode.flush()
+	go func() {
+		for {
+			time.Sleep(RoundTimeout / 4)
+			mutex.Lock()
+			if pNode.stopped {
+				mutex.Unlock()
+				return
+			}
+			pNode.checkTimeout()
+			pNode.flush()
+		}
+	}()
+}
+
+// Stop taking part in the protocol and close the network node
+func (pNode *NodeNarwhal) Close() {
+	mutex.Lock()
+	pNode.stopped = true
+	mutex.Unlock()
+	check(pNode.Node.Close())
+}
+
+// Give transactions to the validator, which disseminates them in its own batches. Unlike the protocols
+// that order the transactions as they spread, they aren't sent to the other validators until then
+func (pNode *NodeNarwhal) Submit(pTransactions []components.Transaction) {
+	mutex.Lock()
+	for _, v := range pTransactions {
+		if pNode.isPending[v] || pNode.DataStructure.IsTransactionCommitted(v) ||
+			!blockchain.VerifyStateTransition([]components.Transaction{v}, pNode.DataStructure.State) {
+			continue
+		}
+		pNode.pending = append(pNode.pending, v)
+		pNode.isPending[v] = true
+	}
+	pNode.propose()
+	pNode.flush()
+}
+
+// Number of validators that may be faulty without affecting the protocol
+func (pNode *NodeNarwhal) faulty() int {
+	return (len(pNode.Validators) - 1) / 3
+}
+
+// Number of validators that must agree on something. Leaving out only the faulty ones, two quorums
+// overlap in a correct validator even when the set isn't three times the faulty ones plus one
+func (pNode *NodeNarwhal) quorum() int {
+	return len(pNode.Validators) - pNode.faulty()
+}
+
+// Key of the validator whose vertex is the anchor of the given round. Only even rounds have anchors
+func (pNode *NodeNarwhal) leader(pRound int) string {
+	return pNode.Validators[pRound/2%len(pNode.Validators)].Key
+}
+
+// Whether the key belongs to the validator set
+func (pNode *NodeNarwhal) isValidator(pKey string) bool {
+	for _, v := range pNode.Validators {
+		if v.Key == pKey {
+			return true
+		}
+	}
+	return false
+}
+
+// Sign a message of the validator and queue it to be sent to the given validator, or to every other one
+// if the key is empty. The validator processes its own messages right away. It is called with the mutex
+// locked
+func (pNode *NodeNarwhal) send(pTo string, pMessage Message) {
+	self := pNode.Validator().Key
+	pMessage.Replica = self
+	pMessage.Signature = components.Sign(pNode.Node, pMessage.signedData())
+	if pTo != self {
+		pNode.outbox = append(pNode.outbox, outgoing{To: pTo, Message: pMessage})
+	}
+	if pTo == "" || pTo == self {
+		pNode.process(pMessage)
+	}
+}
+
+// Unlock the mutex and send the queued messages to the other validators. Messages are sent without
+// holding the structure, so that the validators can answer each other, and each validator receives them
+// in order. A validator that left the network doesn't delay the messages to the others
+func (pNode *NodeNarwhal) flush() {
+	outbox := pNode.outbox
+	pNode.outbox = nil
+	self := pNode.Validator().Key
+	messages := make(map[string][][]byte)
+	for _, v := range outbox {
+		bytes, err := json.Marshal(v.Message)
+		check(err)
+		for _, w := range pNode.Validators {
+			if w.Key != self && (v.To == "" || v.To == w.Key) {
+				messages[w.Address] = append(messages[w.Address], bytes)
+				pNode.MessagesSent++
+			}
+		}
+	}
+	mutex.Unlock()
+	for k, v := range messages {
+		go func(pAddress string, pMessages [][]byte) {
+			for _, w := range pMessages {
+				// A validator that is too busy to answer doesn't stop the next messages from being sent
+				ctx, cancel := context.WithTimeout(context.Background(), RequestTimeout)
+				_, _ = pNode.Node.Request(ctx, pAddress, w)
+				cancel()
+			}
+		}(k, v)
+	}
+}
+
+// Handle the messages of the other validators
+func (pNode *NodeNarwhal) handleRequest(ctx noise.HandlerContext) error {
+	if !ctx.IsRequest() {
+		return nil
+	}
+	var received Message
+	if err := json.Unmarshal(ctx.Data(), &received); err != nil {
+		return ctx.Send([]byte(""))
+	}
+	if err := ctx.Send([]byte("")); err != nil {
+		return err
+	}
+
+	mutex.Lock()
+	if pNode.stopped {
+		mutex.Unlock()
+		return nil
+	}
+	if pNode.isValidator(received.Replica) && received.isSignatureValid() {
+		pNode.process(received)
+	}
+	pNode.flush()
+	return nil
+}
+
+// Process a message according to its type. It is called with the mutex locked
+func (pNode *NodeNarwhal) process(pMessage Message) {
+	switch pMessage.Type {
+	case Proposal:
+		if pMessage.Header != nil {
+			pNode.acceptProposal(pMessage)
+		}
+	case Vote:
+		pNode.addVote(pMessage)
+	case Certification:
+		if pMessage.Certificate != nil {
+			pNode.acceptCertificate(pMessage)
+		}
+	}
+}
+
+// Whether the validator has a reason to propose in its round: transactions to disseminate or to be
+// executed, or other validators already in the round or a later one
+func (pNode *NodeNarwhal) active() bool {
+	return len(pNode.pending) > 0 || len(pNode.inFlight) > 0 || pNode.highestSeen >= pNode.Round
+}
+
+// Propose the header of the current round, if the validator didn't yet and has a reason to. It
+// references every vertex of the previous round in the DAG, which must be at least a quorum, and carries
+// a batch of the pending transactions
+func (pNode *NodeNarwhal) propose() {
+	if len(pNode.Validators) == 0 || pNode.proposed >= pNode.Round || !pNode.active() {
+		return
+	}
+	parents := pNode.DataStructure.Certificates(pNode.Round - 1)
+	if len(parents) < pNode.quorum() {
+		return
+	}
+	theHeader := Header{Author: pNode.Validator().Key, Round: pNode.Round, Transactions: make([]components.Transaction, 0)}
+	for _, v := range parents {
+		theHeader.Parents = append(theHeader.Parents, v.Digest())
+	}
+	for len(pNode.pending) > 0 && len(theHeader.Transactions) < BatchSize {
+		transaction := pNode.pending[0]
+		pNode.pending = pNode.pending[1:]
+		delete(pNode.isPending, transaction)
+		theHeader.Transactions = append(theHeader.Transactions, transaction)
+		pNode.inFlight[transaction] = pNode.Round
+	}
+	pNode.proposed = pNode.Round
+	pNode.header = &theHeader
+	pNode.votes = make(map[string]Message)
+	pNode.send("", Message{Type: Proposal, Round: theHeader.Round, Digest: theHeader.Digest(), Header: &theHeader})
+}
+
+// Vote for the header proposed by a validator, as long as it is the first one of its author in its round
+// and it references a quorum of the previous round. Headers whose parents are unknown wait for them. The
+// vote goes only to the author
+func (pNode *NodeNarwhal) acceptProposal(pMessage Message) {
+	theHeader := *pMessage.Header
+	key := theHeader.Author + "/" + strconv.Itoa(theHeader.Round)
+	if theHeader.Author != pMessage.Replica || theHeader.Round < 1 || pMessage.Digest != theHeader.Digest() || pNode.voted[key] {
+		return
+	}
+	if theHeader.Round > pNode.highestSeen {
+		pNode.highestSeen = theHeader.Round
+	}
+	if !pNode.DataStructure.HasParents(theHeader) {
+		pNode.waiting = append(pNode.waiting, pMessage)
+		return
+	}
+	if valid, _ := pNode.DataStructure.IsHeaderValid(theHeader, pNode.quorum()); !valid {
+		return
+	}
+	pNode.voted[key] = true
+	pNode.send(theHeader.Author, Message{Type: Vote, Round: theHeader.Round, Digest: pMessage.Digest})
+}
+
+// Keep a vote for the header of the validator. Once a quorum voted for it, the certificate is sent to
+// every validator
+func (pNode *NodeNarwhal) addVote(pMessage Message) {
+	if pNode.header == nil || pMessage.Digest != pNode.header.Digest() {
+		return
+	}
+	pNode.votes[pMessage.Replica] = pMessage
+	if len(pNode.votes) < pNode.quorum() {
+		return
+	}
+	theCertificate := Certificate{Header: *pNode.header}
+	for _, v := range pNode.votes {
+		theCertificate.Votes = append(theCertificate.Votes, v)
+	}
+	pNode.header = nil
+	pNode.send("", Message{Type: Certification, Round: theCertificate.Header.Round, Digest: theCertificate.Digest(), Certificate: &theCertificate})
+}
+
+// Add a certificate to the DAG once its votes prove that a quorum stored the header, and its parents are
+// in the DAG. Certificates whose parents are unknown wait for them. Then the anchors that got enough
+// support are committed and the validator moves forward if it can
+func (pNode *NodeNarwhal) acceptCertificate(pMessage Message) {
+	theCertificate := pMessage.Certificate
+	digest := theCertificate.Digest()
+	round := theCertificate.Header.Round
+	if pMessage.Digest != digest || round < 1 || pNode.DataStructure.Vertices[digest] != nil {
+		return
+	}
+	voters := make(map[string]bool)
+	for _, v := range theCertificate.Votes {
+		if v.Type == Vote && v.Round == round && v.Digest == digest && pNode.isValidator(v.Replica) && v.isSignatureValid() {
+			voters[v.Replica] = true
+		}
+	}
+	if len(voters) < pNode.quorum() || !pNode.isValidator(theCertificate.Header.Author) {
+		return
+	}
+	if round > pNode.highestSeen {
+		pNode.highestSeen = round
+	}
+	if !pNode.DataStructure.HasParents(theCertificate.Header) {
+		pNode.waiting = append(pNode.waiting, pMessage)
+		return
+	}
+	if valid, _ := pNode.DataStructure.IsHeaderValid(theCertificate.Header, pNode.quorum()); !valid {
+		return
+	}
+	pNode.DataStructure.insert(theCertificate)
+	pNode.commit()
+
+	waiting := pNode.waiting
+	pNode.waiting = nil
+	for _, v := range waiting {
+		pNode.process(v)
+	}
+	pNode.advance()
+}
+
+// Commit the anchors of the rounds after the last committed one that are referenced by more than the
+// faulty validators in the next round, so that every later anchor reaches them. The transactions of the
+// validator that are still in flight after the vertices of a later round are ordered are disseminated
+// again, since the vertex that carried them is unlikely to be ordered
+func (pNode *NodeNarwhal) commit() {
+	lastAnchor := pNode.DataStructure.LastAnchor
+	for round := lastAnchor + 2; len(pNode.DataStructure.Rounds[round+1]) > 0; round += 2 {
+		anchor, ok := pNode.DataStructure.Rounds[round][pNode.leader(round)]
+		if ok && pNode.DataStructure.Support(anchor) > pNode.faulty() {
+			pNode.DataStructure.commitAnchor(anchor, pNode.leader)
+		}
+	}
+	if pNode.DataStructure.LastAnchor == lastAnchor {
+		return
+	}
+	for k, v := range pNode.inFlight {
+		switch true {
+		case pNode.DataStructure.IsTransactionCommitted(k):
+			delete(pNode.inFlight, k)
+		case v < pNode.DataStructure.LastAnchor-1:
+			delete(pNode.inFlight, k)
+			if !pNode.isPending[k] && blockchain.VerifyStateTransition([]components.Transaction{k}, pNode.DataStructure.State) {
+				pNode.pending = append(pNode.pending, k)
+				pNode.isPending[k] = true
+			}
+		}
+	}
+}
+
+// Move to the next rounds while the validator has a quorum of the current one. In a round with an
+// anchor it also waits for the vertex of the leader, until it times out
+func (pNode *NodeNarwhal) advance() {
+	for len(pNode.DataStructure.Rounds[pNode.Round]) >= pNode.quorum() {
+		if pNode.Round%2 == 0 && !pNode.timedOut {
+			if _, ok := pNode.DataStructure.Rounds[pNode.Round][pNode.leader(pNode.Round)]; !ok {
+				break
+			}
+		}
+		pNode.Round++
+		pNode.roundStart = time.Now()
+		pNode.timedOut = false
+	}
+	pNode.propose()
+}
+
+// Stop waiting for the anchor of the current round if the validator waited for too long while it has
+// a reason to move forward
+func (pNode *NodeNarwhal) checkTimeout() {
+	if time.Since(pNode.roundStart) < RoundTimeout || !pNode.active() {
+		return
+	}
+	pNode.timedOut = true
+	pNode.advance()
+}
+
+// Number of vertices in the total order of the validator. Safe to call while the validator keeps
+// receiving messages
+func (pNode *NodeNarwhal) Height() int {
+	mutex.Lock()
+	defer mutex.Unlock()
+	return len(pNode.DataStructure.Ordered)
+}
+
+// Whether the transaction was executed by the validator. Safe to call while the validator keeps
+// receiving messages
+func (pNode *NodeNarwhal) IsTransactionCommitted(pTransaction components.Transaction) bool {
+	mutex.Lock()
+	defer mutex.Unlock()
+	return pNode.DataStructure.IsTransactionCommitted(pTransaction)
+}
+
+// Current round of the validator and round of its last committed anchor. Safe to call while the
+// validator keeps receiving messages
+func (pNode *NodeNarwhal) CurrentRound() (int, int) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	return pNode.Round, pNode.DataStructure.LastAnchor
+}
+
+// Number of messages the validator sent to the others. Safe to call while the validator keeps receiving messages
+func (pNode *NodeNarwhal) CountMessagesSent() int {
+	mutex.Lock()
+	defer mutex.Unlock()
+	return pNode.MessagesSent
+}
+
+// Balance of an account according to the total order of the validator. Safe to call while the validator
+// keeps receiving messages
+func (pNode *NodeNarwhal) Balance(pAccount string) float64 {
+	mutex.Lock()
+	defer mutex.Unlock()
+	return pNode.DataStructure.State[pAccount]
+}
+
+// Revises whether the error is not nil
+func check(err error) {
+	if err != nil {
+		panic(err)
+	}
+}
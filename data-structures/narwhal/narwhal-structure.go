@@ -0,0 +1,224 @@
+package narwhal
+
+import (
+	"errors"
+	"github.com/gcubillos/isis-3007-distributed-ledger/data-structures/blockchain"
+	"github.com/gcubillos/isis-3007-distributed-ledger/data-structures/shared-components"
+	"sort"
+)
+
+// *** Structs ***
+
+// What the Narwhal data structure contains
+// Vertices is the DAG of certificates, indexed by digest, and Rounds the digest of the certificate of
+// each validator in each round. Round zero has a certificate without transactions nor parents for each
+// validator. Ordered contains the digests of the vertices in the total order given by the committed
+// anchors, and State is the state once their transactions are executed in that order. LastAnchor is the
+// round of the last committed anchor
+type Narwhal struct {
+	Vertices   map[string]*Certificate
+	Rounds     map[int]map[string]string
+	Ordered    []string
+	State      map[string]float64
+	LastAnchor int
+	delivered  map[string]bool
+	committed  map[components.Transaction]bool
+}
+
+// *** Constructors ***
+
+// Create the structure with the initial state of the accounts. The DAG is empty until the certificates
+// of round zero are added
+func CreateNarwhal(pInitialState map[string]float64) Narwhal {
+	rNarwhal := Narwhal{
+		Vertices:  make(map[string]*Certificate),
+		Rounds:    make(map[int]map[string]string),
+		State:     make(map[string]float64, len(pInitialState)),
+		delivered: make(map[string]bool),
+		committed: make(map[components.Transaction]bool),
+	}
+	for k, v := range pInitialState {
+		rNarwhal.State[k] = v
+	}
+	return rNarwhal
+}
+
+// *** Methods ***
+
+// Add the certificates of round zero of the given validators, which are already ordered
+func (pNarwhal *Narwhal) addGenesis(pAuthors []string) {
+	for _, v := range pAuthors {
+		genesis := &Certificate{Header: Header{Author: v, Transactions: make([]components.Transaction, 0)}}
+		pNarwhal.insert(genesis)
+		pNarwhal.delivered[genesis.Digest()] = true
+	}
+}
+
+// Add a certificate to the DAG. Its parents must be in the DAG already
+func (pNarwhal *Narwhal) insert(pCertificate *Certificate) {
+	digest := pCertificate.Digest()
+	pNarwhal.Vertices[digest] = pCertificate
+	if _, ok := pNarwhal.Rounds[pCertificate.Header.Round]; !ok {
+		pNarwhal.Rounds[pCertificate.Header.Round] = make(map[string]string)
+	}
+	pNarwhal.Rounds[pCertificate.Header.Round][pCertificate.Header.Author] = digest
+}
+
+// Whether every parent of the header is in the DAG
+func (pNarwhal *Narwhal) HasParents(pHeader Header) bool {
+	for _, v := range pHeader.Parents {
+		if _, ok := pNarwhal.Vertices[v]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// Check that a header can be added to the DAG once certified: its author didn't have a vertex in its round
+// yet and it references at least the given number of vertices of the previous round, from different
+// validators, all of which are in the DAG
+func (pNarwhal *Narwhal) IsHeaderValid(pHeader Header, pQuorum int) (bool, error) {
+	if _, ok := pNarwhal.Rounds[pHeader.Round][pHeader.Author]; ok {
+		return false, errors.New("the author already has a vertex in the round")
+	}
+	authors := make(map[string]bool)
+	for _, v := range pHeader.Parents {
+		parent, ok := pNarwhal.Vertices[v]
+		switch true {
+		case !ok:
+			return false, errors.New("a parent of the header is unknown")
+		case parent.Header.Round != pHeader.Round-1:
+			return false, errors.New("a parent of the header isn't in the previous round")
+		}
+		authors[parent.Header.Author] = true
+	}
+	if len(authors) < pQuorum {
+		return false, errors.New("the header doesn't reference a quorum of the previous round")
+	}
+	return true, nil
+}
+
+// Certificates of a round, sorted by author
+func (pNarwhal *Narwhal) Certificates(pRound int) []*Certificate {
+	authors := make([]string, 0, len(pNarwhal.Rounds[pRound]))
+	for k := range pNarwhal.Rounds[pRound] {
+		authors = append(authors, k)
+	}
+	sort.Strings(authors)
+	rCertificates := make([]*Certificate, len(authors))
+	for i, v := range authors {
+		rCertificates[i] = pNarwhal.Vertices[pNarwhal.Rounds[pRound][v]]
+	}
+	return rCertificates
+}
+
+// Whether there is a path of parents from the first vertex to the second one
+func (pNarwhal *Narwhal) Reaches(pFrom, pTo string) bool {
+	target, ok := pNarwhal.Vertices[pTo]
+	if !ok {
+		return false
+	}
+	visited := map[string]bool{pFrom: true}
+	for frontier := []string{pFrom}; len(frontier) > 0; {
+		digest := frontier[len(frontier)-1]
+		frontier = frontier[:len(frontier)-1]
+		if digest == pTo {
+			return true
+		}
+		vertex := pNarwhal.Vertices[digest]
+		if vertex == nil || vertex.Header.Round <= target.Header.Round {
+			continue
+		}
+		for _, v := range vertex.Header.Parents {
+			if !visited[v] {
+				visited[v] = true
+				frontier = append(frontier, v)
+			}
+		}
+	}
+	return false
+}
+
+// Number of vertices of the round after the given vertex that reference it
+func (pNarwhal *Narwhal) Support(pDigest string) int {
+	vertex, ok := pNarwhal.Vertices[pDigest]
+	if !ok {
+		return 0
+	}
+	rSupport := 0
+	for _, v := range pNarwhal.Rounds[vertex.Header.Round+1] {
+		for _, w := range pNarwhal.Vertices[v].Header.Parents {
+			if w == pDigest {
+				rSupport++
+				break
+			}
+		}
+	}
+	return rSupport
+}
+
+// Commit an anchor. The anchors of the rounds since the last committed one that it reaches are committed
+// first, from the oldest one, since some validator may have committed them directly. The given function
+// gives the validator whose vertex is the anchor of each round. Each anchor orders its causal history
+func (pNarwhal *Narwhal) commitAnchor(pAnchor string, pLeader func(int) string) {
+	anchors := []string{pAnchor}
+	current := pAnchor
+	for round := pNarwhal.Vertices[pAnchor].Header.Round - 2; round > pNarwhal.LastAnchor; round -= 2 {
+		previous, ok := pNarwhal.Rounds[round][pLeader(round)]
+		if ok && pNarwhal.Reaches(current, previous) {
+			anchors = append(anchors, previous)
+			current = previous
+		}
+	}
+	for i := len(anchors) - 1; i >= 0; i-- {
+		pNarwhal.orderHistory(anchors[i])
+	}
+	pNarwhal.LastAnchor = pNarwhal.Vertices[pAnchor].Header.Round
+}
+
+// Order the vertices of the causal history of an anchor that aren't ordered yet, by round and then by
+// author, and execute their transactions. A transaction that was already executed, or that can't be
+// performed over the state at that point, is skipped
+func (pNarwhal *Narwhal) orderHistory(pAnchor string) {
+	history := make([]*Certificate, 0)
+	visited := map[string]bool{pAnchor: true}
+	for frontier := []string{pAnchor}; len(frontier) > 0; {
+		digest := frontier[len(frontier)-1]
+		frontier = frontier[:len(frontier)-1]
+		if pNarwhal.delivered[digest] {
+			continue
+		}
+		vertex := pNarwhal.Vertices[digest]
+		history = append(history, vertex)
+		for _, v := range vertex.Header.Parents {
+			if !visited[v] {
+				visited[v] = true
+				frontier = append(frontier, v)
+			}
+		}
+	}
+	sort.Slice(history, func(i, j int) bool {
+		if history[i].Header.Round != history[j].Header.Round {
+			return history[i].Header.Round < history[j].Header.Round
+		}
+		return history[i].Header.Author < history[j].Header.Author
+	})
+	for _, v := range history {
+		digest := v.Digest()
+		pNarwhal.delivered[digest] = true
+		pNarwhal.Ordered = append(pNarwhal.Ordered, digest)
+		for _, w := range v.Header.Transactions {
+			transaction := []components.Transaction{w}
+			if pNarwhal.committed[w] || !blockchain.VerifyStateTransition(transaction, pNarwhal.State) {
+				continue
+			}
+			blockchain.ApplyTransactions(pNarwhal.State, transaction)
+			pNarwhal.committed[w] = true
+		}
+	}
+}
+
+// Whether the transaction was executed as part of an ordered vertex
+func (pNarwhal *Narwhal) IsTransactionCommitted(pTransaction components.Transaction) bool {
+	return pNarwhal.committed[pTransaction]
+}
@@ -0,0 +1,61 @@
+package pbft
+
+import (
+	"github.com/gcubillos/isis-3007-distributed-ledger/data-structures/blockchain"
+	"github.com/gcubillos/isis-3007-distributed-ledger/data-structures/shared-components"
+	"strconv"
+)
+
+// *** Structs ***
+
+// Types of messages exchanged by the replicas
+const (
+	// Transactions submitted to the replicas, which the primary orders into blocks
+	Request = "request"
+	// Block proposed by the primary for a sequence number
+	PrePrepare = "pre-prepare"
+	// A replica accepted the block proposed for a sequence number
+	Prepare = "prepare"
+	// A replica knows that a quorum accepted the block, so it won't accept another one for the sequence number
+	Commit = "commit"
+	// A replica wants to move to a new view, because the primary of the current one didn't make progress
+	ViewChange = "view-change"
+	// The primary of a new view proves that a quorum moved to it
+	NewView = "new-view"
+)
+
+// What a message between replicas contains
+// Digest is the hash of the block the message is about. Block is only present in the pre-prepare
+// messages and in the new-view messages that propose again a prepared block, and Transactions in the
+// requests. Certificate contains, in a view change, the pre-prepare and the prepares that prove the
+// replica prepared a block, and in a new view the view changes that prove a quorum moved to it.
+// Every message but the requests is signed by the Replica that sent it, identified by its key
+type Message struct {
+	Type         string
+	View         int
+	Sequence     int
+	Digest       string
+	Block        *blockchain.Block
+	Transactions []components.Transaction
+	Certificate  []Message
+	Replica      string
+	Signature    string
+}
+
+// What a replica knows about the validators: the key that identifies it and the address to reach it
+type Validator struct {
+	Key     string
+	Address string
+}
+
+// *** Methods ***
+
+// Data signed by the replica that sends the message
+func (pMessage *Message) signedData() string {
+	return pMessage.Type + strconv.Itoa(pMessage.View) + "/" + strconv.Itoa(pMessage.Sequence) + pMessage.Digest + pMessage.Replica
+}
+
+// Whether the message was signed by its replica
+func (pMessage *Message) isSignatureValid() bool {
+	return components.VerifySignature(pMessage.Replica, pMessage.signedData(), pMessage.Signature)
+}
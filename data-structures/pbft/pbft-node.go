@@ -0,0 +1,581 @@
+package pbft
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/gcubillos/isis-3007-distributed-ledger/data-structures/blockchain"
+	"github.com/gcubillos/isis-3007-distributed-ledger/data-structures/shared-components"
+	"github.com/perlin-network/noise"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Mutual exclusion variable
+var mutex = &sync.Mutex{}
+
+// Time a node waits for a replica to acknowledge a message
+var RequestTimeout = 2 * time.Second
+
+// Time the replicas wait for the primary to commit a block while there are pending transactions,
+// before trying to move to the next view
+var ViewTimeout = 1 * time.Second
+
+// Maximum number of transactions the primary orders in a block
+var BlockSize = 500
+
+// *** Structs ***
+
+// Declaration of a replica in the network
+// Contains the underlying data structure as well as the node from the noise library.
+// Validators is the known set of replicas, the same for every one of them. The primary of a view is
+// the validator whose position is the view modulo the number of validators. While InViewChange is
+// true, View is the view the replica is trying to move to and it doesn't accept blocks.
+// The replica keeps the transactions that aren't committed yet, the messages received for each view
+// and sequence number, the pre-prepares that arrived before the block they follow, the certificate of
+// the last block it prepared and the view changes received for each view. MessagesSent counts the
+// messages the replica sent to the others
+type NodePBFT struct {
+	DataStructure PBFT
+	Node          *noise.Node
+	Validators    []Validator
+	View          int
+	InViewChange  bool
+	MessagesSent  int
+	pending       []components.Transaction
+	isPending     map[components.Transaction]bool
+	log           map[string]*entry
+	future        []Message
+	preparedCert  []Message
+	viewChanges   map[int]map[string]Message
+	newViewSent   map[int]bool
+	lastProgress  time.Time
+	outbox        []Message
+	stopped       bool
+}
+
+// What a replica knows about a sequence number in a view: the block proposed by the primary and the
+// prepares and commits received, indexed by replica
+type entry struct {
+	PrePrepare *Message
+	Prepares   map[string]Message
+	Commits    map[string]Message
+	Prepared   bool
+	Committed  bool
+}
+
+// *** Constructors ***
+
+// Create a replica that listens to the network. The genesis block and the "main" account with the
+// amount of available currency must be the same for every replica. The replica doesn't take part in
+// the protocol until it is started with the validator set
+func CreateNode(pGenesisBlock blockchain.Block, pAvailableCurrency float64) *NodePBFT {
+	thisNode := &NodePBFT{
+		isPending:   make(map[components.Transaction]bool),
+		log:         make(map[string]*entry),
+		viewChanges: make(map[int]map[string]Message),
+		newViewSent: make(map[int]bool),
+		stopped:     true,
+	}
+	// For simplicity a "main" account will be created that contains the amount of currency available
+	thisNode.DataStructure = CreatePBFT(pGenesisBlock, map[string]float64{"main": pAvailableCurrency})
+
+	// Create network node
+	networkNode, err := noise.NewNode()
+	check(err)
+
+	// Assign the way the node will handle the messages of the other replicas
+	networkNode.Handle(thisNode.handleRequest)
+
+	// Make the node listen to the network
+	check(networkNode.Listen())
+	thisNode.Node = networkNode
+
+	return thisNode
+}
+
+// *** Methods ***
+
+// How the other replicas know this one. It is only valid once the node listens
+func (pNode *NodePBFT) Validator() Validator {
+	return Validator{Key: pNode.Node.ID().ID.String(), Address: pNode.Node.Addr()}
+}
+
+// Start taking part in the protocol with the given validator set, which must include the replica
+// and be in the same order for every replica. The replica checks periodically that the primary
+// makes progress
+func (pNode *NodePBFT) Start(pValidators []Validator) {
+	mutex.Lock()
+	pNode.Validators = pValidators
+	pNode.lastProgress = time.Now()
+	pNode.stopped = false
+	mutex.Unlock()
+	go func() {
+		for {
+			time.Sleep(ViewTimeout / 4)
+			mutex.Lock()
+			if pNode.stopped {
+				mutex.Unlock()
+				return
+			}
+			pNode.checkTimeout()
+			pNode.flush()
+		}
+	}()
+}
+
+// Stop taking part in the protocol and close the network node
+func (pNode *NodePBFT) Close() {
+	mutex.Lock()
+	pNode.stopped = true
+	mutex.Unlock()
+	check(pNode.Node.Close())
+}
+
+// Send transactions to every replica so that the primary orders them in a block
+func (pNode *NodePBFT) Submit(pTransactions []components.Transaction) {
+	mutex.Lock()
+	pNode.send(Message{Type: Request, Transactions: pTransactions})
+	pNode.flush()
+}
+
+// Number of replicas that may be faulty without affecting the protocol
+func (pNode *NodePBFT) faulty() int {
+	return (len(pNode.Validators) - 1) / 3
+}
+
+// Number of replicas that must agree on something, all of them but the faulty ones. Two quorums share
+// at least the faulty ones plus one, so always a correct replica, whether or not the number of replicas is
+// three times the faulty ones plus one
+func (pNode *NodePBFT) quorum() int {
+	return len(pNode.Validators) - pNode.faulty()
+}
+
+// Key of the primary of the given view
+func (pNode *NodePBFT) primary(pView int) string {
+	return pNode.Validators[pView%len(pNode.Validators)].Key
+}
+
+// Whether the key belongs to the validator set
+func (pNode *NodePBFT) isValidator(pKey string) bool {
+	for _, v := range pNode.Validators {
+		if v.Key == pKey {
+			return true
+		}
+	}
+	return false
+}
+
+// Messages a replica knows about a sequence number in a view
+func (pNode *NodePBFT) entryFor(pView, pSequence int) *entry {
+	key := strconv.Itoa(pView) + "/" + strconv.Itoa(pSequence)
+	if _, ok := pNode.log[key]; !ok {
+		pNode.log[key] = &entry{Prepares: make(map[string]Message), Commits: make(map[string]Message)}
+	}
+	return pNode.log[key]
+}
+
+// Sign a message of the replica and queue it to be sent to the others. The replica processes its own
+// messages right away. It is called with the mutex locked
+func (pNode *NodePBFT) send(pMessage Message) {
+	if pMessage.Type != Request {
+		pMessage.Replica = pNode.Validator().Key
+		pMessage.Signature = components.Sign(pNode.Node, pMessage.signedData())
+	}
+	pNode.outbox = append(pNode.outbox, pMessage)
+	pNode.process(pMessage)
+}
+
+// Unlock the mutex and send the queued messages to the other replicas. Messages are sent without
+// holding the structure, so that the replicas can answer each other, and each replica receives them
+// in order. A replica that left the network doesn't delay the messages to the others
+func (pNode *NodePBFT) flush() {
+	outbox := pNode.outbox
+	pNode.outbox = nil
+	self := pNode.Validator().Key
+	validators := pNode.Validators
+	if len(validators) > 0 {
+		pNode.MessagesSent += len(outbox) * (len(validators) - 1)
+	}
+	mutex.Unlock()
+	if len(outbox) == 0 {
+		return
+	}
+	messages := make([][]byte, len(outbox))
+	for i, v := range outbox {
+		bytes, err := json.Marshal(v)
+		check(err)
+		messages[i] = bytes
+	}
+	for _, v := range validators {
+		if v.Key == self {
+			continue
+		}
+		go func(pAddress string) {
+			for _, w := range messages {
+				// A replica that is too busy to answer doesn't stop the next messages from being sent
+				ctx, cancel := context.WithTimeout(context.Background(), RequestTimeout)
+				_, _ = pNode.Node.Request(ctx, pAddress, w)
+				cancel()
+			}
+		}(v.Address)
+	}
+}
+
+// Handle the messages of the other replicas
+func (pNode *NodePBFT) handleRequest(ctx noise.HandlerContext) error {
+	if !ctx.IsRequest() {
+		return nil
+	}
+	var received Message
+	if err := json.Unmarshal(ctx.Data(), &received); err != nil {
+		return ctx.Send([]byte(""))
+	}
+	if err := ctx.Send([]byte("")); err != nil {
+		return err
+	}
+
+	mutex.Lock()
+	if pNode.stopped {
+		mutex.Unlock()
+		return nil
+	}
+	// Only the requests are accepted from outside the validator set
+	if received.Type == Request || pNode.isValidator(received.Replica) && received.isSignatureValid() {
+		pNode.process(received)
+	}
+	pNode.flush()
+	return nil
+}
+
+// Process a message according to its type. It is called with the mutex locked
+func (pNode *NodePBFT) process(pMessage Message) {
+	switch pMessage.Type {
+	case Request:
+		pNode.addRequest(pMessage.Transactions)
+	case PrePrepare:
+		if pMessage.Block != nil && pMessage.Replica == pNode.primary(pMessage.View) {
+			pNode.acceptPrePrepare(pMessage, pMessage.Replica)
+		}
+	case Prepare:
+		theEntry := pNode.entryFor(pMessage.View, pMessage.Sequence)
+		theEntry.Prepares[pMessage.Replica] = pMessage
+		pNode.advance(pMessage.View, pMessage.Sequence)
+	case Commit:
+		theEntry := pNode.entryFor(pMessage.View, pMessage.Sequence)
+		theEntry.Commits[pMessage.Replica] = pMessage
+		pNode.advance(pMessage.View, pMessage.Sequence)
+	case ViewChange:
+		pNode.addViewChange(pMessage)
+	case NewView:
+		pNode.acceptNewView(pMessage)
+	}
+}
+
+// Keep the transactions that aren't committed nor pending yet and that can be performed over the
+// current state. The primary proposes them if it isn't waiting for another block
+func (pNode *NodePBFT) addRequest(pTransactions []components.Transaction) {
+	for _, v := range pTransactions {
+		if pNode.isPending[v] || pNode.DataStructure.IsTransactionCommitted(v) ||
+			!blockchain.VerifyStateTransition([]components.Transaction{v}, pNode.DataStructure.State) {
+			continue
+		}
+		pNode.pending = append(pNode.pending, v)
+		pNode.isPending[v] = true
+	}
+	pNode.propose()
+}
+
+// If the replica is the primary of the current view and the next sequence number has no block yet,
+// order the pending transactions in a block and send it to the replicas. Only one block is being
+// agreed on at a time, since each block must follow the previous one
+func (pNode *NodePBFT) propose() {
+	if pNode.InViewChange || len(pNode.pending) == 0 || pNode.primary(pNode.View) != pNode.Validator().Key {
+		return
+	}
+	sequence := pNode.DataStructure.NextSequence()
+	if pNode.entryFor(pNode.View, sequence).PrePrepare != nil {
+		return
+	}
+	transactions := make([]components.Transaction, 0)
+	for _, v := range pNode.pending {
+		if len(transactions) == BlockSize {
+			break
+		}
+		if blockchain.VerifyStateTransition(append(transactions, v), pNode.DataStructure.State) {
+			transactions = append(transactions, v)
+		}
+	}
+	lastBlock := pNode.DataStructure.LastBlock()
+	// The monotonic clock reading is stripped, since it isn't kept when the block is sent to other replicas
+	newBlock := blockchain.Block{
+		Timestamp:    time.Now().Round(0),
+		PrevHash:     lastBlock.Hash,
+		Transactions: transactions,
+		Producer:     pNode.Validator().Key,
+		Slot:         sequence,
+	}
+	if newBlock.Timestamp.Before(lastBlock.Timestamp) {
+		newBlock.Timestamp = lastBlock.Timestamp
+	}
+	newBlock.Hash = blockchain.CalculateHash(newBlock)
+	newBlock.Signature = components.Sign(pNode.Node, newBlock.Hash)
+	pNode.send(Message{Type: PrePrepare, View: pNode.View, Sequence: sequence, Digest: newBlock.Hash, Block: &newBlock})
+}
+
+// Accept the block proposed for a sequence number in the current view, as long as no other block was
+// accepted for it and it follows the last committed block. The given producer is the replica that must
+// have signed the block. Proposals for later sequence numbers wait until the previous blocks are
+// committed. The replica then prepares the block
+func (pNode *NodePBFT) acceptPrePrepare(pMessage Message, pProducer string) {
+	sequence := pNode.DataStructure.NextSequence()
+	switch true {
+	case pMessage.View != pNode.View || pNode.InViewChange || pMessage.Sequence < sequence:
+		return
+	case pMessage.Sequence > sequence:
+		pNode.future = append(pNode.future, pMessage)
+		return
+	}
+	theEntry := pNode.entryFor(pMessage.View, pMessage.Sequence)
+	if theEntry.PrePrepare != nil || pMessage.Digest != pMessage.Block.Hash {
+		return
+	}
+	if valid, _ := pNode.DataStructure.IsBlockValid(*pMessage.Block, pProducer); !valid {
+		return
+	}
+	theEntry.PrePrepare = &pMessage
+	pNode.send(Message{Type: Prepare, View: pMessage.View, Sequence: pMessage.Sequence, Digest: pMessage.Digest})
+	pNode.advance(pMessage.View, pMessage.Sequence)
+}
+
+// Number of messages that agree with the digest of the block accepted for the entry
+func countMatching(pMessages map[string]Message, pDigest string) int {
+	rCount := 0
+	for _, v := range pMessages {
+		if v.Digest == pDigest {
+			rCount++
+		}
+	}
+	return rCount
+}
+
+// Move a sequence number of a view forward once a quorum agrees with the accepted block. After a
+// quorum of prepares the block is prepared, so no other block can be committed for the sequence
+// number, and the replica commits it. After a quorum of commits the block is final and it is appended
+// to the chain
+func (pNode *NodePBFT) advance(pView, pSequence int) {
+	theEntry := pNode.entryFor(pView, pSequence)
+	if theEntry.PrePrepare == nil || pView != pNode.View || pNode.InViewChange {
+		return
+	}
+	digest := theEntry.PrePrepare.Digest
+	if !theEntry.Prepared && countMatching(theEntry.Prepares, digest) >= pNode.quorum() {
+		theEntry.Prepared = true
+		pNode.preparedCert = []Message{*theEntry.PrePrepare}
+		for _, v := range theEntry.Prepares {
+			if v.Digest == digest {
+				pNode.preparedCert = append(pNode.preparedCert, v)
+			}
+		}
+		pNode.send(Message{Type: Commit, View: pView, Sequence: pSequence, Digest: digest})
+	}
+	if theEntry.Prepared && !theEntry.Committed && countMatching(theEntry.Commits, digest) >= pNode.quorum() {
+		theEntry.Committed = true
+		certificate := make([]Message, 0, len(theEntry.Commits))
+		for _, v := range theEntry.Commits {
+			if v.Digest == digest {
+				certificate = append(certificate, v)
+			}
+		}
+		pNode.commit(*theEntry.PrePrepare.Block, certificate)
+	}
+}
+
+// Append a final block to the chain and drop the pending transactions it contains, as well as the
+// ones that can no longer be performed. Then the proposals that were waiting for the block are
+// processed, and the primary proposes the next block
+func (pNode *NodePBFT) commit(pBlock blockchain.Block, pCertificate []Message) {
+	pNode.DataStructure.commitBlock(pBlock, pCertificate)
+	pNode.lastProgress = time.Now()
+	pending := pNode.pending
+	pNode.pending = make([]components.Transaction, 0, len(pending))
+	for _, v := range pending {
+		if !pNode.DataStructure.IsTransactionCommitted(v) &&
+			blockchain.VerifyStateTransition([]components.Transaction{v}, pNode.DataStructure.State) {
+			pNode.pending = append(pNode.pending, v)
+		} else {
+			delete(pNode.isPending, v)
+		}
+	}
+	future := pNode.future
+	pNode.future = nil
+	for _, v := range future {
+		pNode.acceptPrePrepare(v, v.Replica)
+	}
+	pNode.propose()
+}
+
+// Try to move to the next view if the primary didn't commit a block for a while, either while there
+// are pending transactions or while the primary of the view being moved to doesn't start it
+func (pNode *NodePBFT) checkTimeout() {
+	if time.Since(pNode.lastProgress) < ViewTimeout || !pNode.InViewChange && len(pNode.pending) == 0 {
+		return
+	}
+	pNode.startViewChange(pNode.View + 1)
+}
+
+// Stop accepting blocks in the current view and ask the replicas to move to the given one. The
+// message carries the certificate of the last block the replica prepared, so that the new primary
+// proposes it again if it wasn't committed
+func (pNode *NodePBFT) startViewChange(pView int) {
+	pNode.View = pView
+	pNode.InViewChange = true
+	pNode.lastProgress = time.Now()
+	pNode.future = nil
+	theMessage := Message{Type: ViewChange, View: pView, Sequence: pNode.DataStructure.NextSequence(), Certificate: pNode.preparedCert}
+	if len(pNode.preparedCert) > 0 {
+		theMessage.Digest = pNode.preparedCert[0].Digest
+	}
+	pNode.send(theMessage)
+}
+
+// Keep a view change. A replica joins a view change once the replicas asking for it include a correct
+// one. The new primary starts the view once a quorum asks for it
+func (pNode *NodePBFT) addViewChange(pMessage Message) {
+	if pMessage.View < pNode.View || pMessage.View == pNode.View && !pNode.InViewChange {
+		return
+	}
+	if _, ok := pNode.viewChanges[pMessage.View]; !ok {
+		pNode.viewChanges[pMessage.View] = make(map[string]Message)
+	}
+	pNode.viewChanges[pMessage.View][pMessage.Replica] = pMessage
+	received := pNode.viewChanges[pMessage.View]
+	if pMessage.View > pNode.View && len(received) > pNode.faulty() {
+		pNode.startViewChange(pMessage.View)
+	}
+	if pMessage.View != pNode.View || len(received) < pNode.quorum() || pNode.newViewSent[pMessage.View] ||
+		pNode.primary(pMessage.View) != pNode.Validator().Key {
+		return
+	}
+	pNode.newViewSent[pMessage.View] = true
+	theMessage := Message{Type: NewView, View: pMessage.View, Sequence: pNode.DataStructure.NextSequence()}
+	for _, v := range received {
+		theMessage.Certificate = append(theMessage.Certificate, v)
+	}
+	if prepared := pNode.highestPrepared(theMessage.Certificate, theMessage.Sequence); prepared != nil {
+		theMessage.Digest = prepared.Digest
+		theMessage.Block = prepared.Block
+	}
+	pNode.send(theMessage)
+}
+
+// Pre-prepare of the block prepared in the highest view for the given sequence number, according to
+// the certificates of the view changes. Certificates without a quorum of valid prepares are ignored
+func (pNode *NodePBFT) highestPrepared(pViewChanges []Message, pSequence int) *Message {
+	var rPrePrepare *Message
+	for _, v := range pViewChanges {
+		if len(v.Certificate) == 0 {
+			continue
+		}
+		prePrepare := v.Certificate[0]
+		prepares := make(map[string]Message)
+		for _, w := range v.Certificate[1:] {
+			if w.Type == Prepare && w.View == prePrepare.View && w.Sequence == prePrepare.Sequence &&
+				w.Digest == prePrepare.Digest && pNode.isValidator(w.Replica) && w.isSignatureValid() {
+				prepares[w.Replica] = w
+			}
+		}
+		switch true {
+		case prePrepare.Type != PrePrepare || prePrepare.Sequence != pSequence || prePrepare.Block == nil:
+			continue
+		case prePrepare.Replica != pNode.primary(prePrepare.View) || !prePrepare.isSignatureValid():
+			continue
+		case len(prepares) < pNode.quorum():
+			continue
+		}
+		if rPrePrepare == nil || prePrepare.View > rPrePrepare.View {
+			candidate := prePrepare
+			rPrePrepare = &candidate
+		}
+	}
+	return rPrePrepare
+}
+
+// Move to the view started by its primary, once it proves that a quorum asked for it. If a block was
+// prepared in a previous view, the primary proposes it again with the same digest, so that a block
+// committed by some replica is committed by every other one
+func (pNode *NodePBFT) acceptNewView(pMessage Message) {
+	if pMessage.View < pNode.View || pMessage.View == pNode.View && !pNode.InViewChange ||
+		pMessage.Replica != pNode.primary(pMessage.View) {
+		return
+	}
+	supporters := make(map[string]bool)
+	for _, v := range pMessage.Certificate {
+		if v.Type == ViewChange && v.View == pMessage.View && pNode.isValidator(v.Replica) && v.isSignatureValid() {
+			supporters[v.Replica] = true
+		}
+	}
+	if len(supporters) < pNode.quorum() {
+		return
+	}
+	prepared := pNode.highestPrepared(pMessage.Certificate, pNode.DataStructure.NextSequence())
+	if prepared != nil && prepared.Digest != pMessage.Digest {
+		return
+	}
+	pNode.View = pMessage.View
+	pNode.InViewChange = false
+	pNode.lastProgress = time.Now()
+	if prepared != nil {
+		// The block keeps the producer that signed it in its view
+		reproposal := Message{Type: PrePrepare, View: pMessage.View, Sequence: prepared.Sequence, Digest: prepared.Digest, Block: prepared.Block, Replica: pMessage.Replica}
+		pNode.acceptPrePrepare(reproposal, prepared.Block.Producer)
+		return
+	}
+	pNode.propose()
+}
+
+// Height of the chain of the replica, including the genesis block. Safe to call while the replica
+// keeps receiving messages
+func (pNode *NodePBFT) Height() int {
+	mutex.Lock()
+	defer mutex.Unlock()
+	return len(pNode.DataStructure.Chain)
+}
+
+// Whether the transaction is part of a final block of the replica. Safe to call while the replica
+// keeps receiving messages
+func (pNode *NodePBFT) IsTransactionCommitted(pTransaction components.Transaction) bool {
+	mutex.Lock()
+	defer mutex.Unlock()
+	return pNode.DataStructure.IsTransactionCommitted(pTransaction)
+}
+
+// Current view of the replica and whether it is trying to move to it. Safe to call while the replica
+// keeps receiving messages
+func (pNode *NodePBFT) CurrentView() (int, bool) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	return pNode.View, pNode.InViewChange
+}
+
+// Number of messages the replica sent to the others. Safe to call while the replica keeps receiving messages
+func (pNode *NodePBFT) CountMessagesSent() int {
+	mutex.Lock()
+	defer mutex.Unlock()
+	return pNode.MessagesSent
+}
+
+// Balance of an account according to the chain of the replica. Safe to call while the replica keeps
+// receiving messages
+func (pNode *NodePBFT) Balance(pAccount string) float64 {
+	mutex.Lock()
+	defer mutex.Unlock()
+	return pNode.DataStructure.State[pAccount]
+}
+
+// Revises whether the error is not nil
+func check(err error) {
+	if err != nil {
+		panic(err)
+	}
+}
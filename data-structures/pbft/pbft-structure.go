@@ -0,0 +1,95 @@
+package pbft
+
+import (
+	"errors"
+	"github.com/gcubillos/isis-3007-distributed-ledger/data-structures/blockchain"
+	"github.com/gcubillos/isis-3007-distributed-ledger/data-structures/shared-components"
+	"time"
+)
+
+// *** Structs ***
+
+// What the PBFT data structure contains
+// Chain contains the committed blocks, going from the genesis block to the last one, and State is
+// the state at the end of it. Since a block is only committed once a quorum of replicas agreed on it,
+// it is final and the chain never forks. Certificates keeps the commit messages that prove it, indexed
+// by the hash of the block. The transactions of the chain are kept as well, so that the ones
+// submitted again are recognized
+type PBFT struct {
+	Chain        []blockchain.Block
+	State        map[string]float64
+	Certificates map[string][]Message
+	committed    map[components.Transaction]bool
+}
+
+// *** Constructors ***
+
+// Create the structure with only the genesis block. The initial state is the state at the end of it
+func CreatePBFT(pGenesisBlock blockchain.Block, pInitialState map[string]float64) PBFT {
+	rPBFT := PBFT{
+		Chain:        []blockchain.Block{pGenesisBlock},
+		State:        make(map[string]float64, len(pInitialState)),
+		Certificates: make(map[string][]Message),
+		committed:    make(map[components.Transaction]bool),
+	}
+	for k, v := range pInitialState {
+		rPBFT.State[k] = v
+	}
+	return rPBFT
+}
+
+// Create the genesis block. It has a fixed timestamp, so that every replica creates the same one
+func CreateGenesisBlock() blockchain.Block {
+	rGenesisBlock := blockchain.Block{Timestamp: time.Unix(0, 0).UTC(), Transactions: make([]components.Transaction, 0)}
+	rGenesisBlock.Hash = blockchain.CalculateHash(rGenesisBlock)
+	return rGenesisBlock
+}
+
+// *** Methods ***
+
+// Last committed block
+func (pPBFT *PBFT) LastBlock() blockchain.Block {
+	return pPBFT.Chain[len(pPBFT.Chain)-1]
+}
+
+// Sequence number of the next block to be committed
+func (pPBFT *PBFT) NextSequence() int {
+	return len(pPBFT.Chain)
+}
+
+// Check that the block proposed by the given primary can follow the last committed block.
+// The sequence number is kept in the slot of the block
+func (pPBFT *PBFT) IsBlockValid(pBlock blockchain.Block, pPrimary string) (bool, error) {
+	lastBlock := pPBFT.LastBlock()
+	switch true {
+	case pBlock.PrevHash != lastBlock.Hash:
+		return false, errors.New("the block doesn't follow the last committed block")
+	case pBlock.Slot != pPBFT.NextSequence():
+		return false, errors.New("the sequence number of the block is not the next one")
+	case pBlock.Timestamp.Before(lastBlock.Timestamp):
+		return false, errors.New("timestamp is not valid")
+	case !blockchain.HasCorrectHash(pBlock):
+		return false, errors.New("calculated hash doesn't match")
+	case pBlock.Producer != pPrimary || !components.VerifySignature(pBlock.Producer, pBlock.Hash, pBlock.Signature):
+		return false, errors.New("the block isn't signed by the primary")
+	case !blockchain.VerifyStateTransition(pBlock.Transactions, pPBFT.State):
+		return false, errors.New("the transactions are inconsistent with the state")
+	default:
+		return true, nil
+	}
+}
+
+// Append a block that a quorum committed to the chain, along with the certificate that proves it
+func (pPBFT *PBFT) commitBlock(pBlock blockchain.Block, pCertificate []Message) {
+	blockchain.ApplyTransactions(pPBFT.State, pBlock.Transactions)
+	pPBFT.Chain = append(pPBFT.Chain, pBlock)
+	pPBFT.Certificates[pBlock.Hash] = pCertificate
+	for _, v := range pBlock.Transactions {
+		pPBFT.committed[v] = true
+	}
+}
+
+// Whether the transaction is part of a committed block
+func (pPBFT *PBFT) IsTransactionCommitted(pTransaction components.Transaction) bool {
+	return pPBFT.committed[pTransaction]
+}
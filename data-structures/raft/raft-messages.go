@@ -0,0 +1,58 @@
+package raft
+
+import (
+	"github.com/gcubillos/isis-3007-distributed-ledger/data-structures/blockchain"
+	"github.com/gcubillos/isis-3007-distributed-ledger/data-structures/shared-components"
+)
+
+// *** Structs ***
+
+// Types of messages exchanged by the members of the cluster
+const (
+	// Transactions submitted to the members, which the leader orders into blocks
+	Request = "request"
+	// A candidate asks for the vote of the other members for its term
+	RequestVote = "request-vote"
+	// Answer to a request for a vote
+	Vote = "vote"
+	// The leader replicates the entries of its log that follow the given one, or lets the followers
+	// know it is still alive when there are none
+	AppendEntries = "append-entries"
+	// Answer to the replication of entries, with the last entry the follower has in common with the leader
+	AppendResponse = "append-response"
+)
+
+// Roles a member can have in a term
+const (
+	Follower  = "follower"
+	Candidate = "candidate"
+	Leader    = "leader"
+)
+
+// What a message between members contains
+// Sender is the address of the member that sent the message and Term is its current term.
+// A request for a vote carries the last entry of the log of the candidate, in LastIndex and LastTerm.
+// A replication carries the entry that precedes the replicated ones, in PrevIndex and PrevTerm, and
+// the index up to which the leader committed its log. The answers tell whether the vote was Granted
+// or the entries were appended, and in MatchIndex the last entry known to match the log of the leader
+type Message struct {
+	Type         string
+	Term         int
+	Sender       string
+	LastIndex    int
+	LastTerm     int
+	PrevIndex    int
+	PrevTerm     int
+	Entries      []Entry
+	LeaderCommit int
+	Granted      bool
+	Success      bool
+	MatchIndex   int
+	Transactions []components.Transaction
+}
+
+// What an entry of the replicated log contains: a block and the term in which the leader created it
+type Entry struct {
+	Term  int
+	Block blockchain.Block
+}
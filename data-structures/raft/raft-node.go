@@ -0,0 +1,532 @@
+package raft
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/gcubillos/isis-3007-distributed-ledger/data-structures/blockchain"
+	"github.com/gcubillos/isis-3007-distributed-ledger/data-structures/shared-components"
+	"github.com/perlin-network/noise"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// Mutual exclusion variable
+var mutex = &sync.Mutex{}
+
+// Time a node waits for a member to acknowledge a message
+var RequestTimeout = 2 * time.Second
+
+// Time between the messages the leader sends to let the followers know it is alive
+var HeartbeatInterval = 50 * time.Millisecond
+
+// Minimum time a follower waits without hearing from a leader before becoming a candidate. Each member
+// waits a random time between this one and twice it, so that they rarely become candidates together
+var ElectionTimeout = 300 * time.Millisecond
+
+// Maximum number of transactions the leader orders in a block
+var BlockSize = 500
+
+// Maximum number of entries sent in a single replication
+var MaxEntries = 64
+
+// *** Structs ***
+
+// Declaration of a member of the cluster
+// Contains the underlying data structure as well as the node from the noise library.
+// Members are the addresses of every member of the cluster, including this one, and a member is
+// identified by its address. Role is the role of the member in its CurrentTerm, VotedFor the candidate
+// it voted for in that term and Leader the leader it knows for it.
+// Every member keeps the transactions that aren't committed yet, so that any leader can order them.
+// The leader keeps, for every follower, the next entry to send and the last entry known to match
+type NodeRaft struct {
+	DataStructure Raft
+	Node          *noise.Node
+	Members       []string
+	Role          string
+	CurrentTerm   int
+	VotedFor      string
+	Leader        string
+	pending       []components.Transaction
+	isPending     map[components.Transaction]bool
+	votes         map[string]bool
+	nextIndex     map[string]int
+	matchIndex    map[string]int
+	deadline      time.Time
+	lastHeartbeat time.Time
+	outbox        []outgoing
+	stopped       bool
+}
+
+// A message queued to be sent to a member
+type outgoing struct {
+	Address string
+	Message Message
+}
+
+// *** Constructors ***
+
+// Create a member that listens to the network. The genesis block and the "main" account with the
+// amount of available currency must be the same for every member. The member doesn't take part in
+// the protocol until it is started with the members of the cluster
+func CreateNode(pGenesisBlock blockchain.Block, pAvailableCurrency float64) *NodeRaft {
+	thisNode := &NodeRaft{
+		Role:      Follower,
+		isPending: make(map[components.Transaction]bool),
+		stopped:   true,
+	}
+	// For simplicity a "main" account will be created that contains the amount of currency available
+	thisNode.DataStructure = CreateRaft(pGenesisBlock, map[string]float64{"main": pAvailableCurrency})
+
+	// Create network node
+	networkNode, err := noise.NewNode()
+	check(err)
+
+	// Assign the way the node will handle the messages of the other members
+	networkNode.Handle(thisNode.handleRequest)
+
+	// Make the node listen to the network
+	check(networkNode.Listen())
+	thisNode.Node = networkNode
+
+	return thisNode
+}
+
+// *** Methods ***
+
+// Start taking part in the protocol with the given members, which must include this one. The member
+// starts as a follower, and it periodically checks whether it must become a candidate or, as the
+// leader, let the followers know it is alive
+func (pNode *NodeRaft) Start(pMembers []string) {
+	mutex.Lock()
+	pNode.Members = pMembers
+	pNode.resetDeadline()
+	pNode.stopped = false
+	mutex.Unlock()
+	go func() {
+		for {
+			time.Sleep(HeartbeatInterval / 5)
+			mutex.Lock()
+			if pNode.stopped {
+				mutex.Unlock()
+				return
+			}
+			pNode.tick()
+			pNode.flush()
+		}
+	}()
+}
+
+// Stop taking part in the protocol and close the network node
+func (pNode *NodeRaft) Close() {
+	mutex.Lock()
+	pNode.stopped = true
+	mutex.Unlock()
+	check(pNode.Node.Close())
+}
+
+// Send transactions to every member so that the leader orders them in a block
+func (pNode *NodeRaft) Submit(pTransactions []components.Transaction) {
+	mutex.Lock()
+	request := Message{Type: Request, Sender: pNode.Node.Addr(), Transactions: pTransactions}
+	for _, v := range pNode.Members {
+		if v != pNode.Node.Addr() {
+			pNode.outbox = append(pNode.outbox, outgoing{Address: v, Message: request})
+		}
+	}
+	pNode.addRequest(pTransactions)
+	pNode.flush()
+}
+
+// Unlock the mutex and send the queued messages. Messages are sent without holding the structure, so
+// that the members can answer each other, and each member receives them in order. A member that left
+// the network doesn't delay the messages to the others
+func (pNode *NodeRaft) flush() {
+	outbox := pNode.outbox
+	pNode.outbox = nil
+	mutex.Unlock()
+	byAddress := make(map[string][][]byte)
+	for _, v := range outbox {
+		bytes, err := json.Marshal(v.Message)
+		check(err)
+		byAddress[v.Address] = append(byAddress[v.Address], bytes)
+	}
+	for k, v := range byAddress {
+		go func(pAddress string, pMessages [][]byte) {
+			for _, w := range pMessages {
+				// A member that is too busy to answer doesn't stop the next messages from being sent
+				ctx, cancel := context.WithTimeout(context.Background(), RequestTimeout)
+				_, _ = pNode.Node.Request(ctx, pAddress, w)
+				cancel()
+			}
+		}(k, v)
+	}
+}
+
+// Queue a message of the member for another one
+func (pNode *NodeRaft) send(pAddress string, pMessage Message) {
+	pMessage.Term = pNode.CurrentTerm
+	pMessage.Sender = pNode.Node.Addr()
+	pNode.outbox = append(pNode.outbox, outgoing{Address: pAddress, Message: pMessage})
+}
+
+// Handle the messages of the other members
+func (pNode *NodeRaft) handleRequest(ctx noise.HandlerContext) error {
+	if !ctx.IsRequest() {
+		return nil
+	}
+	var received Message
+	if err := json.Unmarshal(ctx.Data(), &received); err != nil {
+		return ctx.Send([]byte(""))
+	}
+	if err := ctx.Send([]byte("")); err != nil {
+		return err
+	}
+
+	mutex.Lock()
+	if pNode.stopped {
+		mutex.Unlock()
+		return nil
+	}
+	if received.Type == Request {
+		pNode.addRequest(received.Transactions)
+		pNode.flush()
+		return nil
+	}
+	// A member with a more recent term makes the member a follower in that term
+	if received.Term > pNode.CurrentTerm {
+		pNode.becomeFollower(received.Term)
+	}
+	switch received.Type {
+	case RequestVote:
+		pNode.handleRequestVote(received)
+	case Vote:
+		pNode.handleVote(received)
+	case AppendEntries:
+		pNode.handleAppendEntries(received)
+	case AppendResponse:
+		pNode.handleAppendResponse(received)
+	}
+	pNode.flush()
+	return nil
+}
+
+// Choose a new random time after which the member becomes a candidate if it doesn't hear from a leader
+func (pNode *NodeRaft) resetDeadline() {
+	pNode.deadline = time.Now().Add(ElectionTimeout + time.Duration(rand.Int63n(int64(ElectionTimeout))))
+}
+
+// Number of members that form a majority of the cluster
+func (pNode *NodeRaft) majority() int {
+	return len(pNode.Members)/2 + 1
+}
+
+// Periodic work of the member. The leader replicates its log to let the followers know it is alive,
+// and the other members become candidates if they didn't hear from a leader in time
+func (pNode *NodeRaft) tick() {
+	switch true {
+	case pNode.Role == Leader && time.Since(pNode.lastHeartbeat) >= HeartbeatInterval:
+		pNode.replicate()
+	case pNode.Role != Leader && time.Now().After(pNode.deadline):
+		pNode.startElection()
+	}
+}
+
+// Move to the given term as a follower that hasn't voted yet
+func (pNode *NodeRaft) becomeFollower(pTerm int) {
+	pNode.CurrentTerm = pTerm
+	pNode.Role = Follower
+	pNode.VotedFor = ""
+	pNode.Leader = ""
+}
+
+// Move to the next term as a candidate that votes for itself and asks the others for their votes
+func (pNode *NodeRaft) startElection() {
+	pNode.CurrentTerm++
+	pNode.Role = Candidate
+	pNode.VotedFor = pNode.Node.Addr()
+	pNode.Leader = ""
+	pNode.votes = map[string]bool{pNode.Node.Addr(): true}
+	pNode.resetDeadline()
+	lastIndex, lastTerm := pNode.DataStructure.LastEntry()
+	for _, v := range pNode.Members {
+		if v != pNode.Node.Addr() {
+			pNode.send(v, Message{Type: RequestVote, LastIndex: lastIndex, LastTerm: lastTerm})
+		}
+	}
+	if len(pNode.votes) >= pNode.majority() {
+		pNode.becomeLeader()
+	}
+}
+
+// Grant the vote to a candidate of the current term if the member hasn't voted for another one and the
+// log of the candidate is at least as recent as its own, so that the leader has every committed entry
+func (pNode *NodeRaft) handleRequestVote(pMessage Message) {
+	lastIndex, lastTerm := pNode.DataStructure.LastEntry()
+	upToDate := pMessage.LastTerm > lastTerm || pMessage.LastTerm == lastTerm && pMessage.LastIndex >= lastIndex
+	granted := pMessage.Term == pNode.CurrentTerm && upToDate && (pNode.VotedFor == "" || pNode.VotedFor == pMessage.Sender)
+	if granted {
+		pNode.VotedFor = pMessage.Sender
+		pNode.resetDeadline()
+	}
+	pNode.send(pMessage.Sender, Message{Type: Vote, Granted: granted})
+}
+
+// Count a vote for the candidacy of the member, which becomes leader with the votes of a majority
+func (pNode *NodeRaft) handleVote(pMessage Message) {
+	if pNode.Role != Candidate || pMessage.Term != pNode.CurrentTerm || !pMessage.Granted {
+		return
+	}
+	pNode.votes[pMessage.Sender] = true
+	if len(pNode.votes) >= pNode.majority() {
+		pNode.becomeLeader()
+	}
+}
+
+// Lead the current term. The leader appends an empty block of its term, since it can only count the
+// replicas of the entries of its own term to commit them, and the previous ones are committed with it
+func (pNode *NodeRaft) becomeLeader() {
+	pNode.Role = Leader
+	pNode.Leader = pNode.Node.Addr()
+	pNode.DataStructure.recordLeader(pNode.CurrentTerm, pNode.Leader)
+	lastIndex, _ := pNode.DataStructure.LastEntry()
+	pNode.nextIndex = make(map[string]int)
+	pNode.matchIndex = make(map[string]int)
+	for _, v := range pNode.Members {
+		pNode.nextIndex[v] = lastIndex + 1
+		pNode.matchIndex[v] = 0
+	}
+	pNode.appendBlock(make([]components.Transaction, 0))
+}
+
+// Keep the transactions that aren't committed nor pending yet and that can be performed over the
+// current state. The leader orders them if it isn't waiting for another block
+func (pNode *NodeRaft) addRequest(pTransactions []components.Transaction) {
+	for _, v := range pTransactions {
+		if pNode.isPending[v] || pNode.DataStructure.IsTransactionCommitted(v) ||
+			!blockchain.VerifyStateTransition([]components.Transaction{v}, pNode.DataStructure.State) {
+			continue
+		}
+		pNode.pending = append(pNode.pending, v)
+		pNode.isPending[v] = true
+	}
+	pNode.propose()
+}
+
+// If the member is the leader and every entry of its log is committed, order the pending transactions
+// in a block. Only one block is being replicated at a time, so the transactions are verified over the
+// committed state
+func (pNode *NodeRaft) propose() {
+	lastIndex, _ := pNode.DataStructure.LastEntry()
+	if pNode.Role != Leader || len(pNode.pending) == 0 || lastIndex != pNode.DataStructure.CommitIndex {
+		return
+	}
+	transactions := make([]components.Transaction, 0)
+	for _, v := range pNode.pending {
+		if len(transactions) == BlockSize {
+			break
+		}
+		if blockchain.VerifyStateTransition(append(transactions, v), pNode.DataStructure.State) {
+			transactions = append(transactions, v)
+		}
+	}
+	pNode.appendBlock(transactions)
+}
+
+// Append a block with the given transactions to the log of the leader and replicate it
+func (pNode *NodeRaft) appendBlock(pTransactions []components.Transaction) {
+	lastIndex, _ := pNode.DataStructure.LastEntry()
+	lastBlock := pNode.DataStructure.Log[lastIndex].Block
+	// The monotonic clock reading is stripped, since it isn't kept when the block is sent to other members
+	newBlock := blockchain.Block{
+		Timestamp:    time.Now().Round(0),
+		PrevHash:     lastBlock.Hash,
+		Transactions: pTransactions,
+	}
+	if newBlock.Timestamp.Before(lastBlock.Timestamp) {
+		newBlock.Timestamp = lastBlock.Timestamp
+	}
+	newBlock.Hash = blockchain.CalculateHash(newBlock)
+	pNode.DataStructure.Log = append(pNode.DataStructure.Log, Entry{Term: pNode.CurrentTerm, Block: newBlock})
+	pNode.matchIndex[pNode.Node.Addr()] = lastIndex + 1
+	pNode.advanceCommit()
+	pNode.replicate()
+}
+
+// Send to every follower the entries it is missing, or none if it is up to date
+func (pNode *NodeRaft) replicate() {
+	pNode.lastHeartbeat = time.Now()
+	for _, v := range pNode.Members {
+		if v != pNode.Node.Addr() {
+			pNode.replicateTo(v)
+		}
+	}
+}
+
+// Send to a follower the entries of the log that follow the last one it is known to have
+func (pNode *NodeRaft) replicateTo(pAddress string) {
+	prevIndex := pNode.nextIndex[pAddress] - 1
+	end := len(pNode.DataStructure.Log)
+	if end-prevIndex-1 > MaxEntries {
+		end = prevIndex + 1 + MaxEntries
+	}
+	entries := append([]Entry{}, pNode.DataStructure.Log[prevIndex+1:end]...)
+	pNode.send(pAddress, Message{
+		Type:         AppendEntries,
+		PrevIndex:    prevIndex,
+		PrevTerm:     pNode.DataStructure.Log[prevIndex].Term,
+		Entries:      entries,
+		LeaderCommit: pNode.DataStructure.CommitIndex,
+	})
+}
+
+// Append the entries replicated by the leader of the current term, as long as the log has the entry that
+// precedes them, and commit up to the index committed by the leader
+func (pNode *NodeRaft) handleAppendEntries(pMessage Message) {
+	if pMessage.Term < pNode.CurrentTerm {
+		pNode.send(pMessage.Sender, Message{Type: AppendResponse, Success: false})
+		return
+	}
+	// A candidate of the same term gives up once another member won the election
+	pNode.Role = Follower
+	pNode.Leader = pMessage.Sender
+	pNode.DataStructure.recordLeader(pMessage.Term, pMessage.Sender)
+	pNode.resetDeadline()
+
+	if !pNode.DataStructure.HasEntry(pMessage.PrevIndex, pMessage.PrevTerm) {
+		// The leader goes back at most to the last entry of the log, and then one entry at a time
+		lastIndex, _ := pNode.DataStructure.LastEntry()
+		if lastIndex >= pMessage.PrevIndex {
+			lastIndex = pMessage.PrevIndex - 1
+		}
+		pNode.send(pMessage.Sender, Message{Type: AppendResponse, Success: false, MatchIndex: lastIndex})
+		return
+	}
+	matchIndex, err := pNode.DataStructure.AppendEntries(pMessage.PrevIndex, pMessage.Entries)
+	if err != nil {
+		pNode.send(pMessage.Sender, Message{Type: AppendResponse, Success: false, MatchIndex: pNode.DataStructure.CommitIndex})
+		return
+	}
+	if pMessage.LeaderCommit < matchIndex {
+		pNode.commit(pMessage.LeaderCommit)
+	} else {
+		pNode.commit(matchIndex)
+	}
+	pNode.send(pMessage.Sender, Message{Type: AppendResponse, Success: true, MatchIndex: matchIndex})
+}
+
+// Register how much of the log of the leader a follower has. If the follower is missing entries, the
+// leader sends them right away
+func (pNode *NodeRaft) handleAppendResponse(pMessage Message) {
+	if pNode.Role != Leader || pMessage.Term != pNode.CurrentTerm {
+		return
+	}
+	if pMessage.Success {
+		if pMessage.MatchIndex > pNode.matchIndex[pMessage.Sender] {
+			pNode.matchIndex[pMessage.Sender] = pMessage.MatchIndex
+		}
+		pNode.nextIndex[pMessage.Sender] = pNode.matchIndex[pMessage.Sender] + 1
+		pNode.advanceCommit()
+	} else {
+		pNode.nextIndex[pMessage.Sender] = pMessage.MatchIndex + 1
+		if pNode.nextIndex[pMessage.Sender] < 1 {
+			pNode.nextIndex[pMessage.Sender] = 1
+		}
+	}
+	if lastIndex, _ := pNode.DataStructure.LastEntry(); pNode.nextIndex[pMessage.Sender] <= lastIndex {
+		pNode.replicateTo(pMessage.Sender)
+	}
+}
+
+// Commit the entries of the current term stored by a majority of the cluster, along with the ones before
+// them. The followers learn about it right away, unless a new block already carries it
+func (pNode *NodeRaft) advanceCommit() {
+	lastIndex, _ := pNode.DataStructure.LastEntry()
+	for i := lastIndex; i > pNode.DataStructure.CommitIndex && pNode.DataStructure.Log[i].Term == pNode.CurrentTerm; i-- {
+		replicas := 0
+		for _, v := range pNode.Members {
+			if pNode.matchIndex[v] >= i {
+				replicas++
+			}
+		}
+		if replicas >= pNode.majority() {
+			pNode.commit(i)
+			if lastIndex, _ = pNode.DataStructure.LastEntry(); lastIndex == pNode.DataStructure.CommitIndex {
+				pNode.replicate()
+			}
+			return
+		}
+	}
+}
+
+// Commit the log up to the given index and drop the pending transactions that were committed, as well
+// as the ones that can no longer be performed. Then the leader orders the next block
+func (pNode *NodeRaft) commit(pIndex int) {
+	if pIndex <= pNode.DataStructure.CommitIndex {
+		return
+	}
+	pNode.DataStructure.Commit(pIndex)
+	pending := pNode.pending
+	pNode.pending = make([]components.Transaction, 0, len(pending))
+	for _, v := range pending {
+		if !pNode.DataStructure.IsTransactionCommitted(v) &&
+			blockchain.VerifyStateTransition([]components.Transaction{v}, pNode.DataStructure.State) {
+			pNode.pending = append(pNode.pending, v)
+		} else {
+			delete(pNode.isPending, v)
+		}
+	}
+	pNode.propose()
+}
+
+// Whether the member is the leader of its current term. Safe to call while the member keeps receiving messages
+func (pNode *NodeRaft) IsLeader() bool {
+	mutex.Lock()
+	defer mutex.Unlock()
+	return pNode.Role == Leader
+}
+
+// Leader known by the member and its term, the leader being empty if the member doesn't know it yet.
+// Safe to call while the member keeps receiving messages
+func (pNode *NodeRaft) CurrentLeader() (string, int) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	return pNode.Leader, pNode.CurrentTerm
+}
+
+// Index of the last committed entry of the member. Safe to call while the member keeps receiving messages
+func (pNode *NodeRaft) CommitIndex() int {
+	mutex.Lock()
+	defer mutex.Unlock()
+	return pNode.DataStructure.CommitIndex
+}
+
+// Leaders the member learned about, in order. Safe to call while the member keeps receiving messages
+func (pNode *NodeRaft) LeaderChanges() []LeaderChange {
+	mutex.Lock()
+	defer mutex.Unlock()
+	return append([]LeaderChange{}, pNode.DataStructure.LeaderChanges...)
+}
+
+// Whether the transaction is part of a committed entry of the member. Safe to call while the member
+// keeps receiving messages
+func (pNode *NodeRaft) IsTransactionCommitted(pTransaction components.Transaction) bool {
+	mutex.Lock()
+	defer mutex.Unlock()
+	return pNode.DataStructure.IsTransactionCommitted(pTransaction)
+}
+
+// Balance of an account according to the committed entries of the member. Safe to call while the member
+// keeps receiving messages
+func (pNode *NodeRaft) Balance(pAccount string) float64 {
+	mutex.Lock()
+	defer mutex.Unlock()
+	return pNode.DataStructure.State[pAccount]
+}
+
+// Revises whether the error is not nil
+func check(err error) {
+	if err != nil {
+		panic(err)
+	}
+}
@@ -0,0 +1,118 @@
+package raft
+
+import (
+	"errors"
+	"github.com/gcubillos/isis-3007-distributed-ledger/data-structures/blockchain"
+	"github.com/gcubillos/isis-3007-distributed-ledger/data-structures/shared-components"
+	"time"
+)
+
+// *** Structs ***
+
+// What the Raft data structure contains
+// Log contains the entries of the member, starting with the genesis block at index zero. The entries up
+// to CommitIndex are stored by a majority of the cluster, so they are final, while the following ones
+// may still be replaced by a new leader. State is the state at the end of the committed entries.
+// LeaderChanges registers every leader the member learned about, in order
+type Raft struct {
+	Log           []Entry
+	CommitIndex   int
+	State         map[string]float64
+	LeaderChanges []LeaderChange
+	committed     map[components.Transaction]bool
+}
+
+// What is registered every time a member learns about the leader of a new term
+type LeaderChange struct {
+	Timestamp time.Time
+	Term      int
+	Leader    string
+}
+
+// *** Constructors ***
+
+// Create the structure with only the genesis block, which is committed. The initial state is the
+// state at the end of it
+func CreateRaft(pGenesisBlock blockchain.Block, pInitialState map[string]float64) Raft {
+	rRaft := Raft{
+		Log:           []Entry{{Term: 0, Block: pGenesisBlock}},
+		State:         make(map[string]float64, len(pInitialState)),
+		LeaderChanges: make([]LeaderChange, 0),
+		committed:     make(map[components.Transaction]bool),
+	}
+	for k, v := range pInitialState {
+		rRaft.State[k] = v
+	}
+	return rRaft
+}
+
+// Create the genesis block. It has a fixed timestamp, so that every member creates the same one
+func CreateGenesisBlock() blockchain.Block {
+	rGenesisBlock := blockchain.Block{Timestamp: time.Unix(0, 0).UTC(), Transactions: make([]components.Transaction, 0)}
+	rGenesisBlock.Hash = blockchain.CalculateHash(rGenesisBlock)
+	return rGenesisBlock
+}
+
+// *** Methods ***
+
+// Index and term of the last entry of the log
+func (pRaft *Raft) LastEntry() (int, int) {
+	lastIndex := len(pRaft.Log) - 1
+	return lastIndex, pRaft.Log[lastIndex].Term
+}
+
+// Whether the log contains an entry at the given index created in the given term. Two logs with such
+// an entry are the same up to it
+func (pRaft *Raft) HasEntry(pIndex, pTerm int) bool {
+	return pIndex >= 0 && pIndex < len(pRaft.Log) && pRaft.Log[pIndex].Term == pTerm
+}
+
+// Append the entries replicated by the leader after the given index. An entry that conflicts with the
+// one the log has at the same index replaces it along with the ones that follow, which were never
+// committed. It returns the index of the last replicated entry
+func (pRaft *Raft) AppendEntries(pPrevIndex int, pEntries []Entry) (int, error) {
+	if pPrevIndex >= len(pRaft.Log) {
+		return 0, errors.New("the log doesn't have the entry that precedes the replicated ones")
+	}
+	for i, v := range pEntries {
+		index := pPrevIndex + 1 + i
+		switch true {
+		case index < len(pRaft.Log) && pRaft.Log[index].Term == v.Term:
+			continue
+		case index <= pRaft.CommitIndex:
+			return 0, errors.New("a committed entry can't be replaced")
+		case index < len(pRaft.Log):
+			pRaft.Log = pRaft.Log[:index]
+		}
+		pRaft.Log = append(pRaft.Log, v)
+	}
+	return pPrevIndex + len(pEntries), nil
+}
+
+// Commit the entries of the log up to the given index, applying their transactions to the state.
+// The transactions were verified by the leader that created the blocks
+func (pRaft *Raft) Commit(pIndex int) {
+	if lastIndex, _ := pRaft.LastEntry(); pIndex > lastIndex {
+		pIndex = lastIndex
+	}
+	for ; pRaft.CommitIndex < pIndex; pRaft.CommitIndex++ {
+		theBlock := pRaft.Log[pRaft.CommitIndex+1].Block
+		blockchain.ApplyTransactions(pRaft.State, theBlock.Transactions)
+		for _, v := range theBlock.Transactions {
+			pRaft.committed[v] = true
+		}
+	}
+}
+
+// Register the leader of a term, unless it is already known
+func (pRaft *Raft) recordLeader(pTerm int, pLeader string) {
+	if len(pRaft.LeaderChanges) > 0 && pRaft.LeaderChanges[len(pRaft.LeaderChanges)-1].Term >= pTerm {
+		return
+	}
+	pRaft.LeaderChanges = append(pRaft.LeaderChanges, LeaderChange{Timestamp: time.Now(), Term: pTerm, Leader: pLeader})
+}
+
+// Whether the transaction is part of a committed entry
+func (pRaft *Raft) IsTransactionCommitted(pTransaction components.Transaction) bool {
+	return pRaft.committed[pTransaction]
+}
@@ -0,0 +1,146 @@
+package components
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// *** Structs ***
+
+// States of a background miner
+const (
+	MinerStopped = "stopped"
+	MinerRunning = "running"
+	MinerPaused  = "paused"
+)
+
+// Time a background miner waits before trying again when a block couldn't be produced for a reason
+// other than being interrupted, so that it doesn't keep failing in a loop
+var MinerRetryDelay = 10 * time.Millisecond
+
+// Returned by the function that produces a block when it abandoned the block because the tip changed.
+// The miner starts over right away on the new tip instead of waiting as after a failure
+var ErrTipChanged = errors.New("the tip changed while producing the block")
+
+// Produces blocks one after the other in the background until it is stopped
+// The function that produces a block is given a context that is cancelled when the miner is paused
+// or stopped, and it returns nil once the block was produced. Produced counts those blocks.
+// Looping tells whether the goroutine producing the blocks is still running, which it can be for a
+// while after the miner is stopped, so that a new one isn't started until it returns
+type BackgroundMiner struct {
+	produce  func(context.Context) error
+	state    string
+	produced int
+	looping  bool
+	cancel   context.CancelFunc
+	lock     sync.Mutex
+	changed  *sync.Cond
+}
+
+// *** Constructors ***
+
+// Create a stopped miner that produces blocks with the given function
+func CreateBackgroundMiner(pProduce func(context.Context) error) *BackgroundMiner {
+	rMiner := &BackgroundMiner{
+		produce: pProduce,
+		state:   MinerStopped,
+		cancel:  func() {},
+	}
+	rMiner.changed = sync.NewCond(&rMiner.lock)
+	return rMiner
+}
+
+// *** Methods ***
+
+// Start producing blocks, or resume if the miner was paused. If the miner is being stopped, it waits
+// until the previous goroutine returns, so that only one produces blocks at a time
+func (pMiner *BackgroundMiner) Start() {
+	pMiner.lock.Lock()
+	defer pMiner.lock.Unlock()
+	for pMiner.state == MinerStopped && pMiner.looping {
+		pMiner.changed.Wait()
+	}
+	switch pMiner.state {
+	case MinerStopped:
+		pMiner.state = MinerRunning
+		pMiner.looping = true
+		go pMiner.run()
+	case MinerPaused:
+		pMiner.state = MinerRunning
+		pMiner.changed.Broadcast()
+	}
+}
+
+// Stop producing blocks until the miner is started again. The block being produced is abandoned
+func (pMiner *BackgroundMiner) Pause() {
+	pMiner.lock.Lock()
+	defer pMiner.lock.Unlock()
+	if pMiner.state == MinerRunning {
+		pMiner.state = MinerPaused
+		pMiner.cancel()
+	}
+}
+
+// Stop producing blocks, abandoning the block being produced. Returns once the miner won't produce
+// any other block
+func (pMiner *BackgroundMiner) Stop() {
+	pMiner.lock.Lock()
+	defer pMiner.lock.Unlock()
+	if pMiner.state != MinerStopped {
+		pMiner.state = MinerStopped
+		pMiner.cancel()
+		pMiner.changed.Broadcast()
+	}
+	for pMiner.looping && pMiner.state == MinerStopped {
+		pMiner.changed.Wait()
+	}
+}
+
+// Current state of the miner
+func (pMiner *BackgroundMiner) State() string {
+	pMiner.lock.Lock()
+	defer pMiner.lock.Unlock()
+	return pMiner.state
+}
+
+// Number of blocks produced by the miner
+func (pMiner *BackgroundMiner) Produced() int {
+	pMiner.lock.Lock()
+	defer pMiner.lock.Unlock()
+	return pMiner.produced
+}
+
+// Produce blocks while the miner is running, waiting while it is paused
+func (pMiner *BackgroundMiner) run() {
+	defer func() {
+		pMiner.lock.Lock()
+		pMiner.looping = false
+		pMiner.changed.Broadcast()
+		pMiner.lock.Unlock()
+	}()
+	for {
+		pMiner.lock.Lock()
+		for pMiner.state == MinerPaused {
+			pMiner.changed.Wait()
+		}
+		if pMiner.state == MinerStopped {
+			pMiner.lock.Unlock()
+			return
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		pMiner.cancel = cancel
+		pMiner.lock.Unlock()
+
+		err := pMiner.produce(ctx)
+		cancel()
+		if err == nil {
+			pMiner.lock.Lock()
+			pMiner.produced++
+			pMiner.lock.Unlock()
+		} else if ctx.Err() == nil && err != ErrTipChanged {
+			time.Sleep(MinerRetryDelay)
+		}
+	}
+}
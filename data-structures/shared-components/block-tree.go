@@ -0,0 +1,200 @@
+package components
+
+import (
+	"errors"
+)
+
+// *** Structs ***
+
+// What a node of the block tree contains. Only the information needed to choose between
+// branches is kept, the blocks themselves stay in each data structure.
+// Work is the proof of work of the block alone, TotalWork is accumulated from the genesis block.
+// Uncles are the hashes of the stale blocks the block references, if the structure has them.
+// SubtreeSize and SubtreeWork are the number of valid blocks and their work in the subtree rooted
+// at the block, including itself. They are updated every time a block is added or invalidated
+type TreeNode struct {
+	Hash        string
+	ParentHash  string
+	Height      int
+	Work        int
+	TotalWork   int
+	SubtreeSize int
+	SubtreeWork int
+	Children    []string
+	Uncles      []string
+	Invalid     bool
+}
+
+// Tree containing every block received by a node, indexed by its hash
+type BlockTree struct {
+	Nodes   map[string]*TreeNode
+	Genesis string
+}
+
+// *** Constructors ***
+
+// Create a tree that only contains the genesis block
+func CreateBlockTree(pGenesisHash string, pWork int) BlockTree {
+	rTree := BlockTree{
+		Nodes:   make(map[string]*TreeNode),
+		Genesis: pGenesisHash,
+	}
+	rTree.Nodes[pGenesisHash] = &TreeNode{
+		Hash:        pGenesisHash,
+		Height:      0,
+		Work:        pWork,
+		TotalWork:   pWork,
+		SubtreeSize: 1,
+		SubtreeWork: pWork,
+		Children:    make([]string, 0),
+	}
+	return rTree
+}
+
+// *** Methods ***
+
+// Add a block to the tree as a child of its parent, which must be already present
+func (pTree *BlockTree) AddNode(pHash, pParentHash string, pWork int, pUncles []string) error {
+	if _, ok := pTree.Nodes[pHash]; ok {
+		return errors.New("block is already part of the tree")
+	}
+	parentNode, ok := pTree.Nodes[pParentHash]
+	if !ok {
+		return errors.New("parent block is unknown")
+	}
+	pTree.Nodes[pHash] = &TreeNode{
+		Hash:       pHash,
+		ParentHash: pParentHash,
+		Height:     parentNode.Height + 1,
+		Work:       pWork,
+		TotalWork:  parentNode.TotalWork + pWork,
+		Children:   make([]string, 0),
+		Uncles:     append([]string(nil), pUncles...),
+		Invalid:    parentNode.Invalid,
+	}
+	parentNode.Children = append(parentNode.Children, pHash)
+	// The block only adds weight to its ancestors if it is valid
+	if !parentNode.Invalid {
+		pTree.updateSubtreeWeights(pHash, 1, pWork)
+	}
+	return nil
+}
+
+// Add the given size and work to the subtree weights of a block and all of its ancestors
+func (pTree *BlockTree) updateSubtreeWeights(pHash string, pSize, pWork int) {
+	for current := pTree.Nodes[pHash]; ; current = pTree.Nodes[current.ParentHash] {
+		current.SubtreeSize += pSize
+		current.SubtreeWork += pWork
+		if current.Hash == pTree.Genesis {
+			return
+		}
+	}
+}
+
+// Whether the block is part of the tree
+func (pTree *BlockTree) Contains(pHash string) bool {
+	_, ok := pTree.Nodes[pHash]
+	return ok
+}
+
+// Create a copy of the tree that doesn't share any node with the original one
+func (pTree *BlockTree) Copy() BlockTree {
+	rTree := BlockTree{
+		Nodes:   make(map[string]*TreeNode, len(pTree.Nodes)),
+		Genesis: pTree.Genesis,
+	}
+	for k, v := range pTree.Nodes {
+		nodeCopy := *v
+		nodeCopy.Children = append([]string(nil), v.Children...)
+		nodeCopy.Uncles = append([]string(nil), v.Uncles...)
+		rTree.Nodes[k] = &nodeCopy
+	}
+	return rTree
+}
+
+// Find the most recent block shared by the branches ending in the given blocks
+func (pTree *BlockTree) FindForkBlock(pFirstHash, pSecondHash string) string {
+	first := pTree.Nodes[pFirstHash]
+	second := pTree.Nodes[pSecondHash]
+	for first.Height > second.Height {
+		first = pTree.Nodes[first.ParentHash]
+	}
+	for second.Height > first.Height {
+		second = pTree.Nodes[second.ParentHash]
+	}
+	for first.Hash != second.Hash {
+		first = pTree.Nodes[first.ParentHash]
+		second = pTree.Nodes[second.ParentHash]
+	}
+	return first.Hash
+}
+
+// Whether the first block is an ancestor of the second one. A block is considered its own ancestor
+func (pTree *BlockTree) IsAncestor(pAncestorHash, pHash string) bool {
+	ancestor, ok := pTree.Nodes[pAncestorHash]
+	if !ok || !pTree.Contains(pHash) {
+		return false
+	}
+	current := pTree.Nodes[pHash]
+	for current.Height > ancestor.Height {
+		current = pTree.Nodes[current.ParentHash]
+	}
+	return current.Hash == pAncestorHash
+}
+
+// Hashes going from the block after the given ancestor up to the given block, in that order
+func (pTree *BlockTree) PathFrom(pAncestorHash, pHash string) []string {
+	path := make([]string, 0)
+	for current := pHash; current != pAncestorHash; current = pTree.Nodes[current].ParentHash {
+		path = append(path, current)
+	}
+	// Reverse so that the oldest block goes first
+	for i, j := 0, len(path)-1; i < j; i, j = i+1, j-1 {
+		path[i], path[j] = path[j], path[i]
+	}
+	return path
+}
+
+// Mark a block and all of its descendants as invalid so that they are never chosen. Their weight
+// is removed from the subtrees of the ancestors
+func (pTree *BlockTree) MarkInvalid(pHash string) {
+	theNode := pTree.Nodes[pHash]
+	if theNode.Invalid {
+		return
+	}
+	if theNode.Hash != pTree.Genesis {
+		pTree.updateSubtreeWeights(theNode.ParentHash, -theNode.SubtreeSize, -theNode.SubtreeWork)
+	}
+	pTree.markSubtreeInvalid(pHash)
+}
+
+func (pTree *BlockTree) markSubtreeInvalid(pHash string) {
+	theNode := pTree.Nodes[pHash]
+	theNode.Invalid = true
+	theNode.SubtreeSize = 0
+	theNode.SubtreeWork = 0
+	for _, v := range theNode.Children {
+		pTree.markSubtreeInvalid(v)
+	}
+}
+
+// Valid blocks that don't have any valid children
+func (pTree *BlockTree) Leaves() []string {
+	leaves := make([]string, 0)
+	for k, v := range pTree.Nodes {
+		if v.Invalid {
+			continue
+		}
+		isLeaf := true
+		for _, child := range v.Children {
+			if !pTree.Nodes[child].Invalid {
+				isLeaf = false
+				break
+			}
+		}
+		if isLeaf {
+			leaves = append(leaves, k)
+		}
+	}
+	return leaves
+}
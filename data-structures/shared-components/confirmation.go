@@ -0,0 +1,80 @@
+package components
+
+import (
+	"math"
+)
+
+// *** Structs ***
+
+// Fraction of the hashing power, or of the stake, controlled by the attacker assumed when estimating
+// how safe a transaction is
+var AttackerFraction = 0.1
+
+// Highest probability of the attacker replacing the block of a transaction for which the transaction
+// is considered accepted. With an attacker fraction of 0.1 it takes six blocks, as in Bitcoin
+var AcceptanceRisk = 0.001
+
+// What a node knows about a transaction
+// BlockHash is the block containing the transaction, empty if the node doesn't know any. Depth is the
+// number of blocks of the current best chain from that block up to the tip, both included, and zero
+// when the block is outside it, in which case the transaction is Orphaned. Final is set when a finality
+// overlay finalized the block, so it can't be replaced. Safety is the probability that an attacker with
+// the attacker fraction never replaces the block, following the model of the Bitcoin paper
+type Confirmation struct {
+	TransactionID string
+	BlockHash     string
+	Depth         int
+	Orphaned      bool
+	Final         bool
+	Safety        float64
+}
+
+// *** Constructors ***
+
+// Create the confirmation of a transaction found in the given block, estimating its safety
+func CreateConfirmation(pTransactionID, pBlockHash string, pDepth int, pFinal bool) Confirmation {
+	rConfirmation := Confirmation{
+		TransactionID: pTransactionID,
+		BlockHash:     pBlockHash,
+		Depth:         pDepth,
+		Orphaned:      pBlockHash != "" && pDepth == 0,
+		Final:         pFinal,
+	}
+	switch true {
+	case pFinal:
+		rConfirmation.Safety = 1
+	case pDepth > 0:
+		rConfirmation.Safety = 1 - AttackerSuccessProbability(AttackerFraction, pDepth-1)
+	}
+	return rConfirmation
+}
+
+// *** Methods ***
+
+// Probability that an attacker with the given fraction of the hashing power ever catches up with the
+// honest chain once the given number of blocks were added after the block of a transaction, as
+// calculated in section 11 of the Bitcoin paper. The attacker's progress while those blocks were being
+// found follows a Poisson distribution
+func AttackerSuccessProbability(pFraction float64, pBlocksAfter int) float64 {
+	if pFraction >= 0.5 {
+		return 1
+	}
+	honestFraction := 1 - pFraction
+	lambda := float64(pBlocksAfter) * pFraction / honestFraction
+	rProbability := 1.0
+	poisson := math.Exp(-lambda)
+	for k := 0; k <= pBlocksAfter; k++ {
+		if k > 0 {
+			poisson *= lambda / float64(k)
+		}
+		rProbability -= poisson * (1 - math.Pow(pFraction/honestFraction, float64(pBlocksAfter-k)))
+	}
+	return math.Max(rProbability, 0)
+}
+
+// Whether the transaction is accepted. It is the moment used to measure latency: the transaction is
+// in a finalized block, or in a block of the current best chain that the attacker replaces with a
+// probability no higher than the acceptance risk
+func (pConfirmation *Confirmation) IsAccepted() bool {
+	return pConfirmation.Final || pConfirmation.Depth > 0 && 1-pConfirmation.Safety <= AcceptanceRisk
+}
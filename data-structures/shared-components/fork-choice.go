@@ -0,0 +1,166 @@
+package components
+
+import (
+	"errors"
+)
+
+// *** Structs ***
+
+// Rule used by a node to decide which block of the tree is the tip of its active chain.
+// The same tree may lead to different tips depending on the rule, which is what allows running
+// the same network and workload changing only the fork-choice rule
+type ForkChoice interface {
+	// Hash of the block that should be the tip, given the current one
+	SelectTip(pTree *BlockTree, pCurrentTip string) string
+	// Name used to identify the rule in the experiments
+	Name() string
+}
+
+// Chooses the chain with the most blocks
+type LongestChain struct{}
+
+// Chooses the chain with the most accumulated proof of work
+type HeaviestWork struct{}
+
+// Chooses the chain with the most accumulated proof of work and, among chains with the same work,
+// the one with the most blocks. Needed when some blocks carry no work, as the microblocks of
+// Bitcoin-NG, so that the chain still moves forward when they are added
+type HeaviestWorkThenLongest struct{}
+
+// Greedy Heaviest-Observed Sub-Tree as defined in the GHOST paper. Starting at the genesis block,
+// it descends to the child with the heaviest subtree until reaching a leaf. The weight of a subtree
+// is its number of blocks or, when ByWork is set, the sum of their proof of work
+type GhostPaper struct {
+	ByWork bool
+}
+
+// Variant of GHOST used by Ethereum. The weight of a chain is the work of its blocks plus the work
+// of the uncles referenced by them, and the chain with the greatest weight is chosen
+type GhostEthereum struct{}
+
+// *** Constructors ***
+
+// Get a fork-choice rule by its name
+func ForkChoiceByName(pName string) (ForkChoice, error) {
+	for _, v := range []ForkChoice{LongestChain{}, HeaviestWork{}, HeaviestWorkThenLongest{}, GhostPaper{}, GhostPaper{ByWork: true}, GhostEthereum{}} {
+		if v.Name() == pName {
+			return v, nil
+		}
+	}
+	return nil, errors.New("unknown fork-choice rule " + pName)
+}
+
+// *** Methods ***
+
+func (LongestChain) Name() string {
+	return "longest-chain"
+}
+
+func (LongestChain) SelectTip(pTree *BlockTree, pCurrentTip string) string {
+	return selectLeaf(pTree, pCurrentTip, func(pNode *TreeNode) int {
+		return pNode.Height
+	})
+}
+
+func (HeaviestWork) Name() string {
+	return "heaviest-work"
+}
+
+func (HeaviestWork) SelectTip(pTree *BlockTree, pCurrentTip string) string {
+	return selectLeaf(pTree, pCurrentTip, func(pNode *TreeNode) int {
+		return pNode.TotalWork
+	})
+}
+
+func (HeaviestWorkThenLongest) Name() string {
+	return "heaviest-work-then-longest"
+}
+
+func (HeaviestWorkThenLongest) SelectTip(pTree *BlockTree, pCurrentTip string) string {
+	// The work decides first, the height only matters between chains with the same work
+	maxHeight := 0
+	for _, v := range pTree.Nodes {
+		if v.Height > maxHeight {
+			maxHeight = v.Height
+		}
+	}
+	return selectLeaf(pTree, pCurrentTip, func(pNode *TreeNode) int {
+		return pNode.TotalWork*(maxHeight+1) + pNode.Height
+	})
+}
+
+func (pGhostPaper GhostPaper) Name() string {
+	if pGhostPaper.ByWork {
+		return "ghost-paper-work"
+	}
+	return "ghost-paper"
+}
+
+// The subtree weights are cached in the tree, so each step only looks at the children of the block
+func (pGhostPaper GhostPaper) SelectTip(pTree *BlockTree, pCurrentTip string) string {
+	current := pTree.Genesis
+	for {
+		// Choose the child with the heaviest subtree. On ties the child leading to the current tip
+		// is preferred so that the active chain doesn't change without a reason, otherwise the one
+		// with the smallest hash, so that the choice doesn't depend on the order the blocks arrived
+		chosen := ""
+		chosenWeight := 0
+		for _, v := range pTree.Nodes[current].Children {
+			if pTree.Nodes[v].Invalid {
+				continue
+			}
+			weight := pTree.Nodes[v].SubtreeSize
+			if pGhostPaper.ByWork {
+				weight = pTree.Nodes[v].SubtreeWork
+			}
+			keepChosen := chosen != "" && pTree.IsAncestor(chosen, pCurrentTip)
+			if chosen == "" || weight > chosenWeight || weight == chosenWeight && !keepChosen && (pTree.IsAncestor(v, pCurrentTip) || v < chosen) {
+				chosen = v
+				chosenWeight = weight
+			}
+		}
+		if chosen == "" {
+			return current
+		}
+		current = chosen
+	}
+}
+
+func (GhostEthereum) Name() string {
+	return "ghost-ethereum"
+}
+
+func (GhostEthereum) SelectTip(pTree *BlockTree, pCurrentTip string) string {
+	return selectLeaf(pTree, pCurrentTip, func(pNode *TreeNode) int {
+		weight := 0
+		for current := pNode; ; current = pTree.Nodes[current.ParentHash] {
+			weight += current.Work
+			for _, v := range current.Uncles {
+				if uncle, ok := pTree.Nodes[v]; ok && !uncle.Invalid {
+					weight += uncle.Work
+				}
+			}
+			if current.Hash == pTree.Genesis {
+				return weight
+			}
+		}
+	})
+}
+
+// Choose the valid leaf with the greatest score. On ties the current tip is kept, otherwise the
+// smallest hash is chosen so that every node makes the same decision
+func selectLeaf(pTree *BlockTree, pCurrentTip string, pScore func(*TreeNode) int) string {
+	chosen := pCurrentTip
+	chosenScore := -1
+	if theNode, ok := pTree.Nodes[pCurrentTip]; ok && !theNode.Invalid {
+		chosenScore = pScore(theNode)
+	}
+	for _, v := range pTree.Leaves() {
+		score := pScore(pTree.Nodes[v])
+		if score > chosenScore || score == chosenScore && chosen != pCurrentTip && v < chosen {
+			chosen = v
+			chosenScore = score
+		}
+	}
+	return chosen
+}
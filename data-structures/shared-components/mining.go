@@ -0,0 +1,111 @@
+package components
+
+import (
+	"context"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// *** Structs ***
+
+// Number of goroutines searching for a nonce at the same time. Each of them tries a different set
+// of nonces, so they never compute the same hash
+var MiningWorkers = runtime.NumCPU()
+
+// What the search for a nonce returns: the nonce found and its hash, along with the number of hashes
+// computed by all of the workers and the time it took. The nonce and the hash are only set when the
+// search succeeded
+type MiningResult struct {
+	Nonce   int
+	Hash    string
+	Hashes  int
+	Elapsed time.Duration
+}
+
+// Hashes computed and time spent by a node in all of the searches it made, whether they succeeded or not
+type MiningStats struct {
+	Hashes  int
+	Elapsed time.Duration
+}
+
+// *** Methods ***
+
+// Search for a nonce whose hash is valid, splitting the nonces between the mining workers. The first
+// worker to find one stops the others. The search stops as well once the context is cancelled, in which
+// case the error of the context is returned. The function that calculates the hash of a nonce is called
+// by several workers at the same time
+func Mine(pContext context.Context, pHash func(int) string, pIsValid func(string) bool) (MiningResult, error) {
+	startingTime := time.Now()
+	ctx, cancel := context.WithCancel(pContext)
+	defer cancel()
+	workers := MiningWorkers
+	if workers < 1 {
+		workers = 1
+	}
+
+	var hashes int64
+	found := make(chan MiningResult, workers)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		// Worker i tries the nonces i, i + workers, i + 2 * workers...
+		go func(pFirstNonce int) {
+			defer wg.Done()
+			tried := int64(0)
+			defer func() {
+				atomic.AddInt64(&hashes, tried)
+			}()
+			for nonce := pFirstNonce; ; nonce += workers {
+				select {
+				case <-ctx.Done():
+					return
+				default:
+				}
+				hash := pHash(nonce)
+				tried++
+				if pIsValid(hash) {
+					found <- MiningResult{Nonce: nonce, Hash: hash}
+					cancel()
+					return
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	var rResult MiningResult
+	var err error
+	select {
+	case rResult = <-found:
+	default:
+		err = pContext.Err()
+	}
+	rResult.Hashes = int(hashes)
+	rResult.Elapsed = time.Since(startingTime)
+	return rResult, err
+}
+
+// Hashes per second computed during the search
+func (pResult *MiningResult) HashRate() float64 {
+	return hashRate(pResult.Hashes, pResult.Elapsed)
+}
+
+// Add the hashes and time of a search
+func (pStats *MiningStats) Add(pResult MiningResult) {
+	pStats.Hashes += pResult.Hashes
+	pStats.Elapsed += pResult.Elapsed
+}
+
+// Hashes per second computed while searching
+func (pStats *MiningStats) HashRate() float64 {
+	return hashRate(pStats.Hashes, pStats.Elapsed)
+}
+
+func hashRate(pHashes int, pElapsed time.Duration) float64 {
+	if pElapsed <= 0 {
+		return 0
+	}
+	return float64(pHashes) / pElapsed.Seconds()
+}
@@ -0,0 +1,93 @@
+package components
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+)
+
+// *** Structs ***
+
+// Number of entries of 32 bytes in the scratchpad of the memory-hard function, 128 KiB by default
+var ScratchpadEntries = 4096
+
+// Number of entries of the scratchpad read, at positions that depend on the data, for each hash
+var ScratchpadReads = 4096
+
+// Hash function used for the proof of work. The algorithm of a network is recorded in its genesis block
+type ProofOfWorkHash interface {
+	// Name used to record the algorithm in the genesis block
+	Name() string
+	// Hash of the data, in hexadecimal
+	Sum(pData []byte) string
+}
+
+// Single SHA-256, the function used when the genesis block doesn't record any
+type SHA256 struct{}
+
+// SHA-256 applied twice, as in Bitcoin
+type SHA256d struct{}
+
+// Memory-hard function in the style of scrypt. A scratchpad is filled by chaining SHA-256 from the
+// hash of the data, and then entries at positions that depend on the previous ones are read and
+// overwritten, so computing a hash needs the whole scratchpad in memory
+type Scratchpad struct{}
+
+// *** Constructors ***
+
+// Get a proof of work function by its name. An empty name is the one of single SHA-256
+func ProofOfWorkByName(pName string) (ProofOfWorkHash, error) {
+	if pName == "" {
+		return SHA256{}, nil
+	}
+	for _, v := range []ProofOfWorkHash{SHA256{}, SHA256d{}, Scratchpad{}} {
+		if v.Name() == pName {
+			return v, nil
+		}
+	}
+	return nil, errors.New("unknown proof of work algorithm " + pName)
+}
+
+// *** Methods ***
+
+func (SHA256) Name() string {
+	return "sha256"
+}
+
+func (SHA256) Sum(pData []byte) string {
+	h := sha256.Sum256(pData)
+	return hex.EncodeToString(h[:])
+}
+
+func (SHA256d) Name() string {
+	return "sha256d"
+}
+
+func (SHA256d) Sum(pData []byte) string {
+	first := sha256.Sum256(pData)
+	h := sha256.Sum256(first[:])
+	return hex.EncodeToString(h[:])
+}
+
+func (Scratchpad) Name() string {
+	return "scratchpad"
+}
+
+func (Scratchpad) Sum(pData []byte) string {
+	pad := make([][sha256.Size]byte, ScratchpadEntries)
+	pad[0] = sha256.Sum256(pData)
+	for i := 1; i < len(pad); i++ {
+		pad[i] = sha256.Sum256(pad[i-1][:])
+	}
+	state := pad[len(pad)-1]
+	mixed := make([]byte, 2*sha256.Size)
+	for i := 0; i < ScratchpadReads; i++ {
+		position := binary.LittleEndian.Uint32(state[:4]) % uint32(len(pad))
+		copy(mixed, state[:])
+		copy(mixed[sha256.Size:], pad[position][:])
+		state = sha256.Sum256(mixed)
+		pad[position] = state
+	}
+	return hex.EncodeToString(state[:])
+}
@@ -0,0 +1,28 @@
+package components
+
+import (
+	"encoding/hex"
+	"github.com/perlin-network/noise"
+)
+
+// *** Methods ***
+
+// Signature, in hexadecimal, made over the data with the key of the node
+func Sign(pNode *noise.Node, pData string) string {
+	return pNode.Sign([]byte(pData)).String()
+}
+
+// Whether the signature, in hexadecimal, was made over the data by the given hexadecimal public key of a node
+func VerifySignature(pKey, pData, pSignature string) bool {
+	key, err := hex.DecodeString(pKey)
+	if err != nil || len(key) != noise.SizePublicKey {
+		return false
+	}
+	signature, err := hex.DecodeString(pSignature)
+	if err != nil || len(signature) != noise.SizeSignature {
+		return false
+	}
+	var publicKey noise.PublicKey
+	copy(publicKey[:], key)
+	return publicKey.Verify([]byte(pData), noise.UnmarshalSignature(signature))
+}
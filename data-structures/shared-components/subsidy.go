@@ -0,0 +1,69 @@
+package components
+
+import (
+	"math"
+)
+
+// *** Structs ***
+
+// Origin of the transactions that mint the rewards of a block. They don't take the currency from any
+// account, and only the rewards expected by the rules of the structure can have it as their origin
+const CoinbaseOrigin = "coinbase"
+
+// Number of blocks that must follow the block that minted a reward before the reward can be spent.
+// A block at height h can only spend the rewards minted up to height h - CoinbaseMaturity, so that
+// the rewards lost in a reorganization haven't been spent already
+var CoinbaseMaturity = 100
+
+// Amount minted by the block at each height
+type SubsidySchedule interface {
+	Subsidy(pHeight int) float64
+}
+
+// The subsidy starts at the initial amount and is halved every interval of blocks, as in Bitcoin
+type HalvingSubsidy struct {
+	Initial  float64
+	Interval int
+}
+
+// The subsidy is the same for every block
+type ConstantSubsidy struct {
+	Value float64
+}
+
+// *** Constructors ***
+
+// Create the transaction that mints the given value for the given account in the block at the given
+// height. The height is its nonce, so the coinbases of different blocks have different identifiers
+func CreateCoinbase(pDestination string, pValue float64, pHeight int) Transaction {
+	return Transaction{
+		Origin:          CoinbaseOrigin,
+		SenderSignature: CoinbaseOrigin,
+		Destination:     pDestination,
+		Value:           pValue,
+		Nonce:           int64(pHeight),
+	}
+}
+
+// *** Methods ***
+
+// Whether the transaction mints currency
+func IsCoinbase(pTransaction Transaction) bool {
+	return pTransaction.Origin == CoinbaseOrigin
+}
+
+// Whether a reward minted at the given height can be spent by a block at the other height
+func IsMature(pMintedAt, pSpentAt int) bool {
+	return pSpentAt-pMintedAt >= CoinbaseMaturity
+}
+
+func (pSchedule HalvingSubsidy) Subsidy(pHeight int) float64 {
+	if pSchedule.Interval <= 0 {
+		return pSchedule.Initial
+	}
+	return math.Ldexp(pSchedule.Initial, -(pHeight / pSchedule.Interval))
+}
+
+func (pSchedule ConstantSubsidy) Subsidy(int) float64 {
+	return pSchedule.Value
+}
@@ -0,0 +1,125 @@
+package components
+
+import (
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// *** Structs ***
+
+// Number of blocks, ending at the parent, whose median timestamp the timestamp of a block must be after
+var MedianTimeBlocks = 11
+
+// How far ahead of the network-adjusted clock of a node the timestamp of a block can be
+var MaxFutureDrift = 2 * time.Hour
+
+// Largest offset the network-adjusted clock applies to the local clock. When the median offset of the
+// peers is larger, either the local clock or most of the peers are badly wrong, and the local clock is kept
+var MaxClockAdjustment = 70 * time.Minute
+
+// Clock of a node adjusted with the offsets of its peers, the difference between the time they report
+// and the local time. The median offset, counting the node itself, is added to the local time.
+// Since the nodes of a process share the clock of the machine, the skew simulates an error in the
+// local clock of the node. A nil clock is the clock of the machine
+type NetworkClock struct {
+	skew    time.Duration
+	offsets map[string]time.Duration
+	lock    sync.Mutex
+}
+
+// *** Constructors ***
+
+// Create a clock without skew nor offsets from peers
+func CreateNetworkClock() *NetworkClock {
+	return &NetworkClock{offsets: make(map[string]time.Duration)}
+}
+
+// *** Methods ***
+
+// Canonical encoding of a timestamp in the headers, the nanoseconds since the Unix epoch. Unlike
+// the String method, it doesn't depend on the location nor on the monotonic clock reading, so it
+// doesn't change when the block is sent to other nodes
+func EncodeTimestamp(pTimestamp time.Time) string {
+	return strconv.FormatInt(pTimestamp.UnixNano(), 10)
+}
+
+// Timestamp from its canonical encoding
+func DecodeTimestamp(pEncoded string) (time.Time, error) {
+	nanoseconds, err := strconv.ParseInt(pEncoded, 10, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(0, nanoseconds), nil
+}
+
+// Median of the timestamps, the later of the two middle ones when their number is even
+func MedianTime(pTimestamps []time.Time) time.Time {
+	sorted := append([]time.Time(nil), pTimestamps...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Before(sorted[j]) })
+	return sorted[len(sorted)/2]
+}
+
+// Set the simulated error of the local clock
+func (pClock *NetworkClock) SetSkew(pSkew time.Duration) {
+	pClock.lock.Lock()
+	defer pClock.lock.Unlock()
+	pClock.skew = pSkew
+}
+
+// Time of the local clock, including its skew
+func (pClock *NetworkClock) Local() time.Time {
+	if pClock == nil {
+		return time.Now().Round(0)
+	}
+	pClock.lock.Lock()
+	defer pClock.lock.Unlock()
+	return time.Now().Add(pClock.skew).Round(0)
+}
+
+// Record the offset of a peer from the time it reported in an answer. The local times at which the
+// message was sent and the answer received are given, and the time of the peer is taken to correspond
+// to the middle of the round trip. Only the last offset of each peer is kept
+func (pClock *NetworkClock) AddSample(pPeer string, pPeerTime, pSent, pReceived time.Time) {
+	if pClock == nil {
+		return
+	}
+	pClock.lock.Lock()
+	defer pClock.lock.Unlock()
+	pClock.offsets[pPeer] = pPeerTime.Sub(pSent.Add(pReceived.Sub(pSent) / 2))
+}
+
+// Offset applied to the local clock, zero when the median offset is larger than the maximum adjustment.
+// When the number of offsets is even, the median is the middle one closest to zero, so that the clock
+// only moves when most of the offsets agree
+func (pClock *NetworkClock) Offset() time.Duration {
+	if pClock == nil {
+		return 0
+	}
+	pClock.lock.Lock()
+	defer pClock.lock.Unlock()
+	offsets := []time.Duration{0}
+	for _, v := range pClock.offsets {
+		offsets = append(offsets, v)
+	}
+	sort.Slice(offsets, func(i, j int) bool { return offsets[i] < offsets[j] })
+	rOffset := offsets[len(offsets)/2]
+	if len(offsets)%2 == 0 && offsets[len(offsets)/2-1] > -rOffset {
+		rOffset = offsets[len(offsets)/2-1]
+	}
+	if rOffset > MaxClockAdjustment || rOffset < -MaxClockAdjustment {
+		return 0
+	}
+	return rOffset
+}
+
+// Time of the network-adjusted clock
+func (pClock *NetworkClock) Now() time.Time {
+	return pClock.Local().Add(pClock.Offset())
+}
+
+// Whether a timestamp is too far ahead of the network-adjusted clock to be accepted
+func (pClock *NetworkClock) IsTooFarAhead(pTimestamp time.Time) bool {
+	return pTimestamp.After(pClock.Now().Add(MaxFutureDrift))
+}
@@ -1,19 +1,50 @@
 package components
 
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"strconv"
+)
+
 // What a transaction ensues
-// A transaction is a request to move $X from A to B
+// A transaction is a request to move $X from A to B. The nonce tells apart transactions with the same
+// accounts and value, such as a payment made twice
 type Transaction struct {
 	Origin          string
 	SenderSignature string
 	Destination     string
 	Value           float64
+	Nonce           int64
 }
 
+// Create a transaction with a random nonce, so that its identifier differs from the one of any
+// other transaction created with the same fields
 func CreateTransaction(pOrigin, pSignature, pDestination string, pValue float64) Transaction {
 	return Transaction{
 		Origin:          pOrigin,
 		SenderSignature: pSignature,
 		Destination:     pDestination,
 		Value:           pValue,
+		Nonce:           randomNonce(),
+	}
+}
+
+// Random non-negative nonce
+func randomNonce() int64 {
+	var bytes [8]byte
+	if _, err := rand.Read(bytes[:]); err != nil {
+		panic(err)
 	}
+	return int64(binary.BigEndian.Uint64(bytes[:]) >> 1)
+}
+
+// Identifier of the transaction, the hash of its fields including the nonce
+func (pTransaction Transaction) ID() string {
+	record := pTransaction.Origin + pTransaction.SenderSignature + pTransaction.Destination + strconv.FormatFloat(pTransaction.Value, 'f', -1, 64) +
+		strconv.FormatInt(pTransaction.Nonce, 10)
+	h := sha256.New()
+	h.Write([]byte(record))
+	return hex.EncodeToString(h.Sum(nil))
 }
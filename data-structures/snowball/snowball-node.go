@@ -0,0 +1,309 @@
+package snowball
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/gcubillos/isis-3007-distributed-ledger/data-structures/shared-components"
+	"github.com/perlin-network/noise"
+	"github.com/perlin-network/noise/kademlia"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Mutual exclusion variable
+var mutex = &sync.Mutex{}
+
+// Time a node waits for a peer to answer a query
+var RequestTimeout = 2 * time.Second
+
+// Number of peers sampled in each query
+var SampleSize = 5
+
+// Number of sampled peers that must prefer the same spend for a query to be successful. It must be
+// more than half of the sample. When the node knows fewer peers than the sample size, every peer is
+// sampled and the quorum is scaled down in proportion
+var Alpha = 4
+
+// Number of successful queries in a row for the same spend after which a conflict set is decided
+var Beta = 15
+
+// Maximum number of conflict sets a node queries its peers about at a time
+var QueryBatch = 100
+
+// Time a node waits before checking again for undecided conflict sets when there are none
+var PollInterval = 5 * time.Millisecond
+
+// *** Structs ***
+
+// Declaration of node in the network
+// Contains the underlying data structure as well as the node from the noise library.
+// The node keeps querying random samples of the peers of its Kademlia table about the undecided
+// conflict sets until they are decided. QueriesSent counts the queries the node sent to its peers,
+// each of which covers a batch of sets
+type NodeSnowball struct {
+	DataStructure Snowball
+	Node          *noise.Node
+	QueriesSent   int
+	protocol      *kademlia.Protocol
+	stopped       bool
+}
+
+// What a query contains: the spends the node prefers in several conflict sets
+type Query struct {
+	Spends []Spend
+}
+
+// What the answer to a query contains: the spends the peer prefers in the same conflict sets, in the
+// same order. The spend is empty when the peer rejected the one it was queried about
+type Answer struct {
+	Preferences []Spend
+}
+
+// *** Constructors ***
+
+// Create a node in the network such that it can discover other nodes using the Kademlia
+// protocol. The current state of the structure is passed to the Node and a first peer
+// to connect to the network
+func CreateNode(pCurrentSnowball Snowball, pNode *noise.Node) *NodeSnowball {
+	// Create structure. The structure is copied so that the nodes don't share their state
+	mutex.Lock()
+	thisNode := &NodeSnowball{
+		DataStructure: pCurrentSnowball.Copy(),
+	}
+	mutex.Unlock()
+	thisNode.listen()
+
+	// Ping the provided node in the network
+	_, err := thisNode.Node.Ping(context.TODO(), pNode.Addr())
+	check(err)
+
+	// Discover the other nodes present in the network at the moment
+	thisNode.protocol.Discover()
+
+	go thisNode.poll()
+	return thisNode
+}
+
+// Create the initial node
+// For simplicity the initial state gives the amount of available currency to a "main" account
+func CreateInitialNode(pAvailableCurrency float64) *NodeSnowball {
+	thisNode := &NodeSnowball{
+		DataStructure: CreateSnowball(map[string]float64{"main": pAvailableCurrency}),
+	}
+	thisNode.listen()
+	go thisNode.poll()
+	return thisNode
+}
+
+// *** Methods ***
+
+// Create the network node, bind the Kademlia protocol and the way the queries are handled,
+// and make it listen to the network
+func (pNode *NodeSnowball) listen() {
+	// Create network node
+	networkNode, err := noise.NewNode()
+	check(err)
+
+	// Assign the Kademlia protocol to the node so it can discover other nodes
+	pNode.protocol = kademlia.New()
+	networkNode.Bind(pNode.protocol.Protocol())
+
+	// Assign the way the node will answer the queries it receives
+	networkNode.Handle(pNode.handleRequest)
+
+	// Make the node listen to the network
+	check(networkNode.Listen())
+
+	// Assign the network node to the node
+	pNode.Node = networkNode
+}
+
+// Stop querying the peers and close the network node
+func (pNode *NodeSnowball) Close() {
+	mutex.Lock()
+	pNode.stopped = true
+	mutex.Unlock()
+	check(pNode.Node.Close())
+}
+
+// Issue a transaction as the next spend of its origin that the node knows of. The node starts
+// querying its peers about it, which spreads it through the network
+func (pNode *NodeSnowball) IssueTransaction(pTransaction components.Transaction) Spend {
+	mutex.Lock()
+	defer mutex.Unlock()
+	rSpend := CreateSpend(pTransaction, pNode.DataStructure.NextSequence(pTransaction.Origin))
+	_, _ = pNode.DataStructure.AddSpend(rSpend)
+	return rSpend
+}
+
+// Issue a spend with a given sequence, which may conflict with other spends of its origin
+func (pNode *NodeSnowball) IssueSpend(pSpend Spend) error {
+	mutex.Lock()
+	defer mutex.Unlock()
+	_, err := pNode.DataStructure.AddSpend(pSpend)
+	return err
+}
+
+// Keep querying the peers about the undecided conflict sets, a batch at a time. The sets with the
+// lowest sequences are queried first, since the spends of each origin are applied in order
+func (pNode *NodeSnowball) poll() {
+	for {
+		mutex.Lock()
+		if pNode.stopped {
+			mutex.Unlock()
+			return
+		}
+		undecided := pNode.DataStructure.Undecided()
+		sort.Slice(undecided, func(i, j int) bool {
+			first, second := pNode.DataStructure.Sets[undecided[i]], pNode.DataStructure.Sets[undecided[j]]
+			return first.Candidates[first.Preference].Sequence < second.Candidates[second.Preference].Sequence
+		})
+		if len(undecided) > QueryBatch {
+			undecided = undecided[:QueryBatch]
+		}
+		preferences := make([]Spend, len(undecided))
+		for i, v := range undecided {
+			set := pNode.DataStructure.Sets[v]
+			preferences[i] = set.Candidates[set.Preference]
+		}
+		peers := pNode.protocol.Table().Peers()
+		mutex.Unlock()
+		if len(preferences) == 0 || len(peers) == 0 {
+			time.Sleep(PollInterval)
+			continue
+		}
+		pNode.query(preferences, peers)
+	}
+}
+
+// Send the preferred spends of several conflict sets to a random sample of the peers and record the
+// spends they prefer in each set. Peers that don't answer count as preferring none
+func (pNode *NodeSnowball) query(pSpends []Spend, pPeers []noise.ID) {
+	sampleSize := SampleSize
+	if len(pPeers) < sampleSize {
+		sampleSize = len(pPeers)
+	}
+	quorum := (Alpha*sampleSize + SampleSize - 1) / SampleSize
+	if quorum <= sampleSize/2 {
+		quorum = sampleSize/2 + 1
+	}
+	bytes, err := json.Marshal(Query{Spends: pSpends})
+	check(err)
+
+	answers := make(chan []Spend, sampleSize)
+	for _, v := range rand.Perm(len(pPeers))[:sampleSize] {
+		go func(pAddress string) {
+			ctx, cancel := context.WithTimeout(context.Background(), RequestTimeout)
+			defer cancel()
+			var received Answer
+			response, err := pNode.Node.Request(ctx, pAddress, bytes)
+			if err != nil || json.Unmarshal(response, &received) != nil || len(received.Preferences) != len(pSpends) {
+				answers <- nil
+				return
+			}
+			answers <- received.Preferences
+		}(pPeers[v].Address)
+	}
+	votes := make([]map[string]int, len(pSpends))
+	for i := range votes {
+		votes[i] = make(map[string]int)
+	}
+	preferred := make([]Spend, 0)
+	for i := 0; i < sampleSize; i++ {
+		for j, w := range <-answers {
+			if w.Hash != "" && w.Key() == pSpends[j].Key() {
+				votes[j][w.Hash]++
+				preferred = append(preferred, w)
+			}
+		}
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	pNode.QueriesSent += sampleSize
+	// The node learns about the conflicting spends preferred by its peers
+	for _, v := range preferred {
+		_, _ = pNode.DataStructure.AddSpend(v)
+	}
+	for i, v := range pSpends {
+		pNode.DataStructure.RecordQuery(v.Key(), votes[i], quorum, Beta)
+	}
+}
+
+// Answer the queries received with the spends the node prefers in the same conflict sets. A node that
+// didn't know a set prefers the spend it was queried about
+func (pNode *NodeSnowball) handleRequest(ctx noise.HandlerContext) error {
+	if !ctx.IsRequest() {
+		return nil
+	}
+	var received Query
+	// The messages used to discover peers are not queries. They are answered by the Kademlia protocol,
+	// and answering them here as well would make the node that sent them miss the peers it asked for
+	if err := json.Unmarshal(ctx.Data(), &received); err != nil || len(received.Spends) == 0 {
+		return nil
+	}
+
+	mutex.Lock()
+	answer := Answer{Preferences: make([]Spend, len(received.Spends))}
+	for i, v := range received.Spends {
+		if _, err := pNode.DataStructure.AddSpend(v); err != nil {
+			continue
+		}
+		set := pNode.DataStructure.Sets[v.Key()]
+		answer.Preferences[i] = set.Candidates[set.Preference]
+		if set.Decided != "" {
+			answer.Preferences[i] = set.Candidates[set.Decided]
+		}
+	}
+	mutex.Unlock()
+
+	bytes, err := json.Marshal(answer)
+	check(err)
+	return ctx.Send(bytes)
+}
+
+// Whether the spend was accepted by the node. Safe to call while the node keeps querying its peers
+func (pNode *NodeSnowball) IsAccepted(pSpend Spend) bool {
+	mutex.Lock()
+	defer mutex.Unlock()
+	return pNode.DataStructure.IsAccepted(pSpend)
+}
+
+// Hash of the spend the node accepted in the conflict set of the given spend, or of the one it
+// currently prefers if the set is undecided. Safe to call while the node keeps querying its peers
+func (pNode *NodeSnowball) Preference(pSpend Spend) (string, bool) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	set, ok := pNode.DataStructure.Sets[pSpend.Key()]
+	if !ok {
+		return "", false
+	}
+	if set.Decided != "" {
+		return set.Decided, true
+	}
+	return set.Preference, false
+}
+
+// Balance of an account once the accepted spends are applied. Safe to call while the node keeps
+// querying its peers
+func (pNode *NodeSnowball) Balance(pAccount string) float64 {
+	mutex.Lock()
+	defer mutex.Unlock()
+	return pNode.DataStructure.State[pAccount]
+}
+
+// Number of queries the node sent to its peers. Safe to call while the node keeps querying its peers
+func (pNode *NodeSnowball) CountQueries() int {
+	mutex.Lock()
+	defer mutex.Unlock()
+	return pNode.QueriesSent
+}
+
+// Revises whether the error is not nil
+func check(err error) {
+	if err != nil {
+		panic(err)
+	}
+}
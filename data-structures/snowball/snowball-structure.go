@@ -0,0 +1,219 @@
+package snowball
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"github.com/gcubillos/isis-3007-distributed-ledger/data-structures/shared-components"
+	"strconv"
+)
+
+// *** Structs ***
+
+// What a spend contains
+// A transaction along with the position it takes among the transactions of its origin, starting at
+// zero. Two different spends of the same origin with the same sequence conflict, so at most one of
+// them is accepted. The hash identifies the spend
+type Spend struct {
+	Transaction components.Transaction
+	Sequence    int
+	Hash        string
+}
+
+// What a conflict set contains
+// Candidates are the spends competing for the same sequence of an origin, indexed by hash. Preference
+// is the candidate the node currently prefers, Confidence counts the successful queries each candidate
+// got, and Last and Count are the candidate of the last successful query and the number of successful
+// queries in a row for it. Decided is the hash of the accepted spend, empty while the set is undecided
+type ConflictSet struct {
+	Key        string
+	Candidates map[string]Spend
+	Preference string
+	Confidence map[string]int
+	Last       string
+	Count      int
+	Decided    string
+}
+
+// Declaration of structure
+// Sets keeps the conflict sets indexed by key. State is the balance of each account once the accepted
+// spends are applied, which happens in the order of the sequences of each origin, and Applied is the
+// next sequence of each origin to be applied. An accepted spend whose origin doesn't have enough funds
+// when it is applied takes its sequence without moving any currency
+type Snowball struct {
+	Sets    map[string]*ConflictSet
+	State   map[string]float64
+	Applied map[string]int
+}
+
+// *** Constructors ***
+
+// Create a spend, calculating its hash
+func CreateSpend(pTransaction components.Transaction, pSequence int) Spend {
+	rSpend := Spend{Transaction: pTransaction, Sequence: pSequence}
+	rSpend.Hash = calculateHash(rSpend)
+	return rSpend
+}
+
+// Create the structure with the initial balance of the accounts
+func CreateSnowball(pInitialState map[string]float64) Snowball {
+	rSnowball := Snowball{
+		Sets:    make(map[string]*ConflictSet),
+		State:   make(map[string]float64, len(pInitialState)),
+		Applied: make(map[string]int),
+	}
+	for k, v := range pInitialState {
+		rSnowball.State[k] = v
+	}
+	return rSnowball
+}
+
+// *** Methods ***
+
+// Calculate the hash of a spend from its transaction and sequence
+func calculateHash(pSpend Spend) string {
+	record := pSpend.Transaction.Origin + pSpend.Transaction.SenderSignature + pSpend.Transaction.Destination +
+		strconv.FormatFloat(pSpend.Transaction.Value, 'f', -1, 64) + strconv.FormatInt(pSpend.Transaction.Nonce, 10) + strconv.Itoa(pSpend.Sequence)
+	h := sha256.New()
+	h.Write([]byte(record))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Key of the conflict set of a spend: its origin and its sequence
+func (pSpend *Spend) Key() string {
+	return pSpend.Transaction.Origin + "/" + strconv.Itoa(pSpend.Sequence)
+}
+
+// Create a copy of the structure that doesn't share any of its maps with the original one.
+// Needed since several nodes in the same process may start from the same structure
+func (pSnowball *Snowball) Copy() Snowball {
+	rSnowball := CreateSnowball(pSnowball.State)
+	for k, v := range pSnowball.Sets {
+		set := *v
+		set.Candidates = make(map[string]Spend, len(v.Candidates))
+		set.Confidence = make(map[string]int, len(v.Confidence))
+		for l, w := range v.Candidates {
+			set.Candidates[l] = w
+		}
+		for l, w := range v.Confidence {
+			set.Confidence[l] = w
+		}
+		rSnowball.Sets[k] = &set
+	}
+	for k, v := range pSnowball.Applied {
+		rSnowball.Applied[k] = v
+	}
+	return rSnowball
+}
+
+// Next sequence of an origin that has no spend yet, according to the conflict sets known
+func (pSnowball *Snowball) NextSequence(pOrigin string) int {
+	rSequence := pSnowball.Applied[pOrigin]
+	for {
+		if _, ok := pSnowball.Sets[pOrigin+"/"+strconv.Itoa(rSequence)]; !ok {
+			return rSequence
+		}
+		rSequence++
+	}
+}
+
+// Add a spend to its conflict set, creating the set if needed. The first spend of a set is the
+// preference of the node. Returns whether the spend was new
+func (pSnowball *Snowball) AddSpend(pSpend Spend) (bool, error) {
+	switch true {
+	case calculateHash(pSpend) != pSpend.Hash:
+		return false, errors.New("calculated hash doesn't match")
+	case pSpend.Sequence < 0 || pSpend.Transaction.Value < 0:
+		return false, errors.New("the spend is not valid")
+	}
+	key := pSpend.Key()
+	set, ok := pSnowball.Sets[key]
+	if !ok {
+		if pSpend.Sequence < pSnowball.Applied[pSpend.Transaction.Origin] {
+			return false, errors.New("the sequence of the origin was already applied")
+		}
+		set = &ConflictSet{
+			Key:        key,
+			Candidates: make(map[string]Spend),
+			Confidence: make(map[string]int),
+			Preference: pSpend.Hash,
+		}
+		pSnowball.Sets[key] = set
+	}
+	if _, ok := set.Candidates[pSpend.Hash]; ok {
+		return false, nil
+	}
+	set.Candidates[pSpend.Hash] = pSpend
+	return true, nil
+}
+
+// Record the outcome of a query about a conflict set, given the number of sampled peers that prefer
+// each candidate. A query is successful when a candidate got at least the given quorum. Its confidence
+// grows, and it becomes the preference once it has more confidence than the current one. The set is
+// decided once the same candidate succeeds the given number of queries in a row. Returns whether the
+// set was decided by this query
+func (pSnowball *Snowball) RecordQuery(pKey string, pVotes map[string]int, pQuorum, pThreshold int) bool {
+	set, ok := pSnowball.Sets[pKey]
+	if !ok || set.Decided != "" {
+		return false
+	}
+	winner := ""
+	for k, v := range pVotes {
+		if _, known := set.Candidates[k]; known && v >= pQuorum {
+			winner = k
+		}
+	}
+	if winner == "" {
+		set.Count = 0
+		return false
+	}
+	set.Confidence[winner]++
+	if set.Confidence[winner] > set.Confidence[set.Preference] {
+		set.Preference = winner
+	}
+	if winner != set.Last {
+		set.Last = winner
+		set.Count = 1
+	} else {
+		set.Count++
+	}
+	if set.Count < pThreshold {
+		return false
+	}
+	set.Decided = winner
+	pSnowball.apply(set.Candidates[winner].Transaction.Origin)
+	return true
+}
+
+// Apply the accepted spends of an origin whose previous sequences were already applied
+func (pSnowball *Snowball) apply(pOrigin string) {
+	for {
+		set, ok := pSnowball.Sets[pOrigin+"/"+strconv.Itoa(pSnowball.Applied[pOrigin])]
+		if !ok || set.Decided == "" {
+			return
+		}
+		theTransaction := set.Candidates[set.Decided].Transaction
+		if pSnowball.State[theTransaction.Origin] >= theTransaction.Value {
+			pSnowball.State[theTransaction.Origin] -= theTransaction.Value
+			pSnowball.State[theTransaction.Destination] += theTransaction.Value
+		}
+		pSnowball.Applied[pOrigin]++
+	}
+}
+
+// Keys of the conflict sets that are still undecided
+func (pSnowball *Snowball) Undecided() []string {
+	rKeys := make([]string, 0)
+	for k, v := range pSnowball.Sets {
+		if v.Decided == "" {
+			rKeys = append(rKeys, k)
+		}
+	}
+	return rKeys
+}
+
+// Whether the spend was accepted
+func (pSnowball *Snowball) IsAccepted(pSpend Spend) bool {
+	set, ok := pSnowball.Sets[pSpend.Key()]
+	return ok && set.Decided == pSpend.Hash
+}
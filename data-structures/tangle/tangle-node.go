@@ -0,0 +1,168 @@
+package tangle
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/gcubillos/isis-3007-distributed-ledger/data-structures/shared-components"
+	"github.com/perlin-network/noise"
+	"github.com/perlin-network/noise/kademlia"
+	"sync"
+	"time"
+)
+
+// Mutual exclusion variable
+var mutex = &sync.Mutex{}
+
+// Time a node waits for a peer to acknowledge a site
+var RequestTimeout = 2 * time.Second
+
+// *** Structs ***
+
+// Declaration of node in the network
+// Contains the underlying data structure as well as the node from the noise library.
+// The node remembers the sites it has already seen so that each of them is relayed only once,
+// even when it is not attached to the Tangle
+type NodeTangle struct {
+	DataStructure Tangle
+	Node          *noise.Node
+	protocol      *kademlia.Protocol
+	seen          map[string]bool
+}
+
+// *** Constructors ***
+
+// Create a node in the network such that it can discover other nodes using the Kademlia
+// protocol. The current state of the Tangle is passed to the Node and a first peer
+// to connect to the network
+func CreateNode(pCurrentTangle Tangle, pNode *noise.Node) *NodeTangle {
+	// Create structure. The Tangle is copied so that the nodes don't share their state
+	mutex.Lock()
+	thisNode := &NodeTangle{
+		DataStructure: pCurrentTangle.Copy(),
+		Node:          nil,
+	}
+	mutex.Unlock()
+	thisNode.listen()
+
+	// Ping the provided node in the network
+	_, err := thisNode.Node.Ping(context.TODO(), pNode.Addr())
+	check(err)
+
+	// Discover the other nodes present in the network at the moment
+	thisNode.protocol.Discover()
+
+	return thisNode
+}
+
+// Create the initial node
+// For simplicity the genesis site gives the amount of available currency to a "main" account
+func CreateInitialNode(pAvailableCurrency float64) *NodeTangle {
+	thisNode := &NodeTangle{
+		DataStructure: CreateTangle(CreateGenesisSite("main", pAvailableCurrency)),
+	}
+	thisNode.listen()
+	return thisNode
+}
+
+// *** Methods ***
+
+// Create the network node, bind the Kademlia protocol and the way the requests are handled,
+// and make it listen to the network
+func (pNode *NodeTangle) listen() {
+	// Create network node
+	networkNode, err := noise.NewNode()
+	check(err)
+
+	// Assign the Kademlia protocol to the node so it can discover other nodes
+	pNode.protocol = kademlia.New()
+	networkNode.Bind(pNode.protocol.Protocol())
+
+	// Assign the way the node will handle the sites it receives
+	networkNode.Handle(pNode.handleRequest)
+
+	// Make the node listen to the network
+	check(networkNode.Listen())
+
+	// Assign the network node to the node
+	pNode.Node = networkNode
+	pNode.seen = make(map[string]bool)
+}
+
+// Issue a transaction to the network. The tips the new site approves are chosen with the random walk,
+// then the proof of work is done and the site is attached to the Tangle of the node and broadcast
+func (pNode *NodeTangle) IssueTransaction(pTransaction components.Transaction) (Site, error) {
+	mutex.Lock()
+	trunk, branch, err := pNode.DataStructure.SelectTips(pTransaction)
+	if err != nil {
+		mutex.Unlock()
+		return Site{}, err
+	}
+	newSite := CreateSite(trunk, branch, pTransaction)
+	pNode.seen[newSite.Hash] = true
+	_, err = pNode.DataStructure.AddSite(newSite)
+	mutex.Unlock()
+	if err != nil {
+		return Site{}, err
+	}
+	pNode.broadcast(newSite)
+	return newSite, nil
+}
+
+// Send a site to every peer known by the node
+func (pNode *NodeTangle) broadcast(pSite Site) {
+	bytes, err := json.Marshal(pSite)
+	check(err)
+	for _, v := range pNode.protocol.Table().Peers() {
+		// A peer that left the network or is too busy to answer doesn't stop the site from reaching the others
+		ctx, cancel := context.WithTimeout(context.Background(), RequestTimeout)
+		_, _ = pNode.Node.Request(ctx, v.Address, bytes)
+		cancel()
+	}
+}
+
+// Handle the sites received. The ones that are new for the node are relayed to its peers
+func (pNode *NodeTangle) handleRequest(ctx noise.HandlerContext) error {
+	if !ctx.IsRequest() {
+		return nil
+	}
+	var received Site
+	// The messages used to discover peers are not sites
+	if err := json.Unmarshal(ctx.Data(), &received); err != nil || received.Hash == "" {
+		return ctx.Send([]byte(""))
+	}
+	if err := ctx.Send([]byte("")); err != nil {
+		return err
+	}
+
+	mutex.Lock()
+	known := pNode.seen[received.Hash]
+	pNode.seen[received.Hash] = true
+	_, _ = pNode.DataStructure.AddSite(received)
+	mutex.Unlock()
+	if !known {
+		go pNode.broadcast(received)
+	}
+	return nil
+}
+
+// Confirmation confidence of a site according to the node.
+// Safe to call while the node keeps receiving sites
+func (pNode *NodeTangle) ConfirmationConfidence(pHash string) float64 {
+	mutex.Lock()
+	defer mutex.Unlock()
+	return pNode.DataStructure.ConfirmationConfidence(pHash)
+}
+
+// Number of sites attached to the Tangle of the node. Safe to call while the node keeps receiving sites
+func (pNode *NodeTangle) NumberSites() int {
+	mutex.Lock()
+	defer mutex.Unlock()
+	return len(pNode.DataStructure.Sites)
+}
+
+// Revises whether the error is not nil
+func check(err error) {
+	if err != nil {
+		panic(err)
+	}
+}
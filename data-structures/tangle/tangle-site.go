@@ -0,0 +1,120 @@
+package tangle
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"github.com/gcubillos/isis-3007-distributed-ledger/data-structures/shared-components"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// *** Structs ***
+
+// The number of leading zeroes wanted from the hash of every site. As in IOTA, the proof of work is
+// small since it is only meant to prevent spam, the sites are ordered by the ones approving them
+var Difficulty = 1
+
+// What a site in the Tangle contains
+// A site is a vertex of the Tangle that carries a single transaction. Instead of being grouped in
+// blocks, every site approves two earlier sites, the Trunk and the Branch, which are usually tips
+// of the Tangle when the site is issued. The genesis site doesn't approve any site and its
+// transaction creates the whole supply
+type Site struct {
+	Trunk       string
+	Branch      string
+	Transaction components.Transaction
+	Timestamp   time.Time
+	Nonce       int
+	Difficulty  int
+	Hash        string
+}
+
+// *** Constructors ***
+
+// Create a site that approves the given trunk and branch and do its proof of work
+func CreateSite(pTrunk, pBranch string, pTransaction components.Transaction) Site {
+	rSite := Site{
+		Trunk:       pTrunk,
+		Branch:      pBranch,
+		Transaction: pTransaction,
+		Timestamp:   time.Now(),
+		Difficulty:  Difficulty,
+	}
+	// Proof of work, calculating the hash
+	for i := 0; ; i++ {
+		rSite.Nonce = i
+		if hash := CalculateHash(rSite); IsHashValid(hash, rSite.Difficulty) {
+			rSite.Hash = hash
+			break
+		}
+	}
+	return rSite
+}
+
+// Create the genesis site, whose transaction gives the whole supply to the given account
+func CreateGenesisSite(pAccount string, pSupply float64) Site {
+	return CreateSite("", "", components.CreateTransaction("", "", pAccount, pSupply))
+}
+
+// *** Methods ***
+
+// Generate Hash of a site using all of its fields
+func CalculateHash(pSite Site) string {
+	record := pSite.Trunk + pSite.Branch + pSite.Transaction.Origin + pSite.Transaction.SenderSignature +
+		pSite.Transaction.Destination + strconv.FormatFloat(pSite.Transaction.Value, 'f', -1, 64) + strconv.FormatInt(pSite.Transaction.Nonce, 10) +
+		strconv.FormatInt(pSite.Timestamp.UnixNano(), 10) + strconv.Itoa(pSite.Nonce) + strconv.Itoa(pSite.Difficulty)
+	h := sha256.New()
+	h.Write([]byte(record))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Checks whether the hash is valid by checking if it starts with the given number of zeroes specified in the difficulty
+func IsHashValid(hash string, difficulty int) bool {
+	prefix := strings.Repeat("0", difficulty)
+	return strings.HasPrefix(hash, prefix)
+}
+
+// Whether the site has the proof of work of the configured difficulty, so that no peer can skip it
+func (pSite *Site) hasProofOfWork() bool {
+	return pSite.Difficulty == Difficulty && IsHashValid(pSite.Hash, pSite.Difficulty)
+}
+
+// Sites approved directly by the site. The trunk and the branch may be the same site
+func (pSite *Site) Approved() []string {
+	if pSite.Trunk == pSite.Branch {
+		return []string{pSite.Trunk}
+	}
+	return []string{pSite.Trunk, pSite.Branch}
+}
+
+// Check that the site is valid
+// The hash and proof of work must be valid, the approved sites must be part of the Tangle and be
+// older than the site, and the transaction must be consistent with the ones the site approves
+// directly or indirectly, that is no account of its past cone may end with a negative balance.
+// Only the genesis site, which is never checked, has a transaction without origin
+func (pTangle *Tangle) IsSiteValid(pSite Site) (bool, error) {
+	trunk, trunkOk := pTangle.Sites[pSite.Trunk]
+	branch, branchOk := pTangle.Sites[pSite.Branch]
+	switch true {
+	// Does the corresponding hash match
+	case CalculateHash(pSite) != pSite.Hash:
+		return false, errors.New("calculated hash doesn't match")
+	// Checking proof of work, with the configured difficulty
+	case !pSite.hasProofOfWork():
+		return false, errors.New("the proof of work is not valid")
+	case !trunkOk || !branchOk:
+		return false, errors.New("the approved sites are unknown")
+	case pSite.Timestamp.Before(trunk.Timestamp) || pSite.Timestamp.Before(branch.Timestamp):
+		return false, errors.New("the site is older than the sites it approves")
+	case pSite.Transaction.Value < 0:
+		return false, errors.New("the value of the transaction can't be negative")
+	// Only the genesis site creates currency
+	case pSite.Transaction.Origin == "":
+		return false, errors.New("the transaction doesn't have an origin")
+	case !pTangle.IsConsistent(pSite.Trunk, pSite.Branch, &pSite.Transaction):
+		return false, errors.New("the transaction is not consistent with the sites it approves")
+	}
+	return true, nil
+}
@@ -0,0 +1,228 @@
+package tangle
+
+import (
+	"errors"
+	"github.com/gcubillos/isis-3007-distributed-ledger/data-structures/shared-components"
+	"sort"
+)
+
+// *** Structs ***
+
+// Declaration of structure
+// The Tangle is a directed acyclic graph where every site approves two earlier sites.
+// Sites contains every site indexed by its hash and Approvers the sites that approve each site
+// directly. Tips are the sites that haven't been approved yet. CumulativeWeight is the number of
+// sites that approve each site directly or indirectly, plus one for the site itself.
+// Since the sites may arrive in any order, Unsolid keeps the sites whose trunk or branch is still
+// unknown, indexed by the hash they are waiting for
+type Tangle struct {
+	Sites            map[string]Site
+	Approvers        map[string][]string
+	Tips             map[string]bool
+	CumulativeWeight map[string]int
+	Unsolid          map[string][]Site
+	Genesis          string
+	TotalSupply      float64
+}
+
+// *** Constructors ***
+
+// Create the Tangle with the genesis site, which holds the whole supply
+func CreateTangle(pGenesisSite Site) Tangle {
+	rTangle := Tangle{
+		Sites:            make(map[string]Site),
+		Approvers:        make(map[string][]string),
+		Tips:             make(map[string]bool),
+		CumulativeWeight: make(map[string]int),
+		Unsolid:          make(map[string][]Site),
+		Genesis:          pGenesisSite.Hash,
+		TotalSupply:      pGenesisSite.Transaction.Value,
+	}
+	rTangle.Sites[pGenesisSite.Hash] = pGenesisSite
+	rTangle.Tips[pGenesisSite.Hash] = true
+	rTangle.CumulativeWeight[pGenesisSite.Hash] = 1
+	return rTangle
+}
+
+// *** Methods ***
+
+// Create a copy of the Tangle that doesn't share any of its maps with the original one.
+// Needed since several nodes in the same process may start from the same structure
+func (pTangle *Tangle) Copy() Tangle {
+	rTangle := Tangle{
+		Sites:            make(map[string]Site, len(pTangle.Sites)),
+		Approvers:        make(map[string][]string, len(pTangle.Approvers)),
+		Tips:             make(map[string]bool, len(pTangle.Tips)),
+		CumulativeWeight: make(map[string]int, len(pTangle.CumulativeWeight)),
+		Unsolid:          make(map[string][]Site, len(pTangle.Unsolid)),
+		Genesis:          pTangle.Genesis,
+		TotalSupply:      pTangle.TotalSupply,
+	}
+	for k, v := range pTangle.Sites {
+		rTangle.Sites[k] = v
+	}
+	for k, v := range pTangle.Approvers {
+		rTangle.Approvers[k] = append([]string(nil), v...)
+	}
+	for k, v := range pTangle.Tips {
+		rTangle.Tips[k] = v
+	}
+	for k, v := range pTangle.CumulativeWeight {
+		rTangle.CumulativeWeight[k] = v
+	}
+	for k, v := range pTangle.Unsolid {
+		rTangle.Unsolid[k] = append([]Site(nil), v...)
+	}
+	return rTangle
+}
+
+// Hashes of the current tips, sorted so that the result doesn't depend on the order of the map
+func (pTangle *Tangle) TipHashes() []string {
+	rTips := make([]string, 0, len(pTangle.Tips))
+	for k := range pTangle.Tips {
+		rTips = append(rTips, k)
+	}
+	sort.Strings(rTips)
+	return rTips
+}
+
+// Add a site to the Tangle. When one of the sites it approves is still unknown, it is kept as unsolid
+// and added once that site arrives. The sites that became part of the Tangle are returned, that is
+// the site itself followed by the unsolid sites that were waiting for it
+func (pTangle *Tangle) AddSite(pSite Site) ([]Site, error) {
+	// Site was already received
+	if _, ok := pTangle.Sites[pSite.Hash]; ok {
+		return nil, nil
+	}
+	if missing := pTangle.missingApproved(pSite); missing != "" {
+		if CalculateHash(pSite) != pSite.Hash || !pSite.hasProofOfWork() {
+			return nil, errors.New("the site doesn't have a valid proof of work")
+		}
+		for _, v := range pTangle.Unsolid[missing] {
+			if v.Hash == pSite.Hash {
+				return nil, errors.New("the site is waiting for a site that is still unknown")
+			}
+		}
+		pTangle.Unsolid[missing] = append(pTangle.Unsolid[missing], pSite)
+		return nil, errors.New("the site is waiting for a site that is still unknown")
+	}
+	if ok, err := pTangle.IsSiteValid(pSite); !ok {
+		return nil, err
+	}
+	pTangle.attach(pSite)
+
+	rAdded := []Site{pSite}
+	waiting := pTangle.Unsolid[pSite.Hash]
+	delete(pTangle.Unsolid, pSite.Hash)
+	for _, v := range waiting {
+		if added, err := pTangle.AddSite(v); err == nil {
+			rAdded = append(rAdded, added...)
+		}
+	}
+	return rAdded, nil
+}
+
+// Hash of the trunk or the branch when it is not yet part of the Tangle, or an empty string when
+// both of them are known
+func (pTangle *Tangle) missingApproved(pSite Site) string {
+	for _, v := range pSite.Approved() {
+		if _, ok := pTangle.Sites[v]; !ok {
+			return v
+		}
+	}
+	return ""
+}
+
+// Make a valid site part of the Tangle. The sites it approves stop being tips, and the cumulative
+// weight of every site in its past cone increases by one
+func (pTangle *Tangle) attach(pSite Site) {
+	pTangle.Sites[pSite.Hash] = pSite
+	pTangle.Tips[pSite.Hash] = true
+	pTangle.CumulativeWeight[pSite.Hash] = 1
+	for _, v := range pSite.Approved() {
+		pTangle.Approvers[v] = append(pTangle.Approvers[v], pSite.Hash)
+		delete(pTangle.Tips, v)
+	}
+	for k := range pTangle.PastCone(pSite.Approved()...) {
+		pTangle.CumulativeWeight[k]++
+	}
+}
+
+// Sites approved directly or indirectly by the given sites, including themselves
+func (pTangle *Tangle) PastCone(pHashes ...string) map[string]bool {
+	rCone := make(map[string]bool)
+	pending := append([]string(nil), pHashes...)
+	for len(pending) > 0 {
+		current := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+		if rCone[current] {
+			continue
+		}
+		rCone[current] = true
+		if current == pTangle.Genesis {
+			continue
+		}
+		theSite := pTangle.Sites[current]
+		pending = append(pending, theSite.Approved()...)
+	}
+	return rCone
+}
+
+// Sites that approve the given site directly or indirectly, including itself
+func (pTangle *Tangle) FutureCone(pHash string) map[string]bool {
+	rCone := make(map[string]bool)
+	pending := []string{pHash}
+	for len(pending) > 0 {
+		current := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+		if rCone[current] {
+			continue
+		}
+		rCone[current] = true
+		pending = append(pending, pTangle.Approvers[current]...)
+	}
+	return rCone
+}
+
+// Whether a site is approved, directly or indirectly, by another one
+func (pTangle *Tangle) Approves(pApprover, pHash string) bool {
+	return pTangle.PastCone(pApprover)[pHash]
+}
+
+// Balances of the accounts according to the transactions of the past cone of the given sites
+func (pTangle *Tangle) ConeState(pHashes ...string) map[string]float64 {
+	rState := make(map[string]float64)
+	for k := range pTangle.PastCone(pHashes...) {
+		applyTransaction(rState, pTangle.Sites[k].Transaction)
+	}
+	return rState
+}
+
+// Whether a new site approving the given trunk and branch is consistent, that is the past cone of
+// both sites plus the transaction of the new site don't leave any account with a negative balance.
+// The transaction may be nil to check only whether the trunk and the branch are consistent together
+func (pTangle *Tangle) IsConsistent(pTrunk, pBranch string, pTransaction *components.Transaction) bool {
+	state := pTangle.ConeState(pTrunk, pBranch)
+	if pTransaction != nil {
+		applyTransaction(state, *pTransaction)
+	}
+	for _, v := range state {
+		if v < 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Balance of an account according to the transactions approved by the given site
+func (pTangle *Tangle) Balance(pAccount, pHash string) float64 {
+	return pTangle.ConeState(pHash)[pAccount]
+}
+
+// Apply a transaction to the given balances. The transaction of the genesis site has no origin
+func applyTransaction(pState map[string]float64, pTransaction components.Transaction) {
+	if pTransaction.Origin != "" {
+		pState[pTransaction.Origin] -= pTransaction.Value
+	}
+	pState[pTransaction.Destination] += pTransaction.Value
+}
@@ -0,0 +1,91 @@
+package tangle
+
+import (
+	"errors"
+	"github.com/gcubillos/isis-3007-distributed-ledger/data-structures/shared-components"
+	"math"
+	"math/rand"
+)
+
+// *** Structs ***
+
+// Randomness of the random walk used to select the tips. With alpha equal to zero the walk is
+// unweighted and every approver has the same probability of being chosen, while a big alpha makes
+// the walk follow the heaviest approvers, so lazy tips that approve old sites are left behind
+var Alpha = 0.01
+
+// Number of random walks used to estimate the confirmation confidence of a site
+var ConfidenceWalks = 100
+
+// Confirmation confidence from which a site is considered confirmed
+var ConfirmationThreshold = 0.95
+
+// Number of times a pair of tips is selected before giving up on finding a consistent one
+const maxTipSelections = 10
+
+// *** Methods ***
+
+// Weighted random walk (Markov Chain Monte Carlo) from the genesis site towards the tips. At every
+// step the walk moves from the current site x to one of its approvers y with a probability
+// proportional to exp(-alpha * (H(x) - H(y))), where H is the cumulative weight, and it stops on a tip
+func (pTangle *Tangle) RandomWalk() string {
+	current := pTangle.Genesis
+	for {
+		approvers := pTangle.Approvers[current]
+		if len(approvers) == 0 {
+			return current
+		}
+		weights := make([]float64, len(approvers))
+		total := 0.0
+		for i, v := range approvers {
+			difference := pTangle.CumulativeWeight[current] - pTangle.CumulativeWeight[v]
+			weights[i] = math.Exp(-Alpha * float64(difference))
+			total += weights[i]
+		}
+		chosen := rand.Float64() * total
+		next := approvers[len(approvers)-1]
+		for i, v := range weights {
+			if chosen < v {
+				next = approvers[i]
+				break
+			}
+			chosen -= v
+		}
+		current = next
+	}
+}
+
+// Select the trunk and the branch a new site with the given transaction will approve, using two
+// independent random walks. Pairs of tips that are not consistent with each other or with the
+// transaction are discarded and the walks are repeated
+func (pTangle *Tangle) SelectTips(pTransaction components.Transaction) (string, string, error) {
+	for i := 0; i < maxTipSelections; i++ {
+		trunk := pTangle.RandomWalk()
+		branch := pTangle.RandomWalk()
+		if pTangle.IsConsistent(trunk, branch, &pTransaction) {
+			return trunk, branch, nil
+		}
+	}
+	return "", "", errors.New("no consistent tips were found for the transaction")
+}
+
+// Confirmation confidence of a site, that is the fraction of the tips reached by the random walks
+// that approve the site directly or indirectly
+func (pTangle *Tangle) ConfirmationConfidence(pHash string) float64 {
+	if _, ok := pTangle.Sites[pHash]; !ok {
+		return 0
+	}
+	futureCone := pTangle.FutureCone(pHash)
+	approving := 0
+	for i := 0; i < ConfidenceWalks; i++ {
+		if futureCone[pTangle.RandomWalk()] {
+			approving++
+		}
+	}
+	return float64(approving) / float64(ConfidenceWalks)
+}
+
+// Whether the confirmation confidence of the site reached the threshold
+func (pTangle *Tangle) IsConfirmed(pHash string) bool {
+	return pTangle.ConfirmationConfidence(pHash) >= ConfirmationThreshold
+}
@@ -0,0 +1,51 @@
+package tendermint
+
+import (
+	"github.com/gcubillos/isis-3007-distributed-ledger/data-structures/blockchain"
+	"github.com/gcubillos/isis-3007-distributed-ledger/data-structures/shared-components"
+	"strconv"
+)
+
+// *** Structs ***
+
+// Types of messages exchanged by the nodes
+const (
+	// Transactions submitted to the nodes, which the proposers order into blocks
+	Request = "request"
+	// Block proposed by the proposer of a round
+	Proposal = "proposal"
+	// First vote of a validator in a round, for the proposed block or for none
+	Prevote = "prevote"
+	// Second vote of a validator in a round, once it saw more than two thirds of the power prevote for
+	// the same block, or for none
+	Precommit = "precommit"
+)
+
+// What a message between nodes contains
+// Digest is the hash of the block the message is about, empty when a validator votes for no block.
+// A proposal carries the Block and, in POLRound, the last round in which the proposer saw more than two
+// thirds of the power prevote for it, or -1 if the block is new. Every message but the requests is
+// signed by the Validator that sent it, identified by its key
+type Message struct {
+	Type         string
+	Height       int
+	Round        int
+	POLRound     int
+	Digest       string
+	Block        *blockchain.Block
+	Transactions []components.Transaction
+	Validator    string
+	Signature    string
+}
+
+// *** Methods ***
+
+// Data signed by the validator that sends the message
+func (pMessage *Message) signedData() string {
+	return pMessage.Type + strconv.Itoa(pMessage.Height) + "/" + strconv.Itoa(pMessage.Round) + "/" + strconv.Itoa(pMessage.POLRound) + pMessage.Digest + pMessage.Validator
+}
+
+// Whether the message was signed by its validator
+func (pMessage *Message) isSignatureValid() bool {
+	return components.VerifySignature(pMessage.Validator, pMessage.signedData(), pMessage.Signature)
+}
@@ -0,0 +1,589 @@
+package tendermint
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/gcubillos/isis-3007-distributed-ledger/data-structures/blockchain"
+	"github.com/gcubillos/isis-3007-distributed-ledger/data-structures/shared-components"
+	"github.com/perlin-network/noise"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Mutual exclusion variable
+var mutex = &sync.Mutex{}
+
+// Time a node waits for a peer to acknowledge a message
+var RequestTimeout = 2 * time.Second
+
+// Time the validators wait for the proposal of a round, for the rest of the prevotes once more than two
+// thirds of the power prevoted, and for the rest of the precommits once more than two thirds of the
+// power precommitted. Each of them grows by TimeoutDelta every round, so that a round eventually lasts
+// long enough for the messages to arrive
+var (
+	TimeoutPropose   = 300 * time.Millisecond
+	TimeoutPrevote   = 100 * time.Millisecond
+	TimeoutPrecommit = 100 * time.Millisecond
+	TimeoutDelta     = 100 * time.Millisecond
+)
+
+// Maximum number of transactions a proposer orders in a block
+var BlockSize = 500
+
+// Steps of a round
+const (
+	proposeStep = iota
+	prevoteStep
+	precommitStep
+)
+
+// *** Structs ***
+
+// Declaration of a node in the network
+// Contains the underlying data structure as well as the node from the noise library.
+// Peers are the addresses of the other nodes, which receive every message. Only the nodes whose key
+// has voting power in the state take part in the rounds as validators, the others just follow them.
+// Round is the round of the next height the node is in. The node locks on the block it precommitted,
+// and only prevotes for another block if more than two thirds of the power prevoted for it in a later
+// round. The valid block is the last one for which it saw that happen, and it is proposed again.
+// A height only starts once there are pending transactions or other nodes already started it.
+// MessagesSent counts the messages the node sent to its peers
+type NodeTendermint struct {
+	DataStructure Tendermint
+	Node          *noise.Node
+	Peers         []string
+	Round         int
+	MessagesSent  int
+	step          int
+	started       bool
+	lockedBlock   *blockchain.Block
+	lockedRound   int
+	validBlock    *blockchain.Block
+	validRound    int
+	pending       []components.Transaction
+	isPending     map[components.Transaction]bool
+	proposals     map[string]map[string]Message
+	votes         map[string]map[string]Message
+	validity      map[string]bool
+	done          map[string]bool
+	dirty         bool
+	outbox        []Message
+	stopped       bool
+}
+
+// *** Constructors ***
+
+// Create a node that listens to the network. The genesis block and the "main" account with the amount
+// of available currency must be the same for every node. The node doesn't take part in the protocol
+// until it is started with its peers and the initial validators
+func CreateNode(pGenesisBlock blockchain.Block, pAvailableCurrency float64) *NodeTendermint {
+	thisNode := &NodeTendermint{
+		isPending: make(map[components.Transaction]bool),
+		stopped:   true,
+	}
+	// For simplicity a "main" account will be created that contains the amount of currency available
+	thisNode.DataStructure = CreateTendermint(pGenesisBlock, map[string]float64{"main": pAvailableCurrency})
+	thisNode.resetHeight()
+
+	// Create network node
+	networkNode, err := noise.NewNode()
+	check(err)
+
+	// Assign the way the node will handle the messages of the other nodes
+	networkNode.Handle(thisNode.handleRequest)
+
+	// Make the node listen to the network
+	check(networkNode.Listen())
+	thisNode.Node = networkNode
+
+	return thisNode
+}
+
+// *** Methods ***
+
+// Key that identifies the node as a validator. It is only valid once the node listens
+func (pNode *NodeTendermint) ValidatorKey() string {
+	return pNode.Node.ID().ID.String()
+}
+
+// Start taking part in the protocol with the given addresses of the nodes of the network and the keys of
+// the initial validators, which must be the same for every node. The initial validators receive their
+// voting power in the genesis state
+func (pNode *NodeTendermint) Start(pAddresses []string, pValidators []string) {
+	mutex.Lock()
+	pNode.Peers = make([]string, 0, len(pAddresses))
+	for _, v := range pAddresses {
+		if v != pNode.Node.Addr() {
+			pNode.Peers = append(pNode.Peers, v)
+		}
+	}
+	pNode.DataStructure.addValidators(pValidators)
+	pNode.stopped = false
+	pNode.dirty = true
+	pNode.applyRules()
+	pNode.flush()
+}
+
+// Stop taking part in the protocol and close the network node
+func (pNode *NodeTendermint) Close() {
+	mutex.Lock()
+	pNode.stopped = true
+	mutex.Unlock()
+	check(pNode.Node.Close())
+}
+
+// Send transactions to every node so that the proposers order them in blocks
+func (pNode *NodeTendermint) Submit(pTransactions []components.Transaction) {
+	mutex.Lock()
+	pNode.outbox = append(pNode.outbox, Message{Type: Request, Transactions: pTransactions})
+	pNode.addRequest(pTransactions)
+	pNode.applyRules()
+	pNode.flush()
+}
+
+// Unlock the mutex and send the queued messages to the peers. Messages are sent without holding the
+// structure, so that the nodes can answer each other, and each peer receives them in order. A peer that
+// left the network doesn't delay the messages to the others
+func (pNode *NodeTendermint) flush() {
+	outbox := pNode.outbox
+	pNode.outbox = nil
+	peers := pNode.Peers
+	pNode.MessagesSent += len(outbox) * len(peers)
+	mutex.Unlock()
+	if len(outbox) == 0 {
+		return
+	}
+	messages := make([][]byte, len(outbox))
+	for i, v := range outbox {
+		bytes, err := json.Marshal(v)
+		check(err)
+		messages[i] = bytes
+	}
+	for _, v := range peers {
+		go func(pAddress string) {
+			for _, w := range messages {
+				// A peer that is too busy to answer doesn't stop the next messages from being sent
+				ctx, cancel := context.WithTimeout(context.Background(), RequestTimeout)
+				_, _ = pNode.Node.Request(ctx, pAddress, w)
+				cancel()
+			}
+		}(v)
+	}
+}
+
+// Handle the messages of the other nodes
+func (pNode *NodeTendermint) handleRequest(ctx noise.HandlerContext) error {
+	if !ctx.IsRequest() {
+		return nil
+	}
+	var received Message
+	if err := json.Unmarshal(ctx.Data(), &received); err != nil {
+		return ctx.Send([]byte(""))
+	}
+	if err := ctx.Send([]byte("")); err != nil {
+		return err
+	}
+
+	mutex.Lock()
+	if pNode.stopped {
+		mutex.Unlock()
+		return nil
+	}
+	if received.Type == Request {
+		pNode.addRequest(received.Transactions)
+	} else if received.isSignatureValid() {
+		pNode.store(received)
+	}
+	pNode.applyRules()
+	pNode.flush()
+	return nil
+}
+
+// Sign a message of the node and queue it to be sent to its peers. The node stores its own messages
+// right away. Only validators send messages
+func (pNode *NodeTendermint) send(pMessage Message) {
+	if pNode.DataStructure.Power(pNode.ValidatorKey()) == 0 {
+		return
+	}
+	pMessage.Height = pNode.DataStructure.Height()
+	pMessage.Validator = pNode.ValidatorKey()
+	pMessage.Signature = components.Sign(pNode.Node, pMessage.signedData())
+	pNode.outbox = append(pNode.outbox, pMessage)
+	pNode.store(pMessage)
+}
+
+// Keep a proposal or a vote for the current height or a later one, at most one per validator and round
+func (pNode *NodeTendermint) store(pMessage Message) {
+	if pMessage.Height < pNode.DataStructure.Height() {
+		return
+	}
+	var messages map[string]map[string]Message
+	switch pMessage.Type {
+	case Proposal:
+		if pMessage.Block == nil || pMessage.Block.Hash != pMessage.Digest {
+			return
+		}
+		messages = pNode.proposals
+	case Prevote, Precommit:
+		messages = pNode.votes
+	default:
+		return
+	}
+	key := roundKey(pMessage.Type, pMessage.Height, pMessage.Round)
+	if _, ok := messages[key]; !ok {
+		messages[key] = make(map[string]Message)
+	}
+	if _, ok := messages[key][pMessage.Validator]; !ok {
+		messages[key][pMessage.Validator] = pMessage
+		pNode.dirty = true
+	}
+}
+
+// Key of the messages of a type for a round of a height
+func roundKey(pType string, pHeight, pRound int) string {
+	return pType + "/" + strconv.Itoa(pHeight) + "/" + strconv.Itoa(pRound)
+}
+
+// Keep the transactions that aren't committed nor pending yet and that can be performed over the
+// current state
+func (pNode *NodeTendermint) addRequest(pTransactions []components.Transaction) {
+	for _, v := range pTransactions {
+		if pNode.isPending[v] || pNode.DataStructure.IsTransactionCommitted(v) ||
+			!blockchain.VerifyStateTransition([]components.Transaction{v}, pNode.DataStructure.State) {
+			continue
+		}
+		pNode.pending = append(pNode.pending, v)
+		pNode.isPending[v] = true
+		pNode.dirty = true
+	}
+}
+
+// Forget everything about the height that was committed, so that the node starts the next one
+func (pNode *NodeTendermint) resetHeight() {
+	pNode.Round = 0
+	pNode.step = proposeStep
+	pNode.started = false
+	pNode.lockedBlock = nil
+	pNode.lockedRound = -1
+	pNode.validBlock = nil
+	pNode.validRound = -1
+	pNode.validity = make(map[string]bool)
+	pNode.done = make(map[string]bool)
+	height := pNode.DataStructure.Height()
+	previousProposals, previousVotes := pNode.proposals, pNode.votes
+	pNode.proposals = make(map[string]map[string]Message)
+	pNode.votes = make(map[string]map[string]Message)
+	// The messages of later heights that already arrived are kept
+	for _, v := range []map[string]map[string]Message{previousProposals, previousVotes} {
+		for _, w := range v {
+			for _, x := range w {
+				if x.Height >= height {
+					pNode.store(x)
+				}
+			}
+		}
+	}
+}
+
+// Proposal of the proposer of a round of the current height, if it arrived
+func (pNode *NodeTendermint) proposal(pRound int) *Message {
+	proposer := pNode.DataStructure.Proposer(pRound)
+	if rProposal, ok := pNode.proposals[roundKey(Proposal, pNode.DataStructure.Height(), pRound)][proposer]; ok {
+		return &rProposal
+	}
+	return nil
+}
+
+// Whether the block can be committed at the current height. The result is kept for the height
+func (pNode *NodeTendermint) isValid(pBlock *blockchain.Block) bool {
+	if rValid, ok := pNode.validity[pBlock.Hash]; ok {
+		return rValid
+	}
+	rValid, _ := pNode.DataStructure.IsBlockValid(*pBlock)
+	pNode.validity[pBlock.Hash] = rValid
+	return rValid
+}
+
+// Voting power of the validators that sent a vote of the given type in a round of the current height,
+// for the given block. Any vote counts when the digest is nil
+func (pNode *NodeTendermint) votingPower(pType string, pRound int, pDigest *string) float64 {
+	rPower := 0.0
+	for _, v := range pNode.votes[roundKey(pType, pNode.DataStructure.Height(), pRound)] {
+		if pDigest == nil || v.Digest == *pDigest {
+			rPower += pNode.DataStructure.Power(v.Validator)
+		}
+	}
+	return rPower
+}
+
+// Whether the voting power is more than two thirds of the total
+func (pNode *NodeTendermint) isSupermajority(pPower float64) bool {
+	return 3*pPower > 2*pNode.DataStructure.TotalPower()
+}
+
+// Whether the rule was already applied in a round of the current height, marking it as applied
+func (pNode *NodeTendermint) once(pRule string, pRound int) bool {
+	key := pRule + "/" + strconv.Itoa(pRound)
+	if pNode.done[key] {
+		return false
+	}
+	pNode.done[key] = true
+	return true
+}
+
+// Apply the rules of the protocol while the messages the node has lead to new steps
+func (pNode *NodeTendermint) applyRules() {
+	for pNode.dirty && !pNode.stopped {
+		pNode.dirty = false
+		pNode.applyRulesOnce()
+	}
+}
+
+// Rules of the protocol for the current height, applied in the order of the algorithm of Tendermint
+func (pNode *NodeTendermint) applyRulesOnce() {
+	height := pNode.DataStructure.Height()
+	if !pNode.started {
+		if len(pNode.pending) == 0 && len(pNode.proposals) == 0 && len(pNode.votes) == 0 {
+			return
+		}
+		pNode.started = true
+		pNode.startRound(0)
+	}
+	round := pNode.Round
+	noBlock := ""
+
+	// A block is committed once more than two thirds of the power precommit it in any round
+	for _, v := range pNode.proposals {
+		for _, w := range v {
+			if w.Height != height || w.Validator != pNode.DataStructure.Proposer(w.Round) {
+				continue
+			}
+			if pNode.isSupermajority(pNode.votingPower(Precommit, w.Round, &w.Digest)) && pNode.isValid(w.Block) {
+				pNode.commit(*w.Block, pNode.votes[roundKey(Precommit, height, w.Round)])
+				return
+			}
+		}
+	}
+
+	// More than a third of the power is in a later round, so at least a correct validator is there
+	for r := round + 1; ; r++ {
+		senders := make(map[string]bool)
+		for _, t := range []string{Proposal, Prevote, Precommit} {
+			source := pNode.votes
+			if t == Proposal {
+				source = pNode.proposals
+			}
+			for k := range source[roundKey(t, height, r)] {
+				senders[k] = true
+			}
+		}
+		if len(senders) == 0 {
+			break
+		}
+		power := 0.0
+		for k := range senders {
+			power += pNode.DataStructure.Power(k)
+		}
+		if 3*power > pNode.DataStructure.TotalPower() {
+			pNode.startRound(r)
+			return
+		}
+	}
+
+	theProposal := pNode.proposal(round)
+	// Prevote for the proposal if it is valid and doesn't contradict the lock of the node. A block that
+	// was already proposed can be prevoted despite the lock if it got a polka after the lock
+	if pNode.step == proposeStep && theProposal != nil {
+		digest, decided := noBlock, false
+		switch true {
+		case theProposal.POLRound == -1:
+			decided = true
+			if pNode.isValid(theProposal.Block) && (pNode.lockedRound == -1 || pNode.lockedBlock.Hash == theProposal.Digest) {
+				digest = theProposal.Digest
+			}
+		case theProposal.POLRound < round && pNode.isSupermajority(pNode.votingPower(Prevote, theProposal.POLRound, &theProposal.Digest)):
+			decided = true
+			if pNode.isValid(theProposal.Block) && (pNode.lockedRound <= theProposal.POLRound || pNode.lockedBlock.Hash == theProposal.Digest) {
+				digest = theProposal.Digest
+			}
+		}
+		if decided {
+			pNode.send(Message{Type: Prevote, Round: round, Digest: digest})
+			pNode.step = prevoteStep
+			pNode.dirty = true
+			return
+		}
+	}
+
+	// Wait for the rest of the prevotes once more than two thirds of the power prevoted
+	if pNode.step == prevoteStep && pNode.isSupermajority(pNode.votingPower(Prevote, round, nil)) && pNode.once("prevote-wait", round) {
+		pNode.schedule(TimeoutPrevote, height, round, prevoteStep)
+	}
+
+	// A polka, more than two thirds of the power prevoting the proposal, locks the node on it
+	if theProposal != nil && pNode.step >= prevoteStep && pNode.isValid(theProposal.Block) &&
+		pNode.isSupermajority(pNode.votingPower(Prevote, round, &theProposal.Digest)) && pNode.once("polka", round) {
+		if pNode.step == prevoteStep {
+			pNode.lockedBlock = theProposal.Block
+			pNode.lockedRound = round
+			pNode.send(Message{Type: Precommit, Round: round, Digest: theProposal.Digest})
+			pNode.step = precommitStep
+		}
+		pNode.validBlock = theProposal.Block
+		pNode.validRound = round
+		pNode.dirty = true
+		return
+	}
+
+	// More than two thirds of the power prevoted for no block
+	if pNode.step == prevoteStep && pNode.isSupermajority(pNode.votingPower(Prevote, round, &noBlock)) {
+		pNode.send(Message{Type: Precommit, Round: round, Digest: noBlock})
+		pNode.step = precommitStep
+		pNode.dirty = true
+		return
+	}
+
+	// Wait for the rest of the precommits once more than two thirds of the power precommitted
+	if pNode.isSupermajority(pNode.votingPower(Precommit, round, nil)) && pNode.once("precommit-wait", round) {
+		pNode.schedule(TimeoutPrecommit, height, round, precommitStep)
+	}
+}
+
+// Start a round of the current height. The proposer of the round proposes the valid block if there is
+// one, or a new block with the pending transactions otherwise. The other validators wait for it
+func (pNode *NodeTendermint) startRound(pRound int) {
+	pNode.Round = pRound
+	pNode.step = proposeStep
+	pNode.dirty = true
+	height := pNode.DataStructure.Height()
+	if pNode.DataStructure.Proposer(pRound) != pNode.ValidatorKey() {
+		pNode.schedule(TimeoutPropose, height, pRound, proposeStep)
+		return
+	}
+	if pNode.validBlock != nil {
+		pNode.send(Message{Type: Proposal, Round: pRound, POLRound: pNode.validRound, Digest: pNode.validBlock.Hash, Block: pNode.validBlock})
+		return
+	}
+	transactions := make([]components.Transaction, 0)
+	for _, v := range pNode.pending {
+		if len(transactions) == BlockSize {
+			break
+		}
+		if blockchain.VerifyStateTransition(append(transactions, v), pNode.DataStructure.State) {
+			transactions = append(transactions, v)
+		}
+	}
+	lastBlock := pNode.DataStructure.LastBlock()
+	// The monotonic clock reading is stripped, since it isn't kept when the block is sent to other nodes
+	newBlock := blockchain.Block{
+		Timestamp:    time.Now().Round(0),
+		PrevHash:     lastBlock.Hash,
+		Transactions: transactions,
+		Producer:     pNode.ValidatorKey(),
+		Slot:         height,
+	}
+	if newBlock.Timestamp.Before(lastBlock.Timestamp) {
+		newBlock.Timestamp = lastBlock.Timestamp
+	}
+	newBlock.Hash = blockchain.CalculateHash(newBlock)
+	newBlock.Signature = components.Sign(pNode.Node, newBlock.Hash)
+	pNode.send(Message{Type: Proposal, Round: pRound, POLRound: -1, Digest: newBlock.Hash, Block: &newBlock})
+}
+
+// Apply the timeout of a step of a round once its time, which grows with the round, is over. It has no
+// effect if the node already moved on
+func (pNode *NodeTendermint) schedule(pTimeout time.Duration, pHeight, pRound, pStep int) {
+	time.AfterFunc(pTimeout+time.Duration(pRound)*TimeoutDelta, func() {
+		mutex.Lock()
+		if pNode.stopped || pNode.DataStructure.Height() != pHeight || pNode.Round != pRound {
+			mutex.Unlock()
+			return
+		}
+		switch true {
+		// Prevote for no block if the proposal didn't arrive
+		case pStep == proposeStep && pNode.step == proposeStep:
+			pNode.send(Message{Type: Prevote, Round: pRound, Digest: ""})
+			pNode.step = prevoteStep
+		// Precommit for no block if the prevotes didn't agree
+		case pStep == prevoteStep && pNode.step == prevoteStep:
+			pNode.send(Message{Type: Precommit, Round: pRound, Digest: ""})
+			pNode.step = precommitStep
+		// Move to the next round if the precommits didn't agree
+		case pStep == precommitStep:
+			pNode.startRound(pRound + 1)
+		}
+		pNode.dirty = true
+		pNode.applyRules()
+		pNode.flush()
+	})
+}
+
+// Append a block to the chain along with the precommits for it, and drop the pending transactions it
+// contains, as well as the ones that can no longer be performed. Then the node moves to the next height
+func (pNode *NodeTendermint) commit(pBlock blockchain.Block, pPrecommits map[string]Message) {
+	certificate := make([]Message, 0, len(pPrecommits))
+	for _, v := range pPrecommits {
+		if v.Digest == pBlock.Hash {
+			certificate = append(certificate, v)
+		}
+	}
+	pNode.DataStructure.commitBlock(pBlock, certificate)
+	pending := pNode.pending
+	pNode.pending = make([]components.Transaction, 0, len(pending))
+	for _, v := range pending {
+		if !pNode.DataStructure.IsTransactionCommitted(v) &&
+			blockchain.VerifyStateTransition([]components.Transaction{v}, pNode.DataStructure.State) {
+			pNode.pending = append(pNode.pending, v)
+		} else {
+			delete(pNode.isPending, v)
+		}
+	}
+	pNode.resetHeight()
+	pNode.dirty = true
+}
+
+// Height of the chain of the node, including the genesis block. Safe to call while the node keeps
+// receiving messages
+func (pNode *NodeTendermint) Height() int {
+	mutex.Lock()
+	defer mutex.Unlock()
+	return len(pNode.DataStructure.Chain)
+}
+
+// Round of the next height the node is in. Safe to call while the node keeps receiving messages
+func (pNode *NodeTendermint) CurrentRound() int {
+	mutex.Lock()
+	defer mutex.Unlock()
+	return pNode.Round
+}
+
+// Number of messages the node sent to its peers. Safe to call while the node keeps receiving messages
+func (pNode *NodeTendermint) CountMessagesSent() int {
+	mutex.Lock()
+	defer mutex.Unlock()
+	return pNode.MessagesSent
+}
+
+// Whether the transaction is part of a final block of the node. Safe to call while the node keeps
+// receiving messages
+func (pNode *NodeTendermint) IsTransactionCommitted(pTransaction components.Transaction) bool {
+	mutex.Lock()
+	defer mutex.Unlock()
+	return pNode.DataStructure.IsTransactionCommitted(pTransaction)
+}
+
+// Validators of the next height of the node and their voting power. Safe to call while the node keeps
+// receiving messages
+func (pNode *NodeTendermint) Validators() ([]string, []float64) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	return pNode.DataStructure.Validators()
+}
+
+// Revises whether the error is not nil
+func check(err error) {
+	if err != nil {
+		panic(err)
+	}
+}
@@ -0,0 +1,173 @@
+package tendermint
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"github.com/gcubillos/isis-3007-distributed-ledger/data-structures/blockchain"
+	"github.com/gcubillos/isis-3007-distributed-ledger/data-structures/shared-components"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// *** Structs ***
+
+// Voting power the genesis state gives to each of the initial validators
+var InitialPower = 10.0
+
+// Prefix of the accounts that hold the voting power of the validators. A validator is identified by the
+// hexadecimal public key of its node. Transferring currency to its power account increases its power,
+// and transferring it back decreases it, so the validator set changes through transactions
+const PowerPrefix = "power:"
+
+// What the Tendermint data structure contains
+// Chain contains the committed blocks, going from the genesis block to the last one, and State is the
+// state at the end of it. A block is committed once more than two thirds of the voting power precommit
+// it, so it is final. Certificates keeps those precommits, indexed by the hash of the block. The
+// validator set of each height is given by the power accounts of the state at the end of the previous one
+type Tendermint struct {
+	Chain        []blockchain.Block
+	State        map[string]float64
+	Certificates map[string][]Message
+	committed    map[components.Transaction]bool
+}
+
+// *** Constructors ***
+
+// Create the structure with only the genesis block. The initial state is the state at the end of it
+func CreateTendermint(pGenesisBlock blockchain.Block, pInitialState map[string]float64) Tendermint {
+	rTendermint := Tendermint{
+		Chain:        []blockchain.Block{pGenesisBlock},
+		State:        make(map[string]float64, len(pInitialState)),
+		Certificates: make(map[string][]Message),
+		committed:    make(map[components.Transaction]bool),
+	}
+	for k, v := range pInitialState {
+		rTendermint.State[k] = v
+	}
+	return rTendermint
+}
+
+// Create the genesis block. It has a fixed timestamp, so that every node creates the same one
+func CreateGenesisBlock() blockchain.Block {
+	rGenesisBlock := blockchain.Block{Timestamp: time.Unix(0, 0).UTC(), Transactions: make([]components.Transaction, 0)}
+	rGenesisBlock.Hash = blockchain.CalculateHash(rGenesisBlock)
+	return rGenesisBlock
+}
+
+// *** Methods ***
+
+// Account holding the voting power of the given validator
+func PowerAccount(pValidator string) string {
+	return PowerPrefix + pValidator
+}
+
+// Give the initial validators their voting power in the genesis state
+func (pTendermint *Tendermint) addValidators(pValidators []string) {
+	for _, v := range pValidators {
+		pTendermint.State[PowerAccount(v)] = InitialPower
+	}
+}
+
+// Last committed block
+func (pTendermint *Tendermint) LastBlock() blockchain.Block {
+	return pTendermint.Chain[len(pTendermint.Chain)-1]
+}
+
+// Height of the next block to be committed
+func (pTendermint *Tendermint) Height() int {
+	return len(pTendermint.Chain)
+}
+
+// Validators of the next height and their voting power, sorted by validator
+func (pTendermint *Tendermint) Validators() ([]string, []float64) {
+	rValidators := make([]string, 0)
+	for k, v := range pTendermint.State {
+		if strings.HasPrefix(k, PowerPrefix) && v > 0 {
+			rValidators = append(rValidators, strings.TrimPrefix(k, PowerPrefix))
+		}
+	}
+	sort.Strings(rValidators)
+	rPowers := make([]float64, len(rValidators))
+	for i, v := range rValidators {
+		rPowers[i] = pTendermint.State[PowerAccount(v)]
+	}
+	return rValidators, rPowers
+}
+
+// Voting power of a validator in the next height
+func (pTendermint *Tendermint) Power(pValidator string) float64 {
+	if rPower := pTendermint.State[PowerAccount(pValidator)]; rPower > 0 {
+		return rPower
+	}
+	return 0
+}
+
+// Total voting power of the validators of the next height
+func (pTendermint *Tendermint) TotalPower() float64 {
+	_, powers := pTendermint.Validators()
+	rTotal := 0.0
+	for _, v := range powers {
+		rTotal += v
+	}
+	return rTotal
+}
+
+// Proposer of a round of the next height. The selection is pseudo-random, seeded by the last block and
+// the round, and proportional to the voting power, so every node selects the same validator
+func (pTendermint *Tendermint) Proposer(pRound int) string {
+	validators, powers := pTendermint.Validators()
+	if len(validators) == 0 {
+		return ""
+	}
+	seed := sha256.Sum256([]byte(pTendermint.LastBlock().Hash + strconv.Itoa(pRound)))
+	target := float64(binary.BigEndian.Uint64(seed[:8])) / math.MaxUint64 * pTendermint.TotalPower()
+	for i, v := range powers {
+		if target < v {
+			return validators[i]
+		}
+		target -= v
+	}
+	return validators[len(validators)-1]
+}
+
+// Check that the block can be the next one. The height is kept in the slot of the block, and it must be
+// signed by one of the validators of the height, which may have proposed it in a previous round
+func (pTendermint *Tendermint) IsBlockValid(pBlock blockchain.Block) (bool, error) {
+	lastBlock := pTendermint.LastBlock()
+	switch true {
+	case pBlock.PrevHash != lastBlock.Hash:
+		return false, errors.New("the block doesn't follow the last committed block")
+	case pBlock.Slot != pTendermint.Height():
+		return false, errors.New("the height of the block is not the next one")
+	case pBlock.Timestamp.Before(lastBlock.Timestamp):
+		return false, errors.New("timestamp is not valid")
+	case !blockchain.HasCorrectHash(pBlock):
+		return false, errors.New("calculated hash doesn't match")
+	case pTendermint.Power(pBlock.Producer) == 0 || !components.VerifySignature(pBlock.Producer, pBlock.Hash, pBlock.Signature):
+		return false, errors.New("the block isn't signed by a validator")
+	case !blockchain.VerifyStateTransition(pBlock.Transactions, pTendermint.State):
+		return false, errors.New("the transactions are inconsistent with the state")
+	default:
+		return true, nil
+	}
+}
+
+// Append a block precommitted by more than two thirds of the voting power to the chain, along with
+// the precommits that prove it
+func (pTendermint *Tendermint) commitBlock(pBlock blockchain.Block, pCertificate []Message) {
+	blockchain.ApplyTransactions(pTendermint.State, pBlock.Transactions)
+	pTendermint.Chain = append(pTendermint.Chain, pBlock)
+	pTendermint.Certificates[pBlock.Hash] = pCertificate
+	for _, v := range pBlock.Transactions {
+		pTendermint.committed[v] = true
+	}
+}
+
+// Whether the transaction is part of a committed block
+func (pTendermint *Tendermint) IsTransactionCommitted(pTransaction components.Transaction) bool {
+	return pTendermint.committed[pTransaction]
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"github.com/gcubillos/isis-3007-distributed-ledger/data-structures/bitcoin-ng"
+	"github.com/gcubillos/isis-3007-distributed-ledger/data-structures/blockchain"
+	"github.com/gcubillos/isis-3007-distributed-ledger/data-structures/shared-components"
+	"github.com/perlin-network/noise"
+	"time"
+)
+
+// The following code shows how a leader that forks its microblocks is punished.
+// The structure is used directly, without a network, so that both microblocks of the fork can be
+// given to it in the desired order. The leaders still need noise nodes, whose keys identify them
+// and sign their microblocks
+
+func main() {
+
+	// Defining parameters for simple execution
+
+	// Defining the difficulty for the tests (number of leading zeroes required in the hash)
+	blockchain.Difficulty = 1
+
+	// Defining the amount of currency that will be available during the tests.
+	var availableCurrency = 10.0
+
+	genesisBlock := bitcoinng.CreateGenesisBlock()
+	ng := bitcoinng.CreateBitcoinNG(genesisBlock, map[string]float64{"main": availableCurrency}, components.HeaviestWorkThenLongest{})
+
+	leaderA, leaderB, leaderC := createLeader(), createLeader(), createLeader()
+
+	// Leader "a" is elected and signs two microblocks with the same parent, spending the same funds twice
+	keyA := bitcoinng.CreateKeyBlock(genesisBlock.Hash, leaderA.ID().ID.String())
+	check(ng.AddBlock(keyA))
+	time.Sleep(bitcoinng.MicroblockInterval)
+	microA := bitcoinng.CreateMicroblock(keyA.Hash, leaderA, []components.Transaction{components.CreateTransaction("main", "main", "x", 9)}, nil)
+	forkA := bitcoinng.CreateMicroblock(keyA.Hash, leaderA, []components.Transaction{components.CreateTransaction("main", "main", "y", 9)}, nil)
+	check(ng.AddBlock(microA))
+	check(ng.AddBlock(forkA))
+
+	// Leader "b" is elected on top of the active chain and reports the fork in its first microblock
+	keyB := bitcoinng.CreateKeyBlock(ng.TipHash, leaderB.ID().ID.String())
+	check(ng.AddBlock(keyB))
+	time.Sleep(bitcoinng.MicroblockInterval)
+	poisons := ng.PoisonCandidates()
+	fmt.Printf("poisons found by the leader b: %v \n", len(poisons))
+	check(ng.AddBlock(bitcoinng.CreateMicroblock(keyB.Hash, leaderB, make([]components.Transaction, 0), poisons)))
+
+	// The rewards of the epoch of "a" are paid once enough key blocks follow it
+	for i := 0; i < bitcoinng.RewardMaturity; i++ {
+		check(ng.AddBlock(bitcoinng.CreateKeyBlock(ng.TipHash, leaderC.ID().ID.String())))
+	}
+	fmt.Printf("state after the epoch of a matured %v \n", ng.State)
+	fmt.Printf("a: %v, b: %v, c: %v \n", leaderA.ID().ID, leaderB.ID().ID, leaderC.ID().ID)
+}
+
+// Create a noise node for a leader. It listens so that it gets its identity, though no blocks are sent to it
+func createLeader() *noise.Node {
+	rNode, err := noise.NewNode()
+	check(err)
+	check(rNode.Listen())
+	return rNode
+}
+
+// Revises whether the error is not nil
+func check(err error) {
+	if err != nil {
+		panic(err)
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"github.com/gcubillos/isis-3007-distributed-ledger/data-structures/bitcoin-ng"
+	"github.com/gcubillos/isis-3007-distributed-ledger/data-structures/blockchain"
+	"github.com/gcubillos/isis-3007-distributed-ledger/data-structures/shared-components"
+	"math/rand"
+	"time"
+)
+
+// The following code tries to perform the tests regarding the metric of latency on the Bitcoin-NG data structure.
+// The initiation timestamp is taken when the microblock carrying the transaction is created.
+// The completion timestamp is taken when the microblock is part of the active chain of the receiving node
+
+func main() {
+
+	// Defining number of nodes to be present in the network additionally to the initial node
+	var numberNodes = 10
+
+	// Defining number of transactions to occur in the network
+	var numberTransactions = 10
+
+	// Defining the difficulty for the tests (number of leading zeroes required in the hash)
+	blockchain.Difficulty = 2
+
+	// Defining the amount of currency that will be available during the tests.
+	var availableCurrency = 10.0
+
+	// Create the first node in the network to have as a starting point
+	firstNode := bitcoinng.CreateInitialNode(bitcoinng.CreateGenesisBlock(), availableCurrency, components.HeaviestWorkThenLongest{})
+
+	// Array for keeping track of the nodes without having to ask the network
+	nodesNetwork := make([]*bitcoinng.NodeNG, 0)
+
+	// Create other nodes
+	for i := 0; i < numberNodes; i++ {
+		nodesNetwork = append(nodesNetwork, bitcoinng.CreateNode(firstNode.DataStructure, firstNode.Node))
+	}
+
+	// The first node becomes the leader, so that it creates the microblocks
+	keyBlock, err := firstNode.GenerateKeyBlock()
+	check(err)
+	fmt.Printf("key block mined in %v \n", time.Since(keyBlock.Timestamp))
+
+	// Creating seed for randomizing the receiver of transactions
+	rand.Seed(time.Now().UnixNano())
+
+	// Create transactions from the "main" account, as it is the only one that has funds at first
+	for j := 0; j < numberTransactions; j++ {
+		receiver := nodesNetwork[rand.Intn(len(nodesNetwork))]
+		exampleTransaction := components.CreateTransaction("main", "main", receiver.Node.Addr(), availableCurrency/float64(2*numberTransactions))
+		microblock, err := firstNode.GenerateMicroblock([]components.Transaction{exampleTransaction})
+		if err != nil {
+			fmt.Printf("the transaction couldn't be included: %v \n", err)
+			continue
+		}
+
+		// Wait until the receiving node has the microblock in its active chain
+		for !receiver.IsInActiveChain(microblock.Hash) {
+			time.Sleep(time.Millisecond)
+		}
+		fmt.Printf("latency of transaction %v: %v \n", j, time.Since(microblock.Timestamp))
+	}
+
+}
+
+// Revises whether the error is not nil
+func check(err error) {
+	if err != nil {
+		panic(err)
+	}
+}
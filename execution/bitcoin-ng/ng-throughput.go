@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"github.com/gcubillos/isis-3007-distributed-ledger/data-structures/bitcoin-ng"
+	"github.com/gcubillos/isis-3007-distributed-ledger/data-structures/blockchain"
+	"github.com/gcubillos/isis-3007-distributed-ledger/data-structures/shared-components"
+	"time"
+)
+
+// The following code tries to perform the tests regarding the metric of throughput on the Bitcoin-NG data structure.
+// The leader keeps creating microblocks during the test duration, and afterwards the other node mines a
+// key block on top of the last of them, which ends the epoch of the first leader. The throughput is the
+// number of transactions that reach the active chain of the other node over the duration of the test
+
+func main() {
+
+	// Defining the difficulty for the tests (number of leading zeroes required in the hash)
+	blockchain.Difficulty = 3
+
+	// Defining the duration of the test
+	var testDuration = 2 * time.Second
+
+	// Defining the number of transactions in each microblock
+	var transactionsPerMicroblock = 10
+
+	// Defining the amount of currency that will be available during the tests.
+	var availableCurrency = 1000.0
+
+	// Create the first node in the network to have as a starting point
+	firstNode := bitcoinng.CreateInitialNode(bitcoinng.CreateGenesisBlock(), availableCurrency, components.HeaviestWorkThenLongest{})
+
+	// Create other node
+	otherNode := bitcoinng.CreateNode(firstNode.DataStructure, firstNode.Node)
+
+	// The first node becomes the leader
+	_, err := firstNode.GenerateKeyBlock()
+	check(err)
+	time.Sleep(100 * time.Millisecond)
+
+	// Create microblocks while the first node is the leader
+	transactionList := make([]components.Transaction, transactionsPerMicroblock)
+	for i := range transactionList {
+		transactionList[i] = components.CreateTransaction("main", "main", otherNode.Node.Addr(), 0)
+	}
+	startingTime := time.Now()
+	microblocks := make([]bitcoinng.Block, 0)
+	for time.Since(startingTime) < testDuration {
+		if microblock, err := firstNode.GenerateMicroblock(transactionList); err == nil {
+			microblocks = append(microblocks, microblock)
+		}
+	}
+	duration := time.Since(startingTime)
+	time.Sleep(100 * time.Millisecond)
+
+	// The other node becomes the leader of the next epoch
+	keyBlock, err := otherNode.GenerateKeyBlock()
+	check(err)
+	fmt.Printf("key block of the other node mined in %v \n", time.Since(keyBlock.Timestamp))
+
+	// Count the microblocks that are part of the active chain of the other node
+	confirmed := 0
+	for _, v := range microblocks {
+		if otherNode.IsInActiveChain(v.Hash) {
+			confirmed++
+		}
+	}
+	fmt.Printf("The number of microblocks generated were: %v, of which %v are in the active chain \n", len(microblocks), confirmed)
+	fmt.Printf("Throughput: %v transactions per second \n", float64(confirmed*transactionsPerMicroblock)/duration.Seconds())
+}
+
+// Revises whether the error is not nil
+func check(err error) {
+	if err != nil {
+		panic(err)
+	}
+}
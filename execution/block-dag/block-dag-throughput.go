@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"github.com/gcubillos/isis-3007-distributed-ledger/data-structures/block-dag"
+	"github.com/gcubillos/isis-3007-distributed-ledger/data-structures/shared-components"
+	"time"
+)
+
+// The following code tries to perform the tests regarding the metric of throughput on the block DAG data structure.
+// Every node mines the same number of Blocks at the same time, so many of them are parallel, and the
+// throughput is the number of Blocks added to the DAG of the first node per second. The colouring shows
+// how many of the parallel Blocks GHOSTDAG accepts as blue for the chosen K
+
+func main() {
+
+	// Defining number of nodes to be present in the network additionally to the initial node
+	var numberNodes = 5
+
+	// Defining number of Blocks each node mines
+	var numberBlocks = 20
+
+	// Defining the difficulty for the tests (number of leading zeroes required in the hash)
+	blockdag.Difficulty = 2
+
+	// Defining the parameter of the k-cluster colouring
+	var k = 3
+
+	// Defining the amount of currency that will be available during the tests.
+	var availableCurrency = 10.0
+
+	// Create the first node in the network to have as a starting point
+	firstNode := blockdag.CreateInitialNode(availableCurrency, k)
+
+	// Array for keeping track of the nodes without having to ask the network
+	nodesNetwork := make([]*blockdag.NodeDAG, 0)
+
+	// Create other nodes
+	for i := 0; i < numberNodes; i++ {
+		nodesNetwork = append(nodesNetwork, blockdag.CreateNode(firstNode.DataStructure, firstNode.Node))
+	}
+
+	// Every node mines its Blocks concurrently
+	startingTime := time.Now()
+	for _, v := range nodesNetwork {
+		go func(pNode *blockdag.NodeDAG) {
+			for i := 0; i < numberBlocks; i++ {
+				exampleTransaction := components.CreateTransaction(pNode.Node.Addr(), pNode.Node.Addr(), firstNode.Node.Addr(), 0)
+				_, _ = pNode.GenerateBlock([]components.Transaction{exampleTransaction})
+			}
+		}(v)
+	}
+
+	// Wait until the first node has every Block, besides the genesis Block
+	expectedBlocks := numberNodes*numberBlocks + 1
+	for firstNode.NumberBlocks() < expectedBlocks {
+		time.Sleep(time.Millisecond)
+	}
+	elapsed := time.Since(startingTime)
+
+	blues, reds := firstNode.Colouring()
+	fmt.Printf("The number of blocks generated were: %v \n", expectedBlocks-1)
+	fmt.Printf("Time elapsed: %v \n", elapsed)
+	fmt.Printf("Throughput: %v blocks per second \n", float64(expectedBlocks-1)/elapsed.Seconds())
+	fmt.Printf("Blue blocks: %v Red blocks: %v \n", blues, reds)
+
+}
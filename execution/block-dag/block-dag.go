@@ -0,0 +1,48 @@
+package main
+
+import (
+	"fmt"
+	"github.com/gcubillos/isis-3007-distributed-ledger/data-structures/block-dag"
+	"github.com/gcubillos/isis-3007-distributed-ledger/data-structures/shared-components"
+	"time"
+)
+
+func main() {
+
+	// Defining parameters for simple execution
+
+	// Defining the difficulty for the tests (number of leading zeroes required in the hash)
+	blockdag.Difficulty = 1
+
+	// Defining the parameter of the k-cluster colouring
+	var k = 3
+
+	// Defining the amount of currency that will be available during the tests.
+	var availableCurrency = 10.0
+
+	// Create the first node in the network to have as a starting point
+	firstNode := blockdag.CreateInitialNode(availableCurrency, k)
+
+	fmt.Printf("Address first node %v \n", firstNode.Node.Addr())
+
+	// Create other node
+	otherNode := blockdag.CreateNode(firstNode.DataStructure, firstNode.Node)
+
+	fmt.Printf("Address other node %v \n", otherNode.Node.Addr())
+
+	// Both nodes spend the whole "main" account at the same time, so their Blocks are parallel.
+	// The order given by GHOSTDAG decides which of the transactions is accepted
+	go firstNode.GenerateBlock([]components.Transaction{components.CreateTransaction("main", "main", firstNode.Node.Addr(), availableCurrency)})
+	otherNode.GenerateBlock([]components.Transaction{components.CreateTransaction("main", "main", otherNode.Node.Addr(), availableCurrency)})
+	time.Sleep(100 * time.Millisecond)
+
+	// A Block that merges both of them
+	firstNode.GenerateBlock(make([]components.Transaction, 0))
+	time.Sleep(100 * time.Millisecond)
+
+	blues, reds := otherNode.Colouring()
+	fmt.Printf("blue blocks %v red blocks %v \n", blues, reds)
+	state, rejected := otherNode.State()
+	fmt.Printf("state of the other node %v \n", state)
+	fmt.Printf("rejected transactions %v \n", rejected)
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"fmt"
+	"github.com/gcubillos/isis-3007-distributed-ledger/data-structures/block-lattice"
+	"time"
+)
+
+func main() {
+
+	// Defining parameters for simple execution
+
+	// Defining the difficulty for the tests (number of leading zeroes required in the hash)
+	lattice.Difficulty = 1
+
+	// Defining the amount of currency that will be available during the tests.
+	// This is for the sake of simplicity, to have a fixed amount of currency
+	var availableCurrency = 10.0
+
+	// Create the first node in the network to have as a starting point
+	firstNode := lattice.CreateInitialNode(availableCurrency)
+
+	fmt.Printf("Address first node %v \n", firstNode.Node.Addr())
+
+	// Create other nodes
+	otherNode := lattice.CreateNode(firstNode.DataStructure, firstNode.Node)
+
+	fmt.Printf("Address other node %v \n", otherNode.Node.Addr())
+
+	// Send currency from the account of the first node to the other node, which receives it when the send block arrives
+	sendBlock, err := firstNode.Send(firstNode.Account(), otherNode.Account(), 1)
+	if err != nil {
+		panic(err)
+	}
+
+	// Wait for the other node to open its account
+	time.Sleep(time.Second)
+
+	receiveBlock, confirmation, ok := otherNode.ConfirmedReceive(sendBlock.Hash)
+	fmt.Printf("receive block %v \n confirmed %v at %v \n", receiveBlock, ok, confirmation)
+	fmt.Printf("send block %v confirmed %v \n", sendBlock.Hash, otherNode.IsConfirmed(sendBlock.Hash))
+
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"github.com/gcubillos/isis-3007-distributed-ledger/data-structures/block-lattice"
+	"math/rand"
+	"time"
+)
+
+// The following code tries to perform the tests regarding the metric of latency on the block-lattice data structure.
+// The initiation timestamp is taken when the send block (S) is created.
+// The completion timestamp is taken after the receive block (R) is confirmed.
+
+func main() {
+
+	// Defining number of nodes to be present in the network additionally to the initial node
+	var numberNodes = 5
+
+	// Defining number of transactions to occur in the network
+	var numberTransactions = 10
+
+	// Defining the difficulty for the tests (number of leading zeroes required in the hash)
+	lattice.Difficulty = 2
+
+	// Defining the amount of currency that will be available during the tests.
+	var availableCurrency = 10.0
+
+	// Create the first node in the network to have as a starting point
+	firstNode := lattice.CreateInitialNode(availableCurrency)
+
+	// Array for keeping track of the nodes without having to ask the network
+	nodesNetwork := make([]*lattice.NodeLattice, 0)
+
+	// Create other nodes
+	for i := 0; i < numberNodes; i++ {
+		nodesNetwork = append(nodesNetwork, lattice.CreateNode(firstNode.DataStructure, firstNode.Node))
+	}
+
+	// Creating seed for randomizing the receiver of transactions
+	rand.Seed(time.Now().UnixNano())
+
+	// Create transactions from the account of the first node, as it is the only one that has funds at first
+	for j := 0; j < numberTransactions; j++ {
+		receiver := nodesNetwork[rand.Intn(len(nodesNetwork))]
+		sendBlock, err := firstNode.Send(firstNode.Account(), receiver.Account(), availableCurrency/float64(2*numberTransactions))
+		if err != nil {
+			fmt.Printf("the send block couldn't be created: %v \n", err)
+			continue
+		}
+
+		// Wait until the receive block is confirmed by the receiving node
+		for {
+			if _, confirmation, ok := receiver.ConfirmedReceive(sendBlock.Hash); ok {
+				fmt.Printf("latency of transaction %v: %v \n", j, confirmation.Sub(sendBlock.Timestamp))
+				break
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+}
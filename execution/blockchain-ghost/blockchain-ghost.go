@@ -50,7 +50,7 @@ func main() {
 	}
 
 	// Create the first node in the network to have as a starting point
-	firstNode := ghost.CreateInitialNode(genesisBlock)
+	firstNode := ghost.CreateInitialNode(genesisBlock, components.GhostPaper{})
 
 	fmt.Printf("Address first node %v", firstNode.Node.Addr())
 
@@ -65,11 +65,11 @@ func main() {
 	transactionList := make([]components.Transaction, 1, 1)
 	transactionList[0] = exampleTransaction
 
-	theFirstBlock := ghost.GenerateBlock(firstNode,&genesisBlock, transactionList)
+	theFirstBlock := firstNode.GenerateBlock(&genesisBlock, transactionList)
 
-	secondBlock := ghost.GenerateBlock(firstNode,&theFirstBlock, transactionList)
+	secondBlock := firstNode.GenerateBlock(&theFirstBlock, transactionList)
 
-	ghost.GenerateBlock(firstNode,&secondBlock, transactionList)
+	firstNode.GenerateBlock(&secondBlock, transactionList)
 	// TODO: Check the order of the transactions and why is it being printed in current structure Initial Node
 
 	// Latency: Time it takes for the transaction to be accepted by the other nodes
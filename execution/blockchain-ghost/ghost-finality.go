@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	ghost "github.com/gcubillos/isis-3007-distributed-ledger/data-structures/blockchain-ghost"
+	"github.com/gcubillos/isis-3007-distributed-ledger/data-structures/shared-components"
+	"time"
+)
+
+func main() {
+
+	// Defining parameters for simple execution
+
+	// Defining the difficulty for the tests (number of leading zeroes required in the hash)
+	var definedDifficulty = 1
+
+	// Amount of currency available during the test, held by a "main" account
+	var availableCurrency = 100.0
+
+	// Number of nodes in the network, all of them validators with the same stake
+	var numberNodes = 4
+
+	// Number of Blocks mined on the current chain
+	var numberBlocks = 13
+
+	// The rewards can be spent by the next Block, so that the second Block can spend the reward of the first
+	components.CoinbaseMaturity = 1
+
+	genesisBlock := ghost.Block{
+		Timestamp:    time.Now().Round(0),
+		Transactions: make([]components.Transaction, 0),
+		RecentState:  make(map[string]*ghost.Account, 0),
+		Difficulty:   definedDifficulty,
+	}
+	mainAccount := ghost.CreateAccount("main")
+	mainAccount.Balance = availableCurrency
+	genesisBlock.RecentState[mainAccount.Address] = &mainAccount
+	ghost.MineBlock(&genesisBlock)
+
+	// Create the nodes and give each of them the same stake
+	nodes := []*ghost.NodeGhost{ghost.CreateInitialNode(genesisBlock, components.GhostPaper{})}
+	for i := 1; i < numberNodes; i++ {
+		nodes = append(nodes, ghost.GenerateNode(nodes[0].DataStructure, nodes[0].Node))
+	}
+	stakes := make(map[string]float64)
+	for _, v := range nodes {
+		stakes[v.Key()] = 10
+	}
+	for _, v := range nodes {
+		v.EnableFinality(stakes)
+	}
+	fmt.Printf("%v validators, checkpoints every %v Blocks \n", numberNodes, ghost.CheckpointInterval)
+
+	// The first node mines the Blocks, the validators vote as their chains reach each checkpoint
+	// The second Block carries a transaction spending the reward of the first one, whose confirmation
+	// is followed by the last node
+	exampleTransaction := components.CreateTransaction(nodes[0].Node.Addr(), nodes[0].Node.Addr(), nodes[numberNodes-1].Node.Addr(), 0.5)
+	parent := genesisBlock
+	for i := 0; i < numberBlocks; i++ {
+		transactions := make([]components.Transaction, 0)
+		if i == 1 {
+			transactions = append(transactions, exampleTransaction)
+		}
+		parent = nodes[0].GenerateBlock(&parent, transactions)
+		time.Sleep(100 * time.Millisecond)
+	}
+	for i, v := range nodes {
+		justified, finalized := v.Checkpoints()
+		fmt.Printf("node %v: last justified height %v, last finalized height %v \n", i, justified.Height, finalized.Height)
+	}
+	confirmation := nodes[numberNodes-1].Confirmation(exampleTransaction.ID())
+	fmt.Printf("transaction of the second Block: depth %v, final %v, accepted %v \n", confirmation.Depth, confirmation.Final, confirmation.IsAccepted())
+
+	// A longer branch starting at the genesis Block is sent to the last node. It would be chosen without
+	// the overlay, but it conflicts with the finalized checkpoint, so it is refused
+	attacker := ghost.CreateGhost(genesisBlock, components.GhostPaper{})
+	attackerParent := genesisBlock
+	for i := 0; i < 2*numberBlocks; i++ {
+		nBlock := attacker.CreateBlock(&attackerParent, "attacker", make([]components.Transaction, 0))
+		ghost.MineBlock(&nBlock)
+		check(attacker.AddBlock(nBlock))
+		attackerParent = nBlock
+	}
+	bytes, err := json.Marshal(attacker)
+	check(err)
+	last := nodes[numberNodes-1]
+	_, err = nodes[0].Node.Request(context.TODO(), last.Node.Addr(), bytes)
+	check(err)
+	fmt.Printf("branch of %v Blocks from the genesis Block sent, height of the current chain of the last node: %v \n",
+		2*numberBlocks, last.Height())
+
+	// The second node signs a vote for another Block at the height of a checkpoint it already voted
+	// for, and a vote whose link surrounds one of its previous votes. The last node detects both
+	offender := nodes[1]
+	genesisCheckpoint := ghost.Checkpoint{Hash: genesisBlock.Hash, Height: 0}
+	conflicting := []ghost.FinalityVote{
+		{Validator: offender.Key(), Source: genesisCheckpoint, Target: ghost.Checkpoint{Hash: attacker.CurrentChain[4].Hash, Height: 4}},
+		{Validator: offender.Key(), Source: genesisCheckpoint, Target: ghost.Checkpoint{Hash: attacker.CurrentChain[12].Hash, Height: 12}},
+	}
+	for i := range conflicting {
+		conflicting[i].Sign(func(pData []byte) string {
+			return offender.Node.Sign(pData).String()
+		})
+	}
+	bytes, err = json.Marshal(ghost.Ghost{Finality: &ghost.Finality{Votes: conflicting}})
+	check(err)
+	_, err = nodes[0].Node.Request(context.TODO(), last.Node.Addr(), bytes)
+	check(err)
+	for _, v := range last.Slashings() {
+		fmt.Printf("evidence of %v: %v -> %v and %v -> %v \n", v.Condition, v.First.Source.Height, v.First.Target.Height,
+			v.Second.Source.Height, v.Second.Target.Height)
+	}
+}
+
+// Revises whether the error is not nil
+func check(err error) {
+	if err != nil {
+		panic(err)
+	}
+}
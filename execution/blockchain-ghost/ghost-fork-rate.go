@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	ghost "github.com/gcubillos/isis-3007-distributed-ledger/data-structures/blockchain-ghost"
+	components "github.com/gcubillos/isis-3007-distributed-ledger/data-structures/shared-components"
+	"time"
+)
+
+// The following code measures the fork rate of GHOST for several difficulties. Every node mines in the
+// background on top of the tip chosen by the fork-choice rule, starting over each time it changes. The
+// fork rate is the fraction of the Blocks known by the first node that are outside its current chain.
+// A transaction submitted to one of the nodes is included by it in the next Block it mines
+
+func main() {
+
+	// Defining number of nodes to be present in the network additionally to the initial node
+	var numberNodes = 3
+
+	// Defining the difficulties to compare (number of leading zeroes required in the hash)
+	var difficulties = []int{2, 3, 4}
+
+	// Defining the time each difficulty runs
+	var duration = 4 * time.Second
+
+	// Defining the amount of currency that will be available during the tests
+	var availableCurrency = 1000000.0
+
+	results := make([]string, 0)
+	for _, difficulty := range difficulties {
+		// The account spending the transaction is funded in the genesis Block, the rewards are minted
+		genesisBlock := ghost.Block{
+			Timestamp:    time.Now().Round(0),
+			Transactions: make([]components.Transaction, 0),
+			RecentState:  make(map[string]*ghost.Account, 0),
+			Difficulty:   difficulty,
+		}
+		theAccount := ghost.CreateAccount("account")
+		theAccount.Balance = availableCurrency
+		genesisBlock.RecentState[theAccount.Address] = &theAccount
+		ghost.MineBlock(&genesisBlock)
+
+		firstNode := ghost.CreateInitialNode(genesisBlock, components.GhostPaper{})
+		nodesNetwork := []*ghost.NodeGhost{firstNode}
+		for i := 0; i < numberNodes; i++ {
+			nodesNetwork = append(nodesNetwork, ghost.GenerateNode(firstNode.DataStructure, firstNode.Node))
+		}
+
+		for _, v := range nodesNetwork {
+			v.StartMining()
+		}
+		exampleTransaction := components.CreateTransaction("account", "account", "destination", float64(difficulty))
+		nodesNetwork[1].SubmitTransaction(exampleTransaction)
+		time.Sleep(duration)
+		for _, v := range nodesNetwork {
+			v.StopMining()
+		}
+
+		// Blocks still travelling through the network are given some time to arrive
+		time.Sleep(500 * time.Millisecond)
+		mined := 0
+		for _, v := range nodesNetwork {
+			mined += v.BlocksMined()
+		}
+		height := firstNode.Height()
+		known := len(firstNode.DataStructure.Blocks) - 1
+		orphaned := known - height
+		results = append(results, fmt.Sprintf("difficulty %v: %v blocks mined, height %v, %v outside the current chain, fork rate %.3f, transaction at depth %v",
+			difficulty, mined, height, orphaned, float64(orphaned)/float64(known), firstNode.Confirmation(exampleTransaction.ID()).Depth))
+	}
+
+	for _, v := range results {
+		fmt.Println(v)
+	}
+}
@@ -54,7 +54,7 @@ func main() {
 	}
 
 	// Create the first node in the network to have as a starting point
-	firstNode := ghost.CreateInitialNode(genesisBlock)
+	firstNode := ghost.CreateInitialNode(genesisBlock, components.GhostPaper{})
 
 	fmt.Printf("Address first node %v", firstNode.Node.Addr())
 
@@ -53,7 +53,7 @@ func main() {
 	}
 
 	// Create the first node in the network to have as a starting point
-	firstNode := ghost.CreateInitialNode(genesisBlock)
+	firstNode := ghost.CreateInitialNode(genesisBlock, components.GhostPaper{})
 
 	// Create an additional node
 	otherNode := ghost.GenerateNode(firstNode.DataStructure, firstNode.Node)
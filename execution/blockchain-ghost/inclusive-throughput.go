@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	ghost "github.com/gcubillos/isis-3007-distributed-ledger/data-structures/blockchain-ghost"
+	components "github.com/gcubillos/isis-3007-distributed-ledger/data-structures/shared-components"
+	"strconv"
+	"time"
+)
+
+// The following code compares the throughput of GHOST with the one of the inclusive protocol.
+// The structures are used directly, without a network, so that both of them receive the same Blocks.
+// In every round several miners find a Block on top of the same tip, as happens when Blocks are found
+// faster than they propagate. Only one of them stays in the current chain, but with the inclusive
+// protocol the transactions of the others are counted as well
+
+func main() {
+
+	// Defining the difficulty for the tests (number of leading zeroes required in the hash)
+	var definedDifficulty = 2
+
+	// Defining the number of rounds and the number of Blocks found in parallel in each of them
+	var numberRounds = 50
+	var forkWidth = 3
+
+	// Defining the number of transactions in each Block
+	var transactionsPerBlock = 20
+
+	// Defining the amount of currency that will be available during the tests.
+	var availableCurrency = 1000.0
+
+	// Each miner spends from its own account, so that the Blocks of a round don't conflict
+	genesisBlock := ghost.Block{
+		Timestamp:    time.Now(),
+		Transactions: make([]components.Transaction, 0),
+		RecentState:  make(map[string]*ghost.Account, 0),
+		Difficulty:   definedDifficulty,
+	}
+	mainAccount := ghost.CreateAccount("main")
+	mainAccount.Balance = availableCurrency
+	genesisBlock.RecentState[mainAccount.Address] = &mainAccount
+	for i := 0; i < forkWidth; i++ {
+		theAccount := ghost.CreateAccount("account-" + strconv.Itoa(i))
+		theAccount.Balance = availableCurrency
+		genesisBlock.RecentState[theAccount.Address] = &theAccount
+	}
+	ghost.MineBlock(&genesisBlock)
+
+	for _, v := range []ghost.Ghost{ghost.CreateGhost(genesisBlock, components.GhostPaper{}), ghost.CreateInclusiveGhost(genesisBlock, components.GhostPaper{})} {
+		structure := v
+		startingTime := time.Now()
+		for round := 0; round < numberRounds; round++ {
+			tip, _ := structure.GetBlock(structure.CurrentChain[len(structure.CurrentChain)-1].Hash)
+			roundBlocks := make([]ghost.Block, 0, forkWidth)
+			for i := 0; i < forkWidth; i++ {
+				transactionList := make([]components.Transaction, transactionsPerBlock)
+				for j := range transactionList {
+					origin := "account-" + strconv.Itoa(i)
+					transactionList[j] = components.CreateTransaction(origin, origin, "account-"+strconv.Itoa((i+1)%forkWidth), 0.01)
+				}
+				newBlock := structure.CreateBlock(tip, "miner-"+strconv.Itoa(i), transactionList)
+				ghost.MineBlock(&newBlock)
+				roundBlocks = append(roundBlocks, newBlock)
+			}
+			for _, w := range roundBlocks {
+				if err := structure.AddBlock(w); err != nil {
+					fmt.Printf("the block couldn't be added: %v \n", err)
+				}
+			}
+		}
+		duration := time.Since(startingTime)
+
+		fmt.Printf("inclusive %v: %v blocks, %v in the current chain, %v transactions confirmed \n",
+			structure.Inclusive, len(structure.Blocks), len(structure.CurrentChain), structure.ConfirmedTransactions())
+		fmt.Printf("Throughput: %v transactions per second \n", float64(structure.ConfirmedTransactions())/duration.Seconds())
+	}
+}
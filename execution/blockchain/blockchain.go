@@ -33,7 +33,7 @@ func main() {
 	}
 
 	// Create the first node in the network to have as a starting point
-	firstNode := blockchain.CreateInitialNode(genesisBlock, availableCurrency)
+	firstNode := blockchain.CreateInitialNode(genesisBlock, availableCurrency, components.LongestChain{}, blockchain.ProofOfWork{})
 
 	// Create other nodes
 	otherNode := blockchain.CreateNode(firstNode.DataStructure, firstNode.Node)
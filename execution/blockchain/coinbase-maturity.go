@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"github.com/gcubillos/isis-3007-distributed-ledger/data-structures/blockchain"
+	"github.com/gcubillos/isis-3007-distributed-ledger/data-structures/shared-components"
+	"time"
+)
+
+// The following code shows the rewards minted by the coinbase of each block. The subsidy is halved at
+// every interval, so the currency created by the rewards approaches a limit instead of growing forever.
+// The first node mines in the background while a transaction spending more than its first reward is
+// submitted to it. The transaction is left pending until enough rewards of the node have matured
+
+func main() {
+
+	// Defining the difficulty for proof of work
+	blockchain.Difficulty = 2
+
+	// Defining the subsidy schedule, the initial subsidy is halved every interval of blocks
+	blockchain.Subsidy = components.HalvingSubsidy{Initial: 50, Interval: 10}
+
+	// Defining the number of blocks that must follow a reward before it can be spent
+	components.CoinbaseMaturity = 5
+
+	// Defining the number of blocks mined before stopping the miner
+	var numberBlocks = 60
+
+	// Defining the amount of currency that will be available during the tests
+	var availableCurrency = 100.0
+
+	// Creating the genesis block
+	genesisBlock := blockchain.Block{Timestamp: time.Now().Round(0), Transactions: make([]components.Transaction, 0)}
+	genesisBlock.Hash = blockchain.CalculateHash(genesisBlock)
+
+	// Create the first node in the network and another node receiving the transaction
+	firstNode := blockchain.CreateInitialNode(genesisBlock, availableCurrency, components.LongestChain{}, blockchain.ProofOfWork{})
+	otherNode := blockchain.CreateNode(firstNode.DataStructure, firstNode.Node)
+
+	// The first node has no currency in the genesis block, so the transaction needs two of its rewards
+	exampleTransaction := components.CreateTransaction(firstNode.Node.Addr(), firstNode.Node.Addr(), otherNode.Node.Addr(), 60)
+	firstNode.SubmitTransaction(exampleTransaction)
+	firstNode.StartMining()
+	for firstNode.Confirmation(exampleTransaction.ID()).Depth == 0 {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// The miner is stopped while the chain is read, and started again afterwards
+	firstNode.StopMining()
+	confirmation := firstNode.Confirmation(exampleTransaction.ID())
+	fmt.Printf("transaction included at height %v, maturity %v blocks, balance of the other node %v \n",
+		len(firstNode.DataStructure.Blocks)-confirmation.Depth, components.CoinbaseMaturity, firstNode.Balance(otherNode.Node.Addr()))
+	firstNode.StartMining()
+	for firstNode.BlocksMined() < numberBlocks {
+		time.Sleep(10 * time.Millisecond)
+	}
+	firstNode.StopMining()
+
+	// The currency in the state is the one of the genesis block plus the subsidies of the active chain
+	height := len(firstNode.DataStructure.Blocks) - 1
+	expected := availableCurrency
+	for i := 1; i <= height; i++ {
+		expected += blockchain.Subsidy.Subsidy(i)
+	}
+	supply := 0.0
+	for _, v := range firstNode.DataStructure.State {
+		supply += v
+	}
+	for i := 0; i <= height; i += 10 {
+		fmt.Printf("subsidy at height %v: %v \n", i, blockchain.Subsidy.Subsidy(i))
+	}
+	fmt.Printf("height %v: supply %v, expected %v, limit %v \n", height, supply, expected, availableCurrency+2*50*10)
+}
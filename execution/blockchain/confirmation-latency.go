@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"github.com/gcubillos/isis-3007-distributed-ledger/data-structures/blockchain"
+	"github.com/gcubillos/isis-3007-distributed-ledger/data-structures/shared-components"
+	"sort"
+	"time"
+)
+
+// The following code measures the latency of a transaction until it is accepted, as defined by the
+// confirmations: it is in a block of the active chain that an attacker with the attacker fraction replaces
+// with a probability no higher than the acceptance risk. It is compared with the latency until the
+// transaction is first included in the active chain of the receiving node.
+// The initiation timestamp is taken when the first node starts creating the block carrying the transaction,
+// which keeps mining blocks until the receiving node accepts it
+
+func main() {
+
+	// Defining number of nodes to be present in the network additionally to the initial node
+	var numberNodes = 3
+
+	// Defining number of transactions to occur in the network
+	var numberTransactions = 5
+
+	// Defining the difficulty for proof of work
+	blockchain.Difficulty = 3
+
+	// Defining the amount of currency that will be available during the tests
+	var availableCurrency = 100.0
+
+	// Creating the genesis block
+	genesisBlock := blockchain.Block{Timestamp: time.Now().Round(0), Transactions: make([]components.Transaction, 0)}
+	genesisBlock.Hash = blockchain.CalculateHash(genesisBlock)
+
+	// Create the first node in the network and the other nodes
+	firstNode := blockchain.CreateInitialNode(genesisBlock, availableCurrency, components.LongestChain{}, blockchain.ProofOfWork{})
+	nodesNetwork := make([]*blockchain.NodeBlockchain, 0)
+	for i := 0; i < numberNodes; i++ {
+		nodesNetwork = append(nodesNetwork, blockchain.CreateNode(firstNode.DataStructure, firstNode.Node))
+	}
+	receiver := nodesNetwork[numberNodes-1]
+
+	fmt.Printf("attacker fraction %v, acceptance risk %v \n", components.AttackerFraction, components.AcceptanceRisk)
+	included := make([]time.Duration, 0)
+	accepted := make([]time.Duration, 0)
+	for j := 0; j < numberTransactions; j++ {
+		exampleTransaction := components.CreateTransaction("main", "main", receiver.Node.Addr(), 1)
+		startingTime := time.Now()
+		firstNode.GenerateBlock(firstNode.LastBlock(), []components.Transaction{exampleTransaction})
+
+		// The first node keeps extending its chain until the receiving node accepts the transaction
+		var confirmation components.Confirmation
+		for confirmation = receiver.Confirmation(exampleTransaction.ID()); !confirmation.IsAccepted(); confirmation = receiver.Confirmation(exampleTransaction.ID()) {
+			if confirmation.Depth > 0 && len(included) == j {
+				included = append(included, time.Since(startingTime))
+			}
+			firstNode.GenerateBlock(firstNode.LastBlock(), make([]components.Transaction, 0))
+			time.Sleep(time.Millisecond)
+		}
+		accepted = append(accepted, time.Since(startingTime))
+		fmt.Printf("transaction %v: accepted at depth %v, safety %.6f \n", j, confirmation.Depth, confirmation.Safety)
+	}
+
+	sort.Slice(included, func(i, k int) bool { return included[i] < included[k] })
+	sort.Slice(accepted, func(i, k int) bool { return accepted[i] < accepted[k] })
+	fmt.Printf("median latency until included %v, until accepted %v \n", included[len(included)/2], accepted[len(accepted)/2])
+}
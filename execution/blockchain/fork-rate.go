@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"github.com/gcubillos/isis-3007-distributed-ledger/data-structures/blockchain"
+	"github.com/gcubillos/isis-3007-distributed-ledger/data-structures/shared-components"
+	"time"
+)
+
+// The following code measures the fork rate of the longest chain rule for several difficulties. Every
+// node mines in the background on top of its own active chain, starting over each time the tip changes,
+// so the lower the difficulty the more often two nodes find a block before hearing about each other's.
+// The fork rate is the fraction of the blocks known by the first node that ended up outside its active
+// chain. Halfway through, the mining of the first node is paused for a while, and the transactions
+// submitted to the nodes are included by whichever node mines the next block
+
+func main() {
+
+	// Defining number of nodes to be present in the network additionally to the initial node
+	var numberNodes = 3
+
+	// Defining the difficulties to compare (number of leading zeroes required in the hash)
+	var difficulties = []int{2, 3, 4}
+
+	// Defining the time each difficulty runs
+	var duration = 4 * time.Second
+
+	// Defining the amount of currency that will be available during the tests
+	var availableCurrency = 1000000.0
+
+	results := make([]string, 0)
+	for _, difficulty := range difficulties {
+		blockchain.Difficulty = difficulty
+		genesisBlock := blockchain.Block{Timestamp: time.Now().Round(0), Transactions: make([]components.Transaction, 0)}
+		genesisBlock.Hash = blockchain.CalculateHash(genesisBlock)
+		firstNode := blockchain.CreateInitialNode(genesisBlock, availableCurrency, components.LongestChain{}, blockchain.ProofOfWork{})
+		nodesNetwork := []*blockchain.NodeBlockchain{firstNode}
+		for i := 0; i < numberNodes; i++ {
+			nodesNetwork = append(nodesNetwork, blockchain.CreateNode(firstNode.DataStructure, firstNode.Node))
+		}
+
+		for _, v := range nodesNetwork {
+			v.StartMining()
+		}
+		exampleTransaction := components.CreateTransaction("main", "main", nodesNetwork[numberNodes].Node.Addr(), float64(difficulty))
+		nodesNetwork[1].SubmitTransaction(exampleTransaction)
+
+		time.Sleep(duration / 2)
+		firstNode.PauseMining()
+		fmt.Printf("difficulty %v: first node %v, %v blocks mined \n", difficulty, firstNode.MiningState(), firstNode.BlocksMined())
+		time.Sleep(duration / 4)
+		firstNode.StartMining()
+		time.Sleep(duration / 4)
+		for _, v := range nodesNetwork {
+			v.StopMining()
+		}
+
+		// Blocks still travelling through the network are given some time to arrive
+		time.Sleep(500 * time.Millisecond)
+		mined := 0
+		for _, v := range nodesNetwork {
+			mined += v.BlocksMined()
+		}
+		height := len(firstNode.DataStructure.Blocks) - 1
+		orphaned := firstNode.DataStructure.CountOrphanedBlocks()
+		results = append(results, fmt.Sprintf("difficulty %v: %v blocks mined, height %v, %v orphaned, fork rate %.3f, transaction at depth %v",
+			difficulty, mined, height, orphaned, float64(orphaned)/float64(height+orphaned), firstNode.Confirmation(exampleTransaction.ID()).Depth))
+	}
+
+	for _, v := range results {
+		fmt.Println(v)
+	}
+}
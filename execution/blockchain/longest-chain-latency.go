@@ -47,11 +47,11 @@ func main() {
 	blockchain.Difficulty = definedDifficulty
 
 	// Create the first node in the network to have as a starting point
-	firstNode := blockchain.CreateInitialNode(genesisBlock, availableCurrency)
+	firstNode := blockchain.CreateInitialNode(genesisBlock, availableCurrency, components.LongestChain{}, blockchain.ProofOfWork{})
 
 	// Array for keeping track of the nodes' addresses without having to ask the network
-	var nodesNetwork []blockchain.NodeBlockchain
-	nodesNetwork = make([]blockchain.NodeBlockchain, 0)
+	var nodesNetwork []*blockchain.NodeBlockchain
+	nodesNetwork = make([]*blockchain.NodeBlockchain, 0)
 
 	// Create other nodes
 	for i := 0; i < numberNodes; i++ {
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"github.com/gcubillos/isis-3007-distributed-ledger/data-structures/blockchain"
+	"github.com/gcubillos/isis-3007-distributed-ledger/data-structures/shared-components"
+	"math/rand"
+	"sort"
+	"time"
+)
+
+// The following code compares the latency of proof of stake with the one of proof of work, under both fork-choice rules.
+// The initiation timestamp is taken when the first node starts creating the block carrying the transaction.
+// The completion timestamp is taken when the block is part of the active chain of the receiving node.
+// With proof of work the node has to mine the block, while with proof of stake it has to wait for a slot
+// it is selected for, every node having the same stake
+
+func main() {
+
+	// Defining number of nodes to be present in the network additionally to the initial node
+	var numberNodes = 3
+
+	// Defining number of transactions to occur in the network for each configuration
+	var numberTransactions = 10
+
+	// Defining the difficulty for proof of work and the duration of the slots for proof of stake
+	blockchain.Difficulty = 4
+	blockchain.SlotDuration = 20 * time.Millisecond
+
+	// Defining the amount of currency that will be available during the tests.
+	var availableCurrency = 100.0
+
+	// Creating seed for randomizing the receiver of transactions
+	rand.Seed(time.Now().UnixNano())
+
+	results := make([]string, 0)
+	for _, consensus := range []blockchain.Consensus{blockchain.ProofOfWork{}, blockchain.ProofOfStake{}} {
+		for _, forkChoice := range []components.ForkChoice{components.LongestChain{}, components.HeaviestWork{}} {
+			// Creating the genesis block
+			genesisBlock := blockchain.Block{Timestamp: time.Now().Round(0), Transactions: make([]components.Transaction, 0)}
+			genesisBlock.Hash = blockchain.CalculateHash(genesisBlock)
+
+			// Create the first node in the network and the other nodes
+			firstNode := blockchain.CreateInitialNode(genesisBlock, availableCurrency, forkChoice, consensus)
+			nodesNetwork := make([]*blockchain.NodeBlockchain, 0)
+			for i := 0; i < numberNodes; i++ {
+				nodesNetwork = append(nodesNetwork, blockchain.CreateNode(firstNode.DataStructure, firstNode.Node))
+			}
+
+			// With proof of stake, every node stakes the same as the first one
+			if _, ok := consensus.(blockchain.ProofOfStake); ok {
+				stakeTransactions := make([]components.Transaction, 0)
+				for _, v := range nodesNetwork {
+					stakeTransactions = append(stakeTransactions, components.CreateTransaction("main", "main", blockchain.StakeAccount(v.ValidatorKey()), blockchain.InitialStake))
+				}
+				firstNode.GenerateBlock(genesisBlock, stakeTransactions)
+				time.Sleep(100 * time.Millisecond)
+			}
+
+			// Create transactions from the "main" account, as it is the only one that has funds at first
+			latencies := make([]time.Duration, 0)
+			for j := 0; j < numberTransactions; j++ {
+				receiver := nodesNetwork[rand.Intn(len(nodesNetwork))]
+				exampleTransaction := components.CreateTransaction("main", "main", receiver.Node.Addr(), 1)
+				startingTime := time.Now()
+				newBlock := firstNode.GenerateBlock(firstNode.LastBlock(), []components.Transaction{exampleTransaction})
+
+				// Wait until the receiving node has the block in its active chain
+				for !receiver.IsInActiveChain(newBlock.Hash) {
+					time.Sleep(time.Millisecond)
+				}
+				latencies = append(latencies, time.Since(startingTime))
+			}
+			sort.Slice(latencies, func(i, k int) bool { return latencies[i] < latencies[k] })
+			results = append(results, fmt.Sprintf("%v with %v: median latency %v, maximum %v",
+				consensus.Name(), forkChoice.Name(), latencies[len(latencies)/2], latencies[len(latencies)-1]))
+		}
+	}
+
+	for _, v := range results {
+		fmt.Println(v)
+	}
+}
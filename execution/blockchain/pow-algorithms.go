@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/gcubillos/isis-3007-distributed-ledger/data-structures/blockchain"
+	"github.com/gcubillos/isis-3007-distributed-ledger/data-structures/shared-components"
+	"sync"
+	"time"
+)
+
+// The following code compares the proof of work functions when several nodes mine at the same time on
+// the same machine. For each function and number of nodes, every node keeps mining on the tip of its
+// active chain for the same amount of time. The block interval is taken from the active chain of the
+// first node, along with the hash rate of the nodes. A node stops mining a block as soon as the tip of
+// its active chain changes
+
+func main() {
+
+	// Defining the numbers of nodes mining at the same time
+	var numberNodes = []int{1, 4}
+
+	// Defining the time each configuration runs
+	var duration = 5 * time.Second
+
+	// Defining the difficulty for the tests (number of leading zeroes required in the hash)
+	blockchain.Difficulty = 2
+
+	// Defining the amount of currency that will be available during the tests
+	var availableCurrency = 1000000.0
+
+	results := make([]string, 0)
+	for _, algorithm := range []components.ProofOfWorkHash{components.SHA256{}, components.SHA256d{}, components.Scratchpad{}} {
+		// Time of a single hash, without other nodes running
+		startingTime := time.Now()
+		for i := 0; i < 100; i++ {
+			algorithm.Sum([]byte(fmt.Sprint(i)))
+		}
+		fmt.Printf("%v: %v per hash \n", algorithm.Name(), time.Since(startingTime)/100)
+
+		for _, n := range numberNodes {
+			// The genesis block records the function used by the network
+			genesisBlock := blockchain.Block{Timestamp: time.Now().Round(0), Transactions: make([]components.Transaction, 0), Algorithm: algorithm.Name()}
+			genesisBlock.Hash = blockchain.CalculateHash(genesisBlock)
+			firstNode := blockchain.CreateInitialNode(genesisBlock, availableCurrency, components.LongestChain{}, blockchain.ProofOfWork{})
+			nodesNetwork := []*blockchain.NodeBlockchain{firstNode}
+			for i := 1; i < n; i++ {
+				nodesNetwork = append(nodesNetwork, blockchain.CreateNode(firstNode.DataStructure, firstNode.Node))
+			}
+
+			// Every node mines until the time is over
+			ctx, cancel := context.WithTimeout(context.Background(), duration)
+			var wg sync.WaitGroup
+			for _, v := range nodesNetwork {
+				wg.Add(1)
+				go func(pNode *blockchain.NodeBlockchain) {
+					defer wg.Done()
+					for ctx.Err() == nil {
+						_, _ = pNode.GenerateBlockContext(ctx, pNode.LastBlock(), make([]components.Transaction, 0))
+					}
+				}(v)
+			}
+			wg.Wait()
+			cancel()
+
+			height := len(firstNode.DataStructure.Blocks) - 1
+			// The hash rate of a node only covers the time it spent mining, while the hashes per second of
+			// the whole run show how the nodes share the machine
+			hashRate, hashes := 0.0, 0
+			for _, v := range nodesNetwork {
+				hashRate += v.HashRate()
+				hashes += v.Mining.Hashes
+			}
+			interval := time.Duration(0)
+			if height > 0 {
+				interval = duration / time.Duration(height)
+			}
+			results = append(results, fmt.Sprintf("%v with %v nodes: %v blocks, interval %v, %v orphaned, per node %.0f hashes/s while mining and %.0f over the run",
+				algorithm.Name(), n, height, interval, firstNode.DataStructure.CountOrphanedBlocks(), hashRate/float64(n),
+				float64(hashes)/duration.Seconds()/float64(n)))
+		}
+	}
+
+	for _, v := range results {
+		fmt.Println(v)
+	}
+}
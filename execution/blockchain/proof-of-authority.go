@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"github.com/gcubillos/isis-3007-distributed-ledger/data-structures/blockchain"
+	"github.com/gcubillos/isis-3007-distributed-ledger/data-structures/shared-components"
+	"github.com/perlin-network/noise"
+	"time"
+)
+
+// The following code shows how the authorities of proof of authority take turns to sign blocks. When
+// the authority in turn is late, another one signs out of turn, but the block signed in turn is
+// preferred if it arrives. An authority that signed too recently can't sign the next block
+
+func main() {
+
+	// Defining parameters for simple execution
+
+	// Defining number of authorities
+	var numberAuthorities = 3
+
+	// Defining the amount of currency that will be available during the tests.
+	var availableCurrency = 100.0
+
+	// Generating the keys of the authorities, so that the set is known from the start
+	engine := blockchain.ProofOfAuthority{Period: 100 * time.Millisecond}
+	privateKeys := make([]noise.PrivateKey, 0)
+	for i := 0; i < numberAuthorities; i++ {
+		publicKey, privateKey, err := noise.GenerateKeys(nil)
+		check(err)
+		engine.Authorities = append(engine.Authorities, publicKey.String())
+		privateKeys = append(privateKeys, privateKey)
+	}
+
+	// Creating the genesis block. Signed blocks don't need proof of work
+	genesisBlock := blockchain.Block{Timestamp: time.Now().Round(0), Transactions: make([]components.Transaction, 0)}
+	genesisBlock.Hash = blockchain.CalculateHash(genesisBlock)
+
+	// Create the first node in the network, which doesn't sign blocks, and the nodes of the authorities
+	firstNode := blockchain.CreateInitialNode(genesisBlock, availableCurrency, components.HeaviestWork{}, engine)
+	authorities := make([]*blockchain.NodeBlockchain, 0)
+	for _, v := range privateKeys {
+		authorities = append(authorities, blockchain.CreateAuthorityNode(firstNode.DataStructure, firstNode.Node, v))
+	}
+	nodesNetwork := append([]*blockchain.NodeBlockchain{firstNode}, authorities...)
+	authorityAt := func(pKey string) int {
+		for i, v := range authorities {
+			if v.ValidatorKey() == pKey {
+				return i
+			}
+		}
+		return -1
+	}
+
+	// Each authority signs the blocks of its turn
+	for height := 1; height <= 2*numberAuthorities; height++ {
+		signer := authorities[authorityAt(engine.InTurn(height))]
+		newBlock := signer.GenerateBlock(signer.LastBlock(), nil)
+		waitForBlock(nodesNetwork, newBlock)
+		fmt.Printf("block at height %v signed in turn by authority %v, difficulty %v \n", newBlock.Slot, authorityAt(newBlock.Producer), newBlock.Difficulty)
+	}
+
+	// The authority in turn is late, so the next one signs out of turn
+	parent := firstNode.LastBlock()
+	inTurn := authorityAt(engine.InTurn(parent.Slot + 1))
+	outOfTurn := authorities[(inTurn+1)%numberAuthorities]
+	startingTime := time.Now()
+	outOfTurnBlock := outOfTurn.GenerateBlock(parent, nil)
+	waitForBlock(nodesNetwork, outOfTurnBlock)
+	fmt.Printf("block at height %v signed out of turn by authority %v after %v, difficulty %v \n", outOfTurnBlock.Slot, authorityAt(outOfTurnBlock.Producer), time.Since(startingTime), outOfTurnBlock.Difficulty)
+
+	// The block of the authority in turn arrives afterwards and replaces it
+	inTurnBlock := authorities[inTurn].GenerateBlock(parent, nil)
+	waitForBlock(nodesNetwork, inTurnBlock)
+	fmt.Printf("block at height %v signed in turn by authority %v replaces it: %v \n", inTurnBlock.Slot, inTurn, !firstNode.IsInActiveChain(outOfTurnBlock.Hash))
+
+	// The authority that signed the last block can't sign the next one
+	tooSoonBlock := authorities[inTurn].GenerateBlock(inTurnBlock, nil)
+	fmt.Printf("authority %v signing two blocks in a row is accepted: %v \n", inTurn, authorities[inTurn].IsInActiveChain(tooSoonBlock.Hash))
+}
+
+// Wait until the block is part of the active chain of every node
+func waitForBlock(pNodes []*blockchain.NodeBlockchain, pBlock blockchain.Block) {
+	for _, v := range pNodes {
+		for !v.IsInActiveChain(pBlock.Hash) {
+			time.Sleep(time.Millisecond)
+		}
+	}
+}
+
+// Revises whether the error is not nil
+func check(err error) {
+	if err != nil {
+		panic(err)
+	}
+}
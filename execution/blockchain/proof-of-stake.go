@@ -0,0 +1,47 @@
+package main
+
+import (
+	"fmt"
+	"github.com/gcubillos/isis-3007-distributed-ledger/data-structures/blockchain"
+	"github.com/gcubillos/isis-3007-distributed-ledger/data-structures/shared-components"
+	"time"
+)
+
+// The following code shows how a validator that signs two blocks for the same slot is slashed
+
+func main() {
+
+	// Defining parameters for simple execution
+
+	// Defining the amount of currency that will be available during the tests.
+	var availableCurrency = 100.0
+
+	// Creating the genesis block. Signed blocks don't need proof of work
+	genesisBlock := blockchain.Block{Timestamp: time.Now().Round(0), Transactions: make([]components.Transaction, 0)}
+	genesisBlock.Hash = blockchain.CalculateHash(genesisBlock)
+
+	// Create the first node in the network, the first validator
+	firstNode := blockchain.CreateInitialNode(genesisBlock, availableCurrency, components.LongestChain{}, blockchain.ProofOfStake{})
+
+	// Create other node
+	otherNode := blockchain.CreateNode(firstNode.DataStructure, firstNode.Node)
+
+	// The other node becomes a validator with the same stake as the first one
+	stakeTransaction := components.CreateTransaction("main", "main", blockchain.StakeAccount(otherNode.ValidatorKey()), blockchain.InitialStake)
+	stakeBlock := firstNode.GenerateBlock(genesisBlock, []components.Transaction{stakeTransaction})
+	time.Sleep(100 * time.Millisecond)
+	fmt.Printf("stake of the other node %v \n", otherNode.Balance(blockchain.StakeAccount(otherNode.ValidatorKey())))
+
+	// The first node signs two different blocks on top of the same parent, which end up in the same slot
+	go firstNode.GenerateBlock(stakeBlock, []components.Transaction{components.CreateTransaction("main", "main", firstNode.Node.Addr(), 1)})
+	firstNode.GenerateBlock(stakeBlock, []components.Transaction{components.CreateTransaction("main", "main", otherNode.Node.Addr(), 1)})
+	time.Sleep(100 * time.Millisecond)
+
+	// The next block of the other node includes the equivocation, which slashes the stake of the first node
+	firstStake := blockchain.StakeAccount(firstNode.ValidatorKey())
+	fmt.Printf("stake of the first node before the slashing %v \n", otherNode.Balance(firstStake))
+	slashingBlock := otherNode.GenerateBlock(otherNode.LastBlock(), make([]components.Transaction, 0))
+	time.Sleep(100 * time.Millisecond)
+	fmt.Printf("equivocations included %v \n", len(slashingBlock.Slashings))
+	fmt.Printf("stake of the first node after the slashing %v \n", otherNode.Balance(firstStake))
+}
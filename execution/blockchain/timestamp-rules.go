@@ -0,0 +1,91 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/gcubillos/isis-3007-distributed-ledger/data-structures/blockchain"
+	"github.com/gcubillos/isis-3007-distributed-ledger/data-structures/shared-components"
+	"time"
+)
+
+// The following code shows the rules on the timestamps of the blocks. The hash doesn't change when a
+// block is sent, whatever the location of its timestamp. Blocks whose timestamp isn't after the median
+// time past are refused, even when it is only slightly before the one of their parent. Finally, the clock
+// of a node whose local clock is wrong is adjusted with the time reported by its peers, unless it is so
+// wrong that the offset is ignored, in which case its blocks are too far in the future for the others
+
+func main() {
+
+	// Defining number of nodes to be present in the network additionally to the initial node
+	var numberNodes = 4
+
+	// Defining the difficulty for proof of work
+	blockchain.Difficulty = 2
+
+	// Defining the amount of currency that will be available during the tests
+	var availableCurrency = 1000000.0
+
+	// Defining the error of the local clocks of the skewed nodes, within and beyond the maximum adjustment
+	var smallSkew = 30 * time.Minute
+	var largeSkew = 3 * time.Hour
+
+	// Creating the genesis block
+	genesisBlock := blockchain.Block{Timestamp: time.Now(), Transactions: make([]components.Transaction, 0)}
+	genesisBlock.Hash = blockchain.CalculateHash(genesisBlock)
+
+	// The hash is the same once the block is received
+	var receivedBlock blockchain.Block
+	bytes, err := json.Marshal(genesisBlock)
+	if err == nil {
+		err = json.Unmarshal(bytes, &receivedBlock)
+	}
+	fmt.Printf("hash kept after sending the block: %v \n", err == nil && blockchain.CalculateHash(receivedBlock) == genesisBlock.Hash)
+
+	// Create the first node in the network and the other nodes
+	firstNode := blockchain.CreateInitialNode(genesisBlock, availableCurrency, components.LongestChain{}, blockchain.ProofOfWork{})
+	nodesNetwork := []*blockchain.NodeBlockchain{firstNode}
+	for i := 0; i < numberNodes; i++ {
+		nodesNetwork = append(nodesNetwork, blockchain.CreateNode(firstNode.DataStructure, firstNode.Node))
+	}
+
+	// A block between its parent and the median time past of the chain is accepted, while one at the
+	// median time past is refused
+	for i := 0; i < 4; i++ {
+		firstNode.GenerateBlock(firstNode.LastBlock(), make([]components.Transaction, 0))
+	}
+	time.Sleep(200 * time.Millisecond)
+	tip := firstNode.LastBlock()
+	medianTime := firstNode.DataStructure.MedianTimePast(tip)
+	lateBlock := blockchain.Block{
+		Timestamp:    medianTime.Add(tip.Timestamp.Sub(medianTime) / 2),
+		Transactions: []components.Transaction{components.CreateCoinbase(firstNode.Node.Addr(), blockchain.Subsidy.Subsidy(len(firstNode.DataStructure.Blocks)), len(firstNode.DataStructure.Blocks))},
+		PrevHash:     tip.Hash,
+		Difficulty:   blockchain.Difficulty,
+	}
+	for lateBlock.Hash = blockchain.CalculateHash(lateBlock); !blockchain.IsHashValid(lateBlock.Hash, lateBlock.Difficulty); lateBlock.Hash = blockchain.CalculateHash(lateBlock) {
+		lateBlock.Nonce++
+	}
+	earlyBlock := lateBlock
+	earlyBlock.Timestamp = medianTime
+	for earlyBlock.Hash = blockchain.CalculateHash(earlyBlock); !blockchain.IsHashValid(earlyBlock.Hash, earlyBlock.Difficulty); earlyBlock.Hash = blockchain.CalculateHash(earlyBlock) {
+		earlyBlock.Nonce++
+	}
+	for _, v := range []blockchain.Block{lateBlock, earlyBlock} {
+		ok, err := firstNode.DataStructure.IsBlockValid(v, tip)
+		fmt.Printf("block %v before its parent, %v after the median time past: valid %v %v \n", tip.Timestamp.Sub(v.Timestamp), v.Timestamp.Sub(medianTime), ok, err)
+	}
+
+	// The skewed nodes learn the time of their peers when they answer their first block. The first node is
+	// connected to every other node, while the others are only connected to it, so the clock of the first
+	// node can be adjusted while the one of the others never moves
+	for i, v := range []*blockchain.NodeBlockchain{firstNode, nodesNetwork[1]} {
+		skew := []time.Duration{smallSkew, largeSkew}[i]
+		v.DataStructure.Clock.SetSkew(skew)
+		v.GenerateBlock(v.LastBlock(), make([]components.Transaction, 0))
+		time.Sleep(200 * time.Millisecond)
+		newBlock := v.GenerateBlock(v.LastBlock(), make([]components.Transaction, 0))
+		time.Sleep(200 * time.Millisecond)
+		fmt.Printf("skew %v: offset %v, block accepted by the last node %v \n",
+			skew, v.DataStructure.Clock.Offset().Round(time.Minute), nodesNetwork[numberNodes].IsInActiveChain(newBlock.Hash))
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"github.com/gcubillos/isis-3007-distributed-ledger/data-structures/hotstuff"
+	"github.com/gcubillos/isis-3007-distributed-ledger/data-structures/shared-components"
+	"time"
+)
+
+// The following code tries to perform the tests regarding the metric of throughput on the HotStuff data structure.
+// Batches of transactions are submitted to the replicas during the test duration, and the leaders order
+// them in blocks. The throughput is the number of transactions final in the last replica over the
+// duration of the test
+
+func main() {
+
+	// Defining number of replicas in the validator set, which tolerates (numberReplicas-1)/3 faulty replicas
+	var numberReplicas = 4
+
+	// Defining the duration of the test
+	var testDuration = 2 * time.Second
+
+	// Defining the number of transactions in each batch submitted
+	var transactionsPerBatch = 10
+
+	// Defining the amount of currency that will be available during the tests.
+	var availableCurrency = 1000.0
+
+	// Create the replicas with the same genesis block, then start them with the validator set
+	genesisBlock := hotstuff.CreateGenesisBlock()
+	replicas := make([]*hotstuff.NodeHotStuff, 0)
+	validators := make([]hotstuff.Validator, 0)
+	for i := 0; i < numberReplicas; i++ {
+		replica := hotstuff.CreateNode(genesisBlock, availableCurrency)
+		replicas = append(replicas, replica)
+		validators = append(validators, replica.Validator())
+	}
+	for _, v := range replicas {
+		v.Start(validators)
+	}
+	lastReplica := replicas[len(replicas)-1]
+
+	// Submit batches of transactions during the test
+	submitted := make([]components.Transaction, 0)
+	startingTime := time.Now()
+	for i := 0; time.Since(startingTime) < testDuration; i++ {
+		transactionList := make([]components.Transaction, transactionsPerBatch)
+		for j := range transactionList {
+			transactionList[j] = components.CreateTransaction("main", "main", lastReplica.Node.Addr(), 0)
+		}
+		replicas[i%len(replicas)].Submit(transactionList)
+		submitted = append(submitted, transactionList...)
+		time.Sleep(time.Millisecond)
+	}
+	duration := time.Since(startingTime)
+
+	// Count the transactions final in the last replica
+	confirmed := 0
+	for _, v := range submitted {
+		if lastReplica.IsTransactionCommitted(v) {
+			confirmed++
+		}
+	}
+	fmt.Printf("The number of transactions submitted were: %v, of which %v are final in %v blocks \n", len(submitted), confirmed, lastReplica.Height()-1)
+	fmt.Printf("Throughput: %v transactions per second \n", float64(confirmed)/duration.Seconds())
+}
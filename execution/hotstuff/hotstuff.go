@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"github.com/gcubillos/isis-3007-distributed-ledger/data-structures/hotstuff"
+	"github.com/gcubillos/isis-3007-distributed-ledger/data-structures/shared-components"
+	"time"
+)
+
+// The following code shows the HotStuff data structure working in a permissioned network of four
+// replicas, which tolerates one faulty replica. A transaction is committed while every leader is up, then
+// one of the replicas leaves the network and the pacemaker skips the views it should lead
+
+func main() {
+
+	// Defining number of replicas in the validator set
+	var numberReplicas = 4
+
+	// Defining the amount of currency that will be available during the tests.
+	var availableCurrency = 10.0
+
+	// Create the replicas with the same genesis block, then start them with the validator set
+	genesisBlock := hotstuff.CreateGenesisBlock()
+	replicas := make([]*hotstuff.NodeHotStuff, 0)
+	validators := make([]hotstuff.Validator, 0)
+	for i := 0; i < numberReplicas; i++ {
+		replica := hotstuff.CreateNode(genesisBlock, availableCurrency)
+		replicas = append(replicas, replica)
+		validators = append(validators, replica.Validator())
+	}
+	for _, v := range replicas {
+		v.Start(validators)
+	}
+
+	// The first transaction is committed once three nodes of consecutive views are certified on top of it
+	firstTransaction := components.CreateTransaction("main", "main", replicas[1].Node.Addr(), 1)
+	startingTime := time.Now()
+	replicas[1].Submit([]components.Transaction{firstTransaction})
+	waitForCommit(replicas, firstTransaction)
+	fmt.Printf("first transaction final in every replica after %v, view %v \n", time.Since(startingTime), replicas[1].CurrentView())
+
+	// A replica leaves the network, so the views it leads fail and the replicas move past them
+	replicas[0].Close()
+	remaining := replicas[1:]
+	for i := 0; i < 3; i++ {
+		exampleTransaction := components.CreateTransaction("main", "main", remaining[i].Node.Addr(), float64(i+2))
+		startingTime = time.Now()
+		remaining[i].Submit([]components.Transaction{exampleTransaction})
+		waitForCommit(remaining, exampleTransaction)
+		fmt.Printf("transaction %v final in the remaining replicas after %v, view %v \n", i, time.Since(startingTime), remaining[0].CurrentView())
+	}
+
+	for i, v := range remaining {
+		fmt.Printf("replica %v: height %v, balance of main %v, messages sent %v \n", i+1, v.Height(), v.Balance("main"), v.CountMessagesSent())
+	}
+}
+
+// Wait until every given replica committed the transaction
+func waitForCommit(pReplicas []*hotstuff.NodeHotStuff, pTransaction components.Transaction) {
+	for _, v := range pReplicas {
+		for !v.IsTransactionCommitted(pTransaction) {
+			time.Sleep(time.Millisecond)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"github.com/gcubillos/isis-3007-distributed-ledger/data-structures/narwhal"
+	"github.com/gcubillos/isis-3007-distributed-ledger/data-structures/shared-components"
+	"math/rand"
+	"time"
+)
+
+// The following code tries to perform the tests regarding the metric of latency on the Narwhal data structure.
+// The initiation timestamp is taken when the transaction is submitted to a validator.
+// The completion timestamp is taken when the transaction is executed by the receiving validator, which
+// happens once an anchor whose causal history contains the vertex of its batch is committed
+
+func main() {
+
+	// Defining number of validators, which tolerates (numberValidators-1)/3 faulty validators
+	var numberValidators = 7
+
+	// Defining number of transactions to occur in the network
+	var numberTransactions = 10
+
+	// Defining the amount of currency that will be available during the tests.
+	var availableCurrency = 10.0
+
+	// Create the validators, then start them with the validator set
+	validatorsNetwork := make([]*narwhal.NodeNarwhal, 0)
+	validators := make([]narwhal.Validator, 0)
+	for i := 0; i < numberValidators; i++ {
+		validator := narwhal.CreateNode(availableCurrency)
+		validatorsNetwork = append(validatorsNetwork, validator)
+		validators = append(validators, validator.Validator())
+	}
+	for _, v := range validatorsNetwork {
+		v.Start(validators)
+	}
+
+	// Creating seed for randomizing the submitter and the receiver of transactions
+	rand.Seed(time.Now().UnixNano())
+
+	// Create transactions from the "main" account, as it is the only one that has funds at first
+	for j := 0; j < numberTransactions; j++ {
+		receiver := validatorsNetwork[rand.Intn(len(validatorsNetwork))]
+		exampleTransaction := components.CreateTransaction("main", "main", receiver.Node.Addr(), availableCurrency/float64(2*numberTransactions))
+		startingTime := time.Now()
+		validatorsNetwork[rand.Intn(len(validatorsNetwork))].Submit([]components.Transaction{exampleTransaction})
+
+		// Wait until the transaction is executed by the receiving validator
+		for !receiver.IsTransactionCommitted(exampleTransaction) {
+			time.Sleep(time.Millisecond)
+		}
+		fmt.Printf("latency of transaction %v: %v \n", j, time.Since(startingTime))
+	}
+
+	// Messages exchanged by the validators to disseminate and order the transactions
+	messagesSent := 0
+	for _, v := range validatorsNetwork {
+		messagesSent += v.CountMessagesSent()
+	}
+	fmt.Printf("messages sent per transaction: %v \n", float64(messagesSent)/float64(numberTransactions))
+
+}
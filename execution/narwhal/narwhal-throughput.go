@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"github.com/gcubillos/isis-3007-distributed-ledger/data-structures/narwhal"
+	"github.com/gcubillos/isis-3007-distributed-ledger/data-structures/shared-components"
+	"time"
+)
+
+// The following code tries to perform the tests regarding the metric of throughput on the Narwhal data structure.
+// It uses the same parameters as the PBFT test. Batches of transactions are submitted to the validators
+// during the test duration, and each validator disseminates the ones it receives in its own batches, so
+// every validator carries part of the load instead of a single primary. The throughput is the number of
+// transactions executed by the last validator over the duration of the test
+
+func main() {
+
+	// Defining number of validators, which tolerates (numberValidators-1)/3 faulty validators
+	var numberValidators = 4
+
+	// Defining the duration of the test
+	var testDuration = 2 * time.Second
+
+	// Defining the number of transactions in each batch submitted
+	var transactionsPerBatch = 10
+
+	// Defining the amount of currency that will be available during the tests.
+	var availableCurrency = 1000.0
+
+	// Create the validators, then start them with the validator set
+	validatorsNetwork := make([]*narwhal.NodeNarwhal, 0)
+	validators := make([]narwhal.Validator, 0)
+	for i := 0; i < numberValidators; i++ {
+		validator := narwhal.CreateNode(availableCurrency)
+		validatorsNetwork = append(validatorsNetwork, validator)
+		validators = append(validators, validator.Validator())
+	}
+	for _, v := range validatorsNetwork {
+		v.Start(validators)
+	}
+	lastValidator := validatorsNetwork[len(validatorsNetwork)-1]
+
+	// Submit batches of transactions during the test
+	submitted := make([]components.Transaction, 0)
+	startingTime := time.Now()
+	for i := 0; time.Since(startingTime) < testDuration; i++ {
+		transactionList := make([]components.Transaction, transactionsPerBatch)
+		for j := range transactionList {
+			transactionList[j] = components.CreateTransaction("main", "main", lastValidator.Node.Addr(), 0)
+		}
+		validatorsNetwork[i%len(validatorsNetwork)].Submit(transactionList)
+		submitted = append(submitted, transactionList...)
+		time.Sleep(time.Millisecond)
+	}
+	duration := time.Since(startingTime)
+
+	// Count the transactions executed by the last validator
+	confirmed := 0
+	for _, v := range submitted {
+		if lastValidator.IsTransactionCommitted(v) {
+			confirmed++
+		}
+	}
+	round, anchor := lastValidator.CurrentRound()
+	fmt.Printf("The number of transactions submitted were: %v, of which %v are executed in %v vertices, round %v, last anchor in round %v \n", len(submitted), confirmed, lastValidator.Height(), round, anchor)
+	fmt.Printf("Throughput: %v transactions per second \n", float64(confirmed)/duration.Seconds())
+}
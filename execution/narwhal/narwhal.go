@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"github.com/gcubillos/isis-3007-distributed-ledger/data-structures/narwhal"
+	"github.com/gcubillos/isis-3007-distributed-ledger/data-structures/shared-components"
+	"time"
+)
+
+// The following code shows the Narwhal data structure working in a permissioned network of four
+// validators, which tolerates one faulty validator. Transactions submitted to different validators are
+// disseminated in their own batches and ordered by the committed anchors. Afterwards one of the
+// validators leaves the network, and the rounds in which it is the leader move forward without an anchor
+
+func main() {
+
+	// Defining number of validators
+	var numberValidators = 4
+
+	// Defining the amount of currency that will be available during the tests.
+	var availableCurrency = 10.0
+
+	// Create the validators, then start them with the validator set
+	validatorsNetwork := make([]*narwhal.NodeNarwhal, 0)
+	validators := make([]narwhal.Validator, 0)
+	for i := 0; i < numberValidators; i++ {
+		validator := narwhal.CreateNode(availableCurrency)
+		validatorsNetwork = append(validatorsNetwork, validator)
+		validators = append(validators, validator.Validator())
+	}
+	for _, v := range validatorsNetwork {
+		v.Start(validators)
+	}
+
+	// Each validator disseminates a transaction of its own at the same time
+	transactions := make([]components.Transaction, 0)
+	startingTime := time.Now()
+	for i, v := range validatorsNetwork {
+		exampleTransaction := components.CreateTransaction("main", "main", v.Node.Addr(), float64(i+1))
+		v.Submit([]components.Transaction{exampleTransaction})
+		transactions = append(transactions, exampleTransaction)
+	}
+	for _, v := range transactions {
+		waitForCommit(validatorsNetwork, v)
+	}
+	round, anchor := validatorsNetwork[0].CurrentRound()
+	fmt.Printf("transactions executed by every validator after %v, round %v, last anchor in round %v \n", time.Since(startingTime), round, anchor)
+
+	// A validator leaves the network. The others still form a quorum
+	validatorsNetwork[0].Close()
+	remaining := validatorsNetwork[1:]
+	for i := 0; i < 3; i++ {
+		exampleTransaction := components.CreateTransaction("main", "main", remaining[(i+1)%len(remaining)].Node.Addr(), 0)
+		startingTime = time.Now()
+		remaining[i].Submit([]components.Transaction{exampleTransaction})
+		waitForCommit(remaining, exampleTransaction)
+		round, anchor = remaining[0].CurrentRound()
+		fmt.Printf("transaction %v executed by the remaining validators after %v, round %v, last anchor in round %v \n", i, time.Since(startingTime), round, anchor)
+	}
+
+	for i, v := range remaining {
+		fmt.Printf("validator %v: ordered vertices %v, balance of main %v, messages sent %v \n", i+1, v.Height(), v.Balance("main"), v.CountMessagesSent())
+	}
+}
+
+// Wait until every given validator executed the transaction
+func waitForCommit(pValidators []*narwhal.NodeNarwhal, pTransaction components.Transaction) {
+	for _, v := range pValidators {
+		for !v.IsTransactionCommitted(pTransaction) {
+			time.Sleep(time.Millisecond)
+		}
+	}
+}
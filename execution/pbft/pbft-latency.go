@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"github.com/gcubillos/isis-3007-distributed-ledger/data-structures/pbft"
+	"github.com/gcubillos/isis-3007-distributed-ledger/data-structures/shared-components"
+	"math/rand"
+	"time"
+)
+
+// The following code tries to perform the tests regarding the metric of latency on the PBFT data structure.
+// The initiation timestamp is taken when the transaction is submitted to the replicas.
+// The completion timestamp is taken when the block containing it is final in the receiving replica. Since
+// PBFT doesn't fork, no further confirmations are needed
+
+func main() {
+
+	// Defining number of replicas in the validator set, which tolerates (numberReplicas-1)/3 faulty replicas
+	var numberReplicas = 7
+
+	// Defining number of transactions to occur in the network
+	var numberTransactions = 10
+
+	// Defining the amount of currency that will be available during the tests.
+	var availableCurrency = 10.0
+
+	// Create the replicas with the same genesis block, then start them with the validator set
+	genesisBlock := pbft.CreateGenesisBlock()
+	replicas := make([]*pbft.NodePBFT, 0)
+	validators := make([]pbft.Validator, 0)
+	for i := 0; i < numberReplicas; i++ {
+		replica := pbft.CreateNode(genesisBlock, availableCurrency)
+		replicas = append(replicas, replica)
+		validators = append(validators, replica.Validator())
+	}
+	for _, v := range replicas {
+		v.Start(validators)
+	}
+
+	// Creating seed for randomizing the submitter and the receiver of transactions
+	rand.Seed(time.Now().UnixNano())
+
+	// Create transactions from the "main" account, as it is the only one that has funds at first
+	for j := 0; j < numberTransactions; j++ {
+		receiver := replicas[rand.Intn(len(replicas))]
+		exampleTransaction := components.CreateTransaction("main", "main", receiver.Node.Addr(), availableCurrency/float64(2*numberTransactions))
+		startingTime := time.Now()
+		replicas[rand.Intn(len(replicas))].Submit([]components.Transaction{exampleTransaction})
+
+		// Wait until the block containing the transaction is final in the receiving replica
+		for !receiver.IsTransactionCommitted(exampleTransaction) {
+			time.Sleep(time.Millisecond)
+		}
+		fmt.Printf("latency of transaction %v: %v \n", j, time.Since(startingTime))
+	}
+
+	// Messages exchanged by the replicas to agree on the transactions
+	messagesSent := 0
+	for _, v := range replicas {
+		messagesSent += v.CountMessagesSent()
+	}
+	fmt.Printf("messages sent per transaction: %v \n", float64(messagesSent)/float64(numberTransactions))
+
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"github.com/gcubillos/isis-3007-distributed-ledger/data-structures/pbft"
+	"github.com/gcubillos/isis-3007-distributed-ledger/data-structures/shared-components"
+	"time"
+)
+
+// The following code shows the PBFT data structure working in a permissioned network of four replicas,
+// which tolerates one faulty replica. A transaction is committed by the primary of the first view, then
+// the primary leaves the network and the other replicas move to the next view to commit a second one
+
+func main() {
+
+	// Defining number of replicas in the validator set
+	var numberReplicas = 4
+
+	// Defining the amount of currency that will be available during the tests.
+	var availableCurrency = 10.0
+
+	// Create the replicas with the same genesis block, then start them with the validator set
+	genesisBlock := pbft.CreateGenesisBlock()
+	replicas := make([]*pbft.NodePBFT, 0)
+	validators := make([]pbft.Validator, 0)
+	for i := 0; i < numberReplicas; i++ {
+		replica := pbft.CreateNode(genesisBlock, availableCurrency)
+		replicas = append(replicas, replica)
+		validators = append(validators, replica.Validator())
+	}
+	for _, v := range replicas {
+		v.Start(validators)
+	}
+
+	// The first transaction is committed in the first view
+	firstTransaction := components.CreateTransaction("main", "main", replicas[1].Node.Addr(), 1)
+	startingTime := time.Now()
+	replicas[1].Submit([]components.Transaction{firstTransaction})
+	for _, v := range replicas {
+		for !v.IsTransactionCommitted(firstTransaction) {
+			time.Sleep(time.Millisecond)
+		}
+	}
+	view, _ := replicas[1].CurrentView()
+	fmt.Printf("first transaction final in every replica after %v, view %v \n", time.Since(startingTime), view)
+
+	// The primary leaves the network, so the second transaction is only committed after a view change
+	replicas[0].Close()
+	secondTransaction := components.CreateTransaction("main", "main", replicas[2].Node.Addr(), 2)
+	startingTime = time.Now()
+	replicas[2].Submit([]components.Transaction{secondTransaction})
+	for _, v := range replicas[1:] {
+		for !v.IsTransactionCommitted(secondTransaction) {
+			time.Sleep(time.Millisecond)
+		}
+	}
+	view, _ = replicas[1].CurrentView()
+	fmt.Printf("second transaction final in the remaining replicas after %v, view %v \n", time.Since(startingTime), view)
+
+	for i, v := range replicas[1:] {
+		fmt.Printf("replica %v: height %v, balance of main %v \n", i+1, v.Height(), v.Balance("main"))
+	}
+}
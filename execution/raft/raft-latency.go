@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"github.com/gcubillos/isis-3007-distributed-ledger/data-structures/raft"
+	"github.com/gcubillos/isis-3007-distributed-ledger/data-structures/shared-components"
+	"math/rand"
+	"time"
+)
+
+// The following code tries to perform the tests regarding the metric of latency on the Raft data structure.
+// The initiation timestamp is taken when the transaction is submitted to the members.
+// The completion timestamp is taken when the entry containing it is committed in the receiving member.
+// Committed entries are never replaced, so no further confirmations are needed
+
+func main() {
+
+	// Defining number of members of the cluster, which tolerates (numberMembers-1)/2 crashed members
+	var numberMembers = 5
+
+	// Defining number of transactions to occur in the network
+	var numberTransactions = 10
+
+	// Defining the amount of currency that will be available during the tests.
+	var availableCurrency = 10.0
+
+	// Create the members with the same genesis block, then start them with the addresses of the cluster
+	genesisBlock := raft.CreateGenesisBlock()
+	members := make([]*raft.NodeRaft, 0)
+	addresses := make([]string, 0)
+	for i := 0; i < numberMembers; i++ {
+		member := raft.CreateNode(genesisBlock, availableCurrency)
+		members = append(members, member)
+		addresses = append(addresses, member.Node.Addr())
+	}
+	for _, v := range members {
+		v.Start(addresses)
+	}
+
+	// Wait until a leader is elected and its first entry is committed
+	for members[0].CommitIndex() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	leader, term := members[0].CurrentLeader()
+	fmt.Printf("leader %v elected for term %v \n", leader, term)
+
+	// Creating seed for randomizing the submitter and the receiver of transactions
+	rand.Seed(time.Now().UnixNano())
+
+	// Create transactions from the "main" account, as it is the only one that has funds at first
+	for j := 0; j < numberTransactions; j++ {
+		receiver := members[rand.Intn(len(members))]
+		exampleTransaction := components.CreateTransaction("main", "main", receiver.Node.Addr(), availableCurrency/float64(2*numberTransactions))
+		startingTime := time.Now()
+		members[rand.Intn(len(members))].Submit([]components.Transaction{exampleTransaction})
+
+		// Wait until the entry containing the transaction is committed in the receiving member
+		for !receiver.IsTransactionCommitted(exampleTransaction) {
+			time.Sleep(time.Millisecond)
+		}
+		fmt.Printf("latency of transaction %v: %v \n", j, time.Since(startingTime))
+	}
+
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"github.com/gcubillos/isis-3007-distributed-ledger/data-structures/raft"
+	"github.com/gcubillos/isis-3007-distributed-ledger/data-structures/shared-components"
+	"time"
+)
+
+// The following code tries to perform the tests regarding the metric of throughput on the Raft data structure.
+// Batches of transactions are submitted to the members during the test duration, and the leader orders
+// them in blocks. The throughput is the number of transactions committed in the last member over the
+// duration of the test
+
+func main() {
+
+	// Defining number of members of the cluster, which tolerates (numberMembers-1)/2 crashed members
+	var numberMembers = 5
+
+	// Defining the duration of the test
+	var testDuration = 2 * time.Second
+
+	// Defining the number of transactions in each batch submitted
+	var transactionsPerBatch = 10
+
+	// Defining the amount of currency that will be available during the tests.
+	var availableCurrency = 1000.0
+
+	// Create the members with the same genesis block, then start them with the addresses of the cluster
+	genesisBlock := raft.CreateGenesisBlock()
+	members := make([]*raft.NodeRaft, 0)
+	addresses := make([]string, 0)
+	for i := 0; i < numberMembers; i++ {
+		member := raft.CreateNode(genesisBlock, availableCurrency)
+		members = append(members, member)
+		addresses = append(addresses, member.Node.Addr())
+	}
+	for _, v := range members {
+		v.Start(addresses)
+	}
+
+	// Wait until a leader is elected and its first entry is committed
+	for members[0].CommitIndex() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	lastMember := members[len(members)-1]
+
+	// Submit batches of transactions during the test
+	submitted := make([]components.Transaction, 0)
+	startingTime := time.Now()
+	for i := 0; time.Since(startingTime) < testDuration; i++ {
+		transactionList := make([]components.Transaction, transactionsPerBatch)
+		for j := range transactionList {
+			transactionList[j] = components.CreateTransaction("main", "main", lastMember.Node.Addr(), 0)
+		}
+		members[i%len(members)].Submit(transactionList)
+		submitted = append(submitted, transactionList...)
+		time.Sleep(time.Millisecond)
+	}
+	duration := time.Since(startingTime)
+
+	// Count the transactions committed in the last member
+	confirmed := 0
+	for _, v := range submitted {
+		if lastMember.IsTransactionCommitted(v) {
+			confirmed++
+		}
+	}
+	fmt.Printf("The number of transactions submitted were: %v, of which %v are committed up to index %v \n", len(submitted), confirmed, lastMember.CommitIndex())
+	fmt.Printf("Throughput: %v transactions per second \n", float64(confirmed)/duration.Seconds())
+}
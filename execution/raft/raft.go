@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"github.com/gcubillos/isis-3007-distributed-ledger/data-structures/raft"
+	"github.com/gcubillos/isis-3007-distributed-ledger/data-structures/shared-components"
+	"time"
+)
+
+// The following code shows the Raft data structure working in a cluster of five members, which tolerates
+// two crashed members. A leader is elected and a transaction is committed, then the leader leaves the
+// network and the other members elect a new one to commit a second transaction
+
+func main() {
+
+	// Defining number of members of the cluster
+	var numberMembers = 5
+
+	// Defining the amount of currency that will be available during the tests.
+	var availableCurrency = 10.0
+
+	// Create the members with the same genesis block, then start them with the addresses of the cluster
+	genesisBlock := raft.CreateGenesisBlock()
+	members := make([]*raft.NodeRaft, 0)
+	addresses := make([]string, 0)
+	for i := 0; i < numberMembers; i++ {
+		member := raft.CreateNode(genesisBlock, availableCurrency)
+		members = append(members, member)
+		addresses = append(addresses, member.Node.Addr())
+	}
+	startingTime := time.Now()
+	for _, v := range members {
+		v.Start(addresses)
+	}
+
+	// Wait until a leader is elected
+	leader := waitForLeader(members)
+	fmt.Printf("leader %v elected after %v \n", leader.Node.Addr(), time.Since(startingTime))
+
+	// The first transaction is committed by the first leader
+	firstTransaction := components.CreateTransaction("main", "main", members[1].Node.Addr(), 1)
+	startingTime = time.Now()
+	members[1].Submit([]components.Transaction{firstTransaction})
+	waitForCommit(members, firstTransaction)
+	fmt.Printf("first transaction committed in every member after %v \n", time.Since(startingTime))
+
+	// The leader leaves the network, so the second transaction is only committed once a new leader is elected
+	leader.Close()
+	remaining := make([]*raft.NodeRaft, 0)
+	for _, v := range members {
+		if v != leader {
+			remaining = append(remaining, v)
+		}
+	}
+	secondTransaction := components.CreateTransaction("main", "main", remaining[0].Node.Addr(), 2)
+	startingTime = time.Now()
+	remaining[0].Submit([]components.Transaction{secondTransaction})
+	waitForCommit(remaining, secondTransaction)
+	fmt.Printf("second transaction committed in the remaining members after %v \n", time.Since(startingTime))
+
+	for _, v := range remaining[0].LeaderChanges() {
+		fmt.Printf("term %v: leader %v \n", v.Term, v.Leader)
+	}
+	for _, v := range remaining {
+		fmt.Printf("member %v: commit index %v, balance of main %v \n", v.Node.Addr(), v.CommitIndex(), v.Balance("main"))
+	}
+}
+
+// Wait until one of the members is the leader of its term
+func waitForLeader(pMembers []*raft.NodeRaft) *raft.NodeRaft {
+	for {
+		for _, v := range pMembers {
+			if v.IsLeader() {
+				return v
+			}
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// Wait until every given member committed the transaction
+func waitForCommit(pMembers []*raft.NodeRaft, pTransaction components.Transaction) {
+	for _, v := range pMembers {
+		for !v.IsTransactionCommitted(pTransaction) {
+			time.Sleep(time.Millisecond)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"github.com/gcubillos/isis-3007-distributed-ledger/data-structures/shared-components"
+	"github.com/gcubillos/isis-3007-distributed-ledger/data-structures/snowball"
+	"math/rand"
+	"time"
+)
+
+// The following code tries to perform the tests regarding the metric of latency on the Snowball data structure.
+// The initiation timestamp is taken when the transaction is issued by a node.
+// The completion timestamp is taken when the spend is accepted by the receiving node, which happens once
+// Beta queries in a row to random samples of its peers agree on it
+
+func main() {
+
+	// Defining number of nodes in the network
+	var numberNodes = 10
+
+	// Defining number of transactions to occur in the network
+	var numberTransactions = 10
+
+	// Defining the amount of currency that will be available during the tests.
+	var availableCurrency = 10.0
+
+	// Create the first node in the network to have as a starting point, then the others
+	firstNode := snowball.CreateInitialNode(availableCurrency)
+	nodesNetwork := []*snowball.NodeSnowball{firstNode}
+	for i := 1; i < numberNodes; i++ {
+		nodesNetwork = append(nodesNetwork, snowball.CreateNode(firstNode.DataStructure, firstNode.Node))
+	}
+
+	// Creating seed for randomizing the issuer and the receiver of transactions
+	rand.Seed(time.Now().UnixNano())
+
+	// Create transactions from the "main" account, as it is the only one that has funds at first
+	for j := 0; j < numberTransactions; j++ {
+		receiver := nodesNetwork[rand.Intn(len(nodesNetwork))]
+		exampleTransaction := components.CreateTransaction("main", "main", receiver.Node.Addr(), 1)
+		startingTime := time.Now()
+		exampleSpend := nodesNetwork[rand.Intn(len(nodesNetwork))].IssueTransaction(exampleTransaction)
+
+		// Wait until the spend is accepted by the receiving node
+		for !receiver.IsAccepted(exampleSpend) {
+			time.Sleep(time.Millisecond)
+		}
+		fmt.Printf("latency of transaction %v: %v \n", j, time.Since(startingTime))
+
+		// Every node must know the spend before the next one is issued, so that they don't conflict
+		for _, v := range nodesNetwork {
+			for !v.IsAccepted(exampleSpend) {
+				time.Sleep(time.Millisecond)
+			}
+		}
+	}
+
+	// Queries sent by the nodes to accept the transactions
+	queriesSent := 0
+	for _, v := range nodesNetwork {
+		queriesSent += v.CountQueries()
+	}
+	fmt.Printf("queries sent per transaction: %v \n", float64(queriesSent)/float64(numberTransactions))
+}
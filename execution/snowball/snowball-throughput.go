@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+	"github.com/gcubillos/isis-3007-distributed-ledger/data-structures/shared-components"
+	"github.com/gcubillos/isis-3007-distributed-ledger/data-structures/snowball"
+	"time"
+)
+
+// The following code tries to perform the tests regarding the metric of throughput on the Snowball data structure.
+// The first node issues a number of transactions at once, and the nodes query their peers about a batch of
+// the undecided conflict sets at a time. The throughput is the number of spends accepted by the last node
+// per second
+
+func main() {
+
+	// Defining number of nodes in the network
+	var numberNodes = 10
+
+	// Defining number of transactions issued
+	var numberTransactions = 500
+
+	// Defining the amount of currency that will be available during the tests.
+	var availableCurrency = 1000.0
+
+	// Create the first node in the network to have as a starting point, then the others
+	firstNode := snowball.CreateInitialNode(availableCurrency)
+	nodesNetwork := []*snowball.NodeSnowball{firstNode}
+	for i := 1; i < numberNodes; i++ {
+		nodesNetwork = append(nodesNetwork, snowball.CreateNode(firstNode.DataStructure, firstNode.Node))
+	}
+	lastNode := nodesNetwork[len(nodesNetwork)-1]
+
+	// A single node issues the transactions, so that each one takes the next sequence of the "main"
+	// account without conflicts
+	issued := make([]snowball.Spend, 0, numberTransactions)
+	startingTime := time.Now()
+	for i := 0; i < numberTransactions; i++ {
+		exampleTransaction := components.CreateTransaction("main", "main", lastNode.Node.Addr(), 0)
+		issued = append(issued, firstNode.IssueTransaction(exampleTransaction))
+	}
+
+	// Wait until the last node accepted every spend
+	for _, v := range issued {
+		for !lastNode.IsAccepted(v) {
+			time.Sleep(time.Millisecond)
+		}
+	}
+	elapsed := time.Since(startingTime)
+
+	fmt.Printf("The number of spends accepted were: %v \n", len(issued))
+	fmt.Printf("Time elapsed: %v \n", elapsed)
+	fmt.Printf("Throughput: %v transactions per second \n", float64(len(issued))/elapsed.Seconds())
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"github.com/gcubillos/isis-3007-distributed-ledger/data-structures/shared-components"
+	"github.com/gcubillos/isis-3007-distributed-ledger/data-structures/snowball"
+	"time"
+)
+
+// The following code shows the Snowball data structure working in a network of ten nodes. Two nodes
+// issue conflicting spends of the "main" account at the same time, each one preferring its own, and the
+// network settles on one of them. Afterwards a spend without conflicts is accepted
+
+func main() {
+
+	// Defining number of nodes in the network
+	var numberNodes = 10
+
+	// Defining the amount of currency that will be available during the tests.
+	var availableCurrency = 10.0
+
+	// Create the first node in the network to have as a starting point, then the others
+	firstNode := snowball.CreateInitialNode(availableCurrency)
+	nodesNetwork := []*snowball.NodeSnowball{firstNode}
+	for i := 1; i < numberNodes; i++ {
+		nodesNetwork = append(nodesNetwork, snowball.CreateNode(firstNode.DataStructure, firstNode.Node))
+	}
+
+	// Both spends take the first sequence of the "main" account, so at most one of them is accepted
+	firstSpend := snowball.CreateSpend(components.CreateTransaction("main", "main", nodesNetwork[1].Node.Addr(), 6), 0)
+	secondSpend := snowball.CreateSpend(components.CreateTransaction("main", "main", nodesNetwork[2].Node.Addr(), 7), 0)
+	startingTime := time.Now()
+	check(nodesNetwork[1].IssueSpend(firstSpend))
+	check(nodesNetwork[2].IssueSpend(secondSpend))
+	waitForDecision(nodesNetwork, firstSpend)
+	fmt.Printf("conflict decided in every node after %v \n", time.Since(startingTime))
+	for i, v := range nodesNetwork {
+		fmt.Printf("node %v accepted the first spend: %v, the second spend: %v \n", i, v.IsAccepted(firstSpend), v.IsAccepted(secondSpend))
+	}
+
+	// A spend without conflicts takes the next sequence of the "main" account
+	exampleSpend := nodesNetwork[3].IssueTransaction(components.CreateTransaction("main", "main", nodesNetwork[3].Node.Addr(), 1))
+	startingTime = time.Now()
+	waitForDecision(nodesNetwork, exampleSpend)
+	fmt.Printf("spend with sequence %v accepted by every node after %v: %v \n", exampleSpend.Sequence, time.Since(startingTime), nodesNetwork[0].IsAccepted(exampleSpend))
+
+	for i, v := range nodesNetwork {
+		fmt.Printf("node %v: balance of main %v, queries sent %v \n", i, v.Balance("main"), v.CountQueries())
+	}
+}
+
+// Wait until every given node decided the conflict set of the spend
+func waitForDecision(pNodes []*snowball.NodeSnowball, pSpend snowball.Spend) {
+	for _, v := range pNodes {
+		for {
+			if _, decided := v.Preference(pSpend); decided {
+				break
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+}
+
+// Revises whether the error is not nil
+func check(err error) {
+	if err != nil {
+		panic(err)
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"github.com/gcubillos/isis-3007-distributed-ledger/data-structures/shared-components"
+	"github.com/gcubillos/isis-3007-distributed-ledger/data-structures/tangle"
+	"math/rand"
+	"time"
+)
+
+// The following code tries to perform the tests regarding the metric of latency on the Tangle data structure.
+// The initiation timestamp is taken when the site carrying the transaction is created.
+// The completion timestamp is taken when the confirmation confidence of the site in the receiving node
+// reaches the confirmation threshold. Meanwhile the other nodes keep issuing empty transactions,
+// since a site only gets confirmed when new sites approve it
+
+func main() {
+
+	// Defining number of nodes to be present in the network additionally to the initial node
+	var numberNodes = 5
+
+	// Defining number of transactions to occur in the network
+	var numberTransactions = 10
+
+	// Defining the difficulty for the tests (number of leading zeroes required in the hash)
+	tangle.Difficulty = 2
+
+	// Defining the amount of currency that will be available during the tests.
+	var availableCurrency = 10.0
+
+	// Create the first node in the network to have as a starting point
+	firstNode := tangle.CreateInitialNode(availableCurrency)
+
+	// Array for keeping track of the nodes without having to ask the network
+	nodesNetwork := make([]*tangle.NodeTangle, 0)
+
+	// Create other nodes
+	for i := 0; i < numberNodes; i++ {
+		nodesNetwork = append(nodesNetwork, tangle.CreateNode(firstNode.DataStructure, firstNode.Node))
+	}
+
+	// The other nodes keep issuing empty transactions until the test finishes
+	done := make(chan bool)
+	for _, v := range nodesNetwork {
+		go func(pNode *tangle.NodeTangle) {
+			for {
+				select {
+				case <-done:
+					return
+				default:
+					_, _ = pNode.IssueTransaction(components.CreateTransaction(pNode.Node.Addr(), pNode.Node.Addr(), firstNode.Node.Addr(), 0))
+					time.Sleep(10 * time.Millisecond)
+				}
+			}
+		}(v)
+	}
+
+	// Creating seed for randomizing the receiver of transactions
+	rand.Seed(time.Now().UnixNano())
+
+	// Create transactions from the "main" account, as it is the only one that has funds at first
+	for j := 0; j < numberTransactions; j++ {
+		receiver := nodesNetwork[rand.Intn(len(nodesNetwork))]
+		exampleTransaction := components.CreateTransaction("main", "main", receiver.Node.Addr(), availableCurrency/float64(2*numberTransactions))
+		site, err := firstNode.IssueTransaction(exampleTransaction)
+		if err != nil {
+			fmt.Printf("the transaction couldn't be issued: %v \n", err)
+			continue
+		}
+
+		// Wait until the receiving node considers the site confirmed
+		for receiver.ConfirmationConfidence(site.Hash) < tangle.ConfirmationThreshold {
+			time.Sleep(time.Millisecond)
+		}
+		fmt.Printf("latency of transaction %v: %v \n", j, time.Since(site.Timestamp))
+	}
+	close(done)
+
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"github.com/gcubillos/isis-3007-distributed-ledger/data-structures/shared-components"
+	"github.com/gcubillos/isis-3007-distributed-ledger/data-structures/tangle"
+	"time"
+)
+
+// The following code tries to perform the tests regarding the metric of throughput on the Tangle data structure.
+// Every node issues the same number of transactions at the same time, and the throughput is the number of
+// sites attached to the Tangle of the first node per second
+
+func main() {
+
+	// Defining number of nodes to be present in the network additionally to the initial node
+	var numberNodes = 5
+
+	// Defining number of transactions each node issues
+	var numberTransactions = 20
+
+	// Defining the difficulty for the tests (number of leading zeroes required in the hash)
+	tangle.Difficulty = 2
+
+	// Defining the amount of currency that will be available during the tests.
+	var availableCurrency = 10.0
+
+	// Create the first node in the network to have as a starting point
+	firstNode := tangle.CreateInitialNode(availableCurrency)
+
+	// Array for keeping track of the nodes without having to ask the network
+	nodesNetwork := make([]*tangle.NodeTangle, 0)
+
+	// Create other nodes
+	for i := 0; i < numberNodes; i++ {
+		nodesNetwork = append(nodesNetwork, tangle.CreateNode(firstNode.DataStructure, firstNode.Node))
+	}
+
+	// Every node issues its empty transactions concurrently
+	startingTime := time.Now()
+	for _, v := range nodesNetwork {
+		go func(pNode *tangle.NodeTangle) {
+			for i := 0; i < numberTransactions; i++ {
+				_, _ = pNode.IssueTransaction(components.CreateTransaction(pNode.Node.Addr(), pNode.Node.Addr(), firstNode.Node.Addr(), 0))
+			}
+		}(v)
+	}
+
+	// Wait until the first node has every site, besides the genesis site
+	expectedSites := numberNodes*numberTransactions + 1
+	for firstNode.NumberSites() < expectedSites {
+		time.Sleep(time.Millisecond)
+	}
+	elapsed := time.Since(startingTime)
+
+	fmt.Printf("The number of sites attached were: %v \n", expectedSites-1)
+	fmt.Printf("Time elapsed: %v \n", elapsed)
+	fmt.Printf("Throughput: %v sites per second \n", float64(expectedSites-1)/elapsed.Seconds())
+
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"github.com/gcubillos/isis-3007-distributed-ledger/data-structures/shared-components"
+	"github.com/gcubillos/isis-3007-distributed-ledger/data-structures/tangle"
+	"time"
+)
+
+func main() {
+
+	// Defining parameters for simple execution
+
+	// Defining the difficulty for the tests (number of leading zeroes required in the hash)
+	tangle.Difficulty = 1
+
+	// Defining the amount of currency that will be available during the tests.
+	var availableCurrency = 10.0
+
+	// Create the first node in the network to have as a starting point
+	firstNode := tangle.CreateInitialNode(availableCurrency)
+
+	fmt.Printf("Address first node %v \n", firstNode.Node.Addr())
+
+	// Create other node
+	otherNode := tangle.CreateNode(firstNode.DataStructure, firstNode.Node)
+
+	fmt.Printf("Address other node %v \n", otherNode.Node.Addr())
+
+	// Move some currency from the "main" account to the other node
+	exampleTransaction := components.CreateTransaction("main", "main", otherNode.Node.Addr(), 1)
+	site, err := firstNode.IssueTransaction(exampleTransaction)
+	if err != nil {
+		fmt.Printf("the transaction couldn't be issued: %v \n", err)
+		return
+	}
+	fmt.Printf("site %v approves %v and %v \n", site.Hash, site.Trunk, site.Branch)
+
+	// Issue empty transactions so that the site gets approved
+	for i := 0; i < 10; i++ {
+		_, _ = otherNode.IssueTransaction(components.CreateTransaction(otherNode.Node.Addr(), otherNode.Node.Addr(), firstNode.Node.Addr(), 0))
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	fmt.Printf("confirmation confidence of the site in the other node %v \n", otherNode.ConfirmationConfidence(site.Hash))
+}
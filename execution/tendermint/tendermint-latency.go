@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"github.com/gcubillos/isis-3007-distributed-ledger/data-structures/shared-components"
+	"github.com/gcubillos/isis-3007-distributed-ledger/data-structures/tendermint"
+	"math/rand"
+	"time"
+)
+
+// The following code tries to perform the tests regarding the metric of latency on the Tendermint data structure.
+// The initiation timestamp is taken when the transaction is submitted to the nodes.
+// The completion timestamp is taken when the block containing it is final in the receiving node. Since
+// Tendermint doesn't fork, no further confirmations are needed
+
+func main() {
+
+	// Defining number of validators, each with the same voting power, which tolerates (numberValidators-1)/3 faulty validators
+	var numberValidators = 7
+
+	// Defining number of transactions to occur in the network
+	var numberTransactions = 10
+
+	// Defining the amount of currency that will be available during the tests.
+	var availableCurrency = 10.0
+
+	// Create the validators with the same genesis block, then start them with the addresses of the network
+	// and the keys of the validators
+	genesisBlock := tendermint.CreateGenesisBlock()
+	nodesNetwork := make([]*tendermint.NodeTendermint, 0)
+	addresses := make([]string, 0)
+	validators := make([]string, 0)
+	for i := 0; i < numberValidators; i++ {
+		node := tendermint.CreateNode(genesisBlock, availableCurrency)
+		nodesNetwork = append(nodesNetwork, node)
+		addresses = append(addresses, node.Node.Addr())
+		validators = append(validators, node.ValidatorKey())
+	}
+	for _, v := range nodesNetwork {
+		v.Start(addresses, validators)
+	}
+
+	// Creating seed for randomizing the submitter and the receiver of transactions
+	rand.Seed(time.Now().UnixNano())
+
+	// Create transactions from the "main" account, as it is the only one that has funds at first
+	for j := 0; j < numberTransactions; j++ {
+		receiver := nodesNetwork[rand.Intn(len(nodesNetwork))]
+		exampleTransaction := components.CreateTransaction("main", "main", receiver.Node.Addr(), availableCurrency/float64(2*numberTransactions))
+		startingTime := time.Now()
+		nodesNetwork[rand.Intn(len(nodesNetwork))].Submit([]components.Transaction{exampleTransaction})
+
+		// Wait until the block containing the transaction is final in the receiving node
+		for !receiver.IsTransactionCommitted(exampleTransaction) {
+			time.Sleep(time.Millisecond)
+		}
+		fmt.Printf("latency of transaction %v: %v \n", j, time.Since(startingTime))
+	}
+
+	// Messages exchanged by the validators to agree on the transactions
+	messagesSent := 0
+	for _, v := range nodesNetwork {
+		messagesSent += v.CountMessagesSent()
+	}
+	fmt.Printf("messages sent per transaction: %v \n", float64(messagesSent)/float64(numberTransactions))
+
+}
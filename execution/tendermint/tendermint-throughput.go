@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"github.com/gcubillos/isis-3007-distributed-ledger/data-structures/shared-components"
+	"github.com/gcubillos/isis-3007-distributed-ledger/data-structures/tendermint"
+	"time"
+)
+
+// The following code tries to perform the tests regarding the metric of throughput on the Tendermint data structure.
+// Batches of transactions are submitted to the nodes during the test duration, and the proposers order
+// them in blocks. The throughput is the number of transactions final in the last node over the
+// duration of the test
+
+func main() {
+
+	// Defining number of validators, each with the same voting power, which tolerates (numberValidators-1)/3 faulty validators
+	var numberValidators = 4
+
+	// Defining the duration of the test
+	var testDuration = 2 * time.Second
+
+	// Defining the number of transactions in each batch submitted
+	var transactionsPerBatch = 10
+
+	// Defining the amount of currency that will be available during the tests.
+	var availableCurrency = 1000.0
+
+	// Create the validators with the same genesis block, then start them with the addresses of the network
+	// and the keys of the validators
+	genesisBlock := tendermint.CreateGenesisBlock()
+	nodesNetwork := make([]*tendermint.NodeTendermint, 0)
+	addresses := make([]string, 0)
+	validators := make([]string, 0)
+	for i := 0; i < numberValidators; i++ {
+		node := tendermint.CreateNode(genesisBlock, availableCurrency)
+		nodesNetwork = append(nodesNetwork, node)
+		addresses = append(addresses, node.Node.Addr())
+		validators = append(validators, node.ValidatorKey())
+	}
+	for _, v := range nodesNetwork {
+		v.Start(addresses, validators)
+	}
+	lastNode := nodesNetwork[len(nodesNetwork)-1]
+
+	// Submit batches of transactions during the test
+	submitted := make([]components.Transaction, 0)
+	startingTime := time.Now()
+	for i := 0; time.Since(startingTime) < testDuration; i++ {
+		transactionList := make([]components.Transaction, transactionsPerBatch)
+		for j := range transactionList {
+			transactionList[j] = components.CreateTransaction("main", "main", lastNode.Node.Addr(), 0)
+		}
+		nodesNetwork[i%len(nodesNetwork)].Submit(transactionList)
+		submitted = append(submitted, transactionList...)
+		time.Sleep(time.Millisecond)
+	}
+	duration := time.Since(startingTime)
+
+	// Count the transactions final in the last node
+	confirmed := 0
+	for _, v := range submitted {
+		if lastNode.IsTransactionCommitted(v) {
+			confirmed++
+		}
+	}
+	fmt.Printf("The number of transactions submitted were: %v, of which %v are final in %v blocks \n", len(submitted), confirmed, lastNode.Height()-1)
+	fmt.Printf("Throughput: %v transactions per second \n", float64(confirmed)/duration.Seconds())
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"github.com/gcubillos/isis-3007-distributed-ledger/data-structures/shared-components"
+	"github.com/gcubillos/isis-3007-distributed-ledger/data-structures/tendermint"
+	"time"
+)
+
+// The following code shows the Tendermint data structure working in a network of four validators and a
+// node that only follows them. A transaction is committed, then a transaction gives voting power to the
+// follower, which becomes a validator. Afterwards one of the initial validators leaves the network and
+// the others keep committing blocks, moving to later rounds when its turn to propose comes
+
+func main() {
+
+	// Defining number of initial validators and of nodes that only follow them
+	var numberValidators = 4
+	var numberFollowers = 1
+
+	// Defining the amount of currency that will be available during the tests.
+	var availableCurrency = 100.0
+
+	// Create the nodes with the same genesis block, then start them with the addresses of the network and
+	// the initial validators
+	genesisBlock := tendermint.CreateGenesisBlock()
+	nodesNetwork := make([]*tendermint.NodeTendermint, 0)
+	addresses := make([]string, 0)
+	validators := make([]string, 0)
+	for i := 0; i < numberValidators+numberFollowers; i++ {
+		node := tendermint.CreateNode(genesisBlock, availableCurrency)
+		nodesNetwork = append(nodesNetwork, node)
+		addresses = append(addresses, node.Node.Addr())
+		if i < numberValidators {
+			validators = append(validators, node.ValidatorKey())
+		}
+	}
+	for _, v := range nodesNetwork {
+		v.Start(addresses, validators)
+	}
+	follower := nodesNetwork[numberValidators]
+
+	// The first transaction is committed by the initial validators
+	firstTransaction := components.CreateTransaction("main", "main", follower.Node.Addr(), 1)
+	startingTime := time.Now()
+	follower.Submit([]components.Transaction{firstTransaction})
+	waitForCommit(nodesNetwork, firstTransaction)
+	fmt.Printf("first transaction final in every node after %v, in round %v \n", time.Since(startingTime), nodesNetwork[0].CurrentRound())
+
+	// The follower becomes a validator with the same voting power as the others
+	powerTransaction := components.CreateTransaction("main", "main", tendermint.PowerAccount(follower.ValidatorKey()), tendermint.InitialPower)
+	follower.Submit([]components.Transaction{powerTransaction})
+	waitForCommit(nodesNetwork, powerTransaction)
+	currentValidators, _ := follower.Validators()
+	fmt.Printf("validators after the power transaction: %v \n", len(currentValidators))
+
+	// One of the initial validators leaves the network. The others still hold more than two thirds of the power
+	nodesNetwork[0].Close()
+	remaining := nodesNetwork[1:]
+	for i := 0; i < 5; i++ {
+		exampleTransaction := components.CreateTransaction("main", "main", follower.Node.Addr(), float64(i+2))
+		startingTime = time.Now()
+		remaining[0].Submit([]components.Transaction{exampleTransaction})
+		waitForCommit(remaining, exampleTransaction)
+		fmt.Printf("transaction %v final in the remaining nodes after %v \n", i, time.Since(startingTime))
+	}
+
+	for _, v := range remaining {
+		fmt.Printf("node %v: height %v, messages sent %v \n", v.Node.Addr(), v.Height(), v.CountMessagesSent())
+	}
+}
+
+// Wait until every given node committed the transaction
+func waitForCommit(pNodes []*tendermint.NodeTendermint, pTransaction components.Transaction) {
+	for _, v := range pNodes {
+		for !v.IsTransactionCommitted(pTransaction) {
+			time.Sleep(time.Millisecond)
+		}
+	}
+}